@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"privy/config"
+	"privy/internal/api"
+	"privy/internal/app"
+	"privy/internal/apperror"
+	"privy/internal/auth"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const keysUsage = `usage: privy keys create -name NAME [-scopes SCOPES] [-expires-in DURATION] [-- CONFIG FLAGS]
+
+Mints an API key straight into the database and prints it once. Config flags
+after -- are the ones the server takes; run privy -h to list them.
+`
+
+// runKeys handles the keys subcommand, which mints API keys, the first
+// admin key in particular, without going through the server.
+func runKeys(args []string) int {
+	if len(args) == 0 || args[0] != "create" {
+		fmt.Fprint(os.Stderr, keysUsage)
+		return app.ExitConfig
+	}
+
+	flags := flag.NewFlagSet("privy keys create", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), keysUsage)
+		flags.PrintDefaults()
+	}
+	name := flags.String("name", "", "name of the key, e.g. who it is for")
+	scopes := flags.String("scopes", auth.ScopeAdmin, "comma separated scopes of the key")
+	expiresIn := flags.Duration("expires-in", 0, "lifetime of the key, 0 never expires")
+	if err := flags.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return app.ExitOK
+		}
+		return app.ExitConfig
+	}
+
+	cfg, err := config.Load(flags.Args())
+	if errors.Is(err, flag.ErrHelp) {
+		return app.ExitOK
+	}
+	if err != nil {
+		log.Println("[keys] can't load config, err:", err.Error())
+		return app.ExitConfig
+	}
+
+	req := api.APIKeyRequest{Name: name, Scopes: strings.Split(*scopes, ",")}
+	if *scopes == "" {
+		req.Scopes = []string{}
+	}
+	if *expiresIn != 0 {
+		expiresAt := time.Now().Add(*expiresIn)
+		req.ExpiresAt = &expiresAt
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	created, err := app.CreateAPIKey(ctx, cfg, req)
+	if apperror.KindOf(err) == apperror.KindValidation {
+		log.Println("[keys] invalid key, err:", err.Error())
+		return app.ExitConfig
+	}
+	if err != nil {
+		log.Println("[keys] can't create key, err:", err.Error())
+		return app.ExitCode(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "created key %d %q with scopes %s; it is shown only once\n", created.Id, created.Name, strings.Join(created.Scopes, ","))
+	fmt.Println(created.Key)
+	return app.ExitOK
+}
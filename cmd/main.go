@@ -1,30 +1,49 @@
 package main
 
 import (
-	"database/sql"
-	"fmt"
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
 	"privy/config"
-	"privy/internal/api"
-	"privy/internal/repository"
-	cons "privy/models"
-	"privy/routes"
+	"privy/internal/app"
+	"syscall"
 
 	_ "github.com/go-sql-driver/mysql"
 )
 
 func main() {
-	dsn := config.Username + ":" + config.Password + "@tcp(" + config.Host + ":" + config.Port + ")/" + config.Dbname
-	db, err := sql.Open("mysql", dsn)
+	os.Exit(run())
+}
+
+func run() int {
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		return runKeys(os.Args[2:])
+	}
+
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return app.ExitOK
+	}
 	if err != nil {
-		panic(err)
+		log.Println("[main] can't load config, err:", err.Error())
+		return app.ExitConfig
 	}
 
-	repository := repository.New(db)
-	handler := api.New(repository)
-	echo := routes.GetRoutes(handler)
+	application, err := app.New(cfg)
+	if err != nil {
+		log.Println("[main] can't create application, err:", err.Error())
+		return app.ExitCode(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	addres := cons.Addres
-	port := cons.Port
-	host := fmt.Sprintf("%s:%s", addres, port)
-	_ = echo.Start(host)
+	err = application.Run(ctx)
+	if err != nil {
+		log.Println("[main] application stopped, err:", err.Error())
+	}
+	return app.ExitCode(err)
 }
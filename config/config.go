@@ -0,0 +1,443 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the complete runtime configuration of the service. It is
+// resolved by Load from, in increasing order of precedence, the defaults,
+// a YAML or TOML file, PRIVY_* environment variables and command line flags.
+type Config struct {
+	Server        Server        `yaml:"server" toml:"server"`
+	Database      Database      `yaml:"database" toml:"database"`
+	CORS          CORS          `yaml:"cors" toml:"cors"`
+	Pagination    Pagination    `yaml:"pagination" toml:"pagination"`
+	Preconditions Preconditions `yaml:"preconditions" toml:"preconditions"`
+	CacheControl  CacheControl  `yaml:"cache_control" toml:"cache_control"`
+	Cache         Cache         `yaml:"cache" toml:"cache"`
+	Admin         Admin         `yaml:"admin" toml:"admin"`
+	JWT           JWT           `yaml:"jwt" toml:"jwt"`
+	Auth          Auth          `yaml:"auth" toml:"auth"`
+	Images        Images        `yaml:"images" toml:"images"`
+	Import        Import        `yaml:"import" toml:"import"`
+}
+
+// Server configures the HTTP server. StreamTimeout replaces ReadTimeout and
+// WriteTimeout on the export and import routes, which stream whole
+// catalogs; 0 lifts their deadlines.
+type Server struct {
+	Host          string        `yaml:"host" toml:"host"`
+	Port          int           `yaml:"port" toml:"port"`
+	ReadTimeout   time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout  time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	StreamTimeout time.Duration `yaml:"stream_timeout" toml:"stream_timeout"`
+	ShutdownGrace time.Duration `yaml:"shutdown_grace" toml:"shutdown_grace"`
+}
+
+// Address is the host:port the HTTP server listens on.
+func (s Server) Address() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+type CORS struct {
+	AllowOrigins []string `yaml:"allow_origins" toml:"allow_origins"`
+}
+
+// Pagination bounds list pages. CursorSecret signs cursor tokens; when it
+// is empty a random secret is generated at startup, so cursors don't
+// survive a restart and aren't shared between instances.
+type Pagination struct {
+	DefaultLimit int    `yaml:"default_limit" toml:"default_limit"`
+	MaxLimit     int    `yaml:"max_limit" toml:"max_limit"`
+	CursorSecret string `yaml:"cursor_secret" toml:"cursor_secret"`
+}
+
+// Preconditions decides whether writes to a cake must carry If-Match.
+// Without it they are applied unconditionally.
+type Preconditions struct {
+	Required bool `yaml:"required" toml:"required"`
+}
+
+// CacheControl holds the Cache-Control directives of the cake reads, List
+// for the lists and Detail for single cakes. An empty value sends none.
+type CacheControl struct {
+	List   string `yaml:"list" toml:"list"`
+	Detail string `yaml:"detail" toml:"detail"`
+}
+
+// Cache puts a read-through cache in front of the database. Backend is
+// "none", "memory" for an LRU of Size entries in each process, or "redis"
+// for one shared by every instance; entries live for at most TTL.
+type Cache struct {
+	Backend       string        `yaml:"backend" toml:"backend"`
+	Size          int           `yaml:"size" toml:"size"`
+	TTL           time.Duration `yaml:"ttl" toml:"ttl"`
+	RedisAddr     string        `yaml:"redis_addr" toml:"redis_addr"`
+	RedisPassword string        `yaml:"redis_password" toml:"redis_password"`
+	RedisDB       int           `yaml:"redis_db" toml:"redis_db"`
+}
+
+// Admin holds a token granting the cakes:admin scope, alongside admin API
+// keys. It is disabled while Token is empty.
+type Admin struct {
+	Token string `yaml:"token" toml:"token"`
+}
+
+// JWT configures bearer tokens. Secret verifies HS256 tokens; the PEM
+// public key in PublicKeyFile and the keys of the local JWKS file JWKSFile
+// verify RS256 ones. Bearer tokens are refused while no key is set. Issuer
+// and Audience are checked when set, and ClockSkew is the leeway given to
+// the time claims. Tokens without a scope or scp claim are granted
+// DefaultScope, and auth.anonymous_scope at least.
+type JWT struct {
+	Secret        string        `yaml:"secret" toml:"secret"`
+	PublicKeyFile string        `yaml:"public_key_file" toml:"public_key_file"`
+	JWKSFile      string        `yaml:"jwks_file" toml:"jwks_file"`
+	Issuer        string        `yaml:"issuer" toml:"issuer"`
+	Audience      string        `yaml:"audience" toml:"audience"`
+	ClockSkew     time.Duration `yaml:"clock_skew" toml:"clock_skew"`
+	DefaultScope  string        `yaml:"default_scope" toml:"default_scope"`
+}
+
+// Auth decides what requests without credentials may do: AnonymousScope
+// is granted to them, cakes:read or "" for nothing; writes always need
+// credentials. Authenticated requests are granted AnonymousScope too, on
+// top of their own scopes. Every other request needs a bearer
+// token, an API key or the admin token granting the scope of the route.
+// The last use of an API key is recorded at most once per
+// KeyTouchInterval.
+type Auth struct {
+	AnonymousScope   string        `yaml:"anonymous_scope" toml:"anonymous_scope"`
+	KeyTouchInterval time.Duration `yaml:"key_touch_interval" toml:"key_touch_interval"`
+}
+
+// Images configures cake image uploads, which are stored under Dir and
+// disabled while it is empty. Links point at BaseURL, or are /images/ paths
+// on this service when it is empty. CacheControl is sent with every
+// served image.
+//
+// Workers build the Variants of every upload, each a "name:width", in
+// every one of Formats, plus a blurred placeholder PlaceholderWidth pixels
+// wide unless it is 0. Queue uploads wait for a worker at most.
+type Images struct {
+	Dir              string   `yaml:"dir" toml:"dir"`
+	BaseURL          string   `yaml:"base_url" toml:"base_url"`
+	MaxBytes         int      `yaml:"max_bytes" toml:"max_bytes"`
+	MaxWidth         int      `yaml:"max_width" toml:"max_width"`
+	MaxHeight        int      `yaml:"max_height" toml:"max_height"`
+	CacheControl     string   `yaml:"cache_control" toml:"cache_control"`
+	Variants         []string `yaml:"variants" toml:"variants"`
+	Formats          []string `yaml:"formats" toml:"formats"`
+	PlaceholderWidth int      `yaml:"placeholder_width" toml:"placeholder_width"`
+	Quality          int      `yaml:"quality" toml:"quality"`
+	Workers          int      `yaml:"workers" toml:"workers"`
+	Queue            int      `yaml:"queue" toml:"queue"`
+}
+
+// Import bounds the files sent to POST /cakes/import.
+type Import struct {
+	MaxBytes int `yaml:"max_bytes" toml:"max_bytes"`
+}
+
+// ParseVariant splits a "name:width" image variant.
+func ParseVariant(spec string) (string, int, error) {
+	name, rawWidth, ok := strings.Cut(spec, ":")
+	width, err := strconv.Atoi(rawWidth)
+	if !ok || err != nil || width < 1 {
+		return "", 0, fmt.Errorf("images.variants entry %q must be name:width with a positive width", spec)
+	}
+	if name == "" || name == "placeholder" || strings.IndexFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}) >= 0 {
+		return "", 0, fmt.Errorf("images.variants entry %q must be named with lowercase letters and digits, other than placeholder", spec)
+	}
+	return name, width, nil
+}
+
+func Default() Config {
+	return Config{
+		Server: Server{
+			Host:          "0.0.0.0",
+			Port:          8800,
+			ReadTimeout:   15 * time.Second,
+			WriteTimeout:  15 * time.Second,
+			StreamTimeout: 10 * time.Minute,
+			ShutdownGrace: 20 * time.Second,
+		},
+		Database: Database{
+			Host:            "127.0.0.1",
+			Port:            3306,
+			Name:            "technical_privy",
+			User:            "root",
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 5 * time.Minute,
+			ConnMaxIdleTime: time.Minute,
+			DialTimeout:     5 * time.Second,
+			ConnectAttempts: 5,
+			ConnectBackoff:  time.Second,
+			ReadTimeout:     5 * time.Second,
+			WriteTimeout:    10 * time.Second,
+		},
+		CORS: CORS{
+			AllowOrigins: []string{"*"},
+		},
+		Pagination: Pagination{
+			DefaultLimit: 100,
+			MaxLimit:     500,
+		},
+		CacheControl: CacheControl{
+			List:   "no-cache",
+			Detail: "no-cache",
+		},
+		Cache: Cache{
+			Backend:   "none",
+			Size:      10000,
+			TTL:       30 * time.Second,
+			RedisAddr: "127.0.0.1:6379",
+		},
+		JWT: JWT{
+			ClockSkew: 30 * time.Second,
+		},
+		Auth: Auth{
+			AnonymousScope:   "cakes:read",
+			KeyTouchInterval: time.Minute,
+		},
+		Images: Images{
+			Dir:              "data/images",
+			MaxBytes:         5 << 20,
+			MaxWidth:         4096,
+			MaxHeight:        4096,
+			CacheControl:     "public, max-age=31536000, immutable",
+			Variants:         []string{"thumbnail:160", "medium:640", "large:1280"},
+			Formats:          []string{"jpeg"},
+			PlaceholderWidth: 16,
+			Quality:          80,
+			Workers:          2,
+			Queue:            100,
+		},
+		Import: Import{
+			MaxBytes: 64 << 20,
+		},
+	}
+}
+
+// Load resolves the configuration for the given command line arguments
+// and validates the result.
+func Load(args []string) (Config, error) {
+	cfg := Default()
+
+	flags := flag.NewFlagSet("privy", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("PRIVY_CONFIG"), "path to a YAML or TOML config file (env PRIVY_CONFIG)")
+	scratch := Default()
+	for _, s := range settings {
+		flags.Var(s.value(&scratch), s.flag, fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	if err := flags.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if *path != "" {
+		if err := loadFile(*path, &cfg); err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, s := range settings {
+		raw, ok := os.LookupEnv(s.env)
+		if !ok {
+			continue
+		}
+		if err := s.value(&cfg).Set(raw); err != nil {
+			return Config{}, fmt.Errorf("invalid %s: %w", s.env, err)
+		}
+	}
+
+	var err error
+	flags.Visit(func(f *flag.Flag) {
+		s, ok := settingsByFlag[f.Name]
+		if !ok || err != nil {
+			return
+		}
+		if setErr := s.value(&cfg).Set(f.Value.String()); setErr != nil {
+			err = fmt.Errorf("invalid -%s: %w", f.Name, setErr)
+		}
+	})
+	if err != nil {
+		return Config{}, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("can't read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		_, err = toml.Decode(string(data), cfg)
+	default:
+		return fmt.Errorf("unsupported config file %q: want .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("can't parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var problems []string
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		problems = append(problems, "server.port must be between 1 and 65535")
+	}
+	if c.Server.ReadTimeout < 0 || c.Server.WriteTimeout < 0 || c.Server.StreamTimeout < 0 {
+		problems = append(problems, "server timeouts can't be negative")
+	}
+	if c.Server.ShutdownGrace <= 0 {
+		problems = append(problems, "server.shutdown_grace must be positive")
+	}
+	problems = append(problems, c.Database.validate()...)
+	if len(c.CORS.AllowOrigins) == 0 {
+		problems = append(problems, "cors.allow_origins can't be empty")
+	}
+	for _, origin := range c.CORS.AllowOrigins {
+		if origin != "*" && !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			problems = append(problems, fmt.Sprintf("cors.allow_origins entry %q must be * or start with http:// or https://", origin))
+		}
+	}
+	if c.Pagination.MaxLimit < 1 {
+		problems = append(problems, "pagination.max_limit must be at least 1")
+	}
+	if c.Pagination.DefaultLimit < 1 || c.Pagination.DefaultLimit > c.Pagination.MaxLimit {
+		problems = append(problems, "pagination.default_limit must be between 1 and pagination.max_limit")
+	}
+	if c.Pagination.CursorSecret != "" && len(c.Pagination.CursorSecret) < 32 {
+		problems = append(problems, "pagination.cursor_secret must be at least 32 bytes")
+	}
+	if !validCacheControl(c.CacheControl.List) {
+		problems = append(problems, fmt.Sprintf("cache_control.list %q must be a comma separated list of directives", c.CacheControl.List))
+	}
+	if !validCacheControl(c.CacheControl.Detail) {
+		problems = append(problems, fmt.Sprintf("cache_control.detail %q must be a comma separated list of directives", c.CacheControl.Detail))
+	}
+	switch c.Cache.Backend {
+	case "none":
+	case "memory", "redis":
+		if c.Cache.TTL <= 0 {
+			problems = append(problems, "cache.ttl must be positive")
+		}
+		if c.Cache.Backend == "memory" && c.Cache.Size < 1 {
+			problems = append(problems, "cache.size must be at least 1")
+		}
+		if c.Cache.Backend == "redis" && c.Cache.RedisAddr == "" {
+			problems = append(problems, "cache.redis_addr can't be empty")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("cache.backend %q must be none, memory or redis", c.Cache.Backend))
+	}
+	if c.Admin.Token != "" && len(c.Admin.Token) < 32 {
+		problems = append(problems, "admin.token must be at least 32 bytes")
+	}
+	if c.JWT.Secret != "" && len(c.JWT.Secret) < 32 {
+		problems = append(problems, "jwt.secret must be at least 32 bytes")
+	}
+	if c.JWT.ClockSkew < 0 || c.JWT.ClockSkew > 5*time.Minute {
+		problems = append(problems, "jwt.clock_skew must be between 0 and 5m")
+	}
+	if c.JWT.DefaultScope != "" && c.JWT.DefaultScope != "cakes:read" && c.JWT.DefaultScope != "cakes:write" {
+		problems = append(problems, fmt.Sprintf("jwt.default_scope %q must be empty, cakes:read or cakes:write", c.JWT.DefaultScope))
+	}
+	if c.Auth.AnonymousScope != "" && c.Auth.AnonymousScope != "cakes:read" {
+		problems = append(problems, fmt.Sprintf("auth.anonymous_scope %q must be empty or cakes:read", c.Auth.AnonymousScope))
+	}
+	if c.Auth.KeyTouchInterval < 0 {
+		problems = append(problems, "auth.key_touch_interval can't be negative")
+	}
+	if c.Import.MaxBytes < 1 {
+		problems = append(problems, "import.max_bytes must be at least 1")
+	}
+	if c.Images.MaxBytes < 1 {
+		problems = append(problems, "images.max_bytes must be at least 1")
+	}
+	if c.Images.MaxWidth < 1 || c.Images.MaxHeight < 1 {
+		problems = append(problems, "images.max_width and images.max_height must be at least 1")
+	}
+	if c.Images.BaseURL != "" && !strings.HasPrefix(c.Images.BaseURL, "http://") && !strings.HasPrefix(c.Images.BaseURL, "https://") {
+		problems = append(problems, fmt.Sprintf("images.base_url %q must start with http:// or https://", c.Images.BaseURL))
+	}
+	if !validCacheControl(c.Images.CacheControl) {
+		problems = append(problems, fmt.Sprintf("images.cache_control %q must be a comma separated list of directives", c.Images.CacheControl))
+	}
+	variants := map[string]bool{}
+	for _, spec := range c.Images.Variants {
+		name, _, err := ParseVariant(spec)
+		if err != nil {
+			problems = append(problems, err.Error())
+		} else if variants[name] {
+			problems = append(problems, fmt.Sprintf("images.variants names %s twice", name))
+		}
+		variants[name] = true
+	}
+	if len(c.Images.Variants) > 0 && len(c.Images.Formats) == 0 {
+		problems = append(problems, "images.formats can't be empty while there are images.variants")
+	}
+	for _, format := range c.Images.Formats {
+		if format != "jpeg" && format != "png" && format != "webp" {
+			problems = append(problems, fmt.Sprintf("images.formats entry %q must be jpeg, png or webp", format))
+		}
+	}
+	if c.Images.PlaceholderWidth < 0 || c.Images.PlaceholderWidth > 64 {
+		problems = append(problems, "images.placeholder_width must be between 0 and 64")
+	}
+	if c.Images.Quality < 1 || c.Images.Quality > 100 {
+		problems = append(problems, "images.quality must be between 1 and 100")
+	}
+	if c.Images.Workers < 1 || c.Images.Queue < 1 {
+		problems = append(problems, "images.workers and images.queue must be at least 1")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validCacheControl accepts directives like "public, max-age=60" and the
+// empty string.
+func validCacheControl(directives string) bool {
+	if directives == "" {
+		return true
+	}
+	for _, directive := range strings.Split(directives, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if name == "" || strings.IndexFunc(name, func(r rune) bool {
+			return !(r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+		}) >= 0 {
+			return false
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return false
+		}
+	}
+	return true
+}
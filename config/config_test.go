@@ -0,0 +1,277 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("can't write %s: %v", path, err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	yamlFile := writeFile(t, "privy.yaml", `
+server:
+  port: 9000
+database:
+  host: db.internal
+  password: "p@ss:w/rd"
+  read_timeout: 2s
+cors:
+  allow_origins: ["https://shop.example.com"]
+`)
+	tomlFile := writeFile(t, "privy.toml", `
+[server]
+port = 9100
+
+[database]
+host = "toml.internal"
+`)
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		check   func(t *testing.T, cfg Config)
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, cfg Config) {
+				assert.Equal(t, Default(), cfg)
+				assert.Equal(t, "0.0.0.0:8800", cfg.Server.Address())
+			},
+		},
+		{
+			name: "yaml file",
+			args: []string{"-config", yamlFile},
+			check: func(t *testing.T, cfg Config) {
+				assert.Equal(t, 9000, cfg.Server.Port)
+				assert.Equal(t, "db.internal", cfg.Database.Host)
+				assert.Equal(t, 2*time.Second, cfg.Database.ReadTimeout)
+				assert.Equal(t, 3306, cfg.Database.Port)
+				assert.Equal(t, []string{"https://shop.example.com"}, cfg.CORS.AllowOrigins)
+				assert.Equal(t, "root:p@ss:w/rd@tcp(db.internal:3306)/technical_privy?parseTime=true&timeout=5s&time_zone=%27%2B00%3A00%27", cfg.Database.DSN())
+			},
+		},
+		{
+			name: "toml file from env",
+			env:  map[string]string{"PRIVY_CONFIG": tomlFile},
+			check: func(t *testing.T, cfg Config) {
+				assert.Equal(t, 9100, cfg.Server.Port)
+				assert.Equal(t, "toml.internal", cfg.Database.Host)
+			},
+		},
+		{
+			name: "env overrides file",
+			args: []string{"-config", yamlFile},
+			env:  map[string]string{"PRIVY_DB_HOST": "env.internal", "PRIVY_CORS_ALLOW_ORIGINS": "https://a.example.com, https://b.example.com"},
+			check: func(t *testing.T, cfg Config) {
+				assert.Equal(t, "env.internal", cfg.Database.Host)
+				assert.Equal(t, 9000, cfg.Server.Port)
+				assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, cfg.CORS.AllowOrigins)
+			},
+		},
+		{
+			name: "flags override env",
+			args: []string{"-config", yamlFile, "-db-host", "flag.internal", "-port", "9300"},
+			env:  map[string]string{"PRIVY_DB_HOST": "env.internal"},
+			check: func(t *testing.T, cfg Config) {
+				assert.Equal(t, "flag.internal", cfg.Database.Host)
+				assert.Equal(t, 9300, cfg.Server.Port)
+			},
+		},
+		{
+			name: "stream timeout from env",
+			env:  map[string]string{"PRIVY_SERVER_STREAM_TIMEOUT": "0s"},
+			check: func(t *testing.T, cfg Config) {
+				assert.Equal(t, time.Duration(0), cfg.Server.StreamTimeout)
+				assert.Equal(t, 15*time.Second, cfg.Server.WriteTimeout)
+			},
+		},
+		{
+			name:    "invalid env value",
+			env:     map[string]string{"PRIVY_DB_PORT": "mysql"},
+			wantErr: "invalid PRIVY_DB_PORT",
+		},
+		{
+			name:    "validation reports every problem",
+			args:    []string{"-port", "0", "-db-name", "", "-db-max-idle-conns", "50", "-cors-allow-origins", "shop.example.com"},
+			wantErr: "server.port must be between 1 and 65535; database.name can't be empty; database.max_idle_conns (50) can't exceed database.max_open_conns (25); cors.allow_origins entry \"shop.example.com\"",
+		},
+		{
+			name: "pagination from env",
+			env:  map[string]string{"PRIVY_PAGINATION_MAX_LIMIT": "50", "PRIVY_PAGINATION_DEFAULT_LIMIT": "20", "PRIVY_PAGINATION_CURSOR_SECRET": strings.Repeat("s", 32)},
+			check: func(t *testing.T, cfg Config) {
+				assert.Equal(t, Pagination{DefaultLimit: 20, MaxLimit: 50, CursorSecret: strings.Repeat("s", 32)}, cfg.Pagination)
+			},
+		},
+		{
+			name:    "invalid pagination",
+			args:    []string{"-max-limit", "50", "-cursor-secret", "short"},
+			wantErr: "pagination.default_limit must be between 1 and pagination.max_limit; pagination.cursor_secret must be at least 32 bytes",
+		},
+		{
+			name: "bare bool flag",
+			args: []string{"-require-preconditions"},
+			check: func(t *testing.T, cfg Config) {
+				assert.Equal(t, true, cfg.Preconditions.Required)
+			},
+		},
+		{
+			name:    "invalid bool env",
+			env:     map[string]string{"PRIVY_PRECONDITIONS_REQUIRED": "sometimes"},
+			wantErr: "invalid PRIVY_PRECONDITIONS_REQUIRED",
+		},
+		{
+			name: "cache control per route",
+			args: []string{"-cache-control-list", "public, max-age=30", "-cache-control-detail", ""},
+			check: func(t *testing.T, cfg Config) {
+				assert.Equal(t, CacheControl{List: "public, max-age=30"}, cfg.CacheControl)
+			},
+		},
+		{
+			name:    "invalid cache control",
+			env:     map[string]string{"PRIVY_CACHE_CONTROL_DETAIL": "max age=30"},
+			wantErr: `cache_control.detail "max age=30" must be a comma separated list of directives`,
+		},
+		{
+			name: "redis cache from env",
+			env:  map[string]string{"PRIVY_CACHE_BACKEND": "redis", "PRIVY_CACHE_REDIS_ADDR": "cache.internal:6379", "PRIVY_CACHE_TTL": "1m"},
+			check: func(t *testing.T, cfg Config) {
+				assert.Equal(t, "redis", cfg.Cache.Backend)
+				assert.Equal(t, "cache.internal:6379", cfg.Cache.RedisAddr)
+				assert.Equal(t, time.Minute, cfg.Cache.TTL)
+			},
+		},
+		{
+			name:    "invalid cache",
+			args:    []string{"-cache-backend", "memcached"},
+			wantErr: `cache.backend "memcached" must be none, memory or redis`,
+		},
+		{
+			name:    "memory cache without room",
+			args:    []string{"-cache-backend", "memory", "-cache-size", "0", "-cache-ttl", "0s"},
+			wantErr: "cache.ttl must be positive; cache.size must be at least 1",
+		},
+		{
+			name: "admin token from env",
+			env:  map[string]string{"PRIVY_ADMIN_TOKEN": strings.Repeat("a", 32)},
+			check: func(t *testing.T, cfg Config) {
+				assert.Equal(t, strings.Repeat("a", 32), cfg.Admin.Token)
+			},
+		},
+		{
+			name:    "short admin token",
+			args:    []string{"-admin-token", "admin"},
+			wantErr: "admin.token must be at least 32 bytes",
+		},
+		{
+			name: "jwt from env",
+			env:  map[string]string{"PRIVY_JWT_JWKS_FILE": "/etc/privy/jwks.json", "PRIVY_JWT_ISSUER": "https://id.example.com", "PRIVY_JWT_CLOCK_SKEW": "1m"},
+			check: func(t *testing.T, cfg Config) {
+				assert.Equal(t, "/etc/privy/jwks.json", cfg.JWT.JWKSFile)
+				assert.Equal(t, "https://id.example.com", cfg.JWT.Issuer)
+				assert.Equal(t, time.Minute, cfg.JWT.ClockSkew)
+			},
+		},
+		{
+			name: "jwt default scope from flags",
+			args: []string{"-jwt-default-scope", "cakes:write"},
+			check: func(t *testing.T, cfg Config) {
+				assert.Equal(t, "cakes:write", cfg.JWT.DefaultScope)
+			},
+		},
+		{
+			name:    "invalid jwt",
+			args:    []string{"-jwt-secret", "secret", "-jwt-clock-skew", "1h", "-jwt-default-scope", "cakes:admin"},
+			wantErr: `jwt.secret must be at least 32 bytes; jwt.clock_skew must be between 0 and 5m; jwt.default_scope "cakes:admin" must be empty, cakes:read or cakes:write`,
+		},
+		{
+			name: "auth from flags",
+			args: []string{"-auth-anonymous-scope", "", "-auth-key-touch-interval", "5m"},
+			check: func(t *testing.T, cfg Config) {
+				assert.Equal(t, "", cfg.Auth.AnonymousScope)
+				assert.Equal(t, 5*time.Minute, cfg.Auth.KeyTouchInterval)
+			},
+		},
+		{
+			name:    "invalid auth",
+			env:     map[string]string{"PRIVY_AUTH_ANONYMOUS_SCOPE": "cakes:write", "PRIVY_AUTH_KEY_TOUCH_INTERVAL": "-1s"},
+			wantErr: `auth.anonymous_scope "cakes:write" must be empty or cakes:read; auth.key_touch_interval can't be negative`,
+		},
+		{
+			name: "images from env",
+			env:  map[string]string{"PRIVY_IMAGES_DIR": "/var/lib/privy/images", "PRIVY_IMAGES_BASE_URL": "https://cdn.example.com/cakes", "PRIVY_IMAGES_MAX_BYTES": "1048576"},
+			check: func(t *testing.T, cfg Config) {
+				assert.Equal(t, "/var/lib/privy/images", cfg.Images.Dir)
+				assert.Equal(t, "https://cdn.example.com/cakes", cfg.Images.BaseURL)
+				assert.Equal(t, 1<<20, cfg.Images.MaxBytes)
+			},
+		},
+		{
+			name:    "invalid images",
+			args:    []string{"-images-max-bytes", "0", "-images-base-url", "cdn.example.com"},
+			wantErr: `images.max_bytes must be at least 1; images.base_url "cdn.example.com" must start with http:// or https://`,
+		},
+		{
+			name: "image variants from flags",
+			args: []string{"-images-variants", "small:320, wide:1920", "-images-formats", "jpeg,webp"},
+			check: func(t *testing.T, cfg Config) {
+				assert.Equal(t, []string{"small:320", "wide:1920"}, cfg.Images.Variants)
+				assert.Equal(t, []string{"jpeg", "webp"}, cfg.Images.Formats)
+			},
+		},
+		{
+			name:    "invalid image variants",
+			env:     map[string]string{"PRIVY_IMAGES_VARIANTS": "thumbnail:160,thumbnail:320,placeholder:16,huge", "PRIVY_IMAGES_FORMATS": "avif"},
+			wantErr: `images.variants names thumbnail twice; images.variants entry "placeholder:16" must be named with lowercase letters and digits, other than placeholder; images.variants entry "huge" must be name:width with a positive width; images.formats entry "avif" must be jpeg, png or webp`,
+		},
+		{
+			name: "import from flags",
+			args: []string{"-import-max-bytes", "1048576"},
+			check: func(t *testing.T, cfg Config) {
+				assert.Equal(t, 1<<20, cfg.Import.MaxBytes)
+			},
+		},
+		{
+			name:    "invalid import",
+			args:    []string{"-import-max-bytes", "0"},
+			wantErr: "import.max_bytes must be at least 1",
+		},
+		{
+			name:    "unsupported file",
+			args:    []string{"-config", writeFile(t, "privy.ini", "")},
+			wantErr: "unsupported config file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := Load(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() unexpected error = %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
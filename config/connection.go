@@ -1,9 +1,92 @@
 package config
 
-const (
-	Host     = "127.0.0.1"
-	Port     = "3306"
-	Dbname   = "technical_privy"
-	Username = "root"
-	Password = ""
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
 )
+
+type Database struct {
+	Host            string        `yaml:"host" toml:"host"`
+	Port            int           `yaml:"port" toml:"port"`
+	Name            string        `yaml:"name" toml:"name"`
+	User            string        `yaml:"user" toml:"user"`
+	Password        string        `yaml:"password" toml:"password"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time"`
+	DialTimeout     time.Duration `yaml:"dial_timeout" toml:"dial_timeout"`
+	ConnectAttempts int           `yaml:"connect_attempts" toml:"connect_attempts"`
+	ConnectBackoff  time.Duration `yaml:"connect_backoff" toml:"connect_backoff"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+}
+
+// DSN builds the go-sql-driver/mysql data source name. Values are escaped
+// by the driver, so passwords may contain any character. DATETIME columns
+// are parsed into time.Time and the session runs in UTC so that
+// CURRENT_TIMESTAMP and the scanned values agree.
+func (d Database) DSN() string {
+	cfg := mysql.NewConfig()
+	cfg.User = d.User
+	cfg.Passwd = d.Password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(d.Host, strconv.Itoa(d.Port))
+	cfg.DBName = d.Name
+	cfg.Timeout = d.DialTimeout
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+	cfg.Params = map[string]string{"time_zone": "'+00:00'"}
+	return cfg.FormatDSN()
+}
+
+func (d Database) validate() []string {
+	var problems []string
+
+	if d.Host == "" {
+		problems = append(problems, "database.host can't be empty")
+	}
+	if d.Port < 1 || d.Port > 65535 {
+		problems = append(problems, "database.port must be between 1 and 65535")
+	}
+	if d.Name == "" {
+		problems = append(problems, "database.name can't be empty")
+	}
+	if d.User == "" {
+		problems = append(problems, "database.user can't be empty")
+	}
+	if d.MaxOpenConns < 0 {
+		problems = append(problems, "database.max_open_conns can't be negative")
+	}
+	if d.MaxIdleConns < 0 {
+		problems = append(problems, "database.max_idle_conns can't be negative")
+	}
+	if d.ConnectAttempts < 1 {
+		problems = append(problems, "database.connect_attempts must be at least 1")
+	}
+	if d.MaxOpenConns > 0 && d.MaxIdleConns > d.MaxOpenConns {
+		problems = append(problems, fmt.Sprintf("database.max_idle_conns (%d) can't exceed database.max_open_conns (%d)", d.MaxIdleConns, d.MaxOpenConns))
+	}
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"conn_max_lifetime", d.ConnMaxLifetime},
+		{"conn_max_idle_time", d.ConnMaxIdleTime},
+		{"dial_timeout", d.DialTimeout},
+		{"connect_backoff", d.ConnectBackoff},
+		{"read_timeout", d.ReadTimeout},
+		{"write_timeout", d.WriteTimeout},
+	}
+	for _, duration := range durations {
+		if duration.value < 0 {
+			problems = append(problems, fmt.Sprintf("database.%s can't be negative", duration.name))
+		}
+	}
+
+	return problems
+}
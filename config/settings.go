@@ -0,0 +1,172 @@
+package config
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting binds one Config field to its environment variable and flag.
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	value func(*Config) flag.Value
+}
+
+var settings = []setting{
+	{"PRIVY_SERVER_HOST", "host", "interface the HTTP server listens on", func(c *Config) flag.Value { return (*stringValue)(&c.Server.Host) }},
+	{"PRIVY_SERVER_PORT", "port", "port the HTTP server listens on", func(c *Config) flag.Value { return (*intValue)(&c.Server.Port) }},
+	{"PRIVY_SERVER_READ_TIMEOUT", "server-read-timeout", "maximum duration for reading a request", func(c *Config) flag.Value { return (*durationValue)(&c.Server.ReadTimeout) }},
+	{"PRIVY_SERVER_WRITE_TIMEOUT", "server-write-timeout", "maximum duration for writing a response", func(c *Config) flag.Value { return (*durationValue)(&c.Server.WriteTimeout) }},
+	{"PRIVY_SERVER_STREAM_TIMEOUT", "server-stream-timeout", "maximum duration for reading an import or writing an export, 0 for none", func(c *Config) flag.Value { return (*durationValue)(&c.Server.StreamTimeout) }},
+	{"PRIVY_SERVER_SHUTDOWN_GRACE", "shutdown-grace", "time allowed for draining in-flight requests on shutdown", func(c *Config) flag.Value { return (*durationValue)(&c.Server.ShutdownGrace) }},
+
+	{"PRIVY_DB_HOST", "db-host", "database host", func(c *Config) flag.Value { return (*stringValue)(&c.Database.Host) }},
+	{"PRIVY_DB_PORT", "db-port", "database port", func(c *Config) flag.Value { return (*intValue)(&c.Database.Port) }},
+	{"PRIVY_DB_NAME", "db-name", "database name", func(c *Config) flag.Value { return (*stringValue)(&c.Database.Name) }},
+	{"PRIVY_DB_USER", "db-user", "database user", func(c *Config) flag.Value { return (*stringValue)(&c.Database.User) }},
+	{"PRIVY_DB_PASSWORD", "db-password", "database password", func(c *Config) flag.Value { return (*stringValue)(&c.Database.Password) }},
+	{"PRIVY_DB_MAX_OPEN_CONNS", "db-max-open-conns", "maximum open connections, 0 for unlimited", func(c *Config) flag.Value { return (*intValue)(&c.Database.MaxOpenConns) }},
+	{"PRIVY_DB_MAX_IDLE_CONNS", "db-max-idle-conns", "maximum idle connections", func(c *Config) flag.Value { return (*intValue)(&c.Database.MaxIdleConns) }},
+	{"PRIVY_DB_CONN_MAX_LIFETIME", "db-conn-max-lifetime", "maximum lifetime of a connection", func(c *Config) flag.Value { return (*durationValue)(&c.Database.ConnMaxLifetime) }},
+	{"PRIVY_DB_CONN_MAX_IDLE_TIME", "db-conn-max-idle-time", "maximum idle time of a connection", func(c *Config) flag.Value { return (*durationValue)(&c.Database.ConnMaxIdleTime) }},
+	{"PRIVY_DB_DIAL_TIMEOUT", "db-dial-timeout", "timeout for establishing a connection", func(c *Config) flag.Value { return (*durationValue)(&c.Database.DialTimeout) }},
+	{"PRIVY_DB_CONNECT_ATTEMPTS", "db-connect-attempts", "startup connectivity checks before giving up", func(c *Config) flag.Value { return (*intValue)(&c.Database.ConnectAttempts) }},
+	{"PRIVY_DB_CONNECT_BACKOFF", "db-connect-backoff", "initial wait between startup connectivity checks, doubled after each failure", func(c *Config) flag.Value { return (*durationValue)(&c.Database.ConnectBackoff) }},
+	{"PRIVY_DB_READ_TIMEOUT", "db-read-timeout", "deadline for a single read query", func(c *Config) flag.Value { return (*durationValue)(&c.Database.ReadTimeout) }},
+	{"PRIVY_DB_WRITE_TIMEOUT", "db-write-timeout", "deadline for a single write query", func(c *Config) flag.Value { return (*durationValue)(&c.Database.WriteTimeout) }},
+
+	{"PRIVY_CORS_ALLOW_ORIGINS", "cors-allow-origins", "comma separated list of allowed CORS origins", func(c *Config) flag.Value { return (*listValue)(&c.CORS.AllowOrigins) }},
+
+	{"PRIVY_PAGINATION_DEFAULT_LIMIT", "default-limit", "page size used when a request has no limit", func(c *Config) flag.Value { return (*intValue)(&c.Pagination.DefaultLimit) }},
+	{"PRIVY_PAGINATION_MAX_LIMIT", "max-limit", "largest page size a request may ask for", func(c *Config) flag.Value { return (*intValue)(&c.Pagination.MaxLimit) }},
+	{"PRIVY_PAGINATION_CURSOR_SECRET", "cursor-secret", "secret of at least 32 bytes signing pagination cursors", func(c *Config) flag.Value { return (*stringValue)(&c.Pagination.CursorSecret) }},
+
+	{"PRIVY_PRECONDITIONS_REQUIRED", "require-preconditions", "reject PATCH, PUT and DELETE without If-Match with 428", func(c *Config) flag.Value { return (*boolValue)(&c.Preconditions.Required) }},
+
+	{"PRIVY_CACHE_CONTROL_LIST", "cache-control-list", "Cache-Control directives of GET /cakes and GET /cakes/trash, empty for none", func(c *Config) flag.Value { return (*stringValue)(&c.CacheControl.List) }},
+	{"PRIVY_CACHE_CONTROL_DETAIL", "cache-control-detail", "Cache-Control directives of GET /cakes/:id, empty for none", func(c *Config) flag.Value { return (*stringValue)(&c.CacheControl.Detail) }},
+
+	{"PRIVY_CACHE_BACKEND", "cache-backend", "read-through cache: none, memory or redis", func(c *Config) flag.Value { return (*stringValue)(&c.Cache.Backend) }},
+	{"PRIVY_CACHE_SIZE", "cache-size", "entries kept by the memory cache", func(c *Config) flag.Value { return (*intValue)(&c.Cache.Size) }},
+	{"PRIVY_CACHE_TTL", "cache-ttl", "longest time a cached read is served", func(c *Config) flag.Value { return (*durationValue)(&c.Cache.TTL) }},
+	{"PRIVY_CACHE_REDIS_ADDR", "cache-redis-addr", "host:port of the redis cache", func(c *Config) flag.Value { return (*stringValue)(&c.Cache.RedisAddr) }},
+	{"PRIVY_CACHE_REDIS_PASSWORD", "cache-redis-password", "password of the redis cache", func(c *Config) flag.Value { return (*stringValue)(&c.Cache.RedisPassword) }},
+	{"PRIVY_CACHE_REDIS_DB", "cache-redis-db", "database number of the redis cache", func(c *Config) flag.Value { return (*intValue)(&c.Cache.RedisDB) }},
+
+	{"PRIVY_ADMIN_TOKEN", "admin-token", "token of at least 32 bytes granting cakes:admin in X-Admin-Token, empty to disable it", func(c *Config) flag.Value { return (*stringValue)(&c.Admin.Token) }},
+
+	{"PRIVY_JWT_SECRET", "jwt-secret", "secret of at least 32 bytes verifying HS256 bearer tokens", func(c *Config) flag.Value { return (*stringValue)(&c.JWT.Secret) }},
+	{"PRIVY_JWT_PUBLIC_KEY_FILE", "jwt-public-key-file", "PEM RSA public key verifying RS256 bearer tokens", func(c *Config) flag.Value { return (*stringValue)(&c.JWT.PublicKeyFile) }},
+	{"PRIVY_JWT_JWKS_FILE", "jwt-jwks-file", "local JWKS file whose keys verify RS256 bearer tokens", func(c *Config) flag.Value { return (*stringValue)(&c.JWT.JWKSFile) }},
+	{"PRIVY_JWT_ISSUER", "jwt-issuer", "iss bearer tokens must carry, empty to accept any", func(c *Config) flag.Value { return (*stringValue)(&c.JWT.Issuer) }},
+	{"PRIVY_JWT_AUDIENCE", "jwt-audience", "aud bearer tokens must carry, empty to accept any", func(c *Config) flag.Value { return (*stringValue)(&c.JWT.Audience) }},
+	{"PRIVY_JWT_CLOCK_SKEW", "jwt-clock-skew", "leeway given to the exp, nbf and iat of bearer tokens", func(c *Config) flag.Value { return (*durationValue)(&c.JWT.ClockSkew) }},
+	{"PRIVY_JWT_DEFAULT_SCOPE", "jwt-default-scope", "scope of bearer tokens without a scope or scp claim: cakes:read, cakes:write or empty for none", func(c *Config) flag.Value { return (*stringValue)(&c.JWT.DefaultScope) }},
+
+	{"PRIVY_AUTH_ANONYMOUS_SCOPE", "auth-anonymous-scope", "scope of requests without credentials: cakes:read or empty for none", func(c *Config) flag.Value { return (*stringValue)(&c.Auth.AnonymousScope) }},
+	{"PRIVY_AUTH_KEY_TOUCH_INTERVAL", "auth-key-touch-interval", "shortest time between two records of the last use of an API key", func(c *Config) flag.Value { return (*durationValue)(&c.Auth.KeyTouchInterval) }},
+
+	{"PRIVY_IMAGES_DIR", "images-dir", "directory cake images are stored in, empty to disable uploads", func(c *Config) flag.Value { return (*stringValue)(&c.Images.Dir) }},
+	{"PRIVY_IMAGES_BASE_URL", "images-base-url", "URL cake images are linked under, empty for /images/ paths on this service", func(c *Config) flag.Value { return (*stringValue)(&c.Images.BaseURL) }},
+	{"PRIVY_IMAGES_MAX_BYTES", "images-max-bytes", "largest image upload in bytes", func(c *Config) flag.Value { return (*intValue)(&c.Images.MaxBytes) }},
+	{"PRIVY_IMAGES_MAX_WIDTH", "images-max-width", "widest image upload in pixels", func(c *Config) flag.Value { return (*intValue)(&c.Images.MaxWidth) }},
+	{"PRIVY_IMAGES_MAX_HEIGHT", "images-max-height", "tallest image upload in pixels", func(c *Config) flag.Value { return (*intValue)(&c.Images.MaxHeight) }},
+	{"PRIVY_IMAGES_CACHE_CONTROL", "images-cache-control", "Cache-Control directives of GET /images/:key, empty for none", func(c *Config) flag.Value { return (*stringValue)(&c.Images.CacheControl) }},
+	{"PRIVY_IMAGES_VARIANTS", "images-variants", "comma separated name:width image variants to build, empty for none", func(c *Config) flag.Value { return (*listValue)(&c.Images.Variants) }},
+	{"PRIVY_IMAGES_FORMATS", "images-formats", "comma separated formats of each image variant: jpeg, png or webp", func(c *Config) flag.Value { return (*listValue)(&c.Images.Formats) }},
+	{"PRIVY_IMAGES_PLACEHOLDER_WIDTH", "images-placeholder-width", "width of the blurred image placeholder, 0 for none", func(c *Config) flag.Value { return (*intValue)(&c.Images.PlaceholderWidth) }},
+	{"PRIVY_IMAGES_QUALITY", "images-quality", "quality of lossy image variants, 1 to 100", func(c *Config) flag.Value { return (*intValue)(&c.Images.Quality) }},
+	{"PRIVY_IMAGES_WORKERS", "images-workers", "images building variants at once", func(c *Config) flag.Value { return (*intValue)(&c.Images.Workers) }},
+	{"PRIVY_IMAGES_QUEUE", "images-queue", "uploads waiting for variants before more are skipped", func(c *Config) flag.Value { return (*intValue)(&c.Images.Queue) }},
+
+	{"PRIVY_IMPORT_MAX_BYTES", "import-max-bytes", "largest import file in bytes", func(c *Config) flag.Value { return (*intValue)(&c.Import.MaxBytes) }},
+}
+
+var settingsByFlag = func() map[string]setting {
+	m := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		m[s.flag] = s
+	}
+	return m
+}()
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error {
+	*v = stringValue(s)
+	return nil
+}
+
+func (v *stringValue) String() string {
+	return string(*v)
+}
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	*v = intValue(n)
+	return nil
+}
+
+func (v *intValue) String() string {
+	return strconv.Itoa(int(*v))
+}
+
+// boolValue can be given as a bare flag, like the flag package's own.
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*v = boolValue(b)
+	return nil
+}
+
+func (v *boolValue) String() string {
+	return strconv.FormatBool(bool(*v))
+}
+
+func (v *boolValue) IsBoolFlag() bool {
+	return true
+}
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*v = durationValue(d)
+	return nil
+}
+
+func (v *durationValue) String() string {
+	return time.Duration(*v).String()
+}
+
+type listValue []string
+
+func (v *listValue) Set(s string) error {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*v = list
+	return nil
+}
+
+func (v *listValue) String() string {
+	return strings.Join(*v, ",")
+}
@@ -0,0 +1,5 @@
+-- Timestamps are generated by the database in UTC; the application no
+-- longer sends created_at or updated_at on insert.
+ALTER TABLE `privy_cakes`
+  MODIFY `created_at` datetime NOT NULL DEFAULT current_timestamp(),
+  MODIFY `updated_at` datetime NOT NULL DEFAULT current_timestamp() ON UPDATE current_timestamp();
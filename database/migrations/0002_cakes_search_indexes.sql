@@ -0,0 +1,8 @@
+-- GET /cakes searches title and description with MATCH ... AGAINST, which
+-- requires a FULLTEXT index, and filters and sorts on rating and the
+-- timestamps.
+ALTER TABLE `privy_cakes`
+  ADD FULLTEXT KEY `ft_privy_cakes_title_description` (`title`, `description`),
+  ADD KEY `idx_privy_cakes_rating` (`rating`),
+  ADD KEY `idx_privy_cakes_created_at` (`created_at`),
+  ADD KEY `idx_privy_cakes_updated_at` (`updated_at`);
@@ -0,0 +1,6 @@
+-- Deleting a cake moves it to the trash by setting deleted_at; only a purge
+-- removes the row. Every listing filters on deleted_at and the trash is
+-- sorted by it.
+ALTER TABLE `privy_cakes`
+  ADD `deleted_at` datetime DEFAULT NULL AFTER `updated_at`,
+  ADD KEY `idx_privy_cakes_deleted_at` (`deleted_at`);
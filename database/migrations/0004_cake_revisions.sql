@@ -0,0 +1,38 @@
+-- Every change to a cake appends a revision holding the cake as it was
+-- after the change, the fields it touched and who made it. Revisions are
+-- written in the transaction of the change and outlive purged cakes, so
+-- there is no foreign key.
+CREATE TABLE `privy_cake_revisions` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `cake_id` int(11) NOT NULL,
+  `revision` int(11) NOT NULL,
+  `action` varchar(16) NOT NULL,
+  `snapshot` longtext NOT NULL CHECK (json_valid(`snapshot`)),
+  `changed` longtext NOT NULL CHECK (json_valid(`changed`)),
+  `actor` varchar(255) NOT NULL,
+  `created_at` datetime NOT NULL DEFAULT current_timestamp(),
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uq_privy_cake_revisions_cake_revision` (`cake_id`, `revision`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Existing cakes start their history with a create revision of their
+-- current state.
+INSERT INTO `privy_cake_revisions` (`cake_id`, `revision`, `action`, `snapshot`, `changed`, `actor`, `created_at`)
+SELECT
+  `id`,
+  1,
+  'create',
+  JSON_OBJECT(
+    'id', `id`,
+    'title', `title`,
+    'description', `description`,
+    'rating', `rating`,
+    'image', `image`,
+    'created_at', DATE_FORMAT(`created_at`, '%Y-%m-%dT%H:%i:%sZ'),
+    'updated_at', DATE_FORMAT(`updated_at`, '%Y-%m-%dT%H:%i:%sZ'),
+    'deleted_at', DATE_FORMAT(`deleted_at`, '%Y-%m-%dT%H:%i:%sZ')
+  ),
+  '["title","description","rating","image"]',
+  'migration',
+  `updated_at`
+FROM `privy_cakes`;
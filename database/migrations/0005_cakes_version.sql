@@ -0,0 +1,4 @@
+-- version is bumped by every write to a cake. It backs the ETag of the
+-- cake and the If-Match checks of PATCH, PUT and DELETE.
+ALTER TABLE `privy_cakes`
+  ADD `version` int(11) NOT NULL DEFAULT 1 AFTER `image`;
@@ -0,0 +1,17 @@
+-- Renditions of uploaded cake images, built in the background. Each row
+-- belongs to the image a cake showed when it was built, in `source`, so
+-- variants of a replaced image are never served.
+CREATE TABLE `privy_cake_image_variants` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `cake_id` int(11) NOT NULL,
+  `source` text NOT NULL,
+  `name` varchar(32) NOT NULL,
+  `content_type` varchar(64) NOT NULL,
+  `width` int(11) NOT NULL,
+  `height` int(11) NOT NULL,
+  `url` text NOT NULL,
+  `key` varchar(255) NOT NULL,
+  `created_at` datetime NOT NULL DEFAULT current_timestamp(),
+  PRIMARY KEY (`id`),
+  KEY `idx_privy_cake_image_variants_cake_id` (`cake_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
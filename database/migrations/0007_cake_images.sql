@@ -0,0 +1,21 @@
+-- The gallery of a cake: every image with its alt text and place in the
+-- display order. At most one image of a cake is primary, and
+-- privy_cakes.image holds its url, or is empty when there is none, so
+-- readers of the single image keep working.
+CREATE TABLE `privy_cake_images` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `cake_id` int(11) NOT NULL,
+  `url` text NOT NULL,
+  `alt` varchar(255) NOT NULL DEFAULT '',
+  `position` int(11) NOT NULL,
+  `is_primary` tinyint(1) NOT NULL DEFAULT 0,
+  `created_at` datetime NOT NULL DEFAULT current_timestamp(),
+  PRIMARY KEY (`id`),
+  KEY `idx_privy_cake_images_cake_id_position` (`cake_id`, `position`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Existing images become the primary, and only, image of their cake.
+INSERT INTO `privy_cake_images` (`cake_id`, `url`, `alt`, `position`, `is_primary`, `created_at`)
+SELECT `id`, `image`, '', 1, 1, `created_at`
+FROM `privy_cakes`
+WHERE `image` <> '';
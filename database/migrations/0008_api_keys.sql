@@ -0,0 +1,17 @@
+-- API keys of partner integrations. Only the sha256 hash of a key is
+-- kept, with its first characters as prefix so it can be told apart in
+-- lists. scopes is a space separated list. Revoked keys stay, with
+-- revoked_at set, so their prefix still explains old revisions.
+CREATE TABLE `privy_api_keys` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `name` varchar(100) NOT NULL,
+  `prefix` varchar(16) NOT NULL,
+  `hash` char(64) NOT NULL,
+  `scopes` varchar(255) NOT NULL,
+  `expires_at` datetime DEFAULT NULL,
+  `last_used_at` datetime DEFAULT NULL,
+  `revoked_at` datetime DEFAULT NULL,
+  `created_at` datetime NOT NULL DEFAULT current_timestamp(),
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uq_privy_api_keys_hash` (`hash`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
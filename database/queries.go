@@ -1,9 +1,69 @@
 package database
 
 const (
-	GetListOfCakes       = "SELECT * FROM privy_cakes ORDER BY rating DESC, title ASC LIMIT %d OFFSET %d"
-	GetDetailsOfCakeByID = "SELECT * FROM privy_cakes WHERE id='%d'"
-	InsertCake           = "INSERT INTO privy_cakes VALUES('%d','%s','%s','%f','%s','%s','%s')"
-	UpdateCakeByID       = "UPDATE privy_cakes SET title='%s',description='%s',rating='%f',image='%s',created_at='%s',updated_at='%s' WHERE id='%d'"
-	DeleteCakeByID       = "DELETE FROM privy_cakes WHERE id='%d'"
+	SelectCakes                          = "SELECT id, title, description, rating, image, version, created_at, updated_at, deleted_at FROM privy_cakes"
+	SummarizeCakes                       = "SELECT COUNT(*), MAX(updated_at), COALESCE(SUM(version), 0) FROM privy_cakes"
+	GetDetailsOfCakeByID                 = "SELECT id, title, description, rating, image, version, created_at, updated_at, deleted_at FROM privy_cakes WHERE id = ? AND deleted_at IS NULL"
+	GetDetailsOfCakeByIDForUpdate        = "SELECT id, title, description, rating, image, version, created_at, updated_at, deleted_at FROM privy_cakes WHERE id = ? AND deleted_at IS NULL FOR UPDATE"
+	GetDetailsOfTrashedCakeByIDForUpdate = "SELECT id, title, description, rating, image, version, created_at, updated_at, deleted_at FROM privy_cakes WHERE id = ? AND deleted_at IS NOT NULL FOR UPDATE"
+	GetAnyCakeByID                       = "SELECT id, title, description, rating, image, version, created_at, updated_at, deleted_at FROM privy_cakes WHERE id = ?"
+	ExportCakes                          = "SELECT id, title, description, rating, image, version, created_at, updated_at, deleted_at FROM privy_cakes WHERE deleted_at IS NULL ORDER BY id"
+	InsertCake                           = "INSERT INTO privy_cakes (title, description, rating, image) VALUES (?, ?, ?, ?)"
+	InsertCakeWithID                     = "INSERT INTO privy_cakes (id, title, description, rating, image) VALUES (?, ?, ?, ?, ?)"
+	GetCakesByIDs                        = "SELECT id, title, description, rating, image, version, created_at, updated_at, deleted_at FROM privy_cakes WHERE id IN (%s) ORDER BY id"
+	GetAutoIncrementIncrement            = "SELECT @@auto_increment_increment"
+
+	// Multi-row inserts are built by repeating their row once per value.
+	InsertCakes                 = "INSERT INTO privy_cakes (title, description, rating, image) VALUES "
+	InsertCakesRow              = "(?, ?, ?, ?)"
+	InsertFirstCakeRevisions    = "INSERT INTO privy_cake_revisions (cake_id, revision, action, snapshot, changed, actor) VALUES "
+	InsertFirstCakeRevisionsRow = "(?, 1, ?, ?, ?, ?)"
+
+	// Every write below is checked against the version read under the row
+	// lock and bumps it.
+	UpdateCakeByID  = "UPDATE privy_cakes SET title = ?, description = ?, rating = ?, image = ?, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND version = ?"
+	TrashCakeByID   = "UPDATE privy_cakes SET deleted_at = CURRENT_TIMESTAMP, version = version + 1, updated_at = updated_at WHERE id = ? AND version = ?"
+	RestoreCakeByID = "UPDATE privy_cakes SET deleted_at = NULL, version = version + 1, updated_at = updated_at WHERE id = ? AND version = ?"
+	PurgeCakeByID   = "DELETE FROM privy_cakes WHERE id = ? AND version = ?"
+
+	InsertCakeRevision = "INSERT INTO privy_cake_revisions (cake_id, revision, action, snapshot, changed, actor)" +
+		" SELECT ?, COALESCE(MAX(revision), 0) + 1, ?, ?, ?, ? FROM privy_cake_revisions WHERE cake_id = ?"
+	SelectCakeRevisions = "SELECT cake_id, revision, action, snapshot, changed, actor, created_at FROM privy_cake_revisions WHERE cake_id = ? ORDER BY revision DESC LIMIT ? OFFSET ?"
+	CountCakeRevisions  = "SELECT COUNT(*) FROM privy_cake_revisions WHERE cake_id = ?"
+	GetCakeRevision     = "SELECT cake_id, revision, action, snapshot, changed, actor, created_at FROM privy_cake_revisions WHERE cake_id = ? AND revision = ?"
+
+	// Variants only count while the cake still shows their source image, and
+	// recording them bumps the version, so the ETag of the cake changes.
+	GetImageVariants       = "SELECT name, content_type, width, height, url, `key` FROM privy_cake_image_variants WHERE cake_id = ? AND source = ? ORDER BY id"
+	GetAllImageVariants    = "SELECT name, content_type, width, height, url, `key` FROM privy_cake_image_variants WHERE cake_id = ? ORDER BY id"
+	TouchCakeImage         = "UPDATE privy_cakes SET version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND image = ? AND deleted_at IS NULL"
+	DeleteImageVariants    = "DELETE FROM privy_cake_image_variants WHERE cake_id = ?"
+	InsertImageVariants    = "INSERT INTO privy_cake_image_variants (cake_id, source, name, content_type, width, height, url, `key`) VALUES "
+	InsertImageVariantsRow = "(?, ?, ?, ?, ?, ?, ?, ?)"
+
+	// privy_cakes.image holds the url of the primary image of the gallery,
+	// so gallery writes that change the primary write the cake too.
+	GetCakeImages    = "SELECT id, cake_id, url, alt, position, is_primary, created_at FROM privy_cake_images WHERE cake_id = ? ORDER BY position, id"
+	InsertCakeImage  = "INSERT INTO privy_cake_images (cake_id, url, alt, position, is_primary) VALUES (?, ?, ?, ?, ?)"
+	UpdateCakeImage  = "UPDATE privy_cake_images SET alt = ?, position = ?, is_primary = ? WHERE id = ?"
+	DeleteCakeImage  = "DELETE FROM privy_cake_images WHERE id = ?"
+	DeleteCakeImages = "DELETE FROM privy_cake_images WHERE cake_id = ?"
+	TouchCakeByID    = "UPDATE privy_cakes SET version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND version = ?"
+
+	// Writes of image through the cake itself carry over to the primary
+	// image. Clearing it keeps the image in the gallery, as not primary.
+	SetPrimaryImageURL     = "UPDATE privy_cake_images SET url = ? WHERE cake_id = ? AND is_primary = 1"
+	AppendPrimaryImage     = "INSERT INTO privy_cake_images (cake_id, url, alt, position, is_primary) SELECT ?, ?, '', COALESCE(MAX(position), 0) + 1, 1 FROM privy_cake_images WHERE cake_id = ?"
+	ClearPrimaryImage      = "UPDATE privy_cake_images SET is_primary = 0 WHERE cake_id = ? AND is_primary = 1"
+	InsertPrimaryImages    = "INSERT INTO privy_cake_images (cake_id, url, alt, position, is_primary) VALUES "
+	InsertPrimaryImagesRow = "(?, ?, '', 1, 1)"
+
+	// API keys are looked up by the sha256 hash of the key. Revoking keeps
+	// the first revocation time.
+	GetAPIKeys       = "SELECT id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at FROM privy_api_keys ORDER BY id"
+	GetAPIKeyByID    = "SELECT id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at FROM privy_api_keys WHERE id = ?"
+	GetAPIKeyByHash  = "SELECT id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at FROM privy_api_keys WHERE hash = ?"
+	InsertAPIKey     = "INSERT INTO privy_api_keys (name, prefix, hash, scopes, expires_at) VALUES (?, ?, ?, ?, ?)"
+	RevokeAPIKeyByID = "UPDATE privy_api_keys SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP) WHERE id = ?"
+	TouchAPIKeyByID  = "UPDATE privy_api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?"
 )
@@ -0,0 +1,23 @@
+// Package actor carries the name of whoever is behind a request through its
+// context, so the audit trail can record who made each change.
+package actor
+
+import "context"
+
+// Anonymous is recorded for requests that don't identify anyone.
+const Anonymous = "anonymous"
+
+type contextKey struct{}
+
+// WithName returns a copy of ctx acting on behalf of name.
+func WithName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, contextKey{}, name)
+}
+
+// Name returns the actor of ctx, or Anonymous.
+func Name(ctx context.Context) string {
+	if name, ok := ctx.Value(contextKey{}).(string); ok && name != "" {
+		return name
+	}
+	return Anonymous
+}
@@ -0,0 +1,21 @@
+package api
+
+import (
+	"net/http"
+	"privy/internal/apperror"
+	"privy/internal/repository"
+	m "privy/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetCacheStats reports how the repository cache answered reads so far.
+func (h *handler) GetCacheStats(c echo.Context) (err error) {
+	cached, ok := h.repository.(interface{ Stats() repository.CacheStats })
+	if !ok {
+		return apperror.New(apperror.KindNotFound, "cache is disabled")
+	}
+
+	res := m.SetResponse(http.StatusOK, "success", cached.Stats())
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"privy/internal/repository"
+	mock_repo "privy/mock/repository"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+)
+
+func Test_handler_GetCacheStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+
+	tests := []struct {
+		name       string
+		repository repository.Repository
+		statusCode int
+	}{
+		{name: "Cached", repository: repository.NewCached(mockRepository, repository.NewMemoryStore(1)), statusCode: http.StatusOK},
+		{name: "Cache Disabled", repository: mockRepository, statusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, "/admin/cache", nil), rec)
+
+			h := &handler{repository: tt.repository}
+			if err := h.GetCacheStats(c); err != nil {
+				HTTPErrorHandler(err, c)
+			}
+
+			assert.Equal(t, tt.statusCode, rec.Code)
+			if rec.Code == http.StatusOK {
+				assert.Equal(t, `{"status":200,"message":"success","data":{"hits":0,"misses":0,"shared":0,"errors":0}}`, strings.TrimSpace(rec.Body.String()))
+			}
+		})
+	}
+}
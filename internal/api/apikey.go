@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"privy/internal/auth"
+	"privy/internal/validate"
+	m "privy/models"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// APIKeyCreator is the part of the repository API keys are created in.
+type APIKeyCreator interface {
+	CreateAPIKey(ctx context.Context, key m.APIKey) (m.APIKey, error)
+}
+
+// MintAPIKey creates the key req describes once it is valid. The key
+// itself is only ever returned here; the repository keeps its hash.
+func MintAPIKey(ctx context.Context, keys APIKeyCreator, req APIKeyRequest) (m.NewAPIKey, error) {
+	if err := validateAPIKey(req, time.Now()); err != nil {
+		return m.NewAPIKey{}, err
+	}
+
+	secret, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		log.Println("[MintAPIKey] can't generate key, err:", err.Error())
+		return m.NewAPIKey{}, err
+	}
+	key := req.Key()
+	key.Prefix, key.Hash = prefix, hash
+
+	created, err := keys.CreateAPIKey(ctx, key)
+	if err != nil {
+		log.Println("[MintAPIKey] can't create key, err:", err.Error())
+		return m.NewAPIKey{}, err
+	}
+	return m.NewAPIKey{APIKey: created, Key: secret}, nil
+}
+
+// validateAPIKey checks req against its tags, then its scopes and expiry.
+func validateAPIKey(req APIKeyRequest, now time.Time) error {
+	if err := validate.Struct(req); err != nil {
+		return err
+	}
+	if len(req.Scopes) == 0 {
+		return validate.Field("scopes", "required", "is required")
+	}
+	for _, scope := range req.Scopes {
+		if !auth.ValidScope(scope) {
+			return validate.Field("scopes", "oneof", "must only hold cakes:read, cakes:write or cakes:admin")
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return validate.Field("expires_at", "future", "must be in the future")
+	}
+	return nil
+}
+
+// CreateAPIKey mints an API key. The response is the only place the key
+// itself appears, so it must not be cached.
+func (h *handler) CreateAPIKey(c echo.Context) (err error) {
+	var req APIKeyRequest
+	if err = decodeJSON(c, &req, "body must be a JSON object with name, scopes and expires_at"); err != nil {
+		return err
+	}
+
+	created, err := MintAPIKey(c.Request().Context(), h.repository, req)
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+
+	res := m.SetResponse(http.StatusOK, "success", created)
+	return c.JSON(http.StatusOK, res)
+}
+
+// GetAPIKeys lists every API key, revoked and expired ones included.
+func (h *handler) GetAPIKeys(c echo.Context) (err error) {
+	keys, err := h.repository.GetAPIKeys(c.Request().Context())
+	if err != nil {
+		log.Println("[Delivery][GetAPIKeys] can't get keys, err:", err.Error())
+		return err
+	}
+
+	res := m.SetResponse(http.StatusOK, "success", keys)
+	return c.JSON(http.StatusOK, res)
+}
+
+// RevokeAPIKey revokes an API key for good.
+func (h *handler) RevokeAPIKey(c echo.Context) (err error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if c.Param("id") == "" || err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "id must be an integer and can't be empty")
+	}
+
+	key, err := h.repository.RevokeAPIKey(c.Request().Context(), id)
+	if err != nil {
+		log.Println("[Delivery][RevokeAPIKey] can't revoke key, err:", err.Error())
+		return err
+	}
+
+	res := m.SetResponse(http.StatusOK, "success", key)
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"privy/internal/apperror"
+	"privy/internal/auth"
+	mock_repo "privy/mock/repository"
+	m "privy/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+)
+
+func Test_handler_CreateAPIKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+	tomorrow := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+
+	tests := []struct {
+		name       string
+		body       string
+		statusCode int
+		fields     []string
+		mock       func()
+	}{
+		{
+			name:       "Success",
+			body:       `{"name":" partner ","scopes":["cakes:read","cakes:write"],"expires_at":"` + tomorrow.Format(time.RFC3339) + `"}`,
+			statusCode: http.StatusOK,
+			mock: func() {
+				mockRepository.EXPECT().CreateAPIKey(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, key m.APIKey) (m.APIKey, error) {
+					assert.Equal(t, "partner", key.Name)
+					assert.Equal(t, []string{"cakes:read", "cakes:write"}, key.Scopes)
+					assert.Equal(t, tomorrow, *key.ExpiresAt)
+					assert.Equal(t, 64, len(key.Hash))
+					assert.Equal(t, true, strings.HasPrefix(key.Prefix, auth.APIKeyPrefix))
+					key.Id = 1
+					return key, nil
+				})
+			},
+		},
+		{
+			name:       "Missing Fields",
+			body:       `{}`,
+			statusCode: http.StatusUnprocessableEntity,
+			fields:     []string{"name", "scopes"},
+		},
+		{
+			name:       "No Scopes",
+			body:       `{"name":"partner","scopes":[]}`,
+			statusCode: http.StatusUnprocessableEntity,
+			fields:     []string{"scopes"},
+		},
+		{
+			name:       "Unknown Scope",
+			body:       `{"name":"partner","scopes":["cakes:read","cakes:delete"]}`,
+			statusCode: http.StatusUnprocessableEntity,
+			fields:     []string{"scopes"},
+		},
+		{
+			name:       "Expired",
+			body:       `{"name":"partner","scopes":["cakes:read"],"expires_at":"2020-01-01T00:00:00Z"}`,
+			statusCode: http.StatusUnprocessableEntity,
+			fields:     []string{"expires_at"},
+		},
+		{
+			name:       "Unknown Member",
+			body:       `{"name":"partner","scopes":["cakes:read"],"key":"privy_mine"}`,
+			statusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/admin/keys", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			if tt.mock != nil {
+				tt.mock()
+			}
+			h := &handler{repository: mockRepository}
+			if err := h.CreateAPIKey(c); err != nil {
+				HTTPErrorHandler(err, c)
+			}
+
+			assert.Equal(t, tt.statusCode, rec.Code)
+			if tt.fields != nil {
+				var res m.Problem
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatalf("can't decode error body: %v", err)
+				}
+				fields := make([]string, len(res.Errors))
+				for i, e := range res.Errors {
+					fields[i] = e.Field
+				}
+				assert.Equal(t, tt.fields, fields)
+			}
+			if rec.Code == http.StatusOK {
+				var res m.Response[m.NewAPIKey]
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatalf("can't decode body: %v", err)
+				}
+				assert.Equal(t, res.Data.Prefix, res.Data.Key[:len(res.Data.Prefix)])
+				assert.Equal(t, false, strings.Contains(rec.Body.String(), "hash"))
+				assert.Equal(t, "no-store", rec.Header().Get(echo.HeaderCacheControl))
+			}
+		})
+	}
+}
+
+func Test_handler_RevokeAPIKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+	revokedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		id         string
+		statusCode int
+		mock       func()
+	}{
+		{
+			name:       "Success",
+			id:         "1",
+			statusCode: http.StatusOK,
+			mock: func() {
+				mockRepository.EXPECT().RevokeAPIKey(gomock.Any(), 1).Return(m.APIKey{Id: 1, RevokedAt: &revokedAt}, nil)
+			},
+		},
+		{
+			name:       "Unknown Key",
+			id:         "9",
+			statusCode: http.StatusNotFound,
+			mock: func() {
+				mockRepository.EXPECT().RevokeAPIKey(gomock.Any(), 9).Return(m.APIKey{}, apperror.New(apperror.KindNotFound, "API key not found"))
+			},
+		},
+		{
+			name:       "Invalid Id",
+			id:         "x",
+			statusCode: http.StatusBadRequest,
+			mock:       func() {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+			c.SetParamNames("id")
+			c.SetParamValues(tt.id)
+
+			tt.mock()
+			h := &handler{repository: mockRepository}
+			if err := h.RevokeAPIKey(c); err != nil {
+				HTTPErrorHandler(err, c)
+			}
+
+			assert.Equal(t, tt.statusCode, rec.Code)
+		})
+	}
+}
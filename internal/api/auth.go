@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"privy/internal/actor"
+	"privy/internal/apperror"
+	"privy/internal/auth"
+	m "privy/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	HeaderXAdminToken = "X-Admin-Token"
+	HeaderXAPIKey     = "X-API-Key"
+)
+
+// APIKeyFinder is the part of the repository API keys are checked
+// against.
+type APIKeyFinder interface {
+	GetAPIKeyByHash(ctx context.Context, hash string) (m.APIKey, error)
+	TouchAPIKey(ctx context.Context, id int) error
+}
+
+// Guard authenticates requests and checks the scope each route requires.
+// A request may carry a bearer token Verifier accepts, an API key in
+// "Authorization: ApiKey <key>" or X-API-Key, or AdminToken in
+// X-Admin-Token, which grants cakes:admin. Requests without any are
+// granted AnonymousScope, or nothing when it is empty, and so are
+// authenticated ones at least, so credentials never grant less.
+type Guard struct {
+	Verifier       *auth.Verifier
+	Keys           APIKeyFinder
+	AdminToken     string
+	AnonymousScope string
+	// TouchInterval is the shortest time between two records of the last
+	// use of a key.
+	TouchInterval time.Duration
+
+	now func() time.Time
+}
+
+// Require lets through requests whose credentials grant scope, acting as
+// their subject, with their claims in the request context.
+func (g *Guard) Require(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, ok, err := g.authenticate(c)
+			if err != nil {
+				return err
+			}
+			anonymous := g.AnonymousScope != "" && auth.Grants([]string{g.AnonymousScope}, scope)
+			if !ok {
+				if anonymous {
+					return next(c)
+				}
+				g.challenge(c)
+				return echo.NewHTTPError(http.StatusUnauthorized, "credentials are missing")
+			}
+			if !claims.Allows(scope) && !anonymous {
+				return echo.NewHTTPError(http.StatusForbidden, "credentials don't grant the "+scope+" scope")
+			}
+
+			ctx := auth.WithClaims(c.Request().Context(), claims)
+			c.SetRequest(c.Request().WithContext(actor.WithName(ctx, claims.Subject)))
+			return next(c)
+		}
+	}
+}
+
+// authenticate returns the claims of the credentials of a request, and
+// false when it carries none.
+func (g *Guard) authenticate(c echo.Context) (auth.Claims, bool, error) {
+	header := c.Request().Header
+	if authorization := header.Get(echo.HeaderAuthorization); authorization != "" {
+		scheme, credential, _ := strings.Cut(authorization, " ")
+		credential = strings.TrimSpace(credential)
+		switch {
+		case strings.EqualFold(scheme, "Bearer"):
+			return g.bearer(c, credential)
+		case strings.EqualFold(scheme, "ApiKey"):
+			return g.apiKey(c, credential)
+		default:
+			g.challenge(c)
+			return auth.Claims{}, false, echo.NewHTTPError(http.StatusUnauthorized, "authorization scheme must be Bearer or ApiKey")
+		}
+	}
+	if key := header.Get(HeaderXAPIKey); key != "" {
+		return g.apiKey(c, key)
+	}
+	if token := header.Get(HeaderXAdminToken); token != "" {
+		return g.admin(token)
+	}
+	return auth.Claims{}, false, nil
+}
+
+func (g *Guard) bearer(c echo.Context, token string) (auth.Claims, bool, error) {
+	if g.Verifier == nil {
+		g.challenge(c)
+		return auth.Claims{}, false, echo.NewHTTPError(http.StatusUnauthorized, "bearer tokens are not accepted")
+	}
+	if token == "" {
+		g.challenge(c)
+		return auth.Claims{}, false, echo.NewHTTPError(http.StatusUnauthorized, "bearer token is missing")
+	}
+
+	claims, err := g.Verifier.Verify(token)
+	if err != nil {
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token", error_description=`+strconv.Quote(err.Error()))
+		return auth.Claims{}, false, echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	return claims, true, nil
+}
+
+// apiKey looks key up by its hash. Its last use is recorded at most once
+// per TouchInterval; failing to record it doesn't fail the request.
+func (g *Guard) apiKey(c echo.Context, key string) (auth.Claims, bool, error) {
+	if g.Keys == nil || key == "" {
+		g.challenge(c)
+		return auth.Claims{}, false, echo.NewHTTPError(http.StatusUnauthorized, "API key is invalid")
+	}
+
+	ctx := c.Request().Context()
+	found, err := g.Keys.GetAPIKeyByHash(ctx, auth.HashAPIKey(key))
+	if apperror.KindOf(err) == apperror.KindNotFound {
+		g.challenge(c)
+		return auth.Claims{}, false, echo.NewHTTPError(http.StatusUnauthorized, "API key is invalid")
+	}
+	if err != nil {
+		log.Println("[Delivery][Guard] can't get API key, err:", err.Error())
+		return auth.Claims{}, false, err
+	}
+
+	now := g.clock()
+	switch {
+	case found.RevokedAt != nil:
+		g.challenge(c)
+		return auth.Claims{}, false, echo.NewHTTPError(http.StatusUnauthorized, "API key is revoked")
+	case found.Expired(now):
+		g.challenge(c)
+		return auth.Claims{}, false, echo.NewHTTPError(http.StatusUnauthorized, "API key has expired")
+	}
+
+	if found.LastUsedAt == nil || now.Sub(*found.LastUsedAt) >= g.TouchInterval {
+		if err := g.Keys.TouchAPIKey(ctx, found.Id); err != nil {
+			log.Println("[Delivery][Guard] can't record use of API key, err:", err.Error())
+		}
+	}
+
+	claims := auth.Claims{Subject: "key:" + found.Prefix, Scopes: found.Scopes}
+	if found.ExpiresAt != nil {
+		claims.ExpiresAt = *found.ExpiresAt
+	}
+	return claims, true, nil
+}
+
+func (g *Guard) admin(token string) (auth.Claims, bool, error) {
+	if g.AdminToken == "" {
+		return auth.Claims{}, false, echo.NewHTTPError(http.StatusForbidden, "admin token is disabled")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(g.AdminToken)) != 1 {
+		return auth.Claims{}, false, echo.NewHTTPError(http.StatusForbidden, "admin token is invalid")
+	}
+	return auth.Claims{Subject: "admin", Scopes: []string{auth.ScopeAdmin}}, true, nil
+}
+
+// challenge names the schemes a request can authenticate with.
+func (g *Guard) challenge(c echo.Context) {
+	schemes := "ApiKey"
+	if g.Verifier != nil {
+		schemes = "Bearer, ApiKey"
+	}
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, schemes)
+}
+
+func (g *Guard) clock() time.Time {
+	if g.now != nil {
+		return g.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"privy/internal/actor"
+	"privy/internal/apperror"
+	"privy/internal/auth"
+	mock_repo "privy/mock/repository"
+	m "privy/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/golang-jwt/jwt"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+)
+
+func TestGuard(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	adminToken := strings.Repeat("t", 32)
+	secret := []byte(strings.Repeat("s", 32))
+	verifier, err := auth.NewVerifier(auth.Options{Secret: secret})
+	if err != nil {
+		t.Fatalf("NewVerifier() error = %v", err)
+	}
+	defaulted, err := auth.NewVerifier(auth.Options{Secret: secret, DefaultScope: auth.ScopeWrite})
+	if err != nil {
+		t.Fatalf("NewVerifier() error = %v", err)
+	}
+	signed := func(key []byte, exp time.Time, scope string) string {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub": "baker", "exp": exp.Unix(), "scope": scope,
+		}).SignedString(key)
+		return "Bearer " + token
+	}
+	unscoped, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "baker", "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString(secret)
+	unscoped = "Bearer " + unscoped
+	apiKey := "privy_" + strings.Repeat("k", 43)
+	hash := auth.HashAPIKey(apiKey)
+	recently, longAgo, past := now.Add(-time.Second), now.Add(-time.Hour), now.Add(-time.Minute)
+
+	type args struct {
+		scope          string
+		anonymousScope string
+		verifier       *auth.Verifier
+		adminToken     string
+		headers        map[string]string
+	}
+	type wants struct {
+		statusCode int
+		actor      string
+		challenge  string
+	}
+	tests := []struct {
+		name  string
+		args  args
+		wants wants
+		mock  func()
+	}{
+		{
+			name:  "Anonymous Read",
+			args:  args{scope: auth.ScopeRead, anonymousScope: auth.ScopeRead},
+			wants: wants{statusCode: http.StatusNoContent, actor: actor.Anonymous},
+		},
+		{
+			name:  "Anonymous Write",
+			args:  args{scope: auth.ScopeWrite, anonymousScope: auth.ScopeRead, verifier: verifier},
+			wants: wants{statusCode: http.StatusUnauthorized, challenge: "Bearer, ApiKey"},
+		},
+		{
+			name:  "Anonymous Write Allowed",
+			args:  args{scope: auth.ScopeWrite, anonymousScope: auth.ScopeWrite},
+			wants: wants{statusCode: http.StatusNoContent, actor: actor.Anonymous},
+		},
+		{
+			name:  "Anonymous Read Refused",
+			args:  args{scope: auth.ScopeRead},
+			wants: wants{statusCode: http.StatusUnauthorized, challenge: "ApiKey"},
+		},
+		{
+			name:  "Bearer Token",
+			args:  args{scope: auth.ScopeWrite, verifier: verifier, headers: map[string]string{echo.HeaderAuthorization: signed(secret, time.Now().Add(time.Hour), "cakes:write")}},
+			wants: wants{statusCode: http.StatusNoContent, actor: "baker"},
+		},
+		{
+			name:  "Lowercase Bearer Scheme",
+			args:  args{scope: auth.ScopeRead, verifier: verifier, headers: map[string]string{echo.HeaderAuthorization: "bearer" + strings.TrimPrefix(signed(secret, time.Now().Add(time.Hour), "cakes:write"), "Bearer")}},
+			wants: wants{statusCode: http.StatusNoContent, actor: "baker"},
+		},
+		{
+			name:  "Bearer Token Without Scope",
+			args:  args{scope: auth.ScopeWrite, verifier: verifier, headers: map[string]string{echo.HeaderAuthorization: signed(secret, time.Now().Add(time.Hour), "cakes:read")}},
+			wants: wants{statusCode: http.StatusForbidden},
+		},
+		{
+			name:  "Bearer Token Without Scope Claim Reads Like Anonymous",
+			args:  args{scope: auth.ScopeRead, anonymousScope: auth.ScopeRead, verifier: verifier, headers: map[string]string{echo.HeaderAuthorization: unscoped}},
+			wants: wants{statusCode: http.StatusNoContent, actor: "baker"},
+		},
+		{
+			name:  "Bearer Token Without Scope Claim Can't Write",
+			args:  args{scope: auth.ScopeWrite, anonymousScope: auth.ScopeRead, verifier: verifier, headers: map[string]string{echo.HeaderAuthorization: unscoped}},
+			wants: wants{statusCode: http.StatusForbidden},
+		},
+		{
+			name:  "Bearer Token Without Scope Claim And No Anonymous Scope",
+			args:  args{scope: auth.ScopeRead, verifier: verifier, headers: map[string]string{echo.HeaderAuthorization: unscoped}},
+			wants: wants{statusCode: http.StatusForbidden},
+		},
+		{
+			name:  "Bearer Token Without Scope Claim Given Default Scope",
+			args:  args{scope: auth.ScopeWrite, verifier: defaulted, headers: map[string]string{echo.HeaderAuthorization: unscoped}},
+			wants: wants{statusCode: http.StatusNoContent, actor: "baker"},
+		},
+		{
+			name: "Expired Bearer Token",
+			args: args{scope: auth.ScopeWrite, verifier: verifier, headers: map[string]string{echo.HeaderAuthorization: signed(secret, time.Now().Add(-time.Hour), "cakes:write")}},
+			wants: wants{
+				statusCode: http.StatusUnauthorized,
+				challenge:  `Bearer error="invalid_token", error_description="token is invalid: token has expired"`,
+			},
+		},
+		{
+			name: "Bearer Token With Wrong Secret",
+			args: args{scope: auth.ScopeWrite, verifier: verifier, headers: map[string]string{echo.HeaderAuthorization: signed([]byte(strings.Repeat("x", 32)), time.Now().Add(time.Hour), "cakes:write")}},
+			wants: wants{
+				statusCode: http.StatusUnauthorized,
+				challenge:  `Bearer error="invalid_token", error_description="token is invalid: signature is invalid"`,
+			},
+		},
+		{
+			name:  "Bearer Token Without Verifier",
+			args:  args{scope: auth.ScopeRead, anonymousScope: auth.ScopeRead, headers: map[string]string{echo.HeaderAuthorization: signed(secret, time.Now().Add(time.Hour), "cakes:write")}},
+			wants: wants{statusCode: http.StatusUnauthorized, challenge: "ApiKey"},
+		},
+		{
+			name:  "Other Scheme",
+			args:  args{scope: auth.ScopeWrite, verifier: verifier, headers: map[string]string{echo.HeaderAuthorization: "Basic YWRtaW46YWRtaW4="}},
+			wants: wants{statusCode: http.StatusUnauthorized, challenge: "Bearer, ApiKey"},
+		},
+		{
+			name:  "API Key",
+			args:  args{scope: auth.ScopeWrite, headers: map[string]string{echo.HeaderAuthorization: "ApiKey " + apiKey}},
+			wants: wants{statusCode: http.StatusNoContent, actor: "key:privy_kkkkkkkk"},
+			mock: func() {
+				mockRepository.EXPECT().GetAPIKeyByHash(gomock.Any(), hash).Return(m.APIKey{Id: 1, Prefix: "privy_kkkkkkkk", Scopes: []string{"cakes:admin"}}, nil)
+				mockRepository.EXPECT().TouchAPIKey(gomock.Any(), 1).Return(nil)
+			},
+		},
+		{
+			name:  "API Key Header Used Recently",
+			args:  args{scope: auth.ScopeRead, headers: map[string]string{HeaderXAPIKey: apiKey}},
+			wants: wants{statusCode: http.StatusNoContent, actor: "key:privy_kkkkkkkk"},
+			mock: func() {
+				mockRepository.EXPECT().GetAPIKeyByHash(gomock.Any(), hash).Return(m.APIKey{Id: 1, Prefix: "privy_kkkkkkkk", Scopes: []string{"cakes:read"}, LastUsedAt: &recently}, nil)
+			},
+		},
+		{
+			name:  "API Key Touch Fails",
+			args:  args{scope: auth.ScopeRead, headers: map[string]string{HeaderXAPIKey: apiKey}},
+			wants: wants{statusCode: http.StatusNoContent, actor: "key:privy_kkkkkkkk"},
+			mock: func() {
+				mockRepository.EXPECT().GetAPIKeyByHash(gomock.Any(), hash).Return(m.APIKey{Id: 1, Prefix: "privy_kkkkkkkk", Scopes: []string{"cakes:read"}, LastUsedAt: &longAgo}, nil)
+				mockRepository.EXPECT().TouchAPIKey(gomock.Any(), 1).Return(errors.New("database is down"))
+			},
+		},
+		{
+			name:  "API Key Without Scope",
+			args:  args{scope: auth.ScopeAdmin, headers: map[string]string{HeaderXAPIKey: apiKey}},
+			wants: wants{statusCode: http.StatusForbidden},
+			mock: func() {
+				mockRepository.EXPECT().GetAPIKeyByHash(gomock.Any(), hash).Return(m.APIKey{Id: 1, Scopes: []string{"cakes:write"}, LastUsedAt: &recently}, nil)
+			},
+		},
+		{
+			name:  "Unknown API Key",
+			args:  args{scope: auth.ScopeRead, anonymousScope: auth.ScopeRead, headers: map[string]string{HeaderXAPIKey: apiKey}},
+			wants: wants{statusCode: http.StatusUnauthorized, challenge: "ApiKey"},
+			mock: func() {
+				mockRepository.EXPECT().GetAPIKeyByHash(gomock.Any(), hash).Return(m.APIKey{}, apperror.New(apperror.KindNotFound, "API key not found"))
+			},
+		},
+		{
+			name:  "Revoked API Key",
+			args:  args{scope: auth.ScopeRead, headers: map[string]string{HeaderXAPIKey: apiKey}},
+			wants: wants{statusCode: http.StatusUnauthorized, challenge: "ApiKey"},
+			mock: func() {
+				mockRepository.EXPECT().GetAPIKeyByHash(gomock.Any(), hash).Return(m.APIKey{Id: 1, Scopes: []string{"cakes:read"}, RevokedAt: &past}, nil)
+			},
+		},
+		{
+			name:  "Expired API Key",
+			args:  args{scope: auth.ScopeRead, headers: map[string]string{HeaderXAPIKey: apiKey}},
+			wants: wants{statusCode: http.StatusUnauthorized, challenge: "ApiKey"},
+			mock: func() {
+				mockRepository.EXPECT().GetAPIKeyByHash(gomock.Any(), hash).Return(m.APIKey{Id: 1, Scopes: []string{"cakes:read"}, ExpiresAt: &past}, nil)
+			},
+		},
+		{
+			name:  "API Key Lookup Fails",
+			args:  args{scope: auth.ScopeRead, headers: map[string]string{HeaderXAPIKey: apiKey}},
+			wants: wants{statusCode: http.StatusServiceUnavailable},
+			mock: func() {
+				mockRepository.EXPECT().GetAPIKeyByHash(gomock.Any(), hash).Return(m.APIKey{}, apperror.ErrUnavailable)
+			},
+		},
+		{
+			name:  "Admin Token",
+			args:  args{scope: auth.ScopeAdmin, adminToken: adminToken, headers: map[string]string{HeaderXAdminToken: adminToken}},
+			wants: wants{statusCode: http.StatusNoContent, actor: "admin"},
+		},
+		{
+			name:  "Missing Admin Token",
+			args:  args{scope: auth.ScopeAdmin, anonymousScope: auth.ScopeWrite, adminToken: adminToken},
+			wants: wants{statusCode: http.StatusUnauthorized, challenge: "ApiKey"},
+		},
+		{
+			name:  "Wrong Admin Token",
+			args:  args{scope: auth.ScopeAdmin, adminToken: adminToken, headers: map[string]string{HeaderXAdminToken: strings.Repeat("x", 32)}},
+			wants: wants{statusCode: http.StatusForbidden},
+		},
+		{
+			name:  "Prefix Of Admin Token",
+			args:  args{scope: auth.ScopeAdmin, adminToken: adminToken, headers: map[string]string{HeaderXAdminToken: adminToken[:31]}},
+			wants: wants{statusCode: http.StatusForbidden},
+		},
+		{
+			name:  "Admin Token Disabled",
+			args:  args{scope: auth.ScopeAdmin, headers: map[string]string{HeaderXAdminToken: adminToken}},
+			wants: wants{statusCode: http.StatusForbidden},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/cakes", nil)
+			for key, value := range tt.args.headers {
+				req.Header.Set(key, value)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			if tt.mock != nil {
+				tt.mock()
+			}
+			guard := &Guard{
+				Verifier:       tt.args.verifier,
+				Keys:           mockRepository,
+				AdminToken:     tt.args.adminToken,
+				AnonymousScope: tt.args.anonymousScope,
+				TouchInterval:  time.Minute,
+				now:            func() time.Time { return now },
+			}
+			next := func(c echo.Context) error {
+				assert.Equal(t, tt.wants.actor, actor.Name(c.Request().Context()))
+				_, ok := auth.ClaimsFrom(c.Request().Context())
+				assert.Equal(t, tt.wants.actor != actor.Anonymous, ok)
+				return c.NoContent(http.StatusNoContent)
+			}
+			if err := guard.Require(tt.args.scope)(next)(c); err != nil {
+				HTTPErrorHandler(err, c)
+			}
+
+			assert.Equal(t, tt.wants.statusCode, rec.Code)
+			assert.Equal(t, tt.wants.challenge, rec.Header().Get(echo.HeaderWWWAuthenticate))
+		})
+	}
+}
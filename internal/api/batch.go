@@ -0,0 +1,173 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"privy/internal/validate"
+	m "privy/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MaxBatchOperations bounds the operations of one POST /cakes:batch.
+const MaxBatchOperations = 1000
+
+// BatchRequest is the body of POST /cakes:batch. Mode defaults to
+// transactional.
+type BatchRequest struct {
+	Mode       m.BatchMode             `json:"mode"`
+	Operations []BatchOperationRequest `json:"operations"`
+}
+
+// BatchOperationRequest is one operation of a batch. Cake holds the fields
+// of a create, or the merge patch of an update, and is absent on deletes.
+type BatchOperationRequest struct {
+	Op      string          `json:"op"`
+	Id      int             `json:"id"`
+	Version int             `json:"version"`
+	Cake    json.RawMessage `json:"cake"`
+}
+
+// BatchCakes applies a list of creates, updates and deletes. A
+// transactional batch is checked as a whole before anything runs and
+// either every operation is applied or the first failure is returned. A
+// best_effort batch applies every valid operation and reports the outcome
+// of each, failures included, with a 200.
+func (h *handler) BatchCakes(c echo.Context) (err error) {
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != echo.MIMEApplicationJSON {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "content type must be "+echo.MIMEApplicationJSON)
+	}
+
+	var req BatchRequest
+	decoder := json.NewDecoder(c.Request().Body)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "body must be a JSON object with mode and operations")
+	}
+
+	if req.Mode == "" {
+		req.Mode = m.BatchTransactional
+	}
+	if req.Mode != m.BatchTransactional && req.Mode != m.BatchBestEffort {
+		return validate.Field("mode", "oneof", "must be transactional or best_effort")
+	}
+	if len(req.Operations) == 0 {
+		return validate.Field("operations", "required", "is required")
+	}
+	if len(req.Operations) > MaxBatchOperations {
+		return validate.Field("operations", "max", fmt.Sprintf("must have at most %d items", MaxBatchOperations))
+	}
+
+	items := make([]m.BatchItem, len(req.Operations))
+	ops := make([]m.BatchOperation, 0, len(req.Operations))
+	indexes := make([]int, 0, len(req.Operations))
+	var invalid validate.Errors
+	for i, raw := range req.Operations {
+		items[i] = m.BatchItem{Index: i, Op: raw.Op}
+		op, err := h.parseBatchOperation(raw)
+		if err != nil {
+			problem := problemOf(err)
+			items[i].Status, items[i].Error = problem.Status, &problem
+			invalid = append(invalid, nestFields(fmt.Sprintf("operations[%d].", i), err)...)
+			continue
+		}
+		ops = append(ops, op)
+		indexes = append(indexes, i)
+	}
+	if req.Mode == m.BatchTransactional && len(invalid) > 0 {
+		return invalid.Err()
+	}
+
+	var results []m.BatchResult
+	if len(ops) > 0 {
+		results, err = h.repository.ApplyBatch(c.Request().Context(), ops, req.Mode)
+		if err != nil {
+			log.Println("[Delivery][BatchCakes] can't apply batch, err:", err.Error())
+			return err
+		}
+	}
+
+	for i, result := range results {
+		item := &items[indexes[i]]
+		if result.Err != nil {
+			problem := problemOf(result.Err)
+			item.Status, item.Error = problem.Status, &problem
+			continue
+		}
+		item.Status, item.Data = http.StatusOK, result.Cake
+	}
+
+	res := m.SetResponse(http.StatusOK, "success", items)
+	return c.JSON(http.StatusOK, res)
+}
+
+// parseBatchOperation checks one operation the way the single-cake
+// endpoint it stands for checks its request.
+func (h *handler) parseBatchOperation(req BatchOperationRequest) (m.BatchOperation, error) {
+	op := m.BatchOperation{Op: req.Op, Id: req.Id, Version: req.Version}
+
+	switch req.Op {
+	case m.BatchCreate:
+		if req.Id != 0 {
+			return op, validate.Field("id", "unknown", "can't be set on create")
+		}
+		if req.Version != 0 {
+			return op, validate.Field("version", "unknown", "can't be set on create")
+		}
+	case m.BatchUpdate, m.BatchDelete:
+		if req.Id < 1 {
+			return op, validate.Field("id", "required", "is required")
+		}
+		if req.Version < 0 {
+			return op, validate.Field("version", "min", "must be at least 0")
+		}
+		if req.Version == 0 && h.requirePreconditions {
+			return op, validate.Field("version", "required", "is required")
+		}
+	default:
+		return op, validate.Field("op", "oneof", "must be create, update or delete")
+	}
+
+	if req.Op == m.BatchDelete {
+		if len(req.Cake) > 0 {
+			return op, validate.Field("cake", "unknown", "can't be sent on delete")
+		}
+		return op, nil
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(req.Cake), []byte("{")) {
+		return op, validate.Field("cake", "type", "must be an object")
+	}
+	patch, err := parseMergePatch(req.Cake)
+	if err != nil {
+		return op, err
+	}
+	if req.Op == m.BatchCreate {
+		err = validate.Struct(CakeRequest(patch))
+	} else {
+		err = validate.Struct(CakePatchRequest(patch))
+	}
+	op.Patch = patch
+	return op, err
+}
+
+// nestFields returns the fields err reports as invalid, renamed under
+// prefix.
+func nestFields(prefix string, err error) validate.Errors {
+	var fieldErrs validate.Errors
+	if !errors.As(err, &fieldErrs) {
+		return nil
+	}
+	nested := make(validate.Errors, len(fieldErrs))
+	for i, e := range fieldErrs {
+		e.Field = prefix + e.Field
+		nested[i] = e
+	}
+	return nested
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"privy/internal/apperror"
+	mock_repo "privy/mock/repository"
+	m "privy/models"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+)
+
+func Test_handler_BatchCakes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+
+	str := func(s string) *string { return &s }
+	rating := func(f float32) *float32 { return &f }
+	image := "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"
+	create := `{"op":"create","cake":{"title":"judul","description":"deskripsi","rating":9.8,"image":"` + image + `"}}`
+	createOp := m.BatchOperation{Op: m.BatchCreate, Patch: m.CakePatch{Title: str("judul"), Description: str("deskripsi"), Rating: rating(9.8), Image: str(image)}}
+
+	type args struct {
+		contentType          string
+		body                 string
+		requirePreconditions bool
+	}
+	type wants struct {
+		statusCode int
+		fields     []string
+		items      []int
+	}
+	tests := []struct {
+		name  string
+		args  args
+		wants wants
+		mock  func()
+	}{
+		{
+			name: "Transactional success",
+			args: args{
+				body: `{"operations":[` + create + `,{"op":"update","id":3,"version":2,"cake":{"title":"baru"}},{"op":"delete","id":4}]}`,
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+				items:      []int{http.StatusOK, http.StatusOK, http.StatusOK},
+			},
+			mock: func() {
+				mockRepository.EXPECT().ApplyBatch(gomock.Any(), []m.BatchOperation{
+					createOp,
+					{Op: m.BatchUpdate, Id: 3, Version: 2, Patch: m.CakePatch{Title: str("baru")}},
+					{Op: m.BatchDelete, Id: 4},
+				}, m.BatchTransactional).Return([]m.BatchResult{{Cake: &m.Cake{Id: 10}}, {Cake: &m.Cake{Id: 3}}, {}}, nil)
+			},
+		},
+		{
+			name: "Transactional failure",
+			args: args{
+				body: `{"mode":"transactional","operations":[{"op":"delete","id":4,"version":1}]}`,
+			},
+			wants: wants{
+				statusCode: http.StatusPreconditionFailed,
+			},
+			mock: func() {
+				mockRepository.EXPECT().ApplyBatch(gomock.Any(), []m.BatchOperation{{Op: m.BatchDelete, Id: 4, Version: 1}}, m.BatchTransactional).
+					Return(nil, apperror.New(apperror.KindPreconditionFailed, "operations[0]: cake has been changed since it was read"))
+			},
+		},
+		{
+			name: "Transactional invalid operations",
+			args: args{
+				body: `{"operations":[{"op":"create","cake":{"title":"judul"}},{"op":"upsert","id":1},{"op":"delete","id":1,"cake":{}},` + create + `]}`,
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+				fields:     []string{"operations[0].description", "operations[0].rating", "operations[0].image", "operations[1].op", "operations[2].cake"},
+			},
+			mock: func() {},
+		},
+		{
+			name: "Best effort reports each operation",
+			args: args{
+				body: `{"mode":"best_effort","operations":[{"op":"update","id":0,"cake":{}},{"op":"delete","id":4},` + create + `]}`,
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+				items:      []int{http.StatusUnprocessableEntity, http.StatusNotFound, http.StatusOK},
+			},
+			mock: func() {
+				mockRepository.EXPECT().ApplyBatch(gomock.Any(), []m.BatchOperation{{Op: m.BatchDelete, Id: 4}, createOp}, m.BatchBestEffort).
+					Return([]m.BatchResult{{Err: apperror.ErrNotFound}, {Cake: &m.Cake{Id: 10}}}, nil)
+			},
+		},
+		{
+			name: "Best effort without valid operation",
+			args: args{
+				body: `{"mode":"best_effort","operations":[{"op":"update","id":1,"cake":"judul"}]}`,
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+				items:      []int{http.StatusUnprocessableEntity},
+			},
+			mock: func() {},
+		},
+		{
+			name: "Version required",
+			args: args{
+				body:                 `{"operations":[{"op":"delete","id":4}]}`,
+				requirePreconditions: true,
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+				fields:     []string{"operations[0].version"},
+			},
+			mock: func() {},
+		},
+		{
+			name: "Unknown mode",
+			args: args{
+				body: `{"mode":"eventually","operations":[` + create + `]}`,
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+				fields:     []string{"mode"},
+			},
+			mock: func() {},
+		},
+		{
+			name: "No operations",
+			args: args{
+				body: `{"operations":[]}`,
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+				fields:     []string{"operations"},
+			},
+			mock: func() {},
+		},
+		{
+			name: "Too many operations",
+			args: args{
+				body: `{"operations":[` + strings.Repeat(`{"op":"delete","id":1},`, MaxBatchOperations) + `{"op":"delete","id":1}]}`,
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+				fields:     []string{"operations"},
+			},
+			mock: func() {},
+		},
+		{
+			name: "Unknown member",
+			args: args{
+				body: `{"operations":[{"op":"delete","id":1,"force":true}]}`,
+			},
+			wants: wants{
+				statusCode: http.StatusBadRequest,
+			},
+			mock: func() {},
+		},
+		{
+			name: "Form body",
+			args: args{
+				contentType: echo.MIMEApplicationForm,
+				body:        "operations=1",
+			},
+			wants: wants{
+				statusCode: http.StatusUnsupportedMediaType,
+			},
+			mock: func() {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType := tt.args.contentType
+			if contentType == "" {
+				contentType = echo.MIMEApplicationJSON
+			}
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/cakes:batch", strings.NewReader(tt.args.body))
+			req.Header.Set(echo.HeaderContentType, contentType)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			tt.mock()
+
+			h := &handler{
+				repository:           mockRepository,
+				requirePreconditions: tt.args.requirePreconditions,
+			}
+			if err := h.BatchCakes(c); err != nil {
+				HTTPErrorHandler(err, c)
+			}
+
+			assert.Equal(t, tt.wants.statusCode, rec.Code)
+			if tt.wants.fields != nil {
+				var res m.Problem
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatalf("can't decode error body: %v", err)
+				}
+				fields := make([]string, len(res.Errors))
+				for i, e := range res.Errors {
+					fields[i] = e.Field
+				}
+				assert.Equal(t, tt.wants.fields, fields)
+			}
+			if tt.wants.items != nil {
+				var res m.Response[[]m.BatchItem]
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatalf("can't decode body: %v", err)
+				}
+				statuses := make([]int, len(res.Data))
+				for i, item := range res.Data {
+					assert.Equal(t, i, item.Index)
+					statuses[i] = item.Status
+				}
+				assert.Equal(t, tt.wants.items, statuses)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CacheControl sends directives as the Cache-Control header of successful
+// and 304 responses; errors are left uncacheable. Empty directives send
+// nothing.
+func CacheControl(directives string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if directives == "" {
+			return next
+		}
+		return func(c echo.Context) error {
+			res := c.Response()
+			res.Before(func() {
+				if res.Status < http.StatusBadRequest {
+					res.Header().Set(echo.HeaderCacheControl, directives)
+				}
+			})
+			return next(c)
+		}
+	}
+}
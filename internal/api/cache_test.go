@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/labstack/echo/v4"
+)
+
+func TestCacheControl(t *testing.T) {
+	tests := []struct {
+		name       string
+		directives string
+		status     int
+		want       string
+	}{
+		{name: "Success", directives: "public, max-age=60", status: http.StatusOK, want: "public, max-age=60"},
+		{name: "Not Modified", directives: "no-cache", status: http.StatusNotModified, want: "no-cache"},
+		{name: "Error", directives: "public, max-age=60", status: http.StatusNotFound},
+		{name: "No Directives", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, "/cakes", nil), rec)
+
+			next := func(c echo.Context) error {
+				return c.NoContent(tt.status)
+			}
+			if err := CacheControl(tt.directives)(next)(c); err != nil {
+				t.Fatalf("CacheControl() error = %v", err)
+			}
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, tt.want, rec.Header().Get(echo.HeaderCacheControl))
+		})
+	}
+}
@@ -1,12 +1,15 @@
 package api
 
 import (
+	"crypto/rand"
 	"log"
 	"net/http"
 	"privy/internal/repository"
+	"privy/internal/storage"
+	"privy/internal/validate"
 	m "privy/models"
-	"privy/utils"
 	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
@@ -16,55 +19,163 @@ type Handler interface {
 	GetDetailsOfCake(c echo.Context) (err error)
 	InsertCake(c echo.Context) (err error)
 	UpdateCake(c echo.Context) (err error)
+	ReplaceCake(c echo.Context) (err error)
 	DeleteCake(c echo.Context) (err error)
+	BatchCakes(c echo.Context) (err error)
+	ExportCakes(c echo.Context) (err error)
+	ImportCakes(c echo.Context) (err error)
+	GetTrash(c echo.Context) (err error)
+	RestoreCake(c echo.Context) (err error)
+	PurgeCake(c echo.Context) (err error)
+	GetRevisions(c echo.Context) (err error)
+	DiffRevisions(c echo.Context) (err error)
+	RevertCake(c echo.Context) (err error)
+	GetCacheStats(c echo.Context) (err error)
+	UploadCakeImage(c echo.Context) (err error)
+	GetImage(c echo.Context) (err error)
+	GetCakeImages(c echo.Context) (err error)
+	AddCakeImage(c echo.Context) (err error)
+	ReorderCakeImages(c echo.Context) (err error)
+	UpdateCakeImage(c echo.Context) (err error)
+	DeleteCakeImage(c echo.Context) (err error)
+	CreateAPIKey(c echo.Context) (err error)
+	GetAPIKeys(c echo.Context) (err error)
+	RevokeAPIKey(c echo.Context) (err error)
 }
 
 type handler struct {
-	repository repository.Repository
+	repository           repository.Repository
+	limits               Limits
+	cursors              cursorCodec
+	requirePreconditions bool
+	images               storage.BlobStore
+	imageBaseURL         string
+	imageLimits          ImageLimits
+	variants             VariantQueue
+	importMaxBytes       int
 }
 
-func New(repository repository.Repository) Handler {
-	return &handler{
-		repository: repository,
+// Limits bound the page size of list endpoints.
+type Limits struct {
+	Default int
+	Max     int
+}
+
+var DefaultLimits = Limits{Default: 100, Max: 500}
+
+type Option func(*handler)
+
+func WithLimits(limits Limits) Option {
+	return func(h *handler) {
+		h.limits = limits
 	}
 }
-func (h *handler) GetListOfCakes(c echo.Context) (err error) {
-	var (
-		limit  int
-		offset int
-	)
-	if c.FormValue("limit") == "" {
-		limit = 100
-	} else {
-		limit, err = strconv.Atoi(c.FormValue("limit"))
-		if err != nil {
-			res := m.SetError(http.StatusBadRequest, "limit must be an integer")
-			return c.JSON(http.StatusBadRequest, res)
+
+// WithCursorSecret sets the key signing pagination cursors. Without it a
+// random key is generated, valid for the lifetime of the process.
+func WithCursorSecret(secret []byte) Option {
+	return func(h *handler) {
+		h.cursors = cursorCodec{secret: secret}
+	}
+}
+
+// WithRequiredPreconditions makes PATCH, PUT and DELETE of a cake fail
+// with 428 unless they carry If-Match.
+func WithRequiredPreconditions(required bool) Option {
+	return func(h *handler) {
+		h.requirePreconditions = required
+	}
+}
+
+func New(repository repository.Repository, opts ...Option) Handler {
+	h := &handler{
+		repository:     repository,
+		limits:         DefaultLimits,
+		imageLimits:    DefaultImageLimits,
+		importMaxBytes: DefaultImportMaxBytes,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	if len(h.cursors.secret) == 0 {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic("api: can't generate cursor secret: " + err.Error())
 		}
+		log.Println("[Delivery][New] no cursor secret configured, cursors won't survive a restart")
+		h.cursors = cursorCodec{secret: secret}
+	}
+
+	return h
+}
+func (h *handler) GetListOfCakes(c echo.Context) (err error) {
+	return h.listCakes(c, false)
+}
+
+// GetTrash lists the deleted cakes with the parameters of GetListOfCakes.
+func (h *handler) GetTrash(c echo.Context) (err error) {
+	return h.listCakes(c, true)
+}
+
+func (h *handler) listCakes(c echo.Context, trashed bool) (err error) {
+	query, err := parseCakeQuery(c, h.limits)
+	if err != nil {
+		return err
 	}
+	query.Trashed = trashed
 
-	if c.FormValue("offset") == "" {
-		offset = 0
-	} else {
-		offset, err = strconv.Atoi(c.FormValue("offset"))
+	if token := c.QueryParam("cursor"); token != "" {
+		if c.QueryParam("offset") != "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "cursor and offset can't be used together")
+		}
+		key, err := h.cursors.decode(token, query.OrderBy())
 		if err != nil {
-			res := m.SetError(http.StatusBadRequest, "offset must be an integer")
-			return c.JSON(http.StatusBadRequest, res)
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
+		query.After = &key
+	}
+
+	summary, err := h.repository.SummarizeCakes(c.Request().Context(), query.CakeFilter)
+	if err != nil {
+		log.Println("[Delivery][GetListOfCakes] can't summarize cakes, err:", err.Error())
+		return err
+	}
+	// A page has no Last-Modified: cakes leave it without their updated_at
+	// changing, so only the ETag can tell.
+	etag := listETagOf(c, summary)
+	c.Response().Header().Set(HeaderETag, etag)
+	if notModified(c, etag, time.Time{}) {
+		return c.NoContent(http.StatusNotModified)
 	}
 
-	datas, err := h.repository.GetListOfCakes(c.Request().Context(), limit, offset)
+	// One extra row tells whether there is a next page.
+	page := query
+	page.Limit++
+	cakes, err := h.repository.GetListOfCakes(c.Request().Context(), page)
 	if err != nil {
 		log.Println("[Delivery][GetArticles] can't get list of articles, err:", err.Error())
-		res := m.SetError(http.StatusInternalServerError, err.Error())
-		return c.JSON(http.StatusInternalServerError, res)
+		return err
+	}
+	hasMore := len(cakes) > query.Limit
+	if hasMore {
+		cakes = cakes[:query.Limit]
 	}
 
-	cakes := make([]interface{}, len(datas))
-	for i, v := range datas {
-		cakes[i] = v
+	meta := m.Meta{Limit: query.Limit}
+	if query.After == nil {
+		meta = m.NewMeta(summary.Total, query.Limit, query.Offset)
+	}
+	if hasMore && !query.ByRelevance() {
+		meta.NextCursor, err = h.cursors.encode(query.OrderBy(), m.KeyOf(cakes[len(cakes)-1]))
+		if err != nil {
+			log.Println("[Delivery][GetListOfCakes] can't encode cursor, err:", err.Error())
+			return err
+		}
 	}
-	res := m.SetResponse(http.StatusOK, "success", cakes)
+	setPageLinks(c, meta)
+
+	res := m.SetCollection(http.StatusOK, "success", cakes, meta)
 	return c.JSON(http.StatusOK, res)
 }
 func (h *handler) GetDetailsOfCake(c echo.Context) (err error) {
@@ -74,131 +185,177 @@ func (h *handler) GetDetailsOfCake(c echo.Context) (err error) {
 
 	id, err = strconv.Atoi(c.Param("id"))
 	if c.Param("id") == "" || err != nil {
-		res := m.SetError(http.StatusBadRequest, "id must be an integer and can't be empty")
-		return c.JSON(http.StatusBadRequest, res)
+		return echo.NewHTTPError(http.StatusBadRequest, "id must be an integer and can't be empty")
 	}
 
 	data, err := h.repository.GetDetailsOfCake(c.Request().Context(), id)
 	if err != nil {
 		log.Println("[Delivery][GetDetailsOfCake] can't get details of cakes, err:", err.Error())
-		res := m.SetError(http.StatusInternalServerError, err.Error())
-		return c.JSON(http.StatusInternalServerError, res)
+		return err
+	}
+	setETag(c, data)
+	setLastModified(c, data.UpdatedAt)
+	if notModified(c, etagOf(data), data.UpdatedAt) {
+		return c.NoContent(http.StatusNotModified)
 	}
 
-	var cake []interface{}
-	cake = append(cake, data)
-
-	res := m.SetResponse(http.StatusOK, "success", cake)
+	res := m.SetResponse(http.StatusOK, "success", data)
 	return c.JSON(http.StatusOK, res)
 }
 func (h *handler) InsertCake(c echo.Context) (err error) {
+	fields, err := bindCake(c)
+	if err != nil {
+		return err
+	}
+
+	req := CakeRequest(fields)
+	if err = validate.Struct(req); err != nil {
+		return err
+	}
+
+	returnCake, err := h.repository.InsertCake(c.Request().Context(), req.Cake())
+	if err != nil {
+		log.Println("[Delivery][InsertCake] can't insert cake, err:", err.Error())
+		return err
+	}
+	setETag(c, returnCake)
+
+	res := m.SetResponse(http.StatusOK, "success", returnCake)
+	return c.JSON(http.StatusOK, res)
+}
+func (h *handler) UpdateCake(c echo.Context) (err error) {
 	var (
-		insertedCake m.Cake
+		id int
 	)
 
-	if !utils.IsValidAlphaNumericHyphen(c.FormValue("title")) {
-		res := m.SetError(http.StatusBadRequest, "title only accept alphanumeric and hypen and title can't be empty")
-		return c.JSON(http.StatusBadRequest, res)
+	id, err = strconv.Atoi(c.Param("id"))
+	if c.Param("id") == "" || err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "id must be an integer and can't be empty")
 	}
 
-	if c.FormValue("description") == "" {
-		res := m.SetError(http.StatusBadRequest, "description can't be empty")
-		return c.JSON(http.StatusBadRequest, res)
+	version, err := h.ifMatch(c, id)
+	if err != nil {
+		return err
 	}
 
-	if !utils.IsValidFloatNumber(c.FormValue("rating")) {
-		res := m.SetError(http.StatusBadRequest, "rating only accept float number and can't be empty")
-		return c.JSON(http.StatusBadRequest, res)
+	fields, err := bindCake(c)
+	if err != nil {
+		return err
 	}
 
-	if !utils.IsValidLinkImage(c.FormValue("image")) {
-		res := m.SetError(http.StatusBadRequest, "image format is wrong or can't be empty")
-		return c.JSON(http.StatusBadRequest, res)
+	req := CakePatchRequest(fields)
+	if err = validate.Struct(req); err != nil {
+		return err
 	}
 
-	c.Bind(&insertedCake)
-
-	returnCake, err := h.repository.InsertCake(c.Request().Context(), insertedCake)
+	returnCake, err := h.repository.PatchCake(c.Request().Context(), id, version, req.Patch())
 	if err != nil {
-		log.Println("[Delivery][InsertCake] can't insert cake, err:", err.Error())
-		res := m.SetResponse(http.StatusInternalServerError, err.Error(), nil)
-		return c.JSON(http.StatusInternalServerError, res)
+		log.Println("[Delivery][UpdateCake] can't update cake, err:", err.Error())
+		return err
 	}
+	setETag(c, returnCake)
 
-	var cake []interface{}
-	cake = append(cake, returnCake)
-
-	res := m.SetResponse(http.StatusOK, "success", cake)
+	res := m.SetResponse(http.StatusOK, "success", returnCake)
 	return c.JSON(http.StatusOK, res)
 }
-func (h *handler) UpdateCake(c echo.Context) (err error) {
+func (h *handler) ReplaceCake(c echo.Context) (err error) {
 	var (
-		updatedCake m.Cake
+		id int
 	)
 
-	_, err = strconv.Atoi(c.Param("id"))
+	id, err = strconv.Atoi(c.Param("id"))
 	if c.Param("id") == "" || err != nil {
-		res := m.SetError(http.StatusBadRequest, "id must be an integer and can't be empty")
-		return c.JSON(http.StatusBadRequest, res)
+		return echo.NewHTTPError(http.StatusBadRequest, "id must be an integer and can't be empty")
 	}
 
-	if c.FormValue("title") == "" {
-		updatedCake.Title = ""
-	} else if !utils.IsValidAlphaNumericHyphen(c.FormValue("title")) {
-		res := m.SetError(http.StatusBadRequest, "title only accept alphanumeric and hypen")
-		return c.JSON(http.StatusBadRequest, res)
+	version, err := h.ifMatch(c, id)
+	if err != nil {
+		return err
 	}
 
-	if c.FormValue("description") == "" {
-		updatedCake.Description = ""
+	fields, err := bindCake(c)
+	if err != nil {
+		return err
 	}
 
-	if c.FormValue("rating") == "" {
-		updatedCake.Rating = 0
-	} else if !utils.IsValidFloatNumber(c.FormValue("rating")) {
-		res := m.SetError(http.StatusBadRequest, "rating only accept float number")
-		return c.JSON(http.StatusBadRequest, res)
+	req := CakeRequest(fields)
+	if err = validate.Struct(req); err != nil {
+		return err
 	}
 
-	if c.FormValue("image") == "" {
-		updatedCake.Image = ""
-	} else if !utils.IsValidLinkImage(c.FormValue("image")) {
-		res := m.SetError(http.StatusBadRequest, "image format is wrong")
-		return c.JSON(http.StatusBadRequest, res)
+	replacedCake := req.Cake()
+	replacedCake.Id = id
+
+	returnCake, err := h.repository.UpdateCake(c.Request().Context(), replacedCake, version)
+	if err != nil {
+		log.Println("[Delivery][ReplaceCake] can't replace cake, err:", err.Error())
+		return err
 	}
+	setETag(c, returnCake)
 
-	c.Bind(&updatedCake)
+	res := m.SetResponse(http.StatusOK, "success", returnCake)
+	return c.JSON(http.StatusOK, res)
+}
+func (h *handler) DeleteCake(c echo.Context) (err error) {
+	var (
+		id int
+	)
 
-	returnCake, err := h.repository.UpdateCake(c.Request().Context(), updatedCake)
+	id, err = strconv.Atoi(c.Param("id"))
+	if c.Param("id") == "" || err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "id must be an integer and can't be empty")
+	}
+
+	version, err := h.ifMatch(c, id)
 	if err != nil {
-		log.Println("[Delivery][UpdateCake] can't update cake, err:", err.Error())
-		res := m.SetError(http.StatusInternalServerError, err.Error())
-		return c.JSON(http.StatusInternalServerError, res)
+		return err
 	}
 
-	var data []interface{}
-	data = append(data, returnCake)
+	err = h.repository.DeleteCake(c.Request().Context(), id, version)
+	if err != nil {
+		log.Println("[Delivery][DeleteCake] can't delete cake, err:", err.Error())
+		return err
+	}
 
-	res := m.SetResponse(http.StatusOK, "success", data)
+	res := m.SetResponse[*m.Cake](http.StatusOK, "success", nil)
 	return c.JSON(http.StatusOK, res)
 }
-func (h *handler) DeleteCake(c echo.Context) (err error) {
+func (h *handler) RestoreCake(c echo.Context) (err error) {
 	var (
 		id int
 	)
 
 	id, err = strconv.Atoi(c.Param("id"))
 	if c.Param("id") == "" || err != nil {
-		res := m.SetError(http.StatusBadRequest, "id must be an integer and can't be empty")
-		return c.JSON(http.StatusBadRequest, res)
+		return echo.NewHTTPError(http.StatusBadRequest, "id must be an integer and can't be empty")
 	}
 
-	err = h.repository.DeleteCake(c.Request().Context(), id)
+	returnCake, err := h.repository.RestoreCake(c.Request().Context(), id)
 	if err != nil {
-		log.Println("[Delivery][DeleteCake] can't delete cake, err:", err.Error())
-		res := m.SetError(http.StatusInternalServerError, err.Error())
-		return c.JSON(http.StatusInternalServerError, res)
+		log.Println("[Delivery][RestoreCake] can't restore cake, err:", err.Error())
+		return err
+	}
+	setETag(c, returnCake)
+
+	res := m.SetResponse(http.StatusOK, "success", returnCake)
+	return c.JSON(http.StatusOK, res)
+}
+func (h *handler) PurgeCake(c echo.Context) (err error) {
+	var (
+		id int
+	)
+
+	id, err = strconv.Atoi(c.Param("id"))
+	if c.Param("id") == "" || err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "id must be an integer and can't be empty")
+	}
+
+	err = h.repository.PurgeCake(c.Request().Context(), id)
+	if err != nil {
+		log.Println("[Delivery][PurgeCake] can't purge cake, err:", err.Error())
+		return err
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{"message": "OK"})
+	res := m.SetResponse[*m.Cake](http.StatusOK, "success", nil)
+	return c.JSON(http.StatusOK, res)
 }
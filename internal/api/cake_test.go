@@ -1,13 +1,18 @@
 package api
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"privy/internal/apperror"
 	"privy/internal/repository"
 	mock_repo "privy/mock/repository"
 	m "privy/models"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-playground/assert/v2"
 	"github.com/golang/mock/gomock"
@@ -54,7 +59,23 @@ func Test_handler_GetListOfCakes(t *testing.T) {
 	}
 	type wants struct {
 		statusCode int
+		meta       *m.Meta
+		link       string
 	}
+	intp := func(n int) *int { return &n }
+	rating := func(f float32) *float32 { return &f }
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	codec := cursorCodec{secret: secret}
+	cakes := []m.Cake{
+		{Id: 3, Title: "a", Rating: 9, CreatedAt: time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC)},
+		{Id: 1, Title: "b", Rating: 9, CreatedAt: time.Date(2022, 12, 2, 0, 0, 0, 0, time.UTC)},
+		{Id: 2, Title: "c", Rating: 8, CreatedAt: time.Date(2022, 12, 3, 0, 0, 0, 0, time.UTC)},
+	}
+	defaultOrder := m.CakeQuery{}.OrderBy()
+	cursor, _ := codec.encode(defaultOrder, m.KeyOf(cakes[1]))
+	titleCursor, _ := codec.encode(m.CakeQuery{Sort: []m.SortField{{Field: "title"}}}.OrderBy(), m.KeyOf(cakes[1]))
+	after := m.KeyOf(cakes[1])
 	tests := []struct {
 		name  string
 		args  args
@@ -69,11 +90,14 @@ func Test_handler_GetListOfCakes(t *testing.T) {
 			},
 			wants: wants{
 				statusCode: http.StatusOK,
+				meta:       &m.Meta{Total: intp(1), Limit: 10, Offset: intp(0)},
+				link:       `<http://example.com/cakes?limit=10>; rel="first", <http://example.com/cakes?limit=10&offset=0>; rel="last"`,
 			},
 			mock: func() {
-				mockRepository.EXPECT().GetListOfCakes(gomock.Any(), 10, 0).Return([]m.Cake{
+				mockRepository.EXPECT().GetListOfCakes(gomock.Any(), m.CakeQuery{Limit: 11}).Return([]m.Cake{
 					{Id: 1, Title: "title"},
 				}, nil)
+				mockRepository.EXPECT().SummarizeCakes(gomock.Any(), m.CakeFilter{}).Return(m.CakeSummary{Total: 1}, nil)
 			},
 		},
 		{
@@ -86,7 +110,72 @@ func Test_handler_GetListOfCakes(t *testing.T) {
 				statusCode: http.StatusInternalServerError,
 			},
 			mock: func() {
-				mockRepository.EXPECT().GetListOfCakes(gomock.Any(), 10, 0).Return(nil, errors.New("repository error"))
+				mockRepository.EXPECT().SummarizeCakes(gomock.Any(), gomock.Any()).Return(m.CakeSummary{Total: 3}, nil)
+				mockRepository.EXPECT().GetListOfCakes(gomock.Any(), m.CakeQuery{Limit: 11}).Return(nil, errors.New("repository error"))
+			},
+		},
+		{
+			name: "Repository timeout",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?limit=10&offset=0",
+			},
+			wants: wants{
+				statusCode: http.StatusGatewayTimeout,
+			},
+			mock: func() {
+				mockRepository.EXPECT().SummarizeCakes(gomock.Any(), gomock.Any()).Return(m.CakeSummary{Total: 3}, nil)
+				mockRepository.EXPECT().GetListOfCakes(gomock.Any(), m.CakeQuery{Limit: 11}).Return(nil, repository.ErrTimeout)
+			},
+		},
+		{
+			name: "Middle page links to its neighbours",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?limit=10&offset=10&sort=rating",
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+				meta:       &m.Meta{Total: intp(35), Limit: 10, Offset: intp(10), Next: intp(20), Prev: intp(0)},
+				link: `<http://example.com/cakes?limit=10&sort=rating>; rel="first", ` +
+					`<http://example.com/cakes?limit=10&offset=0&sort=rating>; rel="prev", ` +
+					`<http://example.com/cakes?limit=10&offset=20&sort=rating>; rel="next", ` +
+					`<http://example.com/cakes?limit=10&offset=30&sort=rating>; rel="last"`,
+			},
+			mock: func() {
+				mockRepository.EXPECT().GetListOfCakes(gomock.Any(), m.CakeQuery{Sort: []m.SortField{{Field: "rating"}}, Limit: 11, Offset: 10}).Return([]m.Cake{
+					{Id: 11, Title: "title"},
+				}, nil)
+				mockRepository.EXPECT().SummarizeCakes(gomock.Any(), m.CakeFilter{}).Return(m.CakeSummary{Total: 35}, nil)
+			},
+		},
+		{
+			name: "Empty page",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?limit=10&offset=0",
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+				meta:       &m.Meta{Total: intp(0), Limit: 10, Offset: intp(0)},
+				link:       `<http://example.com/cakes?limit=10>; rel="first"`,
+			},
+			mock: func() {
+				mockRepository.EXPECT().GetListOfCakes(gomock.Any(), m.CakeQuery{Limit: 11}).Return([]m.Cake{}, nil)
+				mockRepository.EXPECT().SummarizeCakes(gomock.Any(), m.CakeFilter{}).Return(m.CakeSummary{Total: 0}, nil)
+			},
+		},
+		{
+			name: "Summary error",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?limit=10&offset=0",
+			},
+			wants: wants{
+				statusCode: http.StatusServiceUnavailable,
+			},
+			mock: func() {
+				mockRepository.EXPECT().SummarizeCakes(gomock.Any(), m.CakeFilter{}).Return(m.CakeSummary{Total: 0}, apperror.ErrUnavailable)
 			},
 		},
 		{
@@ -95,85 +184,993 @@ func Test_handler_GetListOfCakes(t *testing.T) {
 				method: http.MethodGet,
 				path:   "/cakes?limit=10",
 			},
+			wants: wants{
+				statusCode: http.StatusOK,
+				meta:       &m.Meta{Total: intp(1), Limit: 10, Offset: intp(0)},
+				link:       `<http://example.com/cakes?limit=10>; rel="first", <http://example.com/cakes?limit=10&offset=0>; rel="last"`,
+			},
+			mock: func() {
+				mockRepository.EXPECT().GetListOfCakes(gomock.Any(), m.CakeQuery{Limit: 11}).Return([]m.Cake{
+					{Id: 1, Title: "title"},
+				}, nil)
+				mockRepository.EXPECT().SummarizeCakes(gomock.Any(), m.CakeFilter{}).Return(m.CakeSummary{Total: 1}, nil)
+			},
+		},
+		{
+			name: "no limit",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?offset=0",
+			},
 			wants: wants{
 				statusCode: http.StatusOK,
 			},
 			mock: func() {
-				mockRepository.EXPECT().GetListOfCakes(gomock.Any(), 10, 0).Return([]m.Cake{
+				mockRepository.EXPECT().GetListOfCakes(gomock.Any(), m.CakeQuery{Limit: 101}).Return([]m.Cake{
 					{Id: 1, Title: "title"},
 				}, nil)
+				mockRepository.EXPECT().SummarizeCakes(gomock.Any(), m.CakeFilter{}).Return(m.CakeSummary{Total: 1}, nil)
+			},
+		},
+		{
+			name: "Filters and sort",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?q=+lemon+cheesecake+&rating_min=7.5&rating_max=10&created_from=2022-12-01&created_to=2022-12-31&updated_from=2022-12-08T10:00:00%2B07:00&sort=-rating,title",
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+			},
+			mock: func() {
+				filter := m.CakeFilter{
+					Search:      "lemon cheesecake",
+					MinRating:   rating(7.5),
+					MaxRating:   rating(10),
+					CreatedFrom: time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC),
+					CreatedTo:   time.Date(2022, 12, 31, 23, 59, 59, 999999999, time.UTC),
+					UpdatedFrom: time.Date(2022, 12, 8, 3, 0, 0, 0, time.UTC),
+				}
+				mockRepository.EXPECT().GetListOfCakes(gomock.Any(), m.CakeQuery{
+					CakeFilter: filter,
+					Sort:       []m.SortField{{Field: "rating", Desc: true}, {Field: "title"}},
+					Limit:      101,
+				}).Return([]m.Cake{{Id: 1, Title: "title"}}, nil)
+				mockRepository.EXPECT().SummarizeCakes(gomock.Any(), filter).Return(m.CakeSummary{Total: 1}, nil)
+			},
+		},
+		{
+			name: "Unknown sort field",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?sort=image",
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+			},
+			mock: func() {
+				mockRepository.EXPECT().SummarizeCakes(gomock.Any(), gomock.Any()).Return(m.CakeSummary{Total: 3}, nil)
+				mockRepository.EXPECT().GetListOfCakes(gomock.Any(), m.CakeQuery{Sort: []m.SortField{{Field: "image"}}, Limit: 101}).
+					Return(nil, apperror.New(apperror.KindValidation, `can't sort by "image"`))
+			},
+		},
+		{
+			name: "rating_min not a number",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?rating_min=high",
+			},
+			wants: wants{
+				statusCode: http.StatusBadRequest,
+			},
+			mock: func() {},
+		},
+		{
+			name: "rating_min greater than rating_max",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?rating_min=8&rating_max=2",
+			},
+			wants: wants{
+				statusCode: http.StatusBadRequest,
+			},
+			mock: func() {},
+		},
+		{
+			name: "created_to not a date",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?created_to=yesterday",
+			},
+			wants: wants{
+				statusCode: http.StatusBadRequest,
+			},
+			mock: func() {},
+		},
+		{
+			name: "updated_from after updated_to",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?updated_from=2022-12-10&updated_to=2022-12-01",
+			},
+			wants: wants{
+				statusCode: http.StatusBadRequest,
+			},
+			mock: func() {},
+		},
+		{
+			name: "Full page issues a cursor",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?limit=2",
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+				meta:       &m.Meta{Total: intp(3), Limit: 2, Offset: intp(0), Next: intp(2), NextCursor: cursor},
+				link: `<http://example.com/cakes?limit=2>; rel="first", ` +
+					`<http://example.com/cakes?limit=2&offset=2>; rel="next", ` +
+					`<http://example.com/cakes?limit=2&offset=2>; rel="last"`,
+			},
+			mock: func() {
+				mockRepository.EXPECT().GetListOfCakes(gomock.Any(), m.CakeQuery{Limit: 3}).Return(cakes, nil)
+				mockRepository.EXPECT().SummarizeCakes(gomock.Any(), m.CakeFilter{}).Return(m.CakeSummary{Total: 3}, nil)
+			},
+		},
+		{
+			name: "Cursor page",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?limit=2&cursor=" + cursor,
 			},
+			wants: wants{
+				statusCode: http.StatusOK,
+				meta:       &m.Meta{Limit: 2},
+				link:       `<http://example.com/cakes?limit=2>; rel="first"`,
+			},
+			mock: func() {
+				mockRepository.EXPECT().SummarizeCakes(gomock.Any(), gomock.Any()).Return(m.CakeSummary{Total: 3}, nil)
+				mockRepository.EXPECT().GetListOfCakes(gomock.Any(), m.CakeQuery{Limit: 3, After: &after}).Return(cakes[2:], nil)
+			},
+		},
+		{
+			name: "Cursor page with more to come",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?limit=1&cursor=" + cursor,
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+				meta:       &m.Meta{Limit: 1, NextCursor: mustEncode(codec, defaultOrder, cakes[2])},
+				link: `<http://example.com/cakes?limit=1>; rel="first", ` +
+					`<http://example.com/cakes?cursor=` + mustEncode(codec, defaultOrder, cakes[2]) + `&limit=1>; rel="next"`,
+			},
+			mock: func() {
+				mockRepository.EXPECT().SummarizeCakes(gomock.Any(), gomock.Any()).Return(m.CakeSummary{Total: 3}, nil)
+				mockRepository.EXPECT().GetListOfCakes(gomock.Any(), m.CakeQuery{Limit: 2, After: &after}).Return(append(cakes[2:], m.Cake{Id: 9}), nil)
+			},
+		},
+		{
+			name: "Search ordered by relevance has no cursor",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?limit=2&q=cake",
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+				meta:       &m.Meta{Total: intp(3), Limit: 2, Offset: intp(0), Next: intp(2)},
+				link: `<http://example.com/cakes?limit=2&q=cake>; rel="first", ` +
+					`<http://example.com/cakes?limit=2&offset=2&q=cake>; rel="next", ` +
+					`<http://example.com/cakes?limit=2&offset=2&q=cake>; rel="last"`,
+			},
+			mock: func() {
+				mockRepository.EXPECT().GetListOfCakes(gomock.Any(), m.CakeQuery{CakeFilter: m.CakeFilter{Search: "cake"}, Limit: 3}).Return(cakes, nil)
+				mockRepository.EXPECT().SummarizeCakes(gomock.Any(), m.CakeFilter{Search: "cake"}).Return(m.CakeSummary{Total: 3}, nil)
+			},
+		},
+		{
+			name: "Cursor issued for another sort",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?limit=2&cursor=" + titleCursor,
+			},
+			wants: wants{
+				statusCode: http.StatusBadRequest,
+			},
+			mock: func() {},
+		},
+		{
+			name: "Tampered cursor",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?limit=2&cursor=" + strings.Replace(cursor, ".", "x.", 1),
+			},
+			wants: wants{
+				statusCode: http.StatusBadRequest,
+			},
+			mock: func() {},
+		},
+		{
+			name: "Cursor and offset together",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?offset=2&cursor=" + cursor,
+			},
+			wants: wants{
+				statusCode: http.StatusBadRequest,
+			},
+			mock: func() {},
+		},
+		{
+			name: "limit zero",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?limit=0",
+			},
+			wants: wants{
+				statusCode: http.StatusBadRequest,
+			},
+			mock: func() {},
+		},
+		{
+			name: "limit above maximum",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?limit=501",
+			},
+			wants: wants{
+				statusCode: http.StatusBadRequest,
+			},
+			mock: func() {},
+		},
+		{
+			name: "negative offset",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?offset=-10",
+			},
+			wants: wants{
+				statusCode: http.StatusBadRequest,
+			},
+			mock: func() {},
+		},
+		{
+			name: "limit not integer",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?limit=not_number&offset=0",
+			},
+			wants: wants{
+				statusCode: http.StatusBadRequest,
+			},
+			mock: func() {
+				return
+			},
+		},
+		{
+			name: "offset not integer",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes?limit=100&offset=not_number",
+			},
+			wants: wants{
+				statusCode: http.StatusBadRequest,
+			},
+			mock: func() {
+				return
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(tt.args.method, tt.args.path, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			tt.mock()
+
+			h := New(mockRepository, WithCursorSecret(secret))
+			if err := h.GetListOfCakes(c); err != nil {
+				HTTPErrorHandler(err, c)
+			}
+
+			assert.Equal(t, tt.wants.statusCode, rec.Code)
+			if tt.wants.meta != nil {
+				var res m.Response[[]m.Cake]
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatalf("can't decode response: %v", err)
+				}
+				assert.Equal(t, tt.wants.meta, res.Meta)
+				assert.Equal(t, tt.wants.link, rec.Header().Get("Link"))
+			}
+		})
+	}
+}
+func Test_handler_GetListOfCakes_Revalidate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+
+	summary := m.CakeSummary{Total: 1, LastModified: time.Date(2022, 12, 8, 10, 40, 2, 0, time.UTC), Versions: 2}
+	get := func(path, ifNoneMatch string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set(HeaderIfNoneMatch, ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		h := &handler{repository: mockRepository, limits: DefaultLimits}
+		if err := h.GetListOfCakes(c); err != nil {
+			HTTPErrorHandler(err, c)
+		}
+		return rec
+	}
+
+	mockRepository.EXPECT().SummarizeCakes(gomock.Any(), m.CakeFilter{}).Return(summary, nil).Times(3)
+	mockRepository.EXPECT().GetListOfCakes(gomock.Any(), gomock.Any()).Return([]m.Cake{{Id: 1, Title: "title"}}, nil).Times(2)
+
+	first := get("/cakes?limit=10", "")
+	assert.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get(HeaderETag)
+	assert.Equal(t, true, strings.HasPrefix(etag, `W/"1-1670496002-2-`))
+
+	unchanged := get("/cakes?limit=10", etag)
+	assert.Equal(t, http.StatusNotModified, unchanged.Code)
+	assert.Equal(t, etag, unchanged.Header().Get(HeaderETag))
+	assert.Equal(t, 0, unchanged.Body.Len())
+
+	otherPage := get("/cakes?limit=10&offset=10", etag)
+	assert.Equal(t, http.StatusOK, otherPage.Code)
+	assert.NotEqual(t, etag, otherPage.Header().Get(HeaderETag))
+
+	summary.Versions++
+	mockRepository.EXPECT().SummarizeCakes(gomock.Any(), m.CakeFilter{}).Return(summary, nil)
+	mockRepository.EXPECT().GetListOfCakes(gomock.Any(), gomock.Any()).Return([]m.Cake{{Id: 1, Title: "changed"}}, nil)
+	changed := get("/cakes?limit=10", etag)
+	assert.Equal(t, http.StatusOK, changed.Code)
+}
+func mustEncode(codec cursorCodec, order []m.SortField, cake m.Cake) string {
+	token, err := codec.encode(order, m.KeyOf(cake))
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
+func Test_handler_GetDetailsOfCake(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+
+	type args struct {
+		method string
+		path   string
+		id     string
+		header map[string]string
+	}
+	type wants struct {
+		statusCode int
+	}
+	tests := []struct {
+		name  string
+		args  args
+		wants wants
+		mock  func()
+	}{
+		{
+			name: "Success",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes",
+				id:     "1",
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+			},
+			mock: func() {
+				mockRepository.EXPECT().GetDetailsOfCake(gomock.Any(), 1).
+					Return(m.Cake{Id: 1, Title: "title", Description: "description", Rating: 10, Image: "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg", Version: 4}, nil)
+			},
+		},
+		{
+			name: "Not Modified By ETag",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes",
+				id:     "1",
+				header: map[string]string{HeaderIfNoneMatch: `"1-4"`},
+			},
+			wants: wants{
+				statusCode: http.StatusNotModified,
+			},
+			mock: func() {
+				mockRepository.EXPECT().GetDetailsOfCake(gomock.Any(), 1).
+					Return(m.Cake{Id: 1, Title: "title", Version: 4, UpdatedAt: time.Date(2022, 12, 8, 10, 40, 2, 0, time.UTC)}, nil)
+			},
+		},
+		{
+			name: "Not Modified Since",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes",
+				id:     "1",
+				header: map[string]string{echo.HeaderIfModifiedSince: "Thu, 08 Dec 2022 10:40:02 GMT"},
+			},
+			wants: wants{
+				statusCode: http.StatusNotModified,
+			},
+			mock: func() {
+				mockRepository.EXPECT().GetDetailsOfCake(gomock.Any(), 1).
+					Return(m.Cake{Id: 1, Title: "title", Version: 4, UpdatedAt: time.Date(2022, 12, 8, 10, 40, 2, 0, time.UTC)}, nil)
+			},
+		},
+		{
+			name: "Changed Since The Cached Copy",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes",
+				id:     "1",
+				header: map[string]string{HeaderIfNoneMatch: `"1-3"`},
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+			},
+			mock: func() {
+				mockRepository.EXPECT().GetDetailsOfCake(gomock.Any(), 1).
+					Return(m.Cake{Id: 1, Title: "title", Version: 4, UpdatedAt: time.Date(2022, 12, 8, 10, 40, 2, 0, time.UTC)}, nil)
+			},
+		},
+		{
+			name: "id not valid",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes",
+				id:     "abc",
+			},
+			wants: wants{
+				statusCode: http.StatusBadRequest,
+			},
+			mock: func() {},
+		},
+		{
+			name: "not found",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes",
+				id:     "2",
+			},
+			wants: wants{
+				statusCode: http.StatusNotFound,
+			},
+			mock: func() {
+				mockRepository.EXPECT().GetDetailsOfCake(gomock.Any(), 2).
+					Return(m.Cake{}, repository.ErrNotFound)
+			},
+		},
+		{
+			name: "repository error",
+			args: args{
+				method: http.MethodGet,
+				path:   "/cakes",
+				id:     "1",
+			},
+			wants: wants{
+				statusCode: http.StatusInternalServerError,
+			},
+			mock: func() {
+				mockRepository.EXPECT().GetDetailsOfCake(gomock.Any(), 1).
+					Return(m.Cake{Id: 1, Title: "title", Description: "description", Rating: 10, Image: "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"}, errors.New("Repository Error"))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest("GET", "/", nil)
+			for k, v := range tt.args.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			c.SetPath("/:id")
+			c.SetParamNames("id")
+			c.SetParamValues(tt.args.id)
+
+			tt.mock()
+
+			h := &handler{
+				repository: mockRepository,
+			}
+			if err := h.GetDetailsOfCake(c); err != nil {
+				HTTPErrorHandler(err, c)
+			}
+
+			assert.Equal(t, tt.wants.statusCode, rec.Code)
+			if rec.Code == http.StatusNotModified {
+				assert.Equal(t, `"1-4"`, rec.Header().Get(HeaderETag))
+				assert.Equal(t, "Thu, 08 Dec 2022 10:40:02 GMT", rec.Header().Get(echo.HeaderLastModified))
+				assert.Equal(t, 0, rec.Body.Len())
+			}
+			if rec.Code == http.StatusOK {
+				var res m.Response[m.Cake]
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatalf("can't decode response: %v", err)
+				}
+				assert.Equal(t, 1, res.Data.Id)
+				assert.Equal(t, `"1-4"`, rec.Header().Get(HeaderETag))
+			}
+		})
+	}
+}
+func Test_handler_InsertCake(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+
+	image := "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"
+	cake := m.Cake{Title: "judul", Description: "deskripsi", Rating: 9.8, Image: image}
+
+	type args struct {
+		contentType string
+		body        string
+	}
+	type wants struct {
+		statusCode int
+		fields     []string
+	}
+	tests := []struct {
+		name  string
+		args  args
+		wants wants
+		mock  func()
+	}{
+		{
+			name: "Success",
+			args: args{
+				contentType: echo.MIMEApplicationForm,
+				body:        "title=judul&description=deskripsi&rating=9.8&image=" + url.QueryEscape(image),
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+			},
+			mock: func() {
+				mockRepository.EXPECT().InsertCake(gomock.Any(), cake).Return(m.Cake{Id: 1, Title: "judul"}, nil)
+			},
+		},
+		{
+			name: "Success with json and unicode title",
+			args: args{
+				contentType: echo.MIMEApplicationJSON,
+				body:        `{"title":"Crème Brûlée","description":"deskripsi","rating":0,"image":"https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"}`,
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+			},
+			mock: func() {
+				mockRepository.EXPECT().InsertCake(gomock.Any(), m.Cake{Title: "Crème Brûlée", Description: "deskripsi", Rating: 0, Image: image}).
+					Return(m.Cake{Id: 1, Title: "Crème Brûlée"}, nil)
+			},
+		},
+		{
+			name: "Repository error",
+			args: args{
+				contentType: echo.MIMEApplicationForm,
+				body:        "title=judul&description=deskripsi&rating=9.8&image=" + url.QueryEscape(image),
+			},
+			wants: wants{
+				statusCode: http.StatusInternalServerError,
+			},
+			mock: func() {
+				mockRepository.EXPECT().InsertCake(gomock.Any(), cake).Return(m.Cake{}, errors.New("repository error"))
+			},
+		},
+		{
+			name: "Empty title",
+			args: args{
+				contentType: echo.MIMEApplicationForm,
+				body:        "title=&description=deskripsi&rating=9.8&image=" + url.QueryEscape(image),
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+				fields:     []string{"title"},
+			},
+			mock: func() {},
+		},
+		{
+			name: "Empty description",
+			args: args{
+				contentType: echo.MIMEApplicationForm,
+				body:        "title=judul&description=&rating=9.8&image=" + url.QueryEscape(image),
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+				fields:     []string{"description"},
+			},
+			mock: func() {},
+		},
+		{
+			name: "Invalid rating",
+			args: args{
+				contentType: echo.MIMEApplicationForm,
+				body:        "title=judul&description=deskripsi&rating=abc&image=" + url.QueryEscape(image),
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+				fields:     []string{"rating"},
+			},
+			mock: func() {},
+		},
+		{
+			name: "Invalid image",
+			args: args{
+				contentType: echo.MIMEApplicationForm,
+				body:        "title=judul&description=deskripsi&rating=9.8&image=1234",
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+				fields:     []string{"image"},
+			},
+			mock: func() {},
+		},
+		{
+			name: "Every failing field is reported",
+			args: args{
+				contentType: echo.MIMEApplicationJSON,
+				body:        `{"title":"a  b","rating":11,"image":"ftp://example.com/cake.png"}`,
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+				fields:     []string{"title", "description", "rating", "image"},
+			},
+			mock: func() {},
+		},
+		{
+			name: "Missing content type",
+			args: args{
+				body: "title=judul",
+			},
+			wants: wants{
+				statusCode: http.StatusUnsupportedMediaType,
+			},
+			mock: func() {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/cakes", strings.NewReader(tt.args.body))
+			req.Header.Set(echo.HeaderContentType, tt.args.contentType)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			tt.mock()
+
+			h := &handler{
+				repository: mockRepository,
+			}
+			if err := h.InsertCake(c); err != nil {
+				HTTPErrorHandler(err, c)
+			}
+
+			assert.Equal(t, tt.wants.statusCode, rec.Code)
+			if tt.wants.fields != nil {
+				var res m.Problem
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatalf("can't decode error body: %v", err)
+				}
+				fields := make([]string, len(res.Errors))
+				for i, e := range res.Errors {
+					fields[i] = e.Field
+				}
+				assert.Equal(t, tt.wants.fields, fields)
+			}
+		})
+	}
+}
+func Test_handler_UpdateCake(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+
+	str := func(s string) *string { return &s }
+	rating := func(f float32) *float32 { return &f }
+	image := "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"
+
+	type args struct {
+		method      string
+		path        string
+		id          string
+		contentType string
+		body        string
+	}
+	type wants struct {
+		statusCode int
+	}
+	tests := []struct {
+		name  string
+		args  args
+		wants wants
+		mock  func()
+	}{
+		{
+			name: "Success",
+			args: args{
+				method:      http.MethodPatch,
+				path:        "/cakes",
+				id:          "1",
+				contentType: MIMEApplicationMergePatchJSON,
+				body:        `{"title":"newjudul","description":"newdeskripsi","rating":9.8,"image":"https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"}`,
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+			},
+			mock: func() {
+				mockRepository.EXPECT().PatchCake(
+					gomock.Any(), 1, 0, m.CakePatch{Title: str("newjudul"), Description: str("newdeskripsi"), Rating: rating(9.8), Image: str(image)}).
+					Return(m.Cake{Id: 1, Title: "newjudul", Description: "newdeskripsi", Rating: 9.8, Image: image}, nil)
+			},
+		},
+		{
+			name: "Success setting zero rating",
+			args: args{
+				method:      http.MethodPatch,
+				path:        "/cakes",
+				id:          "1",
+				contentType: MIMEApplicationMergePatchJSON,
+				body:        `{"rating":0}`,
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+			},
+			mock: func() {
+				mockRepository.EXPECT().PatchCake(gomock.Any(), 1, 0, m.CakePatch{Rating: rating(0)}).
+					Return(m.Cake{Id: 1, Title: "judul", Rating: 0}, nil)
+			},
+		},
+		{
+			name: "Success clearing fields with null",
+			args: args{
+				method:      http.MethodPatch,
+				path:        "/cakes",
+				id:          "1",
+				contentType: MIMEApplicationMergePatchJSON,
+				body:        `{"description":null,"image":null}`,
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+			},
+			mock: func() {
+				mockRepository.EXPECT().PatchCake(gomock.Any(), 1, 0, m.CakePatch{Description: str(""), Image: str("")}).
+					Return(m.Cake{Id: 1, Title: "judul", Rating: 9}, nil)
+			},
+		},
+		{
+			name: "Success with plain json",
+			args: args{
+				method:      http.MethodPatch,
+				path:        "/cakes",
+				id:          "1",
+				contentType: echo.MIMEApplicationJSON,
+				body:        `{"description":"newdeskripsi"}`,
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+			},
+			mock: func() {
+				mockRepository.EXPECT().PatchCake(gomock.Any(), 1, 0, m.CakePatch{Description: str("newdeskripsi")}).
+					Return(m.Cake{Id: 1, Description: "newdeskripsi"}, nil)
+			},
+		},
+		{
+			name: "Success with form",
+			args: args{
+				method:      http.MethodPatch,
+				path:        "/cakes",
+				id:          "1",
+				contentType: echo.MIMEApplicationForm,
+				body:        "title=hello&rating=0",
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+			},
+			mock: func() {
+				mockRepository.EXPECT().PatchCake(gomock.Any(), 1, 0, m.CakePatch{Title: str("hello"), Rating: rating(0)}).
+					Return(m.Cake{Id: 1, Title: "hello"}, nil)
+			},
+		},
+		{
+			name: "id wrong format",
+			args: args{
+				method:      http.MethodPatch,
+				path:        "/cakes",
+				id:          "abc",
+				contentType: MIMEApplicationMergePatchJSON,
+				body:        `{"title":"newjudul"}`,
+			},
+			wants: wants{
+				statusCode: http.StatusBadRequest,
+			},
+			mock: func() {},
+		},
+		{
+			name: "title wrong format",
+			args: args{
+				method:      http.MethodPatch,
+				path:        "/cakes",
+				id:          "1",
+				contentType: MIMEApplicationMergePatchJSON,
+				body:        `{"title":"#"}`,
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+			},
+			mock: func() {},
+		},
+		{
+			name: "title null",
+			args: args{
+				method:      http.MethodPatch,
+				path:        "/cakes",
+				id:          "1",
+				contentType: MIMEApplicationMergePatchJSON,
+				body:        `{"title":null}`,
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+			},
+			mock: func() {},
+		},
+		{
+			name: "rating wrong type",
+			args: args{
+				method:      http.MethodPatch,
+				path:        "/cakes",
+				id:          "1",
+				contentType: MIMEApplicationMergePatchJSON,
+				body:        `{"rating":"abc"}`,
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+			},
+			mock: func() {},
+		},
+		{
+			name: "image wrong format",
+			args: args{
+				method:      http.MethodPatch,
+				path:        "/cakes",
+				id:          "1",
+				contentType: MIMEApplicationMergePatchJSON,
+				body:        `{"image":"httttps://img.taste.com.au/cake"}`,
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+			},
+			mock: func() {},
+		},
+		{
+			name: "rating out of range",
+			args: args{
+				method:      http.MethodPatch,
+				path:        "/cakes",
+				id:          "1",
+				contentType: MIMEApplicationMergePatchJSON,
+				body:        `{"rating":10.5}`,
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+			},
+			mock: func() {},
+		},
+		{
+			name: "unknown field",
+			args: args{
+				method:      http.MethodPatch,
+				path:        "/cakes",
+				id:          "1",
+				contentType: MIMEApplicationMergePatchJSON,
+				body:        `{"created_at":"2022-12-01T00:00:00Z"}`,
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+			},
+			mock: func() {},
+		},
+		{
+			name: "body not an object",
+			args: args{
+				method:      http.MethodPatch,
+				path:        "/cakes",
+				id:          "1",
+				contentType: MIMEApplicationMergePatchJSON,
+				body:        `[1,2]`,
+			},
+			wants: wants{
+				statusCode: http.StatusBadRequest,
+			},
+			mock: func() {},
 		},
 		{
-			name: "no limit",
+			name: "unsupported content type",
 			args: args{
-				method: http.MethodGet,
-				path:   "/cakes?offset=0",
+				method:      http.MethodPatch,
+				path:        "/cakes",
+				id:          "1",
+				contentType: echo.MIMETextPlain,
+				body:        "title=hello",
 			},
 			wants: wants{
-				statusCode: http.StatusOK,
-			},
-			mock: func() {
-				mockRepository.EXPECT().GetListOfCakes(gomock.Any(), 100, 0).Return([]m.Cake{
-					{Id: 1, Title: "title"},
-				}, nil)
+				statusCode: http.StatusUnsupportedMediaType,
 			},
+			mock: func() {},
 		},
 		{
-			name: "limit not integer",
+			name: "Not Found",
 			args: args{
-				method: http.MethodGet,
-				path:   "/cakes?limit=not_number&offset=0",
+				method:      http.MethodPatch,
+				path:        "/cakes",
+				id:          "1",
+				contentType: MIMEApplicationMergePatchJSON,
+				body:        `{"title":"newjudul"}`,
 			},
 			wants: wants{
-				statusCode: http.StatusBadRequest,
+				statusCode: http.StatusNotFound,
 			},
 			mock: func() {
-				return
+				mockRepository.EXPECT().PatchCake(gomock.Any(), 1, 0, m.CakePatch{Title: str("newjudul")}).
+					Return(m.Cake{}, repository.ErrNotFound)
 			},
 		},
 		{
-			name: "offset not integer",
+			name: "Internal Server Error",
 			args: args{
-				method: http.MethodGet,
-				path:   "/cakes?limit=100&offset=not_number",
+				method:      http.MethodPatch,
+				path:        "/cakes",
+				id:          "1",
+				contentType: MIMEApplicationMergePatchJSON,
+				body:        `{"title":"newjudul"}`,
 			},
 			wants: wants{
-				statusCode: http.StatusBadRequest,
+				statusCode: http.StatusInternalServerError,
 			},
 			mock: func() {
-				return
+				mockRepository.EXPECT().PatchCake(gomock.Any(), 1, 0, m.CakePatch{Title: str("newjudul")}).
+					Return(m.Cake{}, errors.New("internal server error"))
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			e := echo.New()
-			req := httptest.NewRequest(tt.args.method, tt.args.path, nil)
+			req := httptest.NewRequest(tt.args.method, tt.args.path, strings.NewReader(tt.args.body))
+			req.Header.Set(echo.HeaderContentType, tt.args.contentType)
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
 
+			c.SetPath("/:id")
+			c.SetParamNames("id")
+			c.SetParamValues(tt.args.id)
+
 			tt.mock()
 
 			h := &handler{
 				repository: mockRepository,
 			}
-			if err := h.GetListOfCakes(c); err != nil {
-				t.Errorf("handler.GetListOfCakes() error = %v", err)
+			if err := h.UpdateCake(c); err != nil {
+				HTTPErrorHandler(err, c)
 			}
 
 			assert.Equal(t, tt.wants.statusCode, rec.Code)
 		})
 	}
 }
-func Test_handler_GetDetailsOfCake(t *testing.T) {
+func Test_handler_ReplaceCake(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mockRepository := mock_repo.NewMockRepository(ctrl)
 
+	image := "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"
+
 	type args struct {
-		method string
-		path   string
-		id     string
+		id          string
+		contentType string
+		body        string
 	}
 	type wants struct {
 		statusCode int
@@ -187,24 +1184,36 @@ func Test_handler_GetDetailsOfCake(t *testing.T) {
 		{
 			name: "Success",
 			args: args{
-				method: http.MethodGet,
-				path:   "/cakes",
-				id:     "1",
+				id:          "1",
+				contentType: echo.MIMEApplicationJSON,
+				body:        `{"title":"judul","description":"deskripsi","rating":0,"image":"https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"}`,
 			},
 			wants: wants{
 				statusCode: http.StatusOK,
 			},
 			mock: func() {
-				mockRepository.EXPECT().GetDetailsOfCake(gomock.Any(), 1).
-					Return(m.Cake{Id: 1, Title: "title", Description: "description", Rating: 10, Image: "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"}, nil)
+				mockRepository.EXPECT().UpdateCake(gomock.Any(), m.Cake{Id: 1, Title: "judul", Description: "deskripsi", Rating: 0, Image: image}, 0).
+					Return(m.Cake{Id: 1, Title: "judul", Image: image}, nil)
 			},
 		},
 		{
-			name: "id not valid",
+			name: "Missing field",
 			args: args{
-				method: http.MethodGet,
-				path:   "/cakes",
-				id:     "abc",
+				id:          "1",
+				contentType: echo.MIMEApplicationJSON,
+				body:        `{"title":"judul","description":"deskripsi","image":"https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"}`,
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+			},
+			mock: func() {},
+		},
+		{
+			name: "id wrong format",
+			args: args{
+				id:          "abc",
+				contentType: echo.MIMEApplicationJSON,
+				body:        `{"title":"judul","description":"deskripsi","rating":9,"image":"https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"}`,
 			},
 			wants: wants{
 				statusCode: http.StatusBadRequest,
@@ -212,25 +1221,26 @@ func Test_handler_GetDetailsOfCake(t *testing.T) {
 			mock: func() {},
 		},
 		{
-			name: "repository error",
+			name: "Not Found",
 			args: args{
-				method: http.MethodGet,
-				path:   "/cakes",
-				id:     "1",
+				id:          "1",
+				contentType: echo.MIMEApplicationJSON,
+				body:        `{"title":"judul","description":"deskripsi","rating":9,"image":"https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"}`,
 			},
 			wants: wants{
-				statusCode: http.StatusInternalServerError,
+				statusCode: http.StatusNotFound,
 			},
 			mock: func() {
-				mockRepository.EXPECT().GetDetailsOfCake(gomock.Any(), 1).
-					Return(m.Cake{Id: 1, Title: "title", Description: "description", Rating: 10, Image: "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"}, errors.New("Repository Error"))
+				mockRepository.EXPECT().UpdateCake(gomock.Any(), m.Cake{Id: 1, Title: "judul", Description: "deskripsi", Rating: 9, Image: image}, 0).
+					Return(m.Cake{}, repository.ErrNotFound)
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			e := echo.New()
-			req := httptest.NewRequest("GET", "/", nil)
+			req := httptest.NewRequest(http.MethodPut, "/cakes", strings.NewReader(tt.args.body))
+			req.Header.Set(echo.HeaderContentType, tt.args.contentType)
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
 
@@ -243,21 +1253,23 @@ func Test_handler_GetDetailsOfCake(t *testing.T) {
 			h := &handler{
 				repository: mockRepository,
 			}
-			if err := h.GetDetailsOfCake(c); err != nil {
-				t.Errorf("handler.GetListOfCakes() error = %v", err)
+			if err := h.ReplaceCake(c); err != nil {
+				HTTPErrorHandler(err, c)
 			}
 
 			assert.Equal(t, tt.wants.statusCode, rec.Code)
 		})
 	}
 }
-func Test_handler_InsertCake(t *testing.T) {
+func Test_handler_DeleteCake(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mockRepository := mock_repo.NewMockRepository(ctrl)
 
 	type args struct {
-		method string
-		path   string
+		method  string
+		path    string
+		id      string
+		ifMatch string
 	}
 	type wants struct {
 		statusCode int
@@ -271,56 +1283,69 @@ func Test_handler_InsertCake(t *testing.T) {
 		{
 			name: "Success",
 			args: args{
-				method: http.MethodPost,
-				path:   "/cakes?title=judul&description=deskripsi&rating=9.8&image=https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
+				method: http.MethodDelete,
+				path:   "/cakes",
+				id:     "1",
 			},
 			wants: wants{
 				statusCode: http.StatusOK,
 			},
 			mock: func() {
-				mockRepository.EXPECT().InsertCake(gomock.Any(), m.Cake{}).Return(m.Cake{Id: 1, Title: "title"}, nil)
+				mockRepository.EXPECT().DeleteCake(gomock.Any(), 1, 0).
+					Return(nil)
 			},
 		},
 		{
-			name: "Repository error",
+			name: "Success With Matching ETag",
 			args: args{
-				method: http.MethodPost,
-				path:   "/cakes?title=judul&description=deskripsi&rating=9.8&image=https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
+				method:  http.MethodDelete,
+				path:    "/cakes",
+				id:      "1",
+				ifMatch: `"1-3"`,
 			},
 			wants: wants{
-				statusCode: http.StatusInternalServerError,
+				statusCode: http.StatusOK,
 			},
 			mock: func() {
-				mockRepository.EXPECT().InsertCake(gomock.Any(), m.Cake{}).Return(m.Cake{}, errors.New("repository error"))
+				mockRepository.EXPECT().DeleteCake(gomock.Any(), 1, 3).
+					Return(nil)
 			},
 		},
 		{
-			name: "Empty title",
+			name: "Stale ETag",
 			args: args{
-				method: http.MethodPost,
-				path:   "/cakes?title=&description=deskripsi&rating=9.8&image=https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
+				method:  http.MethodDelete,
+				path:    "/cakes",
+				id:      "1",
+				ifMatch: `"1-2"`,
 			},
 			wants: wants{
-				statusCode: http.StatusBadRequest,
+				statusCode: http.StatusPreconditionFailed,
+			},
+			mock: func() {
+				mockRepository.EXPECT().DeleteCake(gomock.Any(), 1, 2).
+					Return(apperror.ErrPreconditionFailed)
 			},
-			mock: func() {},
 		},
 		{
-			name: "Empty description",
+			name: "ETag Of Another Cake",
 			args: args{
-				method: http.MethodPost,
-				path:   "/cakes?title=judul&description=&rating=9.8&image=https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
+				method:  http.MethodDelete,
+				path:    "/cakes",
+				id:      "1",
+				ifMatch: `"2-3"`,
 			},
 			wants: wants{
-				statusCode: http.StatusBadRequest,
+				statusCode: http.StatusPreconditionFailed,
 			},
 			mock: func() {},
 		},
 		{
-			name: "Invalid rating",
+			name: "id wrong format",
 			args: args{
-				method: http.MethodPost,
-				path:   "/cakes?title=judul&description=deskripsi&rating=abc&image=https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
+				method: http.MethodDelete,
+				path:   "/cakes",
+				id:     "abc",
 			},
 			wants: wants{
 				statusCode: http.StatusBadRequest,
@@ -328,306 +1353,246 @@ func Test_handler_InsertCake(t *testing.T) {
 			mock: func() {},
 		},
 		{
-			name: "Invalid image",
+			name: "Internal Server Error",
 			args: args{
-				method: http.MethodPost,
-				path:   "/cakes?title=judul&description=deskripsi&rating=9.8&image=1234",
+				method: http.MethodDelete,
+				path:   "/cakes",
+				id:     "1",
 			},
 			wants: wants{
-				statusCode: http.StatusBadRequest,
+				statusCode: http.StatusInternalServerError,
+			},
+			mock: func() {
+				mockRepository.EXPECT().DeleteCake(gomock.Any(), 1, 0).
+					Return(errors.New("internal server error"))
 			},
-			mock: func() {},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			e := echo.New()
 			req := httptest.NewRequest(tt.args.method, tt.args.path, nil)
+			if tt.args.ifMatch != "" {
+				req.Header.Set(HeaderIfMatch, tt.args.ifMatch)
+			}
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
 
+			c.SetPath("/:id")
+			c.SetParamNames("id")
+			c.SetParamValues(tt.args.id)
+
 			tt.mock()
 
 			h := &handler{
 				repository: mockRepository,
 			}
-			if err := h.InsertCake(c); err != nil {
-				t.Errorf("handler.GetListOfCakes() error = %v", err)
+			if err := h.DeleteCake(c); err != nil {
+				HTTPErrorHandler(err, c)
 			}
 
 			assert.Equal(t, tt.wants.statusCode, rec.Code)
 		})
 	}
 }
-func Test_handler_UpdateCake(t *testing.T) {
+func Test_handler_GetTrash(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mockRepository := mock_repo.NewMockRepository(ctrl)
 
-	type args struct {
-		method string
-		path   string
-		id     string
-	}
 	type wants struct {
 		statusCode int
+		meta       *m.Meta
+	}
+	intp := func(n int) *int { return &n }
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	codec := cursorCodec{secret: secret}
+	deletedAt := time.Date(2022, 12, 9, 0, 0, 0, 0, time.UTC)
+	cakes := []m.Cake{
+		{Id: 3, Title: "a", DeletedAt: &deletedAt},
+		{Id: 1, Title: "b", DeletedAt: &deletedAt},
 	}
+	trashOrder := m.CakeQuery{CakeFilter: m.CakeFilter{Trashed: true}}.OrderBy()
 	tests := []struct {
 		name  string
-		args  args
+		path  string
 		wants wants
 		mock  func()
 	}{
 		{
-			name: "Success",
-			args: args{
-				method: http.MethodPatch,
-				path:   "/cakes?title=newjudul&description=newdeskripsi&rating=9.8&image=https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
-				id:     "1",
-			},
-			wants: wants{
-				statusCode: http.StatusOK,
-			},
-			mock: func() {
-				mockRepository.EXPECT().UpdateCake(
-					gomock.Any(), m.Cake{}).
-					Return(m.Cake{Id: 1, Title: "newjudul", Description: "newdeskripsi", Rating: 9.8, Image: "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"}, nil)
-			},
-		},
-		{
-			name: "Success with empty title",
-			args: args{
-				method: http.MethodPatch,
-				path:   "/cakes?title=&description=newdeskripsi&rating=9.8&image=https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
-				id:     "1",
-			},
-			wants: wants{
-				statusCode: http.StatusOK,
-			},
-			mock: func() {
-				mockRepository.EXPECT().UpdateCake(
-					gomock.Any(), m.Cake{}).
-					Return(m.Cake{Id: 1, Title: "newjudul", Description: "newdeskripsi", Rating: 9.8, Image: "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"}, nil)
-			},
-		},
-		{
-			name: "Success with empty description",
-			args: args{
-				method: http.MethodPatch,
-				path:   "/cakes?title=newjudul&description=&rating=9.8&image=https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
-				id:     "1",
-			},
-			wants: wants{
-				statusCode: http.StatusOK,
-			},
-			mock: func() {
-				mockRepository.EXPECT().UpdateCake(
-					gomock.Any(), m.Cake{}).
-					Return(m.Cake{Id: 1, Title: "newjudul", Description: "newdeskripsi", Rating: 9.8, Image: "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"}, nil)
-			},
-		},
-		{
-			name: "Success with empty rating",
-			args: args{
-				method: http.MethodPatch,
-				path:   "/cakes?title=hello&description=newdeskripsi&rating=&image=https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
-				id:     "1",
-			},
+			name: "Most Recently Deleted First",
+			path: "/cakes/trash?limit=1",
 			wants: wants{
 				statusCode: http.StatusOK,
+				meta:       &m.Meta{Total: intp(2), Limit: 1, Offset: intp(0), Next: intp(1), NextCursor: mustEncode(codec, trashOrder, cakes[0])},
 			},
 			mock: func() {
-				mockRepository.EXPECT().UpdateCake(
-					gomock.Any(), m.Cake{}).
-					Return(m.Cake{Id: 1, Title: "newjudul", Description: "newdeskripsi", Rating: 0, Image: "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"}, nil)
+				mockRepository.EXPECT().GetListOfCakes(gomock.Any(), m.CakeQuery{CakeFilter: m.CakeFilter{Trashed: true}, Limit: 2}).Return(cakes, nil)
+				mockRepository.EXPECT().SummarizeCakes(gomock.Any(), m.CakeFilter{Trashed: true}).Return(m.CakeSummary{Total: 2}, nil)
 			},
 		},
 		{
-			name: "Success with empty image",
-			args: args{
-				method: http.MethodPatch,
-				path:   "/cakes?title=hello&description=newdeskripsi&rating=&image=",
-				id:     "1",
-			},
+			name: "Cursor Resumes Trash",
+			path: "/cakes/trash?limit=1&cursor=" + mustEncode(codec, trashOrder, cakes[0]),
 			wants: wants{
 				statusCode: http.StatusOK,
+				meta:       &m.Meta{Limit: 1},
 			},
 			mock: func() {
-				mockRepository.EXPECT().UpdateCake(
-					gomock.Any(), m.Cake{}).
-					Return(m.Cake{Id: 1, Title: "newjudul", Description: "newdeskripsi", Rating: 0, Image: "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"}, nil)
-			},
-		},
-		{
-			name: "id wrong format",
-			args: args{
-				method: http.MethodPatch,
-				path:   "/cakes?title=newjudul&description=newdeskripsi&rating=9.8&image=https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
-				id:     "abc",
+				mockRepository.EXPECT().SummarizeCakes(gomock.Any(), gomock.Any()).Return(m.CakeSummary{Total: 3}, nil)
+				after := m.KeyOf(cakes[0])
+				mockRepository.EXPECT().GetListOfCakes(gomock.Any(), m.CakeQuery{CakeFilter: m.CakeFilter{Trashed: true}, Limit: 2, After: &after}).Return(cakes[1:], nil)
 			},
-			wants: wants{
-				statusCode: http.StatusBadRequest,
-			},
-			mock: func() {},
 		},
 		{
-			name: "title wrong format",
-			args: args{
-				method: http.MethodPatch,
-				path:   "/cakes?title=#&description=newdeskripsi&rating=9.8&image=https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
-				id:     "1",
-			},
+			name: "Live Cursor Rejected",
+			path: "/cakes/trash?cursor=" + mustEncode(codec, m.CakeQuery{}.OrderBy(), cakes[0]),
 			wants: wants{
 				statusCode: http.StatusBadRequest,
 			},
 			mock: func() {},
 		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			tt.mock()
+
+			h := New(mockRepository, WithCursorSecret(secret))
+			if err := h.GetTrash(c); err != nil {
+				HTTPErrorHandler(err, c)
+			}
+
+			assert.Equal(t, tt.wants.statusCode, rec.Code)
+			if tt.wants.meta != nil {
+				var res m.Response[[]m.Cake]
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatalf("can't decode response: %v", err)
+				}
+				assert.Equal(t, tt.wants.meta, res.Meta)
+			}
+		})
+	}
+}
+func Test_handler_RestoreCake(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+
+	tests := []struct {
+		name       string
+		id         string
+		statusCode int
+		mock       func()
+	}{
 		{
-			name: "rating wrong format",
-			args: args{
-				method: http.MethodPatch,
-				path:   "/cakes?title=newtitle&description=newdeskripsi&rating=abc&image=https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
-				id:     "1",
-			},
-			wants: wants{
-				statusCode: http.StatusBadRequest,
+			name:       "Success",
+			id:         "1",
+			statusCode: http.StatusOK,
+			mock: func() {
+				mockRepository.EXPECT().RestoreCake(gomock.Any(), 1).
+					Return(m.Cake{Id: 1, Title: "title"}, nil)
 			},
-			mock: func() {},
 		},
 		{
-			name: "image wrong format",
-			args: args{
-				method: http.MethodPatch,
-				path:   "/cakes?title=newtitle&description=newdeskripsi&rating=abc&image=httttps://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
-				id:     "1",
-			},
-			wants: wants{
-				statusCode: http.StatusBadRequest,
-			},
-			mock: func() {},
+			name:       "id wrong format",
+			id:         "abc",
+			statusCode: http.StatusBadRequest,
+			mock:       func() {},
 		},
 		{
-			name: "Internal Server Error",
-			args: args{
-				method: http.MethodPatch,
-				path:   "/cakes?title=newjudul&description=newdeskripsi&rating=9.8&image=https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
-				id:     "1",
-			},
-			wants: wants{
-				statusCode: http.StatusInternalServerError,
-			},
+			name:       "Not In Trash",
+			id:         "1",
+			statusCode: http.StatusNotFound,
 			mock: func() {
-				mockRepository.EXPECT().UpdateCake(
-					gomock.Any(), m.Cake{}).
-					Return(m.Cake{Id: 1, Title: "newjudul", Description: "newdeskripsi", Rating: 9.8, Image: "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"}, errors.New("internal server error"))
+				mockRepository.EXPECT().RestoreCake(gomock.Any(), 1).
+					Return(m.Cake{}, apperror.New(apperror.KindNotFound, "cake not found"))
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			e := echo.New()
-			req := httptest.NewRequest(tt.args.method, tt.args.path, nil)
+			req := httptest.NewRequest(http.MethodPost, "/cakes", nil)
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
 
-			c.SetPath("/:id")
+			c.SetPath("/:id/restore")
 			c.SetParamNames("id")
-			c.SetParamValues(tt.args.id)
+			c.SetParamValues(tt.id)
 
 			tt.mock()
 
 			h := &handler{
 				repository: mockRepository,
 			}
-			if err := h.UpdateCake(c); err != nil {
-				t.Errorf("handler.UpdateCake() error = %v", err)
+			if err := h.RestoreCake(c); err != nil {
+				HTTPErrorHandler(err, c)
 			}
 
-			assert.Equal(t, tt.wants.statusCode, rec.Code)
+			assert.Equal(t, tt.statusCode, rec.Code)
 		})
 	}
 }
-func Test_handler_DeleteCake(t *testing.T) {
+func Test_handler_PurgeCake(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mockRepository := mock_repo.NewMockRepository(ctrl)
 
-	type args struct {
-		method string
-		path   string
-		id     string
-	}
-	type wants struct {
-		statusCode int
-	}
 	tests := []struct {
-		name  string
-		args  args
-		wants wants
-		mock  func()
+		name       string
+		id         string
+		statusCode int
+		mock       func()
 	}{
 		{
-			name: "Success",
-			args: args{
-				method: http.MethodDelete,
-				path:   "/cakes",
-				id:     "1",
-			},
-			wants: wants{
-				statusCode: http.StatusOK,
-			},
+			name:       "Success",
+			id:         "1",
+			statusCode: http.StatusOK,
 			mock: func() {
-				mockRepository.EXPECT().DeleteCake(gomock.Any(), 1).
+				mockRepository.EXPECT().PurgeCake(gomock.Any(), 1).
 					Return(nil)
 			},
 		},
 		{
-			name: "id wrong format",
-			args: args{
-				method: http.MethodDelete,
-				path:   "/cakes",
-				id:     "abc",
-			},
-			wants: wants{
-				statusCode: http.StatusBadRequest,
-			},
-			mock: func() {},
+			name:       "id wrong format",
+			id:         "abc",
+			statusCode: http.StatusBadRequest,
+			mock:       func() {},
 		},
 		{
-			name: "Internal Server Error",
-			args: args{
-				method: http.MethodDelete,
-				path:   "/cakes",
-				id:     "1",
-			},
-			wants: wants{
-				statusCode: http.StatusInternalServerError,
-			},
+			name:       "Not In Trash",
+			id:         "1",
+			statusCode: http.StatusNotFound,
 			mock: func() {
-				mockRepository.EXPECT().DeleteCake(gomock.Any(), 1).
-					Return(errors.New("internal server error"))
+				mockRepository.EXPECT().PurgeCake(gomock.Any(), 1).
+					Return(apperror.New(apperror.KindNotFound, "cake not found"))
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			e := echo.New()
-			req := httptest.NewRequest(tt.args.method, tt.args.path, nil)
+			req := httptest.NewRequest(http.MethodDelete, "/cakes/trash", nil)
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
 
 			c.SetPath("/:id")
 			c.SetParamNames("id")
-			c.SetParamValues(tt.args.id)
+			c.SetParamValues(tt.id)
 
 			tt.mock()
 
 			h := &handler{
 				repository: mockRepository,
 			}
-			if err := h.DeleteCake(c); err != nil {
-				t.Errorf("handler.GetListOfCakes() error = %v", err)
+			if err := h.PurgeCake(c); err != nil {
+				HTTPErrorHandler(err, c)
 			}
 
-			assert.Equal(t, tt.wants.statusCode, rec.Code)
+			assert.Equal(t, tt.statusCode, rec.Code)
 		})
 	}
 }
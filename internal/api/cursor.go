@@ -0,0 +1,76 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	m "privy/models"
+	"strings"
+)
+
+var errInvalidCursor = errors.New("cursor is invalid")
+
+// cursorCodec turns the position of the last cake on a page into an opaque
+// token. Tokens are signed so that clients can't forge positions, and they
+// carry the sort order they were issued for since a position means nothing
+// under another order.
+type cursorCodec struct {
+	secret []byte
+}
+
+type cursorPayload struct {
+	Sort string    `json:"s"`
+	Key  m.CakeKey `json:"k"`
+}
+
+func (cc cursorCodec) encode(sort []m.SortField, key m.CakeKey) (string, error) {
+	payload, err := json.Marshal(cursorPayload{Sort: sortSpec(sort), Key: key})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(cc.sign(payload)), nil
+}
+
+// decode verifies token and returns the position it holds. It fails unless
+// token was issued by a codec with the same secret for the same order.
+func (cc cursorCodec) decode(token string, sort []m.SortField) (m.CakeKey, error) {
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return m.CakeKey{}, errInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return m.CakeKey{}, errInvalidCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, cc.sign(payload)) {
+		return m.CakeKey{}, errInvalidCursor
+	}
+
+	var cursor cursorPayload
+	if err := json.Unmarshal(payload, &cursor); err != nil || cursor.Sort != sortSpec(sort) {
+		return m.CakeKey{}, errInvalidCursor
+	}
+	return cursor.Key, nil
+}
+
+func (cc cursorCodec) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, cc.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// sortSpec writes sort back in the syntax of the sort query parameter.
+func sortSpec(sort []m.SortField) string {
+	fields := make([]string, len(sort))
+	for i, s := range sort {
+		if s.Desc {
+			fields[i] = "-" + s.Field
+		} else {
+			fields[i] = s.Field
+		}
+	}
+	return strings.Join(fields, ",")
+}
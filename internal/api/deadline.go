@@ -0,0 +1,52 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// connDeadlines is implemented by the writers of net/http connections
+// since Go 1.20, as used by http.ResponseController.
+type connDeadlines interface {
+	SetReadDeadline(deadline time.Time) error
+	SetWriteDeadline(deadline time.Time) error
+}
+
+// StreamDeadlines gives routes streaming a whole catalog timeout to read
+// their request and write their response, in place of the read and write
+// timeouts of the server. A timeout of 0 lifts both deadlines.
+func StreamDeadlines(timeout time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var deadline time.Time
+			if timeout > 0 {
+				deadline = time.Now().Add(timeout)
+			}
+			if err := setDeadlines(c.Response().Writer, deadline); err != nil {
+				log.Println("[Delivery][StreamDeadlines] can't extend deadlines, err:", err.Error())
+			}
+			return next(c)
+		}
+	}
+}
+
+// setDeadlines sets both deadlines of the connection under w, unwrapping
+// it like http.ResponseController does.
+func setDeadlines(w http.ResponseWriter, deadline time.Time) error {
+	for {
+		switch writer := w.(type) {
+		case connDeadlines:
+			if err := writer.SetReadDeadline(deadline); err != nil {
+				return err
+			}
+			return writer.SetWriteDeadline(deadline)
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = writer.Unwrap()
+		default:
+			return http.ErrNotSupported
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// deadlineWriter records the deadlines set on it.
+type deadlineWriter struct {
+	http.ResponseWriter
+	read, write time.Time
+}
+
+func (w *deadlineWriter) SetReadDeadline(deadline time.Time) error {
+	w.read = deadline
+	return nil
+}
+
+func (w *deadlineWriter) SetWriteDeadline(deadline time.Time) error {
+	w.write = deadline
+	return nil
+}
+
+// wrappedWriter hides the writer it wraps but for Unwrap.
+type wrappedWriter struct {
+	http.ResponseWriter
+}
+
+func (w wrappedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func Test_setDeadlines(t *testing.T) {
+	deadline := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	conn := &deadlineWriter{ResponseWriter: httptest.NewRecorder()}
+	err := setDeadlines(wrappedWriter{conn}, deadline)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, deadline, conn.read)
+	assert.Equal(t, deadline, conn.write)
+
+	err = setDeadlines(httptest.NewRecorder(), deadline)
+	assert.Equal(t, true, errors.Is(err, http.ErrNotSupported))
+}
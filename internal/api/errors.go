@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"privy/internal/apperror"
+	"privy/internal/validate"
+	m "privy/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// problemTypes identifies each error kind with a stable URI reference that
+// clients can switch on. Errors without a kind of their own are plain HTTP
+// errors and use about:blank.
+var problemTypes = map[apperror.Kind]string{
+	apperror.KindInternal:             "/problems/internal-error",
+	apperror.KindNotFound:             "/problems/not-found",
+	apperror.KindConflict:             "/problems/conflict",
+	apperror.KindValidation:           "/problems/validation-failed",
+	apperror.KindTimeout:              "/problems/timeout",
+	apperror.KindUnavailable:          "/problems/unavailable",
+	apperror.KindPreconditionFailed:   "/problems/precondition-failed",
+	apperror.KindPreconditionRequired: "/problems/precondition-required",
+}
+
+// HTTPErrorHandler renders every error returned by a handler, or raised by
+// Echo itself, as application/problem+json. Only the client-safe message
+// of an apperror reaches the response body; the underlying cause is logged.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	problem := problemOf(err)
+	problem.Instance = c.Request().URL.Path
+	problem.RequestID = c.Response().Header().Get(echo.HeaderXRequestID)
+	if problem.RequestID == "" {
+		problem.RequestID = c.Request().Header.Get(echo.HeaderXRequestID)
+	}
+
+	if problem.Status >= http.StatusInternalServerError {
+		log.Printf("[Delivery][HTTPErrorHandler] request %s failed, err: %s", problem.RequestID, err.Error())
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(problem.Status)
+	} else {
+		var body []byte
+		body, err = json.Marshal(problem)
+		if err == nil {
+			err = c.Blob(problem.Status, MIMEApplicationProblemJSON, body)
+		}
+	}
+	if err != nil {
+		log.Println("[Delivery][HTTPErrorHandler] can't write error response, err:", err.Error())
+	}
+}
+
+func problemOf(err error) m.Problem {
+	var (
+		httpErr   *echo.HTTPError
+		fieldErrs validate.Errors
+	)
+
+	if errors.As(err, &httpErr) {
+		return m.Problem{
+			Type:   "about:blank",
+			Title:  http.StatusText(httpErr.Code),
+			Status: httpErr.Code,
+			Detail: fmt.Sprint(httpErr.Message),
+		}
+	}
+
+	kind := apperror.KindOf(err)
+	status := statusOf(kind)
+	problem := m.Problem{
+		Type:   problemTypes[kind],
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: apperror.MessageOf(err),
+	}
+	if errors.As(err, &fieldErrs) {
+		problem.Errors = make([]m.FieldError, len(fieldErrs))
+		for i, e := range fieldErrs {
+			problem.Errors[i] = m.FieldError{Field: e.Field, Rule: e.Rule, Message: e.Message}
+		}
+	}
+	return problem
+}
+
+// statusOf maps an error kind onto the HTTP status reported for it.
+func statusOf(kind apperror.Kind) int {
+	switch kind {
+	case apperror.KindNotFound:
+		return http.StatusNotFound
+	case apperror.KindConflict:
+		return http.StatusConflict
+	case apperror.KindValidation:
+		return http.StatusUnprocessableEntity
+	case apperror.KindTimeout:
+		return http.StatusGatewayTimeout
+	case apperror.KindUnavailable:
+		return http.StatusServiceUnavailable
+	case apperror.KindPreconditionFailed:
+		return http.StatusPreconditionFailed
+	case apperror.KindPreconditionRequired:
+		return http.StatusPreconditionRequired
+	default:
+		return http.StatusInternalServerError
+	}
+}
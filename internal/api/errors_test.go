@@ -0,0 +1,115 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"privy/internal/apperror"
+	"privy/internal/validate"
+	m "privy/models"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/labstack/echo/v4"
+)
+
+func TestHTTPErrorHandler(t *testing.T) {
+	type wants struct {
+		statusCode  int
+		problemType string
+		detail      string
+		fields      []m.FieldError
+	}
+	tests := []struct {
+		name  string
+		err   error
+		wants wants
+	}{
+		{
+			name:  "not found",
+			err:   apperror.Wrap(apperror.KindNotFound, "cake not found", sql.ErrNoRows),
+			wants: wants{statusCode: http.StatusNotFound, problemType: "/problems/not-found", detail: "cake not found"},
+		},
+		{
+			name:  "conflict",
+			err:   apperror.Wrap(apperror.KindConflict, "cake already exists", errors.New("Error 1062: Duplicate entry '1' for key 'PRIMARY'")),
+			wants: wants{statusCode: http.StatusConflict, problemType: "/problems/conflict", detail: "cake already exists"},
+		},
+		{
+			name:  "validation",
+			err:   apperror.New(apperror.KindValidation, "cake has an invalid field value"),
+			wants: wants{statusCode: http.StatusUnprocessableEntity, problemType: "/problems/validation-failed", detail: "cake has an invalid field value"},
+		},
+		{
+			name:  "timeout",
+			err:   apperror.ErrTimeout,
+			wants: wants{statusCode: http.StatusGatewayTimeout, problemType: "/problems/timeout", detail: apperror.ErrTimeout.Message},
+		},
+		{
+			name:  "unavailable",
+			err:   apperror.ErrUnavailable,
+			wants: wants{statusCode: http.StatusServiceUnavailable, problemType: "/problems/unavailable", detail: apperror.ErrUnavailable.Message},
+		},
+		{
+			name:  "unknown error is not leaked",
+			err:   errors.New("dial tcp 10.0.0.1:3306: connect: connection refused"),
+			wants: wants{statusCode: http.StatusInternalServerError, problemType: "/problems/internal-error", detail: apperror.ErrInternal.Message},
+		},
+		{
+			name:  "echo http error",
+			err:   echo.NewHTTPError(http.StatusMethodNotAllowed, "method not allowed"),
+			wants: wants{statusCode: http.StatusMethodNotAllowed, problemType: "about:blank", detail: "method not allowed"},
+		},
+		{
+			name: "field errors",
+			err:  validate.Field("rating", "max", "must be at most 10"),
+			wants: wants{
+				statusCode:  http.StatusUnprocessableEntity,
+				problemType: "/problems/validation-failed",
+				detail:      apperror.ErrValidation.Message,
+				fields:      []m.FieldError{{Field: "rating", Rule: "max", Message: "must be at most 10"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/cakes/1?fields=title", nil)
+			req.Header.Set(echo.HeaderXRequestID, "req-1")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			HTTPErrorHandler(tt.err, c)
+
+			var problem m.Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("can't decode problem: %v", err)
+			}
+			assert.Equal(t, tt.wants.statusCode, rec.Code)
+			assert.Equal(t, MIMEApplicationProblemJSON, rec.Header().Get(echo.HeaderContentType))
+			assert.Equal(t, m.Problem{
+				Type:      tt.wants.problemType,
+				Title:     http.StatusText(tt.wants.statusCode),
+				Status:    tt.wants.statusCode,
+				Detail:    tt.wants.detail,
+				Instance:  "/cakes/1",
+				RequestID: "req-1",
+				Errors:    tt.wants.fields,
+			}, problem)
+		})
+	}
+}
+
+func TestHTTPErrorHandler_Head(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodHead, "/cakes/1", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	HTTPErrorHandler(apperror.ErrNotFound, c)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, 0, rec.Body.Len())
+}
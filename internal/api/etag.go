@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"privy/internal/apperror"
+	m "privy/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	HeaderETag        = "ETag"
+	HeaderIfMatch     = "If-Match"
+	HeaderIfNoneMatch = "If-None-Match"
+)
+
+// etagOf is the strong entity tag of a cake. The version changes with
+// every write, so the tag identifies one state of one cake.
+func etagOf(cake m.Cake) string {
+	return fmt.Sprintf(`"%d-%d"`, cake.Id, cake.Version)
+}
+
+// listETagOf is the weak entity tag of a page of cakes. Any write to a
+// matching cake, or one joining or leaving them, changes the summary, and
+// the hashed path and query tell apart pages of the same cakes.
+func listETagOf(c echo.Context, summary m.CakeSummary) string {
+	h := fnv.New64a()
+	h.Write([]byte(c.Request().URL.Path + "?" + c.QueryParams().Encode()))
+	return fmt.Sprintf(`W/"%d-%d-%d-%x"`, summary.Total, summary.LastModified.Unix(), summary.Versions, h.Sum64())
+}
+
+// setETag advertises the state of cake that a response carries.
+func setETag(c echo.Context, cake m.Cake) {
+	c.Response().Header().Set(HeaderETag, etagOf(cake))
+}
+
+// setLastModified sends t, unless it is unknown.
+func setLastModified(c echo.Context, t time.Time) {
+	if !t.IsZero() {
+		c.Response().Header().Set(echo.HeaderLastModified, t.UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified tells whether the client already holds the representation
+// tagged etag and last changed at lastModified. If-None-Match wins over
+// If-Modified-Since, as RFC 7232 asks, and compares weakly.
+func notModified(c echo.Context, etag string, lastModified time.Time) bool {
+	header := c.Request().Header
+	if tags := header.Get(HeaderIfNoneMatch); tags != "" {
+		if strings.TrimSpace(tags) == "*" {
+			return true
+		}
+		for _, tag := range strings.Split(tags, ",") {
+			if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(header.Get(echo.HeaderIfModifiedSince))
+	if err != nil || lastModified.IsZero() {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// ifMatch reads the If-Match precondition of a write to the cake with id
+// and returns the version the cake has to be at, or 0 when any version
+// will do. A tag of another cake, or a weak one, can never match, since
+// If-Match uses the strong comparison.
+func (h *handler) ifMatch(c echo.Context, id int) (int, error) {
+	header := strings.TrimSpace(c.Request().Header.Get(HeaderIfMatch))
+	if header == "" {
+		if h.requirePreconditions {
+			return 0, apperror.New(apperror.KindPreconditionRequired, "If-Match with the ETag of the cake is required")
+		}
+		return 0, nil
+	}
+	if header == "*" {
+		return 0, nil
+	}
+	if strings.Contains(header, ",") {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "If-Match takes a single ETag")
+	}
+
+	mismatch := apperror.New(apperror.KindPreconditionFailed, "cake has been changed since it was read")
+	if len(header) < 2 || !strings.HasPrefix(header, `"`) || !strings.HasSuffix(header, `"`) {
+		return 0, mismatch
+	}
+	tagID, tagVersion, ok := strings.Cut(header[1:len(header)-1], "-")
+	if !ok || tagID != strconv.Itoa(id) {
+		return 0, mismatch
+	}
+	version, err := strconv.Atoi(tagVersion)
+	if err != nil || version < 1 {
+		return 0, mismatch
+	}
+	return version, nil
+}
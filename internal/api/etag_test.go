@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/labstack/echo/v4"
+)
+
+func Test_handler_ifMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		required   bool
+		version    int
+		statusCode int
+	}{
+		{name: "Matching Tag", header: `"1-3"`, version: 3},
+		{name: "Any Version", header: "*", required: true},
+		{name: "No Header", version: 0},
+		{name: "Required", required: true, statusCode: http.StatusPreconditionRequired},
+		{name: "Other Cake", header: `"2-3"`, statusCode: http.StatusPreconditionFailed},
+		{name: "Weak Tag", header: `W/"1-3"`, statusCode: http.StatusPreconditionFailed},
+		{name: "Unquoted Tag", header: "1-3", statusCode: http.StatusPreconditionFailed},
+		{name: "Bad Version", header: `"1-0"`, statusCode: http.StatusPreconditionFailed},
+		{name: "Several Tags", header: `"1-3", "1-4"`, statusCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodDelete, "/cakes/1", nil)
+			if tt.header != "" {
+				req.Header.Set(HeaderIfMatch, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			h := &handler{requirePreconditions: tt.required}
+			version, err := h.ifMatch(c, 1)
+			if err != nil {
+				HTTPErrorHandler(err, c)
+				assert.Equal(t, tt.statusCode, rec.Code)
+				return
+			}
+			assert.Equal(t, 0, tt.statusCode)
+			assert.Equal(t, tt.version, version)
+		})
+	}
+}
+
+func Test_notModified(t *testing.T) {
+	lastModified := time.Date(2022, 12, 8, 10, 40, 2, 500, time.UTC)
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   bool
+	}{
+		{name: "No Condition"},
+		{name: "Matching Tag", header: map[string]string{HeaderIfNoneMatch: `"1-3"`}, want: true},
+		{name: "Weak Match", header: map[string]string{HeaderIfNoneMatch: `W/"1-3"`}, want: true},
+		{name: "One Of Several", header: map[string]string{HeaderIfNoneMatch: `"1-2", "1-3"`}, want: true},
+		{name: "Any", header: map[string]string{HeaderIfNoneMatch: "*"}, want: true},
+		{name: "Stale Tag", header: map[string]string{HeaderIfNoneMatch: `"1-2"`}},
+		{name: "Same Second", header: map[string]string{echo.HeaderIfModifiedSince: "Thu, 08 Dec 2022 10:40:02 GMT"}, want: true},
+		{name: "Modified Since", header: map[string]string{echo.HeaderIfModifiedSince: "Thu, 08 Dec 2022 10:40:01 GMT"}},
+		{name: "Bad Date", header: map[string]string{echo.HeaderIfModifiedSince: "yesterday"}},
+		{
+			name:   "Tag Wins Over Date",
+			header: map[string]string{HeaderIfNoneMatch: `"1-2"`, echo.HeaderIfModifiedSince: "Thu, 08 Dec 2022 10:40:02 GMT"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/cakes/1", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			c := e.NewContext(req, httptest.NewRecorder())
+
+			assert.Equal(t, tt.want, notModified(c, `"1-3"`, lastModified))
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"privy/internal/validate"
+	m "privy/models"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	MIMETextCSV           = "text/csv"
+	MIMEApplicationNDJSON = "application/x-ndjson"
+)
+
+// exportFlushRows is how many cakes an export writes between flushes, so
+// clients see it progress.
+const exportFlushRows = 500
+
+// exportTypes maps the formats of GET /cakes/export onto the content type
+// each is sent as.
+var exportTypes = map[string]string{
+	"csv":    MIMETextCSV + "; charset=utf-8",
+	"ndjson": MIMEApplicationNDJSON,
+	"json":   echo.MIMEApplicationJSONCharsetUTF8,
+}
+
+// csvColumns are the columns of an exported CSV. Imports read id and the
+// writable fields and skip the others, so an export can be imported back.
+var csvColumns = []string{"id", "title", "description", "rating", "image", "version", "created_at", "updated_at"}
+
+// ExportCakes streams every live cake as CSV, NDJSON or a JSON array, by
+// id. Cakes are written as they are read; nothing holds the whole catalog.
+func (h *handler) ExportCakes(c echo.Context) (err error) {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "json"
+	}
+	contentType, ok := exportTypes[format]
+	if !ok {
+		return validate.Field("format", "oneof", "must be csv, ndjson or json")
+	}
+
+	res := c.Response()
+	out := bufio.NewWriter(res)
+	enc := newCakeEncoder(format, out)
+	rows := 0
+	start := func() error {
+		res.Header().Set(echo.HeaderContentType, contentType)
+		res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="cakes.`+format+`"`)
+		res.WriteHeader(http.StatusOK)
+		return enc.begin()
+	}
+
+	err = h.repository.ExportCakes(c.Request().Context(), func(cake m.Cake) error {
+		if rows == 0 {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := enc.encode(cake); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushRows == 0 {
+			if err := out.Flush(); err != nil {
+				return err
+			}
+			res.Flush()
+		}
+		return nil
+	})
+	if err == nil && rows == 0 {
+		err = start()
+	}
+	if err == nil {
+		err = enc.end()
+	}
+	if err == nil {
+		err = out.Flush()
+	}
+	if err != nil {
+		if !res.Committed {
+			log.Println("[Delivery][ExportCakes] can't export cakes, err:", err.Error())
+			return err
+		}
+		// The status is gone already. Dropping the connection is the only
+		// way left to keep a cut export from passing for a complete one.
+		log.Printf("[Delivery][ExportCakes] export broke off after %d cakes, err: %s", rows, err.Error())
+		panic(http.ErrAbortHandler)
+	}
+	return nil
+}
+
+// cakeEncoder writes the cakes of an export one at a time.
+type cakeEncoder interface {
+	begin() error
+	encode(cake m.Cake) error
+	end() error
+}
+
+func newCakeEncoder(format string, w io.Writer) cakeEncoder {
+	switch format {
+	case "csv":
+		return &csvEncoder{w: csv.NewWriter(w)}
+	case "ndjson":
+		return &ndjsonEncoder{enc: json.NewEncoder(w)}
+	default:
+		return &jsonEncoder{w: w}
+	}
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) begin() error {
+	return e.w.Write(csvColumns)
+}
+
+func (e *csvEncoder) encode(cake m.Cake) error {
+	return e.w.Write([]string{
+		strconv.Itoa(cake.Id),
+		cake.Title,
+		cake.Description,
+		strconv.FormatFloat(float64(cake.Rating), 'f', -1, 32),
+		cake.Image,
+		strconv.Itoa(cake.Version),
+		cake.CreatedAt.UTC().Format(time.RFC3339),
+		cake.UpdatedAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func (e *csvEncoder) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) begin() error { return nil }
+
+func (e *ndjsonEncoder) encode(cake m.Cake) error {
+	return e.enc.Encode(cake)
+}
+
+func (e *ndjsonEncoder) end() error { return nil }
+
+type jsonEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonEncoder) begin() error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonEncoder) encode(cake m.Cake) error {
+	if e.count > 0 {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+	raw, err := json.Marshal(cake)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(raw)
+	return err
+}
+
+func (e *jsonEncoder) end() error {
+	_, err := io.WriteString(e.w, "]\n")
+	return err
+}
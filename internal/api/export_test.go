@@ -0,0 +1,145 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	mock_repo "privy/mock/repository"
+	m "privy/models"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+)
+
+func Test_handler_ExportCakes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+
+	at := time.Date(2022, 12, 1, 20, 29, 0, 0, time.UTC)
+	cakes := []m.Cake{
+		{Id: 1, Title: "judul", Description: "deskripsi, \"lembut\"", Rating: 9.8, Image: "https://www.abc.com/abc.jpeg", Version: 1, CreatedAt: at, UpdatedAt: at},
+		{Id: 2, Title: "kedua", Rating: 7, Version: 3, CreatedAt: at, UpdatedAt: at},
+	}
+	export := func(cakes []m.Cake, err error) func() {
+		return func() {
+			mockRepository.EXPECT().ExportCakes(gomock.Any(), gomock.Any()).DoAndReturn(func(_ interface{}, fn func(m.Cake) error) error {
+				for _, cake := range cakes {
+					if err := fn(cake); err != nil {
+						return err
+					}
+				}
+				return err
+			})
+		}
+	}
+
+	tests := []struct {
+		name        string
+		format      string
+		statusCode  int
+		contentType string
+		body        string
+		mock        func()
+	}{
+		{
+			name:        "CSV",
+			format:      "csv",
+			statusCode:  http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			body: "id,title,description,rating,image,version,created_at,updated_at\n" +
+				"1,judul,\"deskripsi, \"\"lembut\"\"\",9.8,https://www.abc.com/abc.jpeg,1,2022-12-01T20:29:00Z,2022-12-01T20:29:00Z\n" +
+				"2,kedua,,7,,3,2022-12-01T20:29:00Z,2022-12-01T20:29:00Z\n",
+			mock: export(cakes, nil),
+		},
+		{
+			name:        "NDJSON",
+			format:      "ndjson",
+			statusCode:  http.StatusOK,
+			contentType: MIMEApplicationNDJSON,
+			body: `{"id":1,"title":"judul","description":"deskripsi, \"lembut\"","rating":9.8,"image":"https://www.abc.com/abc.jpeg","version":1,"created_at":"2022-12-01T20:29:00Z","updated_at":"2022-12-01T20:29:00Z"}` + "\n" +
+				`{"id":2,"title":"kedua","description":"","rating":7,"image":"","version":3,"created_at":"2022-12-01T20:29:00Z","updated_at":"2022-12-01T20:29:00Z"}` + "\n",
+			mock: export(cakes, nil),
+		},
+		{
+			name:        "JSON by default",
+			statusCode:  http.StatusOK,
+			contentType: echo.MIMEApplicationJSONCharsetUTF8,
+			body:        `[{"id":2,"title":"kedua","description":"","rating":7,"image":"","version":3,"created_at":"2022-12-01T20:29:00Z","updated_at":"2022-12-01T20:29:00Z"}]` + "\n",
+			mock:        export(cakes[1:], nil),
+		},
+		{
+			name:        "Empty catalog",
+			format:      "csv",
+			statusCode:  http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			body:        "id,title,description,rating,image,version,created_at,updated_at\n",
+			mock:        export(nil, nil),
+		},
+		{
+			name:        "Repository error before the first cake",
+			format:      "ndjson",
+			statusCode:  http.StatusInternalServerError,
+			contentType: MIMEApplicationProblemJSON,
+			mock:        export(nil, errors.New("repository error")),
+		},
+		{
+			name:        "Unknown format",
+			format:      "xlsx",
+			statusCode:  http.StatusUnprocessableEntity,
+			contentType: MIMEApplicationProblemJSON,
+			mock:        func() {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/cakes/export?format="+tt.format, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			tt.mock()
+
+			h := &handler{
+				repository: mockRepository,
+			}
+			if err := h.ExportCakes(c); err != nil {
+				HTTPErrorHandler(err, c)
+			}
+
+			assert.Equal(t, tt.statusCode, rec.Code)
+			assert.Equal(t, tt.contentType, rec.Header().Get(echo.HeaderContentType))
+			if tt.body != "" {
+				assert.Equal(t, tt.body, rec.Body.String())
+			}
+		})
+	}
+}
+
+func Test_handler_ExportCakes_abortsCutExport(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+	mockRepository.EXPECT().ExportCakes(gomock.Any(), gomock.Any()).DoAndReturn(func(_ interface{}, fn func(m.Cake) error) error {
+		if err := fn(m.Cake{Id: 1}); err != nil {
+			return err
+		}
+		return errors.New("connection lost")
+	})
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/cakes/export?format=ndjson", nil), rec)
+	h := &handler{
+		repository: mockRepository,
+	}
+
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Errorf("ExportCakes() panicked with %v, want http.ErrAbortHandler", r)
+		}
+	}()
+	_ = h.ExportCakes(c)
+	t.Error("ExportCakes() returned after the export broke off")
+}
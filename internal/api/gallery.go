@@ -0,0 +1,257 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"privy/internal/storage"
+	"privy/internal/validate"
+	m "privy/models"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetCakeImages lists the gallery of a cake in display order. The ETag is
+// the one of the cake, which every gallery write bumps.
+func (h *handler) GetCakeImages(c echo.Context) (err error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if c.Param("id") == "" || err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "id must be an integer and can't be empty")
+	}
+
+	cake, images, err := h.repository.GetCakeImages(c.Request().Context(), id)
+	if err != nil {
+		log.Println("[Delivery][GetCakeImages] can't get images of cake, err:", err.Error())
+		return err
+	}
+	setETag(c, cake)
+	if notModified(c, etagOf(cake), cake.UpdatedAt) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	res := m.SetResponse(http.StatusOK, "success", images)
+	return c.JSON(http.StatusOK, res)
+}
+
+// AddCakeImage adds an image to the gallery of a cake: a link in a JSON
+// body, or an upload in a multipart one with the same fields as form
+// values.
+func (h *handler) AddCakeImage(c echo.Context) (err error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if c.Param("id") == "" || err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "id must be an integer and can't be empty")
+	}
+
+	version, err := h.ifMatch(c, id)
+	if err != nil {
+		return err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType == echo.MIMEMultipartForm {
+		return h.addUploadedImage(c, id, version)
+	}
+
+	var req CakeImageRequest
+	if err = decodeJSON(c, &req, "body must be a JSON object with url, alt, position and primary"); err != nil {
+		return err
+	}
+	if err = validate.Struct(req); err != nil {
+		return err
+	}
+
+	cake, images, err := h.repository.AddCakeImage(c.Request().Context(), id, version, req.Image())
+	if err != nil {
+		log.Println("[Delivery][AddCakeImage] can't add image, err:", err.Error())
+		return err
+	}
+	return h.galleryResponse(c, cake, images)
+}
+
+// addUploadedImage stores the image of a multipart upload and adds it to
+// the gallery. The upload is deleted again when it can't be added.
+func (h *handler) addUploadedImage(c echo.Context, id, version int) error {
+	if h.images == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "image uploads are disabled")
+	}
+
+	ctx := c.Request().Context()
+	key, link, err := h.storeUpload(c)
+	if err != nil {
+		return err
+	}
+
+	req, err := parseImageForm(c, link)
+	if err == nil {
+		err = validate.Struct(req)
+	}
+	if err != nil {
+		h.deleteUpload(ctx, key)
+		return err
+	}
+
+	cake, images, err := h.repository.AddCakeImage(ctx, id, version, req.Image())
+	if err != nil {
+		log.Println("[Delivery][AddCakeImage] can't add uploaded image, err:", err.Error())
+		h.deleteUpload(ctx, key)
+		return err
+	}
+	return h.galleryResponse(c, cake, images)
+}
+
+// ReorderCakeImages puts the gallery of a cake in the order of the image
+// ids it is sent, which must list every image once.
+func (h *handler) ReorderCakeImages(c echo.Context) (err error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if c.Param("id") == "" || err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "id must be an integer and can't be empty")
+	}
+
+	version, err := h.ifMatch(c, id)
+	if err != nil {
+		return err
+	}
+
+	var req CakeImageOrderRequest
+	if err = decodeJSON(c, &req, "body must be a JSON object with order"); err != nil {
+		return err
+	}
+	if err = validate.Struct(req); err != nil {
+		return err
+	}
+
+	cake, images, err := h.repository.ReorderCakeImages(c.Request().Context(), id, version, req.Order)
+	if err != nil {
+		log.Println("[Delivery][ReorderCakeImages] can't reorder images, err:", err.Error())
+		return err
+	}
+	return h.galleryResponse(c, cake, images)
+}
+
+// UpdateCakeImage changes the alt text of an image or makes it the primary
+// image, and so the image, of the cake.
+func (h *handler) UpdateCakeImage(c echo.Context) (err error) {
+	id, imageID, err := galleryParams(c)
+	if err != nil {
+		return err
+	}
+
+	version, err := h.ifMatch(c, id)
+	if err != nil {
+		return err
+	}
+
+	var req CakeImagePatchRequest
+	if err = decodeJSON(c, &req, "body must be a JSON object with alt and primary"); err != nil {
+		return err
+	}
+	if err = validate.Struct(req); err != nil {
+		return err
+	}
+
+	cake, images, err := h.repository.UpdateCakeImage(c.Request().Context(), id, version, imageID, req.Patch())
+	if err != nil {
+		log.Println("[Delivery][UpdateCakeImage] can't update image, err:", err.Error())
+		return err
+	}
+	return h.galleryResponse(c, cake, images)
+}
+
+// DeleteCakeImage takes an image out of the gallery of a cake. Stored
+// uploads are kept, since revisions may still link to them.
+func (h *handler) DeleteCakeImage(c echo.Context) (err error) {
+	id, imageID, err := galleryParams(c)
+	if err != nil {
+		return err
+	}
+
+	version, err := h.ifMatch(c, id)
+	if err != nil {
+		return err
+	}
+
+	cake, images, err := h.repository.DeleteCakeImage(c.Request().Context(), id, version, imageID)
+	if err != nil {
+		log.Println("[Delivery][DeleteCakeImage] can't delete image, err:", err.Error())
+		return err
+	}
+	return h.galleryResponse(c, cake, images)
+}
+
+// galleryResponse answers a gallery write with the gallery and the new
+// ETag of the cake. When the primary image is an upload without variants,
+// as after it was added or promoted, they are queued.
+func (h *handler) galleryResponse(c echo.Context, cake m.Cake, images []m.CakeImage) error {
+	setETag(c, cake)
+	if key, ok := h.uploadKey(cake.Image); ok && cake.Images == nil {
+		h.queueVariants(cake.Id, key, cake.Image)
+	}
+
+	res := m.SetResponse(http.StatusOK, "success", images)
+	return c.JSON(http.StatusOK, res)
+}
+
+// uploadKey returns the key of the stored upload link points at, if any.
+func (h *handler) uploadKey(link string) (string, bool) {
+	if h.images == nil || link == "" {
+		return "", false
+	}
+	prefix := h.imageURL("")
+	if !strings.HasPrefix(link, prefix) {
+		return "", false
+	}
+	key := strings.TrimPrefix(link, prefix)
+	return key, storage.ValidKey(key)
+}
+
+func galleryParams(c echo.Context) (id, imageID int, err error) {
+	id, err = strconv.Atoi(c.Param("id"))
+	if c.Param("id") == "" || err != nil {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "id must be an integer and can't be empty")
+	}
+	imageID, err = strconv.Atoi(c.Param("image_id"))
+	if c.Param("image_id") == "" || err != nil {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "image_id must be an integer and can't be empty")
+	}
+	return id, imageID, nil
+}
+
+// parseImageForm reads the fields of an uploaded gallery image, shown as
+// link, from the multipart form storeUpload parsed.
+func parseImageForm(c echo.Context, link string) (CakeImageRequest, error) {
+	req := CakeImageRequest{URL: &link, Alt: c.FormValue("alt")}
+	if value := c.FormValue("position"); value != "" {
+		position, err := strconv.Atoi(value)
+		if err != nil {
+			return CakeImageRequest{}, validate.Field("position", "type", "must be an integer")
+		}
+		req.Position = position
+	}
+	if value := c.FormValue("primary"); value != "" {
+		primary, err := strconv.ParseBool(value)
+		if err != nil {
+			return CakeImageRequest{}, validate.Field("primary", "type", "must be true or false")
+		}
+		req.Primary = primary
+	}
+	return req, nil
+}
+
+// decodeJSON decodes a JSON body into v, rejecting unknown members. shape
+// describes the expected body when it doesn't decode.
+func decodeJSON(c echo.Context, v interface{}, shape string) error {
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != echo.MIMEApplicationJSON {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "content type must be "+echo.MIMEApplicationJSON)
+	}
+
+	decoder := json.NewDecoder(c.Request().Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, shape)
+	}
+	return nil
+}
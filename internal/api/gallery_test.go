@@ -0,0 +1,325 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"privy/internal/apperror"
+	"privy/internal/storage"
+	mock_repo "privy/mock/repository"
+	m "privy/models"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+)
+
+const galleryImage = "https://www.abc.com/a.png"
+
+func Test_handler_gallery(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+
+	gallery := []m.CakeImage{{Id: 1, CakeId: 1, URL: galleryImage, Position: 1, Primary: true}}
+	cake := m.Cake{Id: 1, Image: galleryImage, Version: 4}
+
+	type args struct {
+		method   string
+		params   []string
+		body     string
+		ifMatch  string
+		serve    func(h *handler, c echo.Context) error
+		jsonType bool
+	}
+	type wants struct {
+		statusCode int
+		fields     []string
+		etag       string
+	}
+	tests := []struct {
+		name  string
+		args  args
+		wants wants
+		mock  func()
+	}{
+		{
+			name: "List",
+			args: args{method: http.MethodGet, params: []string{"1"}, serve: (*handler).GetCakeImages},
+			wants: wants{
+				statusCode: http.StatusOK,
+				etag:       `"1-4"`,
+			},
+			mock: func() {
+				mockRepository.EXPECT().GetCakeImages(gomock.Any(), 1).Return(cake, gallery, nil)
+			},
+		},
+		{
+			name: "Add Link",
+			args: args{
+				method: http.MethodPost, params: []string{"1"}, ifMatch: `"1-3"`, jsonType: true,
+				body:  `{"url":"` + galleryImage + `","alt":"a lemon cheesecake","position":2,"primary":true}`,
+				serve: (*handler).AddCakeImage,
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+				etag:       `"1-4"`,
+			},
+			mock: func() {
+				image := m.CakeImage{URL: galleryImage, Alt: "a lemon cheesecake", Position: 2, Primary: true}
+				mockRepository.EXPECT().AddCakeImage(gomock.Any(), 1, 3, image).Return(cake, gallery, nil)
+			},
+		},
+		{
+			name: "Add Invalid Link",
+			args: args{
+				method: http.MethodPost, params: []string{"1"}, jsonType: true,
+				body:  `{"url":"ftp://www.abc.com/a.png","position":-1}`,
+				serve: (*handler).AddCakeImage,
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+				fields:     []string{"url", "position"},
+			},
+			mock: func() {},
+		},
+		{
+			name: "Add Unknown Member",
+			args: args{
+				method: http.MethodPost, params: []string{"1"}, jsonType: true,
+				body:  `{"url":"` + galleryImage + `","caption":"cake"}`,
+				serve: (*handler).AddCakeImage,
+			},
+			wants: wants{
+				statusCode: http.StatusBadRequest,
+			},
+			mock: func() {},
+		},
+		{
+			name: "Add Without JSON",
+			args: args{
+				method: http.MethodPost, params: []string{"1"},
+				body:  `url=` + galleryImage,
+				serve: (*handler).AddCakeImage,
+			},
+			wants: wants{
+				statusCode: http.StatusUnsupportedMediaType,
+			},
+			mock: func() {},
+		},
+		{
+			name: "Reorder",
+			args: args{
+				method: http.MethodPut, params: []string{"1"}, jsonType: true, ifMatch: `"1-3"`,
+				body:  `{"order":[2,1]}`,
+				serve: (*handler).ReorderCakeImages,
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+				etag:       `"1-4"`,
+			},
+			mock: func() {
+				mockRepository.EXPECT().ReorderCakeImages(gomock.Any(), 1, 3, []int{2, 1}).Return(cake, gallery, nil)
+			},
+		},
+		{
+			name: "Reorder Without Order",
+			args: args{
+				method: http.MethodPut, params: []string{"1"}, jsonType: true,
+				body:  `{}`,
+				serve: (*handler).ReorderCakeImages,
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+				fields:     []string{"order"},
+			},
+			mock: func() {},
+		},
+		{
+			name: "Reorder Stale",
+			args: args{
+				method: http.MethodPut, params: []string{"1"}, jsonType: true, ifMatch: `"1-2"`,
+				body:  `{"order":[1]}`,
+				serve: (*handler).ReorderCakeImages,
+			},
+			wants: wants{
+				statusCode: http.StatusPreconditionFailed,
+			},
+			mock: func() {
+				mockRepository.EXPECT().ReorderCakeImages(gomock.Any(), 1, 2, []int{1}).Return(m.Cake{}, nil, apperror.ErrPreconditionFailed)
+			},
+		},
+		{
+			name: "Set Primary",
+			args: args{
+				method: http.MethodPatch, params: []string{"1", "2"}, jsonType: true,
+				body:  `{"alt":"","primary":true}`,
+				serve: (*handler).UpdateCakeImage,
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+				etag:       `"1-4"`,
+			},
+			mock: func() {
+				alt := ""
+				mockRepository.EXPECT().UpdateCakeImage(gomock.Any(), 1, 0, 2, m.CakeImagePatch{Alt: &alt, Primary: true}).Return(cake, gallery, nil)
+			},
+		},
+		{
+			name: "Update Alt Too Long",
+			args: args{
+				method: http.MethodPatch, params: []string{"1", "2"}, jsonType: true,
+				body:  `{"alt":"` + strings.Repeat("a", 256) + `"}`,
+				serve: (*handler).UpdateCakeImage,
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+				fields:     []string{"alt"},
+			},
+			mock: func() {},
+		},
+		{
+			name: "Update Invalid Image Id",
+			args: args{
+				method: http.MethodPatch, params: []string{"1", "x"}, jsonType: true,
+				body:  `{"primary":true}`,
+				serve: (*handler).UpdateCakeImage,
+			},
+			wants: wants{
+				statusCode: http.StatusBadRequest,
+			},
+			mock: func() {},
+		},
+		{
+			name: "Delete",
+			args: args{method: http.MethodDelete, params: []string{"1", "2"}, ifMatch: `"1-3"`, serve: (*handler).DeleteCakeImage},
+			wants: wants{
+				statusCode: http.StatusOK,
+				etag:       `"1-4"`,
+			},
+			mock: func() {
+				mockRepository.EXPECT().DeleteCakeImage(gomock.Any(), 1, 3, 2).Return(cake, gallery, nil)
+			},
+		},
+		{
+			name: "Delete Missing Image",
+			args: args{method: http.MethodDelete, params: []string{"1", "9"}, serve: (*handler).DeleteCakeImage},
+			wants: wants{
+				statusCode: http.StatusNotFound,
+			},
+			mock: func() {
+				mockRepository.EXPECT().DeleteCakeImage(gomock.Any(), 1, 0, 9).Return(m.Cake{}, nil, apperror.New(apperror.KindNotFound, "image not found"))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(tt.args.method, "/", strings.NewReader(tt.args.body))
+			if tt.args.jsonType {
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			} else if tt.args.body != "" {
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+			}
+			if tt.args.ifMatch != "" {
+				req.Header.Set(HeaderIfMatch, tt.args.ifMatch)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id", "image_id")
+			c.SetParamValues(tt.args.params...)
+
+			tt.mock()
+
+			h := &handler{repository: mockRepository}
+			if err := tt.args.serve(h, c); err != nil {
+				HTTPErrorHandler(err, c)
+			}
+
+			assert.Equal(t, tt.wants.statusCode, rec.Code)
+			assert.Equal(t, tt.wants.etag, rec.Header().Get(HeaderETag))
+			if tt.wants.fields != nil {
+				var res m.Problem
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatalf("can't decode error body: %v", err)
+				}
+				fields := make([]string, len(res.Errors))
+				for i, e := range res.Errors {
+					fields[i] = e.Field
+				}
+				assert.Equal(t, tt.wants.fields, fields)
+			}
+			if tt.wants.statusCode == http.StatusOK && tt.args.method != http.MethodGet {
+				var res m.Response[[]m.CakeImage]
+				_ = json.Unmarshal(rec.Body.Bytes(), &res)
+				assert.Equal(t, len(gallery), len(res.Data))
+			}
+		})
+	}
+}
+
+func Test_handler_AddCakeImage_upload(t *testing.T) {
+	tests := []struct {
+		name       string
+		repoErr    error
+		statusCode int
+		stored     int
+		queued     int
+	}{
+		{name: "Primary Upload Queues Variants", statusCode: http.StatusOK, stored: 1, queued: 1},
+		{name: "Refused Upload Is Deleted", repoErr: apperror.New(apperror.KindConflict, "cake already has 20 images"), statusCode: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockRepository := mock_repo.NewMockRepository(ctrl)
+			dir := t.TempDir()
+			store, err := storage.NewLocalStore(dir)
+			if err != nil {
+				t.Fatalf("can't open store: %v", err)
+			}
+
+			mockRepository.EXPECT().AddCakeImage(gomock.Any(), 1, 0, gomock.Any()).DoAndReturn(func(_ context.Context, id, _ int, image m.CakeImage) (m.Cake, []m.CakeImage, error) {
+				assert.Equal(t, "a lemon cheesecake", image.Alt)
+				assert.Equal(t, 1, image.Position)
+				if tt.repoErr != nil {
+					return m.Cake{}, nil, tt.repoErr
+				}
+				image.Id, image.CakeId, image.Primary = 1, id, true
+				return m.Cake{Id: id, Image: image.URL, Version: 2}, []m.CakeImage{image}, nil
+			})
+
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			file, _ := form.CreateFormFile("image", "cake.png")
+			_, _ = file.Write(pngOf(t, 4, 4))
+			_ = form.WriteField("alt", "a lemon cheesecake")
+			_ = form.WriteField("position", "1")
+			_ = form.Close()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/cakes/1/images", &body)
+			req.Header.Set(echo.HeaderContentType, form.FormDataContentType())
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+
+			jobs := &queue{}
+			h := New(mockRepository, WithImages(store, "", DefaultImageLimits), WithImageVariants(jobs))
+			if err := h.AddCakeImage(c); err != nil {
+				HTTPErrorHandler(err, c)
+			}
+
+			assert.Equal(t, tt.statusCode, rec.Code)
+			entries, _ := os.ReadDir(dir)
+			assert.Equal(t, tt.stored, len(entries)-1)
+			assert.Equal(t, tt.queued, len(jobs.jobs))
+		})
+	}
+}
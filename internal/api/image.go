@@ -0,0 +1,279 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"privy/internal/imaging"
+	"privy/internal/storage"
+	"privy/internal/validate"
+	m "privy/models"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	_ "golang.org/x/image/webp"
+)
+
+// ImageLimits bound the images uploaded to POST /cakes/:id/image.
+type ImageLimits struct {
+	MaxBytes  int
+	MaxWidth  int
+	MaxHeight int
+}
+
+var DefaultImageLimits = ImageLimits{MaxBytes: 5 << 20, MaxWidth: 4096, MaxHeight: 4096}
+
+// multipartOverhead is what the form around an image may add to the body.
+const multipartOverhead = 64 << 10
+
+// imageTypes maps the content types an upload may sniff as onto the
+// extension it is stored under. SVG isn't taken: it can carry scripts.
+var imageTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// WithImages stores uploaded images in store. They are linked from cakes
+// under baseURL, or as /images/ paths on this service when it is empty.
+func WithImages(store storage.BlobStore, baseURL string, limits ImageLimits) Option {
+	return func(h *handler) {
+		h.images = store
+		h.imageBaseURL = strings.TrimSuffix(baseURL, "/")
+		h.imageLimits = limits
+	}
+}
+
+// VariantQueue takes uploaded images to build variants of.
+type VariantQueue interface {
+	Enqueue(job imaging.Job) bool
+}
+
+// WithImageVariants has variants of every uploaded image built by queue.
+func WithImageVariants(queue VariantQueue) Option {
+	return func(h *handler) {
+		h.variants = queue
+	}
+}
+
+// UploadCakeImage stores the image of a multipart upload and makes it the
+// image of the cake. The upload it replaces is deleted once the write has
+// committed, unless the gallery still shows it; revisions linking to it are
+// left with a broken link.
+func (h *handler) UploadCakeImage(c echo.Context) (err error) {
+	if h.images == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "image uploads are disabled")
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if c.Param("id") == "" || err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "id must be an integer and can't be empty")
+	}
+
+	version, err := h.ifMatch(c, id)
+	if err != nil {
+		return err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != echo.MIMEMultipartForm {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "content type must be "+echo.MIMEMultipartForm)
+	}
+
+	ctx := c.Request().Context()
+	key, link, err := h.storeUpload(c)
+	if err != nil {
+		return err
+	}
+
+	before, err := h.repository.GetDetailsOfCake(ctx, id)
+	if err != nil {
+		log.Println("[Delivery][UploadCakeImage] can't get cake, err:", err.Error())
+		h.deleteUpload(ctx, key)
+		return err
+	}
+
+	cake, err := h.repository.PatchCake(ctx, id, version, m.CakePatch{Image: &link})
+	if err != nil {
+		log.Println("[Delivery][UploadCakeImage] can't set image of cake, err:", err.Error())
+		h.deleteUpload(ctx, key)
+		return err
+	}
+	setETag(c, cake)
+	h.queueVariants(id, key, link)
+	h.deleteReplacedUpload(ctx, cake, before.Image)
+
+	res := m.SetResponse(http.StatusOK, "success", cake)
+	return c.JSON(http.StatusOK, res)
+}
+
+// storeUpload stores the image field of a multipart request and returns
+// its key and link. The type is sniffed from the content, whatever the
+// client claims, and the image is decoded far enough to check its size.
+func (h *handler) storeUpload(c echo.Context) (key, link string, err error) {
+	tooLarge := echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("image must be at most %d bytes", h.imageLimits.MaxBytes))
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, int64(h.imageLimits.MaxBytes+multipartOverhead))
+	header, err := c.FormFile("image")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			return "", "", tooLarge
+		case errors.Is(err, http.ErrMissingFile):
+			return "", "", validate.Field("image", "required", "is required")
+		default:
+			return "", "", echo.NewHTTPError(http.StatusBadRequest, "can't parse multipart form")
+		}
+	}
+	if header.Size > int64(h.imageLimits.MaxBytes) {
+		return "", "", tooLarge
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return "", "", echo.NewHTTPError(http.StatusBadRequest, "can't read image")
+	}
+	defer file.Close()
+
+	contentType, err := h.checkImage(file)
+	if err != nil {
+		return "", "", err
+	}
+
+	key, err = imageKey(imageTypes[contentType])
+	if err != nil {
+		return "", "", err
+	}
+	if err = h.images.Put(c.Request().Context(), key, file, storage.Info{ContentType: contentType, Size: header.Size}); err != nil {
+		log.Println("[Delivery][storeUpload] can't store image, err:", err.Error())
+		return "", "", err
+	}
+	return key, h.imageURL(key), nil
+}
+
+// deleteReplacedUpload deletes the upload at link, which cake no longer
+// shows, unless its gallery still does.
+func (h *handler) deleteReplacedUpload(ctx context.Context, cake m.Cake, link string) {
+	key, ok := h.uploadKey(link)
+	if !ok || link == cake.Image {
+		return
+	}
+	_, images, err := h.repository.GetCakeImages(ctx, cake.Id)
+	if err != nil {
+		log.Println("[Delivery][deleteReplacedUpload] can't get gallery, keeping image, err:", err.Error())
+		return
+	}
+	for _, image := range images {
+		if image.URL == link {
+			return
+		}
+	}
+	h.deleteUpload(ctx, key)
+}
+
+// deleteUpload deletes an upload no cake ended up showing.
+func (h *handler) deleteUpload(ctx context.Context, key string) {
+	if err := h.images.Delete(ctx, key); err != nil {
+		log.Println("[Delivery][deleteUpload] can't delete unused image, err:", err.Error())
+	}
+}
+
+// queueVariants asks for the variants of the upload at key, shown by the
+// cake with id as link.
+func (h *handler) queueVariants(id int, key, link string) {
+	if h.variants != nil && !h.variants.Enqueue(imaging.Job{CakeID: id, Key: key, Source: link}) {
+		log.Println("[Delivery][queueVariants] can't queue variants of", key)
+	}
+}
+
+// checkImage sniffs the type of an upload and checks its dimensions, and
+// rewinds it for storing.
+func (h *handler) checkImage(file io.ReadSeeker) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "can't read image")
+	}
+	contentType := http.DetectContentType(head[:n])
+	if _, ok := imageTypes[contentType]; !ok {
+		return "", echo.NewHTTPError(http.StatusUnsupportedMediaType, "image must be a png, jpeg, gif or webp")
+	}
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return "", validate.Field("image", "type", "can't be decoded as "+contentType)
+	}
+	if config.Width > h.imageLimits.MaxWidth || config.Height > h.imageLimits.MaxHeight {
+		return "", validate.Field("image", "max", fmt.Sprintf("must be at most %dx%d pixels", h.imageLimits.MaxWidth, h.imageLimits.MaxHeight))
+	}
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return contentType, nil
+}
+
+// GetImage serves a stored image. Keys are never reused, so images can be
+// cached for good.
+func (h *handler) GetImage(c echo.Context) (err error) {
+	if h.images == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "image uploads are disabled")
+	}
+
+	blob, err := h.images.Get(c.Request().Context(), c.Param("key"))
+	if err != nil {
+		return err
+	}
+	defer blob.Body.Close()
+
+	contentType := blob.ContentType
+	if contentType == "" {
+		contentType = echo.MIMEOctetStream
+	}
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, contentType)
+	header.Set(echo.HeaderXContentTypeOptions, "nosniff")
+
+	if seeker, ok := blob.Body.(io.ReadSeeker); ok {
+		http.ServeContent(c.Response(), c.Request(), c.Param("key"), blob.ModTime, seeker)
+		return nil
+	}
+	if blob.Size > 0 {
+		header.Set(echo.HeaderContentLength, strconv.FormatInt(blob.Size, 10))
+	}
+	return c.Stream(http.StatusOK, contentType, blob.Body)
+}
+
+// imageURL links the upload at key. Without a base URL the link is a path
+// on this service: one built from the Host of the upload would let any
+// client pick where the image of a cake sends every reader.
+func (h *handler) imageURL(key string) string {
+	if h.imageBaseURL != "" {
+		return h.imageBaseURL + "/" + key
+	}
+	return "/images/" + key
+}
+
+// imageKey is a new random key with ext.
+func imageKey(ext string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b) + ext, nil
+}
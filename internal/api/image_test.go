@@ -0,0 +1,355 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"privy/internal/apperror"
+	"privy/internal/imaging"
+	"privy/internal/storage"
+	mock_repo "privy/mock/repository"
+	m "privy/models"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+)
+
+func pngOf(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("can't encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func imageForm(t *testing.T, field, filename string, content []byte) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, _ := form.CreateFormFile(field, filename)
+	_, _ = file.Write(content)
+	_ = form.Close()
+	return &body, form.FormDataContentType()
+}
+
+func Test_handler_UploadCakeImage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+
+	// previous is an earlier upload the cake shows.
+	const previous = "00112233445566778899aabbccddeeff.png"
+	uploaded := func(_ context.Context, id, _ int, patch m.CakePatch) (m.Cake, error) {
+		if !strings.HasPrefix(*patch.Image, "/images/") || !strings.HasSuffix(*patch.Image, ".png") {
+			t.Errorf("PatchCake() image = %s, want a png under /images/", *patch.Image)
+		}
+		return m.Cake{Id: id, Image: *patch.Image, Version: 4}, nil
+	}
+
+	type args struct {
+		field    string
+		content  []byte
+		ifMatch  string
+		noStore  bool
+		jsonBody bool
+		previous bool
+	}
+	type wants struct {
+		statusCode int
+		fields     []string
+		stored     int
+	}
+	tests := []struct {
+		name  string
+		args  args
+		wants wants
+		mock  func()
+	}{
+		{
+			name: "Success",
+			args: args{field: "image", content: pngOf(t, 40, 30), ifMatch: `"1-3"`},
+			wants: wants{
+				statusCode: http.StatusOK,
+				stored:     1,
+			},
+			mock: func() {
+				mockRepository.EXPECT().GetDetailsOfCake(gomock.Any(), 1).Return(m.Cake{Id: 1, Image: "https://example.com/cake.png", Version: 3}, nil)
+				mockRepository.EXPECT().PatchCake(gomock.Any(), 1, 3, gomock.Any()).DoAndReturn(uploaded)
+			},
+		},
+		{
+			name: "Replaced upload is deleted",
+			args: args{field: "image", content: pngOf(t, 40, 30), previous: true},
+			wants: wants{
+				statusCode: http.StatusOK,
+				stored:     1,
+			},
+			mock: func() {
+				mockRepository.EXPECT().GetDetailsOfCake(gomock.Any(), 1).Return(m.Cake{Id: 1, Image: "/images/" + previous, Version: 3}, nil)
+				mockRepository.EXPECT().PatchCake(gomock.Any(), 1, 0, gomock.Any()).DoAndReturn(uploaded)
+				mockRepository.EXPECT().GetCakeImages(gomock.Any(), 1).Return(m.Cake{}, []m.CakeImage{}, nil)
+			},
+		},
+		{
+			name: "Replaced upload kept by the gallery",
+			args: args{field: "image", content: pngOf(t, 40, 30), previous: true},
+			wants: wants{
+				statusCode: http.StatusOK,
+				stored:     2,
+			},
+			mock: func() {
+				mockRepository.EXPECT().GetDetailsOfCake(gomock.Any(), 1).Return(m.Cake{Id: 1, Image: "/images/" + previous, Version: 3}, nil)
+				mockRepository.EXPECT().PatchCake(gomock.Any(), 1, 0, gomock.Any()).DoAndReturn(uploaded)
+				mockRepository.EXPECT().GetCakeImages(gomock.Any(), 1).Return(m.Cake{}, []m.CakeImage{{Id: 2, URL: "/images/" + previous}}, nil)
+			},
+		},
+		{
+			name: "Cake gone drops the image",
+			args: args{field: "image", content: pngOf(t, 40, 30)},
+			wants: wants{
+				statusCode: http.StatusNotFound,
+			},
+			mock: func() {
+				mockRepository.EXPECT().GetDetailsOfCake(gomock.Any(), 1).Return(m.Cake{}, apperror.ErrNotFound)
+			},
+		},
+		{
+			name: "Stale version keeps the replaced upload",
+			args: args{field: "image", content: pngOf(t, 40, 30), ifMatch: `"1-2"`, previous: true},
+			wants: wants{
+				statusCode: http.StatusPreconditionFailed,
+				stored:     1,
+			},
+			mock: func() {
+				mockRepository.EXPECT().GetDetailsOfCake(gomock.Any(), 1).Return(m.Cake{Id: 1, Image: "/images/" + previous, Version: 3}, nil)
+				mockRepository.EXPECT().PatchCake(gomock.Any(), 1, 2, gomock.Any()).Return(m.Cake{}, apperror.ErrPreconditionFailed)
+			},
+		},
+		{
+			name: "Too many pixels",
+			args: args{field: "image", content: pngOf(t, 65, 10)},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+				fields:     []string{"image"},
+			},
+			mock: func() {},
+		},
+		{
+			name: "Too many bytes",
+			args: args{field: "image", content: append(pngOf(t, 1, 1), make([]byte, 4096)...)},
+			wants: wants{
+				statusCode: http.StatusRequestEntityTooLarge,
+			},
+			mock: func() {},
+		},
+		{
+			name: "Not an image",
+			args: args{field: "image", content: []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"><script>alert(1)</script></svg>")},
+			wants: wants{
+				statusCode: http.StatusUnsupportedMediaType,
+			},
+			mock: func() {},
+		},
+		{
+			name: "Corrupt image",
+			args: args{field: "image", content: pngOf(t, 4, 4)[:20]},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+				fields:     []string{"image"},
+			},
+			mock: func() {},
+		},
+		{
+			name: "Missing file",
+			args: args{field: "photo", content: pngOf(t, 4, 4)},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+				fields:     []string{"image"},
+			},
+			mock: func() {},
+		},
+		{
+			name: "Not multipart",
+			args: args{jsonBody: true},
+			wants: wants{
+				statusCode: http.StatusUnsupportedMediaType,
+			},
+			mock: func() {},
+		},
+		{
+			name: "Uploads disabled",
+			args: args{field: "image", content: pngOf(t, 4, 4), noStore: true},
+			wants: wants{
+				statusCode: http.StatusNotFound,
+			},
+			mock: func() {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := storage.NewLocalStore(dir)
+			if err != nil {
+				t.Fatalf("can't open store: %v", err)
+			}
+			if tt.args.previous {
+				_ = store.Put(context.Background(), previous, bytes.NewReader(pngOf(t, 4, 4)), storage.Info{ContentType: "image/png"})
+			}
+
+			var body io.Reader
+			var contentType string
+			if tt.args.jsonBody {
+				body, contentType = strings.NewReader(`{"image":"x"}`), echo.MIMEApplicationJSON
+			} else {
+				body, contentType = imageForm(t, tt.args.field, "cake.png", tt.args.content)
+			}
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/cakes/1/image", body)
+			req.Header.Set(echo.HeaderContentType, contentType)
+			if tt.args.ifMatch != "" {
+				req.Header.Set(HeaderIfMatch, tt.args.ifMatch)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+
+			tt.mock()
+
+			h := &handler{
+				repository:  mockRepository,
+				imageLimits: ImageLimits{MaxBytes: 2048, MaxWidth: 64, MaxHeight: 64},
+			}
+			if !tt.args.noStore {
+				h.images = store
+			}
+			if err := h.UploadCakeImage(c); err != nil {
+				HTTPErrorHandler(err, c)
+			}
+
+			assert.Equal(t, tt.wants.statusCode, rec.Code)
+			if tt.wants.fields != nil {
+				var res m.Problem
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatalf("can't decode error body: %v", err)
+				}
+				fields := make([]string, len(res.Errors))
+				for i, e := range res.Errors {
+					fields[i] = e.Field
+				}
+				assert.Equal(t, tt.wants.fields, fields)
+			}
+			if tt.wants.statusCode == http.StatusOK {
+				assert.Equal(t, `"1-4"`, rec.Header().Get(HeaderETag))
+			}
+			entries, _ := os.ReadDir(dir)
+			assert.Equal(t, tt.wants.stored, len(entries)-1)
+		})
+	}
+}
+
+func Test_handler_GetImage(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("can't open store: %v", err)
+	}
+	content := pngOf(t, 4, 4)
+	_ = store.Put(context.Background(), "cake.png", bytes.NewReader(content), storage.Info{ContentType: "image/png"})
+	h := &handler{images: store}
+
+	tests := []struct {
+		name       string
+		key        string
+		rangeBytes string
+		statusCode int
+		body       []byte
+	}{
+		{name: "Whole image", key: "cake.png", statusCode: http.StatusOK, body: content},
+		{name: "Range", key: "cake.png", rangeBytes: "bytes=0-7", statusCode: http.StatusPartialContent, body: content[:8]},
+		{name: "Missing image", key: "gone.png", statusCode: http.StatusNotFound},
+		{name: "Key outside the store", key: "..%2Fsecret", statusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/images/"+tt.key, nil)
+			if tt.rangeBytes != "" {
+				req.Header.Set("Range", tt.rangeBytes)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("key")
+			c.SetParamValues(tt.key)
+
+			if err := h.GetImage(c); err != nil {
+				HTTPErrorHandler(err, c)
+			}
+
+			assert.Equal(t, tt.statusCode, rec.Code)
+			if tt.body != nil {
+				assert.Equal(t, tt.body, rec.Body.Bytes())
+				assert.Equal(t, "image/png", rec.Header().Get(echo.HeaderContentType))
+				assert.Equal(t, "nosniff", rec.Header().Get(echo.HeaderXContentTypeOptions))
+			}
+		})
+	}
+}
+
+// queue is a VariantQueue that keeps its jobs.
+type queue struct {
+	jobs []imaging.Job
+}
+
+func (q *queue) Enqueue(job imaging.Job) bool {
+	q.jobs = append(q.jobs, job)
+	return true
+}
+
+func Test_handler_UploadCakeImage_queuesVariants(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+	mockRepository.EXPECT().GetDetailsOfCake(gomock.Any(), 1).Return(m.Cake{Id: 1, Version: 1}, nil)
+	mockRepository.EXPECT().PatchCake(gomock.Any(), 1, 0, gomock.Any()).DoAndReturn(func(_ context.Context, id, _ int, patch m.CakePatch) (m.Cake, error) {
+		return m.Cake{Id: id, Image: *patch.Image, Version: 2}, nil
+	})
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("can't open store: %v", err)
+	}
+
+	body, contentType := imageForm(t, "image", "cake.png", pngOf(t, 4, 4))
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/cakes/1/image", body)
+	req.Header.Set(echo.HeaderContentType, contentType)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	jobs := &queue{}
+	h := New(mockRepository, WithImages(store, "https://cdn.example.com/", DefaultImageLimits), WithImageVariants(jobs))
+	if err := h.UploadCakeImage(c); err != nil {
+		t.Fatalf("UploadCakeImage() error = %v", err)
+	}
+
+	var res m.Response[m.Cake]
+	_ = json.Unmarshal(rec.Body.Bytes(), &res)
+	if len(jobs.jobs) != 1 {
+		t.Fatalf("UploadCakeImage() queued %d jobs, want 1", len(jobs.jobs))
+	}
+	job := jobs.jobs[0]
+	assert.Equal(t, 1, job.CakeID)
+	assert.Equal(t, res.Data.Image, job.Source)
+	assert.Equal(t, "https://cdn.example.com/"+job.Key, job.Source)
+}
@@ -0,0 +1,461 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"privy/internal/apperror"
+	"privy/internal/repository"
+	"privy/internal/validate"
+	m "privy/models"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// importChunk is how many new cakes an import inserts at once.
+	importChunk = 500
+	// maxImportErrors bounds the rows an import report details; later
+	// failures are only counted.
+	maxImportErrors = 1000
+	// maxNDJSONLine bounds one line of an NDJSON import.
+	maxNDJSONLine = 1 << 20
+)
+
+// DefaultImportMaxBytes bounds the body of an import unless WithImportLimit
+// sets another bound.
+const DefaultImportMaxBytes = 64 << 20
+
+// WithImportLimit bounds the body of POST /cakes/import to maxBytes.
+func WithImportLimit(maxBytes int) Option {
+	return func(h *handler) {
+		h.importMaxBytes = maxBytes
+	}
+}
+
+// importFormats maps the content types an import body may have onto its
+// format.
+var importFormats = map[string]string{
+	MIMETextCSV:           "csv",
+	MIMEApplicationNDJSON: "ndjson",
+}
+
+// readOnlyColumns are fields of an export that an import skips.
+var readOnlyColumns = map[string]bool{"version": true, "created_at": true, "updated_at": true, "deleted_at": true}
+
+// ImportCakes reads a CSV or NDJSON file, sent as the body or as the file
+// field of a multipart form, and inserts every row that passes the checks
+// of POST /cakes. Rows with an id are refused unless upsert is set, in which
+// case they replace the cake with that id or create it. With dry_run the
+// rows are only checked. The report lists the failing rows by line.
+//
+// A body over the import limit is refused with 413. When it has no
+// Content-Length that is only found out while reading it, so the rows
+// before the limit may have been written.
+func (h *handler) ImportCakes(c echo.Context) (err error) {
+	dryRun, err := boolParam(c, "dry_run")
+	if err != nil {
+		return err
+	}
+	upsert, err := boolParam(c, "upsert")
+	if err != nil {
+		return err
+	}
+
+	body, format, err := h.importBody(c)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	var rows cakeRows
+	if format == "csv" {
+		rows, err = newCSVRows(body)
+	} else {
+		rows = newNDJSONRows(body)
+	}
+	if err != nil {
+		return h.importTooLarge(err)
+	}
+
+	imp := &importer{
+		repository: h.repository,
+		dryRun:     dryRun,
+		report:     m.ImportReport{DryRun: dryRun, Errors: []m.ImportError{}},
+	}
+	ctx := c.Request().Context()
+	for {
+		row, err := rows.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Println("[Delivery][ImportCakes] can't read import, err:", err.Error())
+			return h.importTooLarge(err)
+		}
+
+		imp.report.Rows++
+		if row.err == nil {
+			row.err = validate.Struct(CakeRequest(row.patch))
+		}
+		if row.err == nil && row.id != 0 && !upsert {
+			row.err = validate.Field("id", "unknown", "can't be set unless upsert is on")
+		}
+		switch {
+		case row.err != nil:
+			imp.fail(row.line, row.err)
+		case row.id != 0:
+			imp.upsert(ctx, row)
+		default:
+			imp.create(ctx, row)
+		}
+	}
+	imp.flush(ctx)
+
+	res := m.SetResponse(http.StatusOK, "success", imp.report)
+	return c.JSON(http.StatusOK, res)
+}
+
+// importBody returns the file to import and its format, named by the format
+// parameter or else told by its content type or file name. The body is cut
+// off at the import limit.
+func (h *handler) importBody(c echo.Context) (io.ReadCloser, string, error) {
+	format := c.QueryParam("format")
+	if format != "" && format != "csv" && format != "ndjson" {
+		return nil, "", validate.Field("format", "oneof", "must be csv or ndjson")
+	}
+
+	if c.Request().ContentLength > int64(h.importMaxBytes) {
+		return nil, "", h.importTooLarge(&http.MaxBytesError{Limit: int64(h.importMaxBytes)})
+	}
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, int64(h.importMaxBytes))
+
+	body := io.NopCloser(c.Request().Body)
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType == echo.MIMEMultipartForm {
+		header, err := c.FormFile("file")
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, "", h.importTooLarge(err)
+		}
+		if err != nil {
+			return nil, "", validate.Field("file", "required", "is required")
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, "", echo.NewHTTPError(http.StatusBadRequest, "can't read file")
+		}
+		body = file
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(path.Ext(header.Filename)), ".")
+			mediaType, _, _ = mime.ParseMediaType(header.Header.Get(echo.HeaderContentType))
+		}
+	}
+	if format == "" || (format != "csv" && format != "ndjson") {
+		format = importFormats[mediaType]
+	}
+	if format == "" {
+		body.Close()
+		return nil, "", echo.NewHTTPError(http.StatusUnsupportedMediaType, "content type must be "+MIMETextCSV+" or "+MIMEApplicationNDJSON+", or a multipart form with a csv or ndjson file")
+	}
+	return body, format, nil
+}
+
+// importTooLarge turns err into a 413 when the body went over the import
+// limit, and returns it untouched otherwise.
+func (h *handler) importTooLarge(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("import must be at most %d bytes", h.importMaxBytes))
+	}
+	return err
+}
+
+func boolParam(c echo.Context, name string) (bool, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, validate.Field(name, "type", "must be true or false")
+	}
+	return b, nil
+}
+
+// importRow is one row of an import, or why it can't be read.
+type importRow struct {
+	line  int
+	id    int
+	patch m.CakePatch
+	err   error
+}
+
+// cakeRows reads an import a row at a time. Errors of a single row are
+// set on the row; next only fails when the file can't be read any further,
+// and returns io.EOF at its end.
+type cakeRows interface {
+	next() (importRow, error)
+}
+
+type csvRows struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+// newCSVRows reads the header of a CSV import. Columns are matched by
+// name; the writable fields are required and id is optional.
+func newCSVRows(body io.Reader) (*csvRows, error) {
+	r := csv.NewReader(body)
+	r.ReuseRecord = true
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, validate.Field("file", "required", "is empty")
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "can't read CSV header: "+err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows := &csvRows{r: r, columns: make(map[string]int, len(header))}
+	var errs validate.Errors
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch {
+		case readOnlyColumns[name]:
+		case name != "id" && name != "title" && name != "description" && name != "rating" && name != "image":
+			errs = append(errs, validate.FieldError{Field: name, Rule: "unknown", Message: "isn't a cake column"})
+		default:
+			if _, ok := rows.columns[name]; ok {
+				errs = append(errs, validate.FieldError{Field: name, Rule: "unique", Message: "appears more than once"})
+			}
+			rows.columns[name] = i
+		}
+	}
+	for _, name := range []string{"title", "description", "rating", "image"} {
+		if _, ok := rows.columns[name]; !ok {
+			errs = append(errs, validate.FieldError{Field: name, Rule: "required", Message: "is a required column"})
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (rows *csvRows) next() (importRow, error) {
+	record, err := rows.r.Read()
+	if err == io.EOF {
+		return importRow{}, io.EOF
+	}
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		row := importRow{line: parseErr.StartLine}
+		if errors.Is(err, csv.ErrFieldCount) {
+			row.err = echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("row has %d fields, the header has %d", len(record), rows.r.FieldsPerRecord))
+		} else {
+			row.err = echo.NewHTTPError(http.StatusBadRequest, "malformed CSV: "+parseErr.Err.Error())
+		}
+		return row, nil
+	}
+	if err != nil {
+		return importRow{}, err
+	}
+
+	line, _ := rows.r.FieldPos(0)
+	row := importRow{line: line}
+	cell := func(name string) *string {
+		value := record[rows.columns[name]]
+		return &value
+	}
+
+	if i, ok := rows.columns["id"]; ok {
+		if value := strings.TrimSpace(record[i]); value != "" {
+			row.id, row.err = parseImportID(value)
+		}
+	}
+	row.patch.Title = cell("title")
+	row.patch.Description = cell("description")
+	row.patch.Image = cell("image")
+	rating, err := strconv.ParseFloat(strings.TrimSpace(*cell("rating")), 32)
+	if err != nil && row.err == nil {
+		row.err = validate.Field("rating", "type", "must be a number")
+	}
+	value := float32(rating)
+	row.patch.Rating = &value
+	return row, nil
+}
+
+func parseImportID(value string) (int, error) {
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, validate.Field("id", "type", "must be an integer")
+	}
+	if id < 1 {
+		return 0, validate.Field("id", "min", "must be at least 1")
+	}
+	return id, nil
+}
+
+type ndjsonRows struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newNDJSONRows(body io.Reader) *ndjsonRows {
+	s := bufio.NewScanner(body)
+	s.Buffer(make([]byte, 0, 64*1024), maxNDJSONLine)
+	return &ndjsonRows{s: s}
+}
+
+// next reads the object on the next line that isn't blank. It takes the
+// fields of a merge patch, an optional id and the read-only fields of an
+// export, which are skipped.
+func (rows *ndjsonRows) next() (importRow, error) {
+	for rows.s.Scan() {
+		rows.line++
+		text := bytes.TrimSpace(rows.s.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		row := importRow{line: rows.line}
+
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(text, &members); err != nil || members == nil {
+			row.err = echo.NewHTTPError(http.StatusBadRequest, "line must be a JSON object")
+			return row, nil
+		}
+		if raw, ok := members["id"]; ok && !bytes.Equal(raw, []byte("null")) {
+			var id json.Number
+			if err := json.Unmarshal(raw, &id); err != nil {
+				row.err = validate.Field("id", "type", "must be an integer")
+				return row, nil
+			}
+			if row.id, row.err = parseImportID(id.String()); row.err != nil {
+				return row, nil
+			}
+		}
+		delete(members, "id")
+		for name := range readOnlyColumns {
+			delete(members, name)
+		}
+
+		fields, err := json.Marshal(members)
+		if err != nil {
+			return importRow{}, err
+		}
+		row.patch, row.err = parseMergePatch(fields)
+		return row, nil
+	}
+
+	if err := rows.s.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return importRow{}, echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("line %d is longer than %d bytes", rows.line+1, maxNDJSONLine))
+		}
+		return importRow{}, err
+	}
+	return importRow{}, io.EOF
+}
+
+// importer writes the rows of an import and keeps its report. New cakes
+// are inserted importChunk at a time; upserts one by one.
+type importer struct {
+	repository repository.Repository
+	dryRun     bool
+	report     m.ImportReport
+
+	creates []m.BatchOperation
+	lines   []int
+}
+
+func (imp *importer) fail(line int, err error) {
+	imp.report.Failed++
+	if len(imp.report.Errors) < maxImportErrors {
+		imp.report.Errors = append(imp.report.Errors, m.ImportError{Line: line, Problem: problemOf(err)})
+	}
+}
+
+func (imp *importer) create(ctx context.Context, row importRow) {
+	if imp.dryRun {
+		imp.report.Created++
+		return
+	}
+	imp.creates = append(imp.creates, m.BatchOperation{Op: m.BatchCreate, Patch: row.patch})
+	imp.lines = append(imp.lines, row.line)
+	if len(imp.creates) == importChunk {
+		imp.flush(ctx)
+	}
+}
+
+func (imp *importer) flush(ctx context.Context) {
+	if len(imp.creates) == 0 {
+		return
+	}
+	results, err := imp.repository.ApplyBatch(ctx, imp.creates, m.BatchBestEffort)
+	for i, line := range imp.lines {
+		switch {
+		case err != nil:
+			imp.fail(line, err)
+		case results[i].Err != nil:
+			imp.fail(line, results[i].Err)
+		default:
+			imp.report.Created++
+		}
+	}
+	imp.creates, imp.lines = imp.creates[:0], imp.lines[:0]
+}
+
+// upsert replaces the cake with the id of row, or creates it with that id
+// when there is none. A cake in the trash can be neither, since its id is
+// taken.
+func (imp *importer) upsert(ctx context.Context, row importRow) {
+	if imp.dryRun {
+		cake, err := imp.repository.GetAnyCake(ctx, row.id)
+		switch {
+		case err == nil && cake.DeletedAt == nil:
+			imp.report.Updated++
+		case err == nil:
+			imp.fail(row.line, apperror.New(apperror.KindConflict, "cake already exists"))
+		case apperror.KindOf(err) == apperror.KindNotFound:
+			imp.report.Created++
+		default:
+			imp.fail(row.line, err)
+		}
+		return
+	}
+
+	cake := CakeRequest(row.patch).Cake()
+	cake.Id = row.id
+	_, err := imp.repository.UpdateCake(ctx, cake, 0)
+	if err == nil {
+		imp.report.Updated++
+		return
+	}
+	if apperror.KindOf(err) == apperror.KindNotFound {
+		if _, err = imp.repository.InsertCake(ctx, cake); err == nil {
+			imp.report.Created++
+			return
+		}
+	}
+	log.Println("[Delivery][ImportCakes] can't upsert cake, err:", err.Error())
+	imp.fail(row.line, err)
+}
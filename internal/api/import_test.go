@@ -0,0 +1,294 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"privy/internal/apperror"
+	mock_repo "privy/mock/repository"
+	m "privy/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+)
+
+func Test_handler_ImportCakes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+
+	str := func(s string) *string { return &s }
+	rating := func(f float32) *float32 { return &f }
+	image := "https://www.abc.com/abc.jpeg"
+	create := func(title string, r float32) m.BatchOperation {
+		return m.BatchOperation{Op: m.BatchCreate, Patch: m.CakePatch{Title: str(title), Description: str("deskripsi"), Rating: rating(r), Image: str(image)}}
+	}
+	cake := func(id int, title string, r float32) m.Cake {
+		return m.Cake{Id: id, Title: title, Description: "deskripsi", Rating: r, Image: image}
+	}
+
+	type args struct {
+		query       string
+		contentType string
+		body        string
+		maxBytes    int
+		// streamed sends the body without a Content-Length.
+		streamed bool
+	}
+	type wants struct {
+		statusCode int
+		report     m.ImportReport
+		lines      []int
+		fields     []string
+	}
+	tests := []struct {
+		name  string
+		args  args
+		wants wants
+		mock  func()
+	}{
+		{
+			name: "CSV",
+			args: args{
+				contentType: MIMETextCSV,
+				body: "\ufefftitle,description,rating,image,version\n" +
+					"judul,deskripsi,9.8," + image + ",1\n" +
+					"judul kedua,deskripsi,sepuluh," + image + ",1\n" +
+					"\"judul\nketiga\",deskripsi,7," + image + ",1\n" +
+					"judul keempat,deskripsi,7," + image + "\n" +
+					"judul kelima,deskripsi,8," + image + ",\n",
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+				report:     m.ImportReport{Rows: 5, Created: 2, Failed: 3},
+				lines:      []int{3, 4, 6},
+			},
+			mock: func() {
+				mockRepository.EXPECT().ApplyBatch(gomock.Any(), []m.BatchOperation{create("judul", 9.8), create("judul kelima", 8)}, m.BatchBestEffort).
+					Return([]m.BatchResult{{Cake: &m.Cake{Id: 1}}, {Cake: &m.Cake{Id: 2}}}, nil)
+			},
+		},
+		{
+			name: "CSV with ids needs upsert",
+			args: args{
+				contentType: MIMETextCSV,
+				body:        "id,title,description,rating,image\n7,judul,deskripsi,9," + image + "\n",
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+				report:     m.ImportReport{Rows: 1, Failed: 1},
+				lines:      []int{2},
+			},
+			mock: func() {},
+		},
+		{
+			name: "NDJSON upsert",
+			args: args{
+				query:       "?upsert=true",
+				contentType: MIMEApplicationNDJSON,
+				body: `{"id":7,"title":"judul","description":"deskripsi","rating":9,"image":"` + image + `","version":4,"created_at":"2022-12-01T20:29:00Z"}` + "\n" +
+					"\n" +
+					`{"id":8,"title":"baru","description":"deskripsi","rating":8,"image":"` + image + `"}` + "\n" +
+					`{"title":"judul","description":"deskripsi","rating":11,"image":"` + image + `"}` + "\n" +
+					`{"id":9,"title":"dipakai","description":"deskripsi","rating":8,"image":"` + image + `"}` + "\n" +
+					`[1, 2]` + "\n",
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+				report:     m.ImportReport{Rows: 5, Created: 1, Updated: 1, Failed: 3},
+				lines:      []int{4, 5, 6},
+			},
+			mock: func() {
+				mockRepository.EXPECT().UpdateCake(gomock.Any(), cake(7, "judul", 9), 0).Return(cake(7, "judul", 9), nil)
+				mockRepository.EXPECT().UpdateCake(gomock.Any(), cake(8, "baru", 8), 0).Return(m.Cake{}, apperror.ErrNotFound)
+				mockRepository.EXPECT().InsertCake(gomock.Any(), cake(8, "baru", 8)).Return(cake(8, "baru", 8), nil)
+				mockRepository.EXPECT().UpdateCake(gomock.Any(), cake(9, "dipakai", 8), 0).Return(m.Cake{}, apperror.ErrNotFound)
+				mockRepository.EXPECT().InsertCake(gomock.Any(), cake(9, "dipakai", 8)).Return(m.Cake{}, apperror.New(apperror.KindConflict, "cake already exists"))
+			},
+		},
+		{
+			name: "Dry run writes nothing",
+			args: args{
+				query:       "?dry_run=true&upsert=true&format=ndjson",
+				contentType: echo.MIMETextPlain,
+				body: `{"id":7,"title":"judul","description":"deskripsi","rating":9,"image":"` + image + `"}` + "\n" +
+					`{"id":8,"title":"baru","description":"deskripsi","rating":8,"image":"` + image + `"}` + "\n" +
+					`{"title":"judul","description":"deskripsi","rating":9,"image":"` + image + `"}` + "\n" +
+					`{"id":9,"title":"dibuang","description":"deskripsi","rating":8,"image":"` + image + `"}` + "\n",
+			},
+			wants: wants{
+				statusCode: http.StatusOK,
+				report:     m.ImportReport{DryRun: true, Rows: 4, Created: 2, Updated: 1, Failed: 1},
+				lines:      []int{4},
+			},
+			mock: func() {
+				deletedAt := time.Date(2022, 12, 1, 20, 29, 0, 0, time.UTC)
+				trashed := cake(9, "dibuang", 8)
+				trashed.DeletedAt = &deletedAt
+				mockRepository.EXPECT().GetAnyCake(gomock.Any(), 7).Return(cake(7, "judul", 9), nil)
+				mockRepository.EXPECT().GetAnyCake(gomock.Any(), 8).Return(m.Cake{}, apperror.ErrNotFound)
+				mockRepository.EXPECT().GetAnyCake(gomock.Any(), 9).Return(trashed, nil)
+			},
+		},
+		{
+			name: "Body over the limit",
+			args: args{
+				contentType: MIMEApplicationNDJSON,
+				body:        `{"title":"judul","description":"deskripsi","rating":9,"image":"` + image + `"}` + "\n",
+				maxBytes:    16,
+			},
+			wants: wants{
+				statusCode: http.StatusRequestEntityTooLarge,
+			},
+			mock: func() {},
+		},
+		{
+			name: "Streamed body over the limit",
+			args: args{
+				contentType: MIMETextCSV,
+				body:        "title,description,rating,image\njudul,deskripsi,9.8," + image + "\n",
+				maxBytes:    40,
+				streamed:    true,
+			},
+			wants: wants{
+				statusCode: http.StatusRequestEntityTooLarge,
+			},
+			mock: func() {},
+		},
+		{
+			name: "CSV header without required columns",
+			args: args{
+				contentType: MIMETextCSV,
+				body:        "title,rating,colour\njudul,9,merah\n",
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+				fields:     []string{"colour", "description", "image"},
+			},
+			mock: func() {},
+		},
+		{
+			name: "Empty CSV",
+			args: args{
+				contentType: MIMETextCSV,
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+				fields:     []string{"file"},
+			},
+			mock: func() {},
+		},
+		{
+			name: "Invalid dry run",
+			args: args{
+				query:       "?dry_run=maybe",
+				contentType: MIMETextCSV,
+			},
+			wants: wants{
+				statusCode: http.StatusUnprocessableEntity,
+				fields:     []string{"dry_run"},
+			},
+			mock: func() {},
+		},
+		{
+			name: "Unsupported content type",
+			args: args{
+				contentType: echo.MIMEApplicationJSON,
+				body:        `[]`,
+			},
+			wants: wants{
+				statusCode: http.StatusUnsupportedMediaType,
+			},
+			mock: func() {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/cakes/import"+tt.args.query, strings.NewReader(tt.args.body))
+			req.Header.Set(echo.HeaderContentType, tt.args.contentType)
+			if tt.args.streamed {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			tt.mock()
+
+			h := &handler{
+				repository:     mockRepository,
+				importMaxBytes: DefaultImportMaxBytes,
+			}
+			if tt.args.maxBytes != 0 {
+				h.importMaxBytes = tt.args.maxBytes
+			}
+			if err := h.ImportCakes(c); err != nil {
+				HTTPErrorHandler(err, c)
+			}
+
+			assert.Equal(t, tt.wants.statusCode, rec.Code)
+			if tt.wants.fields != nil {
+				var res m.Problem
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatalf("can't decode error body: %v", err)
+				}
+				fields := make([]string, len(res.Errors))
+				for i, e := range res.Errors {
+					fields[i] = e.Field
+				}
+				assert.Equal(t, tt.wants.fields, fields)
+			}
+			if tt.wants.statusCode == http.StatusOK {
+				var res m.Response[m.ImportReport]
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatalf("can't decode body: %v", err)
+				}
+				lines := []int{}
+				for _, e := range res.Data.Errors {
+					lines = append(lines, e.Line)
+				}
+				if tt.wants.lines == nil {
+					tt.wants.lines = []int{}
+				}
+				assert.Equal(t, tt.wants.lines, lines)
+				res.Data.Errors = nil
+				assert.Equal(t, tt.wants.report, res.Data)
+			}
+		})
+	}
+}
+
+func Test_handler_ImportCakes_multipart(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+	mockRepository.EXPECT().ApplyBatch(gomock.Any(), gomock.Len(1), m.BatchBestEffort).Return([]m.BatchResult{{Cake: &m.Cake{Id: 1}}}, nil)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, _ := form.CreateFormFile("file", "catalog.csv")
+	_, _ = file.Write([]byte("title,description,rating,image\njudul,deskripsi,9,https://www.abc.com/abc.jpeg\n"))
+	_ = form.Close()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/cakes/import", &body)
+	req.Header.Set(echo.HeaderContentType, form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	h := &handler{
+		repository:     mockRepository,
+		importMaxBytes: DefaultImportMaxBytes,
+	}
+	if err := h.ImportCakes(c); err != nil {
+		HTTPErrorHandler(err, c)
+	}
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var res m.Response[m.ImportReport]
+	_ = json.Unmarshal(rec.Body.Bytes(), &res)
+	assert.Equal(t, 1, res.Data.Created)
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	m "privy/models"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// setPageLinks advertises the neighbouring pages of a collection in an
+// RFC 8288 Link header. Offset pages link to the first, previous, next and
+// last pages; cursor pages link to the first page and the next one. The
+// links keep every other query parameter of the request.
+func setPageLinks(c echo.Context, meta m.Meta) {
+	if meta.Limit <= 0 {
+		return
+	}
+	limit := strconv.Itoa(meta.Limit)
+
+	links := []string{pageLink(c, "first", "limit", limit)}
+	if meta.Offset != nil {
+		if meta.Prev != nil {
+			links = append(links, pageLink(c, "prev", "limit", limit, "offset", strconv.Itoa(*meta.Prev)))
+		}
+		if meta.Next != nil {
+			links = append(links, pageLink(c, "next", "limit", limit, "offset", strconv.Itoa(*meta.Next)))
+		}
+		if meta.Total != nil && *meta.Total > 0 {
+			last := (*meta.Total - 1) / meta.Limit * meta.Limit
+			links = append(links, pageLink(c, "last", "limit", limit, "offset", strconv.Itoa(last)))
+		}
+	} else if meta.NextCursor != "" {
+		links = append(links, pageLink(c, "next", "limit", limit, "cursor", meta.NextCursor))
+	}
+	c.Response().Header().Set("Link", strings.Join(links, ", "))
+}
+
+// pageLink points at the current URL with its position parameters replaced
+// by the given key/value pairs.
+func pageLink(c echo.Context, rel string, params ...string) string {
+	query := c.QueryParams()
+	page := make(url.Values, len(query)+len(params)/2)
+	for key, values := range query {
+		if key != "offset" && key != "cursor" {
+			page[key] = values
+		}
+	}
+	for i := 0; i+1 < len(params); i += 2 {
+		page.Set(params[i], params[i+1])
+	}
+
+	target := url.URL{
+		Scheme:   c.Scheme(),
+		Host:     c.Request().Host,
+		Path:     c.Request().URL.Path,
+		RawQuery: page.Encode(),
+	}
+	return fmt.Sprintf("<%s>; rel=%q", target.String(), rel)
+}
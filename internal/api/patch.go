@@ -0,0 +1,115 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"privy/internal/validate"
+	m "privy/models"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const MIMEApplicationMergePatchJSON = "application/merge-patch+json"
+
+// bindCake reads the cake fields present in the request body. JSON bodies
+// follow RFC 7396: a member that is absent is left alone and a null member
+// clears the field. Form bodies set every key that is sent.
+func bindCake(c echo.Context) (m.CakePatch, error) {
+	mediaType, _, err := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if err != nil {
+		return m.CakePatch{}, echo.NewHTTPError(http.StatusUnsupportedMediaType, "content type must be "+MIMEApplicationMergePatchJSON+", "+echo.MIMEApplicationJSON+" or "+echo.MIMEApplicationForm)
+	}
+
+	switch mediaType {
+	case MIMEApplicationMergePatchJSON, echo.MIMEApplicationJSON:
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return m.CakePatch{}, echo.NewHTTPError(http.StatusBadRequest, "can't read request body")
+		}
+		return parseMergePatch(body)
+	case echo.MIMEApplicationForm, echo.MIMEMultipartForm:
+		form, err := c.FormParams()
+		if err != nil {
+			return m.CakePatch{}, echo.NewHTTPError(http.StatusBadRequest, "can't parse form body")
+		}
+		return parseFormPatch(form)
+	default:
+		return m.CakePatch{}, echo.NewHTTPError(http.StatusUnsupportedMediaType, "content type must be "+MIMEApplicationMergePatchJSON+", "+echo.MIMEApplicationJSON+" or "+echo.MIMEApplicationForm)
+	}
+}
+
+func parseMergePatch(body []byte) (m.CakePatch, error) {
+	var (
+		patch   m.CakePatch
+		members map[string]json.RawMessage
+	)
+
+	if err := json.Unmarshal(body, &members); err != nil || members == nil {
+		return m.CakePatch{}, echo.NewHTTPError(http.StatusBadRequest, "body must be a JSON object")
+	}
+
+	for name, raw := range members {
+		isNull := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+
+		switch name {
+		case "title":
+			if isNull {
+				return m.CakePatch{}, validate.Field("title", "required", "can't be null")
+			}
+			patch.Title = new(string)
+			if err := json.Unmarshal(raw, patch.Title); err != nil {
+				return m.CakePatch{}, validate.Field("title", "type", "must be a string")
+			}
+		case "description":
+			patch.Description = new(string)
+			if err := json.Unmarshal(raw, patch.Description); err != nil {
+				return m.CakePatch{}, validate.Field("description", "type", "must be a string or null")
+			}
+		case "rating":
+			if isNull {
+				return m.CakePatch{}, validate.Field("rating", "required", "can't be null")
+			}
+			patch.Rating = new(float32)
+			if err := json.Unmarshal(raw, patch.Rating); err != nil {
+				return m.CakePatch{}, validate.Field("rating", "type", "must be a number")
+			}
+		case "image":
+			patch.Image = new(string)
+			if err := json.Unmarshal(raw, patch.Image); err != nil {
+				return m.CakePatch{}, validate.Field("image", "type", "must be a string or null")
+			}
+		default:
+			return m.CakePatch{}, validate.Field(name, "unknown", "can't be changed")
+		}
+	}
+
+	return patch, nil
+}
+
+func parseFormPatch(form map[string][]string) (m.CakePatch, error) {
+	var patch m.CakePatch
+
+	if values, ok := form["title"]; ok {
+		patch.Title = &values[0]
+	}
+	if values, ok := form["description"]; ok {
+		patch.Description = &values[0]
+	}
+	if values, ok := form["rating"]; ok {
+		rating, err := strconv.ParseFloat(values[0], 32)
+		if err != nil {
+			return m.CakePatch{}, validate.Field("rating", "type", "must be a number")
+		}
+		value := float32(rating)
+		patch.Rating = &value
+	}
+	if values, ok := form["image"]; ok {
+		patch.Image = &values[0]
+	}
+
+	return patch, nil
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	m "privy/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	maxSearchLength = 200
+	dateLayout      = "2006-01-02"
+)
+
+// parseCakeQuery reads the listing parameters of GET /cakes. Whether a
+// sort field is allowed is decided by the repository, which owns the
+// column whitelist.
+func parseCakeQuery(c echo.Context, limits Limits) (m.CakeQuery, error) {
+	var (
+		err   error
+		query m.CakeQuery
+	)
+
+	if query.Limit, query.Offset, err = parsePage(c, limits); err != nil {
+		return m.CakeQuery{}, err
+	}
+
+	query.Search = strings.TrimSpace(c.QueryParam("q"))
+	if len([]rune(query.Search)) > maxSearchLength {
+		return m.CakeQuery{}, echo.NewHTTPError(http.StatusBadRequest, "q can't be longer than "+strconv.Itoa(maxSearchLength)+" characters")
+	}
+
+	if query.MinRating, err = parseRating(c, "rating_min"); err != nil {
+		return m.CakeQuery{}, err
+	}
+	if query.MaxRating, err = parseRating(c, "rating_max"); err != nil {
+		return m.CakeQuery{}, err
+	}
+	if query.MinRating != nil && query.MaxRating != nil && *query.MinRating > *query.MaxRating {
+		return m.CakeQuery{}, echo.NewHTTPError(http.StatusBadRequest, "rating_min can't be greater than rating_max")
+	}
+
+	bounds := []struct {
+		from, to       string
+		fromDst, toDst *time.Time
+	}{
+		{"created_from", "created_to", &query.CreatedFrom, &query.CreatedTo},
+		{"updated_from", "updated_to", &query.UpdatedFrom, &query.UpdatedTo},
+	}
+	for _, b := range bounds {
+		if *b.fromDst, err = parseTime(c, b.from, false); err != nil {
+			return m.CakeQuery{}, err
+		}
+		if *b.toDst, err = parseTime(c, b.to, true); err != nil {
+			return m.CakeQuery{}, err
+		}
+		if !b.fromDst.IsZero() && !b.toDst.IsZero() && b.fromDst.After(*b.toDst) {
+			return m.CakeQuery{}, echo.NewHTTPError(http.StatusBadRequest, b.from+" can't be after "+b.to)
+		}
+	}
+
+	query.Sort = parseSort(c.QueryParam("sort"))
+	return query, nil
+}
+
+// parsePage reads the limit and offset parameters shared by every list
+// endpoint.
+func parsePage(c echo.Context, limits Limits) (limit, offset int, err error) {
+	limit = limits.Default
+	if c.QueryParam("limit") != "" {
+		limit, err = strconv.Atoi(c.QueryParam("limit"))
+		if err != nil {
+			return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "limit must be an integer")
+		}
+		if limit < 1 || limit > limits.Max {
+			return 0, 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", limits.Max))
+		}
+	}
+	if c.QueryParam("offset") != "" {
+		offset, err = strconv.Atoi(c.QueryParam("offset"))
+		if err != nil {
+			return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "offset must be an integer")
+		}
+		if offset < 0 {
+			return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "offset can't be negative")
+		}
+	}
+	return limit, offset, nil
+}
+
+func parseRating(c echo.Context, name string) (*float32, error) {
+	raw := c.QueryParam(name)
+	if raw == "" {
+		return nil, nil
+	}
+	rating, err := strconv.ParseFloat(raw, 32)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, name+" must be a number")
+	}
+	value := float32(rating)
+	return &value, nil
+}
+
+// parseTime accepts RFC 3339 timestamps and plain dates. A plain date used
+// as an upper bound covers the whole day.
+func parseTime(c echo.Context, name string, upper bool) (time.Time, error) {
+	raw := c.QueryParam(name)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+		return t.UTC(), nil
+	}
+	day, err := time.Parse(dateLayout, raw)
+	if err != nil {
+		return time.Time{}, echo.NewHTTPError(http.StatusBadRequest, name+" must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
+	}
+	if upper {
+		return day.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+	}
+	return day, nil
+}
+
+// parseSort reads a comma separated list of fields, each descending when
+// prefixed with "-", e.g. "-rating,title".
+func parseSort(raw string) []m.SortField {
+	var sort []m.SortField
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if strings.HasPrefix(field, "-") {
+			sort = append(sort, m.SortField{Field: field[1:], Desc: true})
+		} else {
+			sort = append(sort, m.SortField{Field: strings.TrimPrefix(field, "+")})
+		}
+	}
+	return sort
+}
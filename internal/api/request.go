@@ -0,0 +1,81 @@
+package api
+
+import (
+	m "privy/models"
+	"strings"
+	"time"
+)
+
+// CakeRequest is the body of POST /cakes and PUT /cakes/:id. Every field
+// is required; pointers tell a missing field apart from a zero value.
+type CakeRequest struct {
+	Title       *string  `json:"title" validate:"required,max=100,title"`
+	Description *string  `json:"description" validate:"required,notblank,max=2000"`
+	Rating      *float32 `json:"rating" validate:"required,min=0,max=10"`
+	Image       *string  `json:"image" validate:"required,max=2048,image_url"`
+}
+
+// Cake returns the cake described by a validated request.
+func (r CakeRequest) Cake() m.Cake {
+	var cake m.Cake
+	m.CakePatch(r).Apply(&cake)
+	return cake
+}
+
+// CakePatchRequest is the body of PATCH /cakes/:id. Only the fields that
+// are sent are checked; description and image may be cleared.
+type CakePatchRequest struct {
+	Title       *string  `json:"title" validate:"max=100,title"`
+	Description *string  `json:"description" validate:"max=2000"`
+	Rating      *float32 `json:"rating" validate:"min=0,max=10"`
+	Image       *string  `json:"image" validate:"omitempty,max=2048,image_url"`
+}
+
+func (r CakePatchRequest) Patch() m.CakePatch {
+	return m.CakePatch(r)
+}
+
+// CakeImageRequest is the body of POST /cakes/:id/images. A zero position
+// adds the image at the end of the gallery.
+type CakeImageRequest struct {
+	URL      *string `json:"url" validate:"required,max=2048,image_url"`
+	Alt      string  `json:"alt" validate:"max=255"`
+	Position int     `json:"position" validate:"min=0"`
+	Primary  bool    `json:"primary"`
+}
+
+func (r CakeImageRequest) Image() m.CakeImage {
+	return m.CakeImage{URL: *r.URL, Alt: r.Alt, Position: r.Position, Primary: r.Primary}
+}
+
+// CakeImageOrderRequest is the body of PUT /cakes/:id/images/order.
+type CakeImageOrderRequest struct {
+	Order []int `json:"order" validate:"required"`
+}
+
+// CakeImagePatchRequest is the body of PATCH /cakes/:id/images/:image_id.
+type CakeImagePatchRequest struct {
+	Alt     *string `json:"alt" validate:"max=255"`
+	Primary bool    `json:"primary"`
+}
+
+func (r CakeImagePatchRequest) Patch() m.CakeImagePatch {
+	return m.CakeImagePatch(r)
+}
+
+// APIKeyRequest is the body of POST /admin/keys. A key without expires_at
+// never expires.
+type APIKeyRequest struct {
+	Name      *string    `json:"name" validate:"required,notblank,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (r APIKeyRequest) Key() m.APIKey {
+	key := m.APIKey{Name: strings.TrimSpace(*r.Name), Scopes: r.Scopes}
+	if r.ExpiresAt != nil {
+		expiresAt := r.ExpiresAt.UTC()
+		key.ExpiresAt = &expiresAt
+	}
+	return key
+}
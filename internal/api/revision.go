@@ -0,0 +1,102 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	m "privy/models"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (h *handler) GetRevisions(c echo.Context) (err error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if c.Param("id") == "" || err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "id must be an integer and can't be empty")
+	}
+
+	limit, offset, err := parsePage(c, h.limits)
+	if err != nil {
+		return err
+	}
+
+	revisions, err := h.repository.GetRevisions(c.Request().Context(), id, limit, offset)
+	if err != nil {
+		log.Println("[Delivery][GetRevisions] can't get revisions, err:", err.Error())
+		return err
+	}
+	total, err := h.repository.CountRevisions(c.Request().Context(), id)
+	if err != nil {
+		log.Println("[Delivery][GetRevisions] can't count revisions, err:", err.Error())
+		return err
+	}
+
+	meta := m.NewMeta(total, limit, offset)
+	setPageLinks(c, meta)
+
+	res := m.SetCollection(http.StatusOK, "success", revisions, meta)
+	return c.JSON(http.StatusOK, res)
+}
+
+// DiffRevisions compares the snapshots of the revisions given by the from
+// and to query parameters.
+func (h *handler) DiffRevisions(c echo.Context) (err error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if c.Param("id") == "" || err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "id must be an integer and can't be empty")
+	}
+
+	from, err := strconv.Atoi(c.QueryParam("from"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "from must be a revision number")
+	}
+	to, err := strconv.Atoi(c.QueryParam("to"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "to must be a revision number")
+	}
+
+	fromRevision, err := h.repository.GetRevision(c.Request().Context(), id, from)
+	if err != nil {
+		log.Println("[Delivery][DiffRevisions] can't get revision, err:", err.Error())
+		return err
+	}
+	toRevision, err := h.repository.GetRevision(c.Request().Context(), id, to)
+	if err != nil {
+		log.Println("[Delivery][DiffRevisions] can't get revision, err:", err.Error())
+		return err
+	}
+
+	diff := m.RevisionDiff{
+		CakeId:  id,
+		From:    from,
+		To:      to,
+		Changes: m.Diff(fromRevision.Snapshot, toRevision.Snapshot),
+	}
+	res := m.SetResponse(http.StatusOK, "success", diff)
+	return c.JSON(http.StatusOK, res)
+}
+func (h *handler) RevertCake(c echo.Context) (err error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if c.Param("id") == "" || err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "id must be an integer and can't be empty")
+	}
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if c.Param("rev") == "" || err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "rev must be an integer and can't be empty")
+	}
+
+	version, err := h.ifMatch(c, id)
+	if err != nil {
+		return err
+	}
+
+	returnCake, err := h.repository.RevertCake(c.Request().Context(), id, version, rev)
+	if err != nil {
+		log.Println("[Delivery][RevertCake] can't revert cake, err:", err.Error())
+		return err
+	}
+	setETag(c, returnCake)
+
+	res := m.SetResponse(http.StatusOK, "success", returnCake)
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,260 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"privy/internal/apperror"
+	mock_repo "privy/mock/repository"
+	m "privy/models"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+)
+
+func Test_handler_GetRevisions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+
+	intp := func(n int) *int { return &n }
+	tests := []struct {
+		name       string
+		id         string
+		query      string
+		statusCode int
+		meta       *m.Meta
+		mock       func()
+	}{
+		{
+			name:       "Success",
+			id:         "1",
+			query:      "?limit=1",
+			statusCode: http.StatusOK,
+			meta:       &m.Meta{Total: intp(2), Limit: 1, Offset: intp(0), Next: intp(1)},
+			mock: func() {
+				mockRepository.EXPECT().GetRevisions(gomock.Any(), 1, 1, 0).
+					Return([]m.Revision{{CakeId: 1, Number: 2, Action: m.RevisionUpdate}}, nil)
+				mockRepository.EXPECT().CountRevisions(gomock.Any(), 1).Return(2, nil)
+			},
+		},
+		{
+			name:       "id wrong format",
+			id:         "abc",
+			statusCode: http.StatusBadRequest,
+			mock:       func() {},
+		},
+		{
+			name:       "limit above maximum",
+			id:         "1",
+			query:      "?limit=501",
+			statusCode: http.StatusBadRequest,
+			mock:       func() {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/cakes/"+tt.id+"/revisions"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			c.SetPath("/cakes/:id/revisions")
+			c.SetParamNames("id")
+			c.SetParamValues(tt.id)
+
+			tt.mock()
+
+			h := &handler{
+				repository: mockRepository,
+				limits:     DefaultLimits,
+			}
+			if err := h.GetRevisions(c); err != nil {
+				HTTPErrorHandler(err, c)
+			}
+
+			assert.Equal(t, tt.statusCode, rec.Code)
+			if tt.meta != nil {
+				var res m.Response[[]m.Revision]
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatalf("can't decode response: %v", err)
+				}
+				assert.Equal(t, tt.meta, res.Meta)
+			}
+		})
+	}
+}
+func Test_handler_DiffRevisions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+
+	first := m.Revision{CakeId: 1, Number: 1, Snapshot: m.Cake{Id: 1, Title: "title", Description: "description", Rating: 8, Image: "a.jpg"}}
+	third := m.Revision{CakeId: 1, Number: 3, Snapshot: m.Cake{Id: 1, Title: "title", Description: "", Rating: 9.5, Image: "a.jpg"}}
+	tests := []struct {
+		name       string
+		query      string
+		statusCode int
+		want       *m.RevisionDiff
+		mock       func()
+	}{
+		{
+			name:       "Success",
+			query:      "?from=1&to=3",
+			statusCode: http.StatusOK,
+			want: &m.RevisionDiff{CakeId: 1, From: 1, To: 3, Changes: []m.Change{
+				{Field: "description", From: "description", To: ""},
+				{Field: "rating", From: float64(8), To: 9.5},
+			}},
+			mock: func() {
+				mockRepository.EXPECT().GetRevision(gomock.Any(), 1, 1).Return(first, nil)
+				mockRepository.EXPECT().GetRevision(gomock.Any(), 1, 3).Return(third, nil)
+			},
+		},
+		{
+			name:       "Same Revision",
+			query:      "?from=3&to=3",
+			statusCode: http.StatusOK,
+			want:       &m.RevisionDiff{CakeId: 1, From: 3, To: 3, Changes: []m.Change{}},
+			mock: func() {
+				mockRepository.EXPECT().GetRevision(gomock.Any(), 1, 3).Return(third, nil).Times(2)
+			},
+		},
+		{
+			name:       "Missing to",
+			query:      "?from=1",
+			statusCode: http.StatusBadRequest,
+			mock:       func() {},
+		},
+		{
+			name:       "Unknown Revision",
+			query:      "?from=1&to=9",
+			statusCode: http.StatusNotFound,
+			mock: func() {
+				mockRepository.EXPECT().GetRevision(gomock.Any(), 1, 1).Return(first, nil)
+				mockRepository.EXPECT().GetRevision(gomock.Any(), 1, 9).
+					Return(m.Revision{}, apperror.New(apperror.KindNotFound, "revision not found"))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/cakes/1/revisions/diff"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			c.SetPath("/cakes/:id/revisions/diff")
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+
+			tt.mock()
+
+			h := &handler{
+				repository: mockRepository,
+			}
+			if err := h.DiffRevisions(c); err != nil {
+				HTTPErrorHandler(err, c)
+			}
+
+			assert.Equal(t, tt.statusCode, rec.Code)
+			if tt.want != nil {
+				var res m.Response[m.RevisionDiff]
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatalf("can't decode response: %v", err)
+				}
+				assert.Equal(t, *tt.want, res.Data)
+			}
+		})
+	}
+}
+func Test_handler_RevertCake(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepository := mock_repo.NewMockRepository(ctrl)
+
+	tests := []struct {
+		name       string
+		rev        string
+		ifMatch    string
+		statusCode int
+		mock       func()
+	}{
+		{
+			name:       "Success",
+			rev:        "2",
+			statusCode: http.StatusOK,
+			mock: func() {
+				mockRepository.EXPECT().RevertCake(gomock.Any(), 1, 0, 2).
+					Return(m.Cake{Id: 1, Title: "title"}, nil)
+			},
+		},
+		{
+			name:       "If-Match",
+			rev:        "2",
+			ifMatch:    `"1-3"`,
+			statusCode: http.StatusOK,
+			mock: func() {
+				mockRepository.EXPECT().RevertCake(gomock.Any(), 1, 3, 2).
+					Return(m.Cake{Id: 1, Title: "title", Version: 4}, nil)
+			},
+		},
+		{
+			name:       "Stale If-Match",
+			rev:        "2",
+			ifMatch:    `"1-3"`,
+			statusCode: http.StatusPreconditionFailed,
+			mock: func() {
+				mockRepository.EXPECT().RevertCake(gomock.Any(), 1, 3, 2).
+					Return(m.Cake{}, apperror.New(apperror.KindPreconditionFailed, "cake has been changed since it was read"))
+			},
+		},
+		{
+			name:       "If-Match Of Another Cake",
+			rev:        "2",
+			ifMatch:    `"2-3"`,
+			statusCode: http.StatusPreconditionFailed,
+			mock:       func() {},
+		},
+		{
+			name:       "rev wrong format",
+			rev:        "latest",
+			statusCode: http.StatusBadRequest,
+			mock:       func() {},
+		},
+		{
+			name:       "Unknown Revision",
+			rev:        "9",
+			statusCode: http.StatusNotFound,
+			mock: func() {
+				mockRepository.EXPECT().RevertCake(gomock.Any(), 1, 0, 9).
+					Return(m.Cake{}, apperror.New(apperror.KindNotFound, "revision not found"))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/cakes/1/revisions/"+tt.rev+"/revert", nil)
+			if tt.ifMatch != "" {
+				req.Header.Set(HeaderIfMatch, tt.ifMatch)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			c.SetPath("/cakes/:id/revisions/:rev/revert")
+			c.SetParamNames("id", "rev")
+			c.SetParamValues("1", tt.rev)
+
+			tt.mock()
+
+			h := &handler{
+				repository: mockRepository,
+			}
+			if err := h.RevertCake(c); err != nil {
+				HTTPErrorHandler(err, c)
+			}
+
+			assert.Equal(t, tt.statusCode, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"privy/config"
+	"privy/internal/api"
+	"privy/internal/auth"
+	"privy/internal/imaging"
+	"privy/internal/repository"
+	"privy/internal/storage"
+	"privy/routes"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+)
+
+// Exit codes reported by the process for each way Run can end.
+const (
+	ExitOK       = 0
+	ExitServer   = 1
+	ExitConfig   = 2
+	ExitDatabase = 3
+	ExitShutdown = 4
+)
+
+var (
+	ErrDatabase = errors.New("database unavailable")
+	ErrServer   = errors.New("http server failed")
+	ErrShutdown = errors.New("graceful shutdown did not finish")
+)
+
+// App owns the database pool and the HTTP server for the lifetime of the
+// process.
+type App struct {
+	cfg        config.Config
+	db         *sql.DB
+	repository repository.Repository
+	variants   *imaging.Pool
+	echo       *echo.Echo
+}
+
+// New opens the database pool and the image store and wires the
+// repository, handlers and routes. The database is not contacted until Run.
+func New(cfg config.Config) (*App, error) {
+	var images storage.BlobStore
+	if cfg.Images.Dir != "" {
+		store, err := storage.NewLocalStore(cfg.Images.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("can't open image store: %w", err)
+		}
+		images = store
+	}
+
+	db, err := sql.Open("mysql", cfg.Database.DSN())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	db.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.Database.ConnMaxIdleTime)
+
+	a, err := newApp(cfg, db, images)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+func newApp(cfg config.Config, db *sql.DB, images storage.BlobStore) (*App, error) {
+	repository := withCache(cfg.Cache, cfg.Database.ReadTimeout, repository.New(db, repository.WithTimeouts(repository.Timeouts{
+		Read:  cfg.Database.ReadTimeout,
+		Write: cfg.Database.WriteTimeout,
+	})))
+	opts := []api.Option{
+		api.WithLimits(api.Limits{Default: cfg.Pagination.DefaultLimit, Max: cfg.Pagination.MaxLimit}),
+		api.WithCursorSecret([]byte(cfg.Pagination.CursorSecret)),
+		api.WithRequiredPreconditions(cfg.Preconditions.Required),
+		api.WithImportLimit(cfg.Import.MaxBytes),
+	}
+	var variants *imaging.Pool
+	if images != nil {
+		opts = append(opts, api.WithImages(images, cfg.Images.BaseURL, api.ImageLimits{
+			MaxBytes:  cfg.Images.MaxBytes,
+			MaxWidth:  cfg.Images.MaxWidth,
+			MaxHeight: cfg.Images.MaxHeight,
+		}))
+		if len(cfg.Images.Variants) > 0 || cfg.Images.PlaceholderWidth > 0 {
+			pool, err := newVariantPool(cfg.Images, images, repository)
+			if err != nil {
+				return nil, err
+			}
+			variants = pool
+			opts = append(opts, api.WithImageVariants(pool))
+		}
+	}
+	handler := api.New(repository, opts...)
+
+	verifier, err := newVerifier(cfg.JWT)
+	if err != nil {
+		return nil, err
+	}
+	guard := &api.Guard{
+		Verifier:       verifier,
+		Keys:           repository,
+		AdminToken:     cfg.Admin.Token,
+		AnonymousScope: cfg.Auth.AnonymousScope,
+		TouchInterval:  cfg.Auth.KeyTouchInterval,
+	}
+
+	e := routes.GetRoutes(handler, cfg, guard)
+	e.HideBanner = true
+	e.Server.ReadTimeout = cfg.Server.ReadTimeout
+	e.Server.WriteTimeout = cfg.Server.WriteTimeout
+
+	return &App{
+		cfg:        cfg,
+		db:         db,
+		repository: repository,
+		variants:   variants,
+		echo:       e,
+	}, nil
+}
+
+// newVariantPool starts the workers building the configured image
+// variants.
+func newVariantPool(cfg config.Images, store storage.BlobStore, recorder repository.ImageVariantRecorder) (*imaging.Pool, error) {
+	opts := imaging.Options{
+		Formats:          cfg.Formats,
+		PlaceholderWidth: cfg.PlaceholderWidth,
+		Quality:          cfg.Quality,
+		Workers:          cfg.Workers,
+		Queue:            cfg.Queue,
+	}
+	for _, spec := range cfg.Variants {
+		name, width, err := config.ParseVariant(spec)
+		if err != nil {
+			return nil, err
+		}
+		opts.Sizes = append(opts.Sizes, imaging.Size{Name: name, Width: width})
+	}
+	return imaging.NewPool(store, recorder, opts)
+}
+
+// newVerifier loads the keys verifying bearer tokens. Without any it
+// returns nil, and bearer tokens are refused.
+func newVerifier(cfg config.JWT) (*auth.Verifier, error) {
+	opts := auth.Options{
+		Secret:        []byte(cfg.Secret),
+		PublicKeyFile: cfg.PublicKeyFile,
+		JWKSFile:      cfg.JWKSFile,
+		Issuer:        cfg.Issuer,
+		Audience:      cfg.Audience,
+		ClockSkew:     cfg.ClockSkew,
+		DefaultScope:  cfg.DefaultScope,
+	}
+	if !opts.Enabled() {
+		return nil, nil
+	}
+	return auth.NewVerifier(opts)
+}
+
+// withCache wraps r in the configured read-through cache, if any. Loads
+// shared by concurrent misses are bounded by readTimeout.
+func withCache(cfg config.Cache, readTimeout time.Duration, r repository.Repository) repository.Repository {
+	var store repository.Store
+	switch cfg.Backend {
+	case "memory":
+		store = repository.NewMemoryStore(cfg.Size)
+	case "redis":
+		store = repository.NewRedisStore(redis.NewClient(&redis.Options{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDB,
+		}), "privy:")
+	default:
+		return r
+	}
+	return repository.NewCached(r, store, repository.WithTTL(cfg.TTL), repository.WithLoadTimeout(readTimeout))
+}
+
+// Run checks database connectivity, serves HTTP until ctx is cancelled and
+// then drains in-flight requests within the configured grace period. The
+// database pool is closed before Run returns.
+func (a *App) Run(ctx context.Context) error {
+	defer a.close()
+
+	if err := a.waitForDatabase(ctx); err != nil {
+		return err
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- a.echo.Start(a.cfg.Server.Address())
+	}()
+
+	select {
+	case err := <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return fmt.Errorf("%w: %v", ErrServer, err)
+	case <-ctx.Done():
+	}
+
+	log.Println("[App] shutting down, grace period:", a.cfg.Server.ShutdownGrace)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.cfg.Server.ShutdownGrace)
+	defer cancel()
+
+	if err := a.echo.Shutdown(shutdownCtx); err != nil {
+		_ = a.echo.Close()
+		return fmt.Errorf("%w: %v", ErrShutdown, err)
+	}
+	return nil
+}
+
+// waitForDatabase pings the database until it answers, doubling the wait
+// between attempts.
+func (a *App) waitForDatabase(ctx context.Context) error {
+	var (
+		err     error
+		backoff = a.cfg.Database.ConnectBackoff
+	)
+
+	for attempt := 1; attempt <= a.cfg.Database.ConnectAttempts; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, a.cfg.Database.DialTimeout)
+		err = a.db.PingContext(pingCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		log.Printf("[App] database ping %d/%d failed, err: %s", attempt, a.cfg.Database.ConnectAttempts, err.Error())
+
+		if attempt == a.cfg.Database.ConnectAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %v", ErrDatabase, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	return fmt.Errorf("%w: %v", ErrDatabase, err)
+}
+
+func (a *App) close() {
+	if a.variants != nil {
+		_ = a.variants.Close()
+	}
+	if closer, ok := a.repository.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Println("[App] can't close repository, err:", err.Error())
+		}
+	}
+	if err := a.db.Close(); err != nil {
+		log.Println("[App] can't close database, err:", err.Error())
+	}
+}
+
+// ExitCode maps the error returned by Run to the process exit status.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrDatabase):
+		return ExitDatabase
+	case errors.Is(err, ErrShutdown):
+		return ExitShutdown
+	default:
+		return ExitServer
+	}
+}
@@ -0,0 +1,236 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"privy/config"
+	"privy/database"
+	"privy/internal/repository"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-playground/assert/v2"
+	"github.com/labstack/echo/v4"
+)
+
+func testConfig() config.Config {
+	cfg := config.Default()
+	cfg.Server.Host = "127.0.0.1"
+	cfg.Server.Port = 0
+	cfg.Server.ShutdownGrace = time.Second
+	cfg.Database.ConnectAttempts = 3
+	cfg.Database.ConnectBackoff = time.Millisecond
+	return cfg
+}
+
+func waitForListener(t *testing.T, a *App) string {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		if addr := a.echo.ListenerAddr(); addr != nil {
+			return addr.String()
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("server did not start listening")
+	return ""
+}
+
+func TestApp_Run(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+
+	sqlMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	sqlMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	sqlMock.ExpectPing()
+	sqlMock.ExpectClose()
+
+	a, _ := newApp(testConfig(), db, nil)
+	a.echo.GET("/slow", func(c echo.Context) error {
+		time.Sleep(200 * time.Millisecond)
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- a.Run(ctx)
+	}()
+
+	addr := waitForListener(t, a)
+	status := make(chan int, 1)
+	go func() {
+		res, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			status <- 0
+			return
+		}
+		res.Body.Close()
+		status <- res.StatusCode
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	assert.Equal(t, http.StatusNoContent, <-status)
+	err = <-runErr
+	assert.Equal(t, nil, err)
+	assert.Equal(t, ExitOK, ExitCode(err))
+	if err := sqlMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestApp_Run_DatabaseUnavailable(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		sqlMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	}
+	sqlMock.ExpectClose()
+
+	a, _ := newApp(testConfig(), db, nil)
+	err = a.Run(context.Background())
+
+	assert.Equal(t, true, errors.Is(err, ErrDatabase))
+	assert.Equal(t, ExitDatabase, ExitCode(err))
+	if err := sqlMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_withCache(t *testing.T) {
+	tests := []struct {
+		backend string
+		cached  bool
+	}{
+		{backend: "none"},
+		{backend: "memory", cached: true},
+		{backend: "redis", cached: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.backend, func(t *testing.T) {
+			cfg := config.Default().Cache
+			cfg.Backend = tt.backend
+
+			r := withCache(cfg, time.Second, repository.New(nil))
+			_, cached := r.(*repository.CachedRepository)
+			assert.Equal(t, tt.cached, cached)
+		})
+	}
+}
+
+func Test_newApp_jwt(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	// Without any key configured, writes are refused rather than let through.
+	a, err := newApp(testConfig(), db, nil)
+	if err != nil {
+		t.Fatalf("newApp() error = %v", err)
+	}
+	for _, authorization := range []string{"", "Bearer token"} {
+		req := httptest.NewRequest(http.MethodPost, "/cakes", strings.NewReader(`{}`))
+		if authorization != "" {
+			req.Header.Set(echo.HeaderAuthorization, authorization)
+		}
+		rec := httptest.NewRecorder()
+		a.echo.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	}
+
+	cfg := testConfig()
+	cfg.JWT.Secret = strings.Repeat("s", 32)
+	a, err = newApp(cfg, db, nil)
+	if err != nil {
+		t.Fatalf("newApp() error = %v", err)
+	}
+	rec := httptest.NewRecorder()
+	a.echo.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/cakes", strings.NewReader(`{}`)))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	cfg = testConfig()
+	cfg.JWT.JWKSFile = filepath.Join(t.TempDir(), "missing.json")
+	_, err = newApp(cfg, db, nil)
+	if err == nil || !strings.Contains(err.Error(), "can't read JWKS file") {
+		t.Errorf("newApp() error = %v, want a JWKS error", err)
+	}
+}
+
+func Test_newApp_scopes(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	cfg := testConfig()
+	cfg.Auth.AnonymousScope = ""
+	a, err := newApp(cfg, db, nil)
+	if err != nil {
+		t.Fatalf("newApp() error = %v", err)
+	}
+	for _, target := range []string{"/cakes", "/admin/keys"} {
+		rec := httptest.NewRecorder()
+		a.echo.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "ApiKey", rec.Header().Get(echo.HeaderWWWAuthenticate))
+	}
+}
+
+func TestApp_Run_SlowExport(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+
+	sqlMock.ExpectPing()
+	sqlMock.ExpectPrepare(regexp.QuoteMeta(database.ExportCakes)).ExpectQuery().
+		WillDelayFor(300 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "description", "rating", "image", "version", "created_at", "updated_at", "deleted_at"}).
+			AddRow(1, "title", "desc", 10, "https://example.com/cake.png", 1, time.Now(), time.Now(), nil))
+	sqlMock.ExpectClose()
+
+	// The export takes longer than the write timeout of the server.
+	cfg := testConfig()
+	cfg.Server.WriteTimeout = 100 * time.Millisecond
+	a, _ := newApp(cfg, db, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- a.Run(ctx)
+	}()
+
+	res, err := http.Get("http://" + waitForListener(t, a) + "/cakes/export?format=ndjson")
+	if err != nil {
+		t.Fatalf("GET /cakes/export error = %v", err)
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatalf("can't read export: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, true, strings.Contains(string(body), `"title":"title"`))
+
+	cancel()
+	assert.Equal(t, nil, <-runErr)
+	if err := sqlMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,40 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"privy/config"
+	"privy/internal/api"
+	"privy/internal/apperror"
+	"privy/internal/repository"
+	m "privy/models"
+)
+
+// CreateAPIKey mints the key req describes straight into the database of
+// cfg, so the first admin key can be made before the server has any.
+func CreateAPIKey(ctx context.Context, cfg config.Config, req api.APIKeyRequest) (m.NewAPIKey, error) {
+	db, err := sql.Open("mysql", cfg.Database.DSN())
+	if err != nil {
+		return m.NewAPIKey{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	a := &App{
+		cfg: cfg,
+		db:  db,
+		repository: repository.New(db, repository.WithTimeouts(repository.Timeouts{
+			Read:  cfg.Database.ReadTimeout,
+			Write: cfg.Database.WriteTimeout,
+		})),
+	}
+	defer a.close()
+
+	if err := a.waitForDatabase(ctx); err != nil {
+		return m.NewAPIKey{}, err
+	}
+
+	created, err := api.MintAPIKey(ctx, a.repository, req)
+	if err != nil && apperror.KindOf(err) != apperror.KindValidation {
+		return m.NewAPIKey{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return created, err
+}
@@ -0,0 +1,110 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kind classifies an error by how a client should react to it, independent
+// of the driver or layer that produced it.
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindNotFound
+	KindConflict
+	KindValidation
+	KindTimeout
+	KindUnavailable
+	KindPreconditionFailed
+	KindPreconditionRequired
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindNotFound:
+		return "not found"
+	case KindConflict:
+		return "conflict"
+	case KindValidation:
+		return "validation failed"
+	case KindTimeout:
+		return "timeout"
+	case KindUnavailable:
+		return "unavailable"
+	case KindPreconditionFailed:
+		return "precondition failed"
+	case KindPreconditionRequired:
+		return "precondition required"
+	default:
+		return "internal error"
+	}
+}
+
+// Error carries a Kind, a message that is safe to show to clients and the
+// underlying cause, which is kept for logs only.
+type Error struct {
+	Kind    Kind
+	Message string
+	Err     error
+}
+
+var (
+	ErrInternal             = &Error{Kind: KindInternal, Message: "internal server error"}
+	ErrNotFound             = &Error{Kind: KindNotFound, Message: "not found"}
+	ErrConflict             = &Error{Kind: KindConflict, Message: "conflict"}
+	ErrValidation           = &Error{Kind: KindValidation, Message: "validation failed"}
+	ErrTimeout              = &Error{Kind: KindTimeout, Message: "query deadline exceeded"}
+	ErrUnavailable          = &Error{Kind: KindUnavailable, Message: "service unavailable"}
+	ErrPreconditionFailed   = &Error{Kind: KindPreconditionFailed, Message: "precondition failed"}
+	ErrPreconditionRequired = &Error{Kind: KindPreconditionRequired, Message: "precondition required"}
+)
+
+func New(kind Kind, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+func Wrap(kind Kind, message string, err error) *Error {
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an *Error of the same Kind, so that
+// errors.Is(err, ErrNotFound) holds for every not-found error.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return t.Kind == e.Kind
+}
+
+// KindOf returns the Kind of the first *Error in err's chain, or
+// KindInternal when there is none.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindInternal
+}
+
+// MessageOf returns the client-safe message of err. Errors outside the
+// taxonomy never leak their text.
+func MessageOf(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Message
+	}
+	return ErrInternal.Message
+}
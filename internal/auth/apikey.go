@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// APIKeyPrefix starts every API key, so leaked keys are easy to scan for.
+const APIKeyPrefix = "privy_"
+
+// apiKeyShown is how many characters of a key are kept as its prefix.
+const apiKeyShown = len(APIKeyPrefix) + 8
+
+// NewAPIKey returns a random API key, the prefix it is listed under and
+// the hash it is stored as.
+func NewAPIKey() (key, prefix, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, key[:apiKeyShown], HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the hash key is stored and looked up as. Keys carry
+// 256 random bits, so a plain sha256 is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	key, prefix, hash, err := NewAPIKey()
+	if err != nil {
+		t.Fatalf("NewAPIKey() error = %v", err)
+	}
+	other, _, _, _ := NewAPIKey()
+
+	assert.Equal(t, true, strings.HasPrefix(key, APIKeyPrefix))
+	assert.Equal(t, 49, len(key))
+	assert.Equal(t, key[:14], prefix)
+	assert.Equal(t, HashAPIKey(key), hash)
+	assert.Equal(t, 64, len(hash))
+	assert.NotEqual(t, key, other)
+}
+
+func TestGrants(t *testing.T) {
+	tests := []struct {
+		granted []string
+		scope   string
+		want    bool
+	}{
+		{granted: []string{ScopeRead}, scope: ScopeRead, want: true},
+		{granted: []string{ScopeRead}, scope: ScopeWrite},
+		{granted: []string{ScopeWrite}, scope: ScopeRead, want: true},
+		{granted: []string{ScopeWrite}, scope: ScopeAdmin},
+		{granted: []string{ScopeRead, ScopeAdmin}, scope: ScopeWrite, want: true},
+		{granted: []string{"cakes:delete"}, scope: ScopeRead},
+		{granted: []string{ScopeAdmin}, scope: "cakes:delete"},
+		{scope: ScopeRead},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.granted, " ")+" "+tt.scope, func(t *testing.T) {
+			assert.Equal(t, tt.want, Grants(tt.granted, tt.scope))
+		})
+	}
+}
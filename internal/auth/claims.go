@@ -0,0 +1,121 @@
+// Package auth verifies the credentials requests carry and keeps what they
+// prove about the caller in the request context.
+package auth
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+)
+
+// Claims are the claims of a verified token. Scopes come from the
+// space-separated "scope" claim, or the "scp" list some issuers use.
+type Claims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+	Scopes    []string
+	Raw       map[string]interface{}
+}
+
+// HasScope reports whether the claims grant scope.
+func (c Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Scopes a credential can grant. Each one implies the ones before it, so
+// an admin key can also write and read.
+const (
+	ScopeRead  = "cakes:read"
+	ScopeWrite = "cakes:write"
+	ScopeAdmin = "cakes:admin"
+)
+
+var scopeLevels = map[string]int{ScopeRead: 1, ScopeWrite: 2, ScopeAdmin: 3}
+
+// ValidScope reports whether scope is one a key can be given.
+func ValidScope(scope string) bool {
+	return scopeLevels[scope] > 0
+}
+
+// Grants reports whether holding granted lets a caller use scope.
+func Grants(granted []string, scope string) bool {
+	for _, s := range granted {
+		if scopeLevels[s] >= scopeLevels[scope] && scopeLevels[scope] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the claims grant scope, or a scope implying it.
+func (c Claims) Allows(scope string) bool {
+	return Grants(c.Scopes, scope)
+}
+
+type contextKey struct{}
+
+// WithClaims returns a copy of ctx carrying claims.
+func WithClaims(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// ClaimsFrom returns the claims of ctx, if it carries any.
+func ClaimsFrom(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(Claims)
+	return claims, ok
+}
+
+// claimsOf reads the registered claims and scopes out of raw.
+func claimsOf(raw map[string]interface{}) Claims {
+	claims := Claims{Raw: raw}
+	claims.Subject, _ = raw["sub"].(string)
+	claims.Issuer, _ = raw["iss"].(string)
+	claims.Audience = stringsOf(raw["aud"])
+	claims.ExpiresAt = timeOf(raw["exp"])
+	claims.NotBefore = timeOf(raw["nbf"])
+	claims.IssuedAt = timeOf(raw["iat"])
+	if scope, ok := raw["scope"].(string); ok {
+		claims.Scopes = strings.Fields(scope)
+	} else {
+		claims.Scopes = stringsOf(raw["scp"])
+	}
+	return claims
+}
+
+// stringsOf reads a claim that is either a string or a list of them.
+func stringsOf(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
+
+// timeOf reads a NumericDate claim, or returns the zero time.
+func timeOf(v interface{}) time.Time {
+	seconds, ok := v.(float64)
+	if !ok {
+		return time.Time{}
+	}
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*float64(time.Second))).UTC()
+}
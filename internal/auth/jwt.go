@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Signing algorithms a Verifier accepts.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+)
+
+// jwksReloadInterval bounds how often a token with an unknown kid makes
+// the JWKS file be read again, so keys can be rotated without a restart.
+const jwksReloadInterval = time.Minute
+
+// ErrInvalidToken is wrapped by every error Verify returns. Their messages
+// are safe to send back to the client.
+var ErrInvalidToken = errors.New("token is invalid")
+
+// Options configure a Verifier. Secret verifies HS256 tokens; the PEM
+// public key in PublicKeyFile and the keys of the JWKS file verify RS256
+// ones. Issuer and Audience are checked when set, and ClockSkew is the
+// leeway given to the exp, nbf and iat claims. Tokens without a scope or
+// scp claim are granted DefaultScope, if any.
+type Options struct {
+	Secret        []byte
+	PublicKeyFile string
+	JWKSFile      string
+	Issuer        string
+	Audience      string
+	ClockSkew     time.Duration
+	DefaultScope  string
+}
+
+// Enabled reports whether any key is configured.
+func (o Options) Enabled() bool {
+	return len(o.Secret) > 0 || o.PublicKeyFile != "" || o.JWKSFile != ""
+}
+
+// Verifier checks the signature and the claims of bearer tokens.
+type Verifier struct {
+	opts      Options
+	publicKey *rsa.PublicKey
+	now       func() time.Time
+
+	mu       sync.Mutex
+	jwks     map[string]*rsa.PublicKey
+	loadedAt time.Time
+}
+
+// NewVerifier loads the keys of opts. At least one key must be configured.
+func NewVerifier(opts Options) (*Verifier, error) {
+	if !opts.Enabled() {
+		return nil, errors.New("no JWT key is configured")
+	}
+
+	v := &Verifier{opts: opts, now: time.Now}
+	if opts.PublicKeyFile != "" {
+		data, err := os.ReadFile(opts.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read JWT public key: %w", err)
+		}
+		if v.publicKey, err = jwt.ParseRSAPublicKeyFromPEM(data); err != nil {
+			return nil, fmt.Errorf("can't parse JWT public key %s: %w", opts.PublicKeyFile, err)
+		}
+	}
+	if opts.JWKSFile != "" {
+		keys, err := loadJWKS(opts.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.jwks, v.loadedAt = keys, v.now()
+	}
+	return v, nil
+}
+
+// Verify returns the claims of token once its signature, expiry, issuer
+// and audience are checked. A token without exp is refused.
+func (v *Verifier) Verify(token string) (Claims, error) {
+	parser := jwt.Parser{ValidMethods: []string{HS256, RS256}, SkipClaimsValidation: true}
+	parsed, err := parser.Parse(token, v.key)
+	if err != nil {
+		return Claims{}, parseError(err)
+	}
+	raw, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return Claims{}, invalid("claims are not an object")
+	}
+
+	claims := claimsOf(raw)
+	if err = v.check(claims); err != nil {
+		return Claims{}, err
+	}
+	if len(claims.Scopes) == 0 && v.opts.DefaultScope != "" {
+		claims.Scopes = []string{v.opts.DefaultScope}
+	}
+	return claims, nil
+}
+
+// key picks the key of a token by its alg and kid. The secret is only
+// handed out for HS256, so an RS256 public key can't be used as an HMAC
+// secret.
+func (v *Verifier) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	switch token.Method.Alg() {
+	case HS256:
+		if len(v.opts.Secret) == 0 {
+			return nil, invalid("HS256 tokens are not accepted")
+		}
+		return v.opts.Secret, nil
+	case RS256:
+		if key := v.rsaKey(kid); key != nil {
+			return key, nil
+		}
+		if v.publicKey == nil && v.opts.JWKSFile == "" {
+			return nil, invalid("RS256 tokens are not accepted")
+		}
+		return nil, invalid(fmt.Sprintf("no key for kid %q", kid))
+	default:
+		return nil, invalid("signing method is not accepted")
+	}
+}
+
+// rsaKey returns the RSA key for kid: a JWKS key, or the PEM key for a
+// token without kid. An unknown kid rereads the JWKS file at most once per
+// jwksReloadInterval.
+func (v *Verifier) rsaKey(kid string) *rsa.PublicKey {
+	if kid == "" && v.publicKey != nil {
+		return v.publicKey
+	}
+	if v.opts.JWKSFile == "" {
+		return nil
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if key, ok := v.jwks[kid]; ok {
+		return key
+	}
+	if kid == "" && len(v.jwks) == 1 {
+		for _, key := range v.jwks {
+			return key
+		}
+	}
+	if v.now().Sub(v.loadedAt) < jwksReloadInterval {
+		return nil
+	}
+
+	v.loadedAt = v.now()
+	keys, err := loadJWKS(v.opts.JWKSFile)
+	if err != nil {
+		return nil
+	}
+	v.jwks = keys
+	return keys[kid]
+}
+
+// check validates the time claims, with ClockSkew of leeway, and the
+// issuer and audience.
+func (v *Verifier) check(claims Claims) error {
+	now, skew := v.now(), v.opts.ClockSkew
+	if claims.ExpiresAt.IsZero() {
+		return invalid("token has no expiry")
+	}
+	if now.After(claims.ExpiresAt.Add(skew)) {
+		return invalid("token has expired")
+	}
+	if !claims.NotBefore.IsZero() && claims.NotBefore.After(now.Add(skew)) {
+		return invalid("token is not valid yet")
+	}
+	if !claims.IssuedAt.IsZero() && claims.IssuedAt.After(now.Add(skew)) {
+		return invalid("token is issued in the future")
+	}
+	if v.opts.Issuer != "" && claims.Issuer != v.opts.Issuer {
+		return invalid("issuer is not accepted")
+	}
+	if v.opts.Audience != "" && !contains(claims.Audience, v.opts.Audience) {
+		return invalid("audience is not accepted")
+	}
+	return nil
+}
+
+func invalid(reason string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidToken, reason)
+}
+
+// parseError turns an error of the parser into one safe to show.
+func parseError(err error) error {
+	var validation *jwt.ValidationError
+	if !errors.As(err, &validation) {
+		return invalid("token can't be parsed")
+	}
+	if errors.Is(validation.Inner, ErrInvalidToken) {
+		return validation.Inner
+	}
+	switch {
+	case validation.Errors&jwt.ValidationErrorMalformed != 0:
+		return invalid("token is malformed")
+	case validation.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+		return invalid("signature is invalid")
+	default:
+		return invalid("token can't be verified")
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,300 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/golang-jwt/jwt"
+)
+
+var (
+	testSecret = []byte("0123456789abcdef0123456789abcdef")
+	testNow    = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func rsaKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("can't generate key: %v", err)
+	}
+	return key
+}
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("can't write %s: %v", name, err)
+	}
+	return path
+}
+
+func pemOf(t *testing.T, key *rsa.PublicKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("can't marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func jwksOf(t *testing.T, keys map[string]*rsa.PublicKey) []byte {
+	t.Helper()
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	for kid, key := range keys {
+		set.Keys = append(set.Keys, jwk{
+			Kty: "RSA", Kid: kid, Use: "sig", Alg: RS256,
+			N: base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	data, _ := json.Marshal(set)
+	return data
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("can't sign token: %v", err)
+	}
+	return signed
+}
+
+func claimsAt(exp time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   "baker",
+		"iss":   "https://id.privy.test",
+		"aud":   []string{"privy"},
+		"exp":   exp.Unix(),
+		"iat":   testNow.Add(-time.Minute).Unix(),
+		"scope": "cakes:read cakes:write",
+	}
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	key, other := rsaKey(t), rsaKey(t)
+	pemFile := writeFile(t, "key.pem", pemOf(t, &key.PublicKey))
+	jwksFile := writeFile(t, "jwks.json", jwksOf(t, map[string]*rsa.PublicKey{"k1": &key.PublicKey}))
+	valid := claimsAt(testNow.Add(time.Hour))
+
+	tests := []struct {
+		name    string
+		opts    Options
+		token   string
+		wantErr string
+	}{
+		{
+			name:  "HS256",
+			opts:  Options{Secret: testSecret},
+			token: sign(t, jwt.SigningMethodHS256, testSecret, "", valid),
+		},
+		{
+			name:  "RS256 PEM",
+			opts:  Options{PublicKeyFile: pemFile},
+			token: sign(t, jwt.SigningMethodRS256, key, "", valid),
+		},
+		{
+			name:  "RS256 JWKS",
+			opts:  Options{JWKSFile: jwksFile},
+			token: sign(t, jwt.SigningMethodRS256, key, "k1", valid),
+		},
+		{
+			name:    "Unknown Kid",
+			opts:    Options{JWKSFile: jwksFile},
+			token:   sign(t, jwt.SigningMethodRS256, key, "k2", valid),
+			wantErr: `token is invalid: no key for kid "k2"`,
+		},
+		{
+			name:    "Wrong Key",
+			opts:    Options{PublicKeyFile: pemFile},
+			token:   sign(t, jwt.SigningMethodRS256, other, "", valid),
+			wantErr: "token is invalid: signature is invalid",
+		},
+		{
+			name:    "Public Key As HMAC Secret",
+			opts:    Options{PublicKeyFile: pemFile},
+			token:   sign(t, jwt.SigningMethodHS256, pemOf(t, &key.PublicKey), "", valid),
+			wantErr: "token is invalid: HS256 tokens are not accepted",
+		},
+		{
+			name:    "None Algorithm",
+			opts:    Options{Secret: testSecret},
+			token:   sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", valid),
+			wantErr: "token is invalid: signature is invalid",
+		},
+		{
+			name:    "Malformed",
+			opts:    Options{Secret: testSecret},
+			token:   "not.a.token",
+			wantErr: "token is invalid: token is malformed",
+		},
+		{
+			name:  "Expired Within Skew",
+			opts:  Options{Secret: testSecret, ClockSkew: time.Minute},
+			token: sign(t, jwt.SigningMethodHS256, testSecret, "", claimsAt(testNow.Add(-30*time.Second))),
+		},
+		{
+			name:    "Expired",
+			opts:    Options{Secret: testSecret, ClockSkew: time.Minute},
+			token:   sign(t, jwt.SigningMethodHS256, testSecret, "", claimsAt(testNow.Add(-2*time.Minute))),
+			wantErr: "token is invalid: token has expired",
+		},
+		{
+			name:    "Without Expiry",
+			opts:    Options{Secret: testSecret},
+			token:   sign(t, jwt.SigningMethodHS256, testSecret, "", jwt.MapClaims{"sub": "baker"}),
+			wantErr: "token is invalid: token has no expiry",
+		},
+		{
+			name: "Not Valid Yet",
+			opts: Options{Secret: testSecret, ClockSkew: time.Minute},
+			token: sign(t, jwt.SigningMethodHS256, testSecret, "", jwt.MapClaims{
+				"exp": testNow.Add(time.Hour).Unix(), "nbf": testNow.Add(5 * time.Minute).Unix(),
+			}),
+			wantErr: "token is invalid: token is not valid yet",
+		},
+		{
+			name:  "Issuer And Audience",
+			opts:  Options{Secret: testSecret, Issuer: "https://id.privy.test", Audience: "privy"},
+			token: sign(t, jwt.SigningMethodHS256, testSecret, "", valid),
+		},
+		{
+			name:    "Wrong Issuer",
+			opts:    Options{Secret: testSecret, Issuer: "https://id.other.test"},
+			token:   sign(t, jwt.SigningMethodHS256, testSecret, "", valid),
+			wantErr: "token is invalid: issuer is not accepted",
+		},
+		{
+			name:    "Wrong Audience",
+			opts:    Options{Secret: testSecret, Audience: "bakery"},
+			token:   sign(t, jwt.SigningMethodHS256, testSecret, "", valid),
+			wantErr: "token is invalid: audience is not accepted",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewVerifier(tt.opts)
+			if err != nil {
+				t.Fatalf("NewVerifier() error = %v", err)
+			}
+			v.now = func() time.Time { return testNow }
+
+			claims, err := v.Verify(tt.token)
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("Verify() error = nil, want %q", tt.wantErr)
+				}
+				assert.Equal(t, tt.wantErr, err.Error())
+				assert.Equal(t, true, errors.Is(err, ErrInvalidToken))
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			assert.Equal(t, "baker", claims.Subject)
+			assert.Equal(t, []string{"cakes:read", "cakes:write"}, claims.Scopes)
+			assert.Equal(t, true, claims.HasScope("cakes:write"))
+			assert.Equal(t, false, claims.HasScope("cakes:admin"))
+		})
+	}
+}
+
+func TestVerifier_defaultScope(t *testing.T) {
+	unscoped := claimsAt(testNow.Add(time.Hour))
+	delete(unscoped, "scope")
+
+	tests := []struct {
+		name         string
+		defaultScope string
+		claims       jwt.MapClaims
+		want         []string
+	}{
+		{name: "Granted To Tokens Without Scope", defaultScope: ScopeWrite, claims: unscoped, want: []string{ScopeWrite}},
+		{name: "Ignored When Tokens Carry Scopes", defaultScope: ScopeWrite, claims: claimsAt(testNow.Add(time.Hour)), want: []string{ScopeRead, ScopeWrite}},
+		{name: "None Configured", claims: unscoped},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewVerifier(Options{Secret: testSecret, DefaultScope: tt.defaultScope})
+			if err != nil {
+				t.Fatalf("NewVerifier() error = %v", err)
+			}
+			v.now = func() time.Time { return testNow }
+
+			claims, err := v.Verify(sign(t, jwt.SigningMethodHS256, testSecret, "", tt.claims))
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			assert.Equal(t, tt.want, claims.Scopes)
+		})
+	}
+}
+
+func TestVerifier_reloadsJWKS(t *testing.T) {
+	first, second := rsaKey(t), rsaKey(t)
+	path := writeFile(t, "jwks.json", jwksOf(t, map[string]*rsa.PublicKey{"k1": &first.PublicKey}))
+	v, err := NewVerifier(Options{JWKSFile: path})
+	if err != nil {
+		t.Fatalf("NewVerifier() error = %v", err)
+	}
+	now := testNow
+	v.now = func() time.Time { return now }
+	v.loadedAt = now
+
+	rotated := jwksOf(t, map[string]*rsa.PublicKey{"k1": &first.PublicKey, "k2": &second.PublicKey})
+	if err = os.WriteFile(path, rotated, 0o600); err != nil {
+		t.Fatalf("can't rotate keys: %v", err)
+	}
+	token := sign(t, jwt.SigningMethodRS256, second, "k2", claimsAt(testNow.Add(time.Hour)))
+
+	_, err = v.Verify(token)
+	assert.Equal(t, true, errors.Is(err, ErrInvalidToken))
+
+	now = now.Add(jwksReloadInterval)
+	if _, err = v.Verify(token); err != nil {
+		t.Fatalf("Verify() after reload error = %v", err)
+	}
+}
+
+func TestNewVerifier_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr string
+	}{
+		{name: "No Key", opts: Options{}, wantErr: "no JWT key is configured"},
+		{name: "Missing PEM", opts: Options{PublicKeyFile: filepath.Join(t.TempDir(), "missing.pem")}, wantErr: "can't read JWT public key"},
+		{name: "Invalid PEM", opts: Options{PublicKeyFile: writeFile(t, "key.pem", []byte("key"))}, wantErr: "can't parse JWT public key"},
+		{name: "Invalid JWKS", opts: Options{JWKSFile: writeFile(t, "jwks.json", []byte("{"))}, wantErr: "can't parse JWKS file"},
+		{name: "JWKS Without RSA Keys", opts: Options{JWKSFile: writeFile(t, "jwks.json", []byte(`{"keys":[{"kty":"EC","kid":"k1"}]}`))}, wantErr: "has no RS256 signing keys"},
+		{name: "JWKS Bad Exponent", opts: Options{JWKSFile: writeFile(t, "jwks.json", []byte(`{"keys":[{"kty":"RSA","kid":"k1","n":"AQAB","e":"!"}]}`))}, wantErr: "exponent is not a base64url integer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewVerifier(tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewVerifier() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
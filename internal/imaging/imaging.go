@@ -0,0 +1,133 @@
+// Package imaging builds the variants of uploaded cake images: resized
+// renditions in each configured format and a blurred placeholder small
+// enough to inline. Pool builds them in the background.
+package imaging
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Size is a named width variants are built at. Images narrower than Width
+// are never enlarged.
+type Size struct {
+	Name  string
+	Width int
+}
+
+// Encoder writes images in one format. Quality runs from 1 to 100 and may
+// be ignored by lossless formats.
+type Encoder struct {
+	ContentType string
+	Ext         string
+	Encode      func(w io.Writer, img image.Image, quality int) error
+}
+
+// encoders are the formats variants can be built in; webp.go adds WebP
+// when built with cgo.
+var encoders = map[string]Encoder{
+	"jpeg": {ContentType: "image/jpeg", Ext: ".jpg", Encode: encodeJPEG},
+	"png":  {ContentType: "image/png", Ext: ".png", Encode: encodePNG},
+}
+
+func encoderFor(format string) (Encoder, error) {
+	enc, ok := encoders[format]
+	if !ok {
+		return Encoder{}, fmt.Errorf("imaging: no encoder for %s", format)
+	}
+	return enc, nil
+}
+
+func encodeJPEG(w io.Writer, img image.Image, quality int) error {
+	return jpeg.Encode(w, flatten(img), &jpeg.Options{Quality: quality})
+}
+
+func encodePNG(w io.Writer, img image.Image, _ int) error {
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	return enc.Encode(w, img)
+}
+
+// flatten lays img on white, since JPEG has no transparency and would show
+// transparent pixels as black.
+func flatten(img image.Image) image.Image {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return img
+	}
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
+
+// Resize scales img down to width, keeping its aspect ratio. Images that
+// are narrow enough already are returned as they are.
+func Resize(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if width <= 0 || width >= bounds.Dx() {
+		return img
+	}
+	height := (bounds.Dy()*width + bounds.Dx()/2) / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// Placeholder is img shrunk to width and blurred, as a data URI of a
+// low-quality JPEG. Stretched to the size of the real image it stands in
+// for it while that loads.
+func Placeholder(img image.Image, width int) (string, image.Rectangle, error) {
+	small := blur(Resize(img, width))
+	var buf bytes.Buffer
+	if err := encodeJPEG(&buf, small, 40); err != nil {
+		return "", image.Rectangle{}, err
+	}
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), small.Bounds(), nil
+}
+
+// blur averages every pixel with its neighbours, twice, which is close
+// enough to a gaussian blur at placeholder sizes.
+func blur(img image.Image) image.Image {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	for pass := 0; pass < 2; pass++ {
+		dst := image.NewRGBA(src.Bounds())
+		for y := 0; y < src.Rect.Dy(); y++ {
+			for x := 0; x < src.Rect.Dx(); x++ {
+				var sum [4]int
+				n := 0
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						if !(image.Point{x + dx, y + dy}.In(src.Rect)) {
+							continue
+						}
+						i := src.PixOffset(x+dx, y+dy)
+						for c := 0; c < 4; c++ {
+							sum[c] += int(src.Pix[i+c])
+						}
+						n++
+					}
+				}
+				i := dst.PixOffset(x, y)
+				for c := 0; c < 4; c++ {
+					dst.Pix[i+c] = uint8(sum[c] / n)
+				}
+			}
+		}
+		src = dst
+	}
+	return src
+}
@@ -0,0 +1,70 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestResize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	tests := []struct {
+		name  string
+		width int
+		want  image.Rectangle
+	}{
+		{name: "Scales down keeping the ratio", width: 160, want: image.Rect(0, 0, 160, 120)},
+		{name: "Never enlarges", width: 1280, want: image.Rect(0, 0, 400, 300)},
+		{name: "Keeps a pixel of height", width: 1, want: image.Rect(0, 0, 1, 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Resize(src, tt.width).Bounds())
+		})
+	}
+}
+
+func TestPlaceholder(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for x := 0; x < 400; x++ {
+		for y := 0; y < 200; y++ {
+			if x < 200 {
+				src.Set(x, y, color.White)
+			} else {
+				src.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	uri, bounds, err := Placeholder(src, 16)
+	if err != nil {
+		t.Fatalf("Placeholder() error = %v", err)
+	}
+	assert.Equal(t, image.Rect(0, 0, 16, 8), bounds)
+	if !strings.HasPrefix(uri, "data:image/jpeg;base64,") {
+		t.Fatalf("Placeholder() = %s, want a jpeg data URI", uri)
+	}
+	raw, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(uri, "data:image/jpeg;base64,"))
+	img, err := jpeg.Decode(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("can't decode placeholder: %v", err)
+	}
+	// The hard edge in the middle is blurred into a grey.
+	r, _, _, _ := img.At(8, 4).RGBA()
+	if r>>8 < 40 || r>>8 > 215 {
+		t.Errorf("placeholder edge = %d, want it blurred", r>>8)
+	}
+}
+
+func Test_flatten(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	got := flatten(src).At(0, 0)
+	r, g, b, a := got.RGBA()
+	assert.Equal(t, [4]uint32{0xffff, 0xffff, 0xffff, 0xffff}, [4]uint32{r, g, b, a})
+}
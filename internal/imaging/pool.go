@@ -0,0 +1,233 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"path"
+	"privy/internal/repository"
+	"privy/internal/storage"
+	m "privy/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jobTimeout bounds the work on one image, storing included.
+const jobTimeout = time.Minute
+
+// Options configure the variants a Pool builds and how many at once.
+type Options struct {
+	Sizes            []Size
+	Formats          []string
+	PlaceholderWidth int
+	Quality          int
+	Workers          int
+	Queue            int
+}
+
+var DefaultOptions = Options{
+	Sizes:            []Size{{"thumbnail", 160}, {"medium", 640}, {"large", 1280}},
+	Formats:          []string{"jpeg"},
+	PlaceholderWidth: 16,
+	Quality:          80,
+	Workers:          2,
+	Queue:            100,
+}
+
+// Job asks for the variants of the image stored at Key, which Cake shows
+// as Source.
+type Job struct {
+	CakeID int
+	Key    string
+	Source string
+}
+
+// Pool builds variants on a fixed number of workers. Variants are stored
+// next to their source image, under its key with the size name appended,
+// and recorded against the cake once all of them are stored.
+type Pool struct {
+	store    storage.BlobStore
+	recorder repository.ImageVariantRecorder
+	opts     Options
+	encoders []Encoder
+
+	mu     sync.Mutex
+	closed bool
+	jobs   chan Job
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewPool starts the workers. It fails when a format has no encoder.
+func NewPool(store storage.BlobStore, recorder repository.ImageVariantRecorder, opts Options) (*Pool, error) {
+	p := &Pool{
+		store:    store,
+		recorder: recorder,
+		opts:     opts,
+		jobs:     make(chan Job, opts.Queue),
+		done:     make(chan struct{}),
+	}
+	for _, format := range opts.Formats {
+		enc, err := encoderFor(format)
+		if err != nil {
+			return nil, err
+		}
+		p.encoders = append(p.encoders, enc)
+	}
+
+	for i := 0; i < opts.Workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p, nil
+}
+
+// Enqueue hands job to the workers. It reports false, and drops the job,
+// when the queue is full or the pool is closed.
+func (p *Pool) Enqueue(job Job) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	select {
+	case p.jobs <- job:
+		return true
+	default:
+		log.Printf("[Pool][Enqueue] queue is full, dropping variants of cake %d", job.CakeID)
+		return false
+	}
+}
+
+// Close stops taking jobs and waits for the ones being built. Jobs still
+// queued are dropped; their images keep working without variants.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	if n := len(p.jobs); n > 0 {
+		log.Printf("[Pool][Close] dropped %d queued jobs", n)
+	}
+	return nil
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.done:
+			return
+		case job := <-p.jobs:
+			p.process(job)
+		}
+	}
+}
+
+// process builds and records the variants of job. Whatever it stored is
+// deleted again when they can't be recorded, and the variants they replace
+// are deleted once they are.
+func (p *Pool) process(job Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+
+	variants, err := p.build(ctx, job)
+	if err == nil {
+		var replaced []m.ImageVariant
+		replaced, err = p.recorder.SaveImageVariants(ctx, job.CakeID, job.Source, variants)
+		if err == nil {
+			p.remove(ctx, replaced, variants)
+			return
+		}
+	}
+
+	if errors.Is(err, repository.ErrImageReplaced) {
+		log.Printf("[Pool][process] cake %d no longer shows %s, dropping its variants", job.CakeID, job.Key)
+	} else {
+		log.Printf("[Pool][process] can't build variants of %s, err: %s", job.Key, err.Error())
+	}
+	p.remove(ctx, variants, nil)
+}
+
+// build stores every variant of job and returns them, along with the ones
+// stored before a failure.
+func (p *Pool) build(ctx context.Context, job Job) ([]m.ImageVariant, error) {
+	blob, err := p.store.Get(ctx, job.Key)
+	if err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(blob.Body)
+	blob.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("can't decode image: %w", err)
+	}
+
+	prefix := strings.TrimSuffix(job.Source, job.Key)
+	base := strings.TrimSuffix(job.Key, path.Ext(job.Key))
+
+	var variants []m.ImageVariant
+	for _, size := range p.opts.Sizes {
+		img := Resize(src, size.Width)
+		bounds := img.Bounds()
+		for _, enc := range p.encoders {
+			var buf bytes.Buffer
+			if err := enc.Encode(&buf, img, p.opts.Quality); err != nil {
+				return variants, fmt.Errorf("can't encode %s: %w", enc.ContentType, err)
+			}
+			key := base + "-" + size.Name + enc.Ext
+			info := storage.Info{ContentType: enc.ContentType, Size: int64(buf.Len())}
+			if err := p.store.Put(ctx, key, &buf, info); err != nil {
+				return variants, err
+			}
+			variants = append(variants, m.ImageVariant{
+				Name:   size.Name,
+				Type:   enc.ContentType,
+				Width:  bounds.Dx(),
+				Height: bounds.Dy(),
+				URL:    prefix + key,
+				Key:    key,
+			})
+		}
+	}
+
+	if p.opts.PlaceholderWidth > 0 {
+		uri, bounds, err := Placeholder(src, p.opts.PlaceholderWidth)
+		if err != nil {
+			return variants, err
+		}
+		variants = append(variants, m.ImageVariant{
+			Name:   m.PlaceholderVariant,
+			Type:   "image/jpeg",
+			Width:  bounds.Dx(),
+			Height: bounds.Dy(),
+			URL:    uri,
+		})
+	}
+	return variants, nil
+}
+
+// remove deletes the stored files of variants, except those kept.
+func (p *Pool) remove(ctx context.Context, variants, kept []m.ImageVariant) {
+	keep := make(map[string]bool, len(kept))
+	for _, v := range kept {
+		keep[v.Key] = true
+	}
+	for _, v := range variants {
+		if v.Key == "" || keep[v.Key] {
+			continue
+		}
+		if err := p.store.Delete(ctx, v.Key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Println("[Pool][remove] can't delete", v.Key, "err:", err.Error())
+		}
+	}
+}
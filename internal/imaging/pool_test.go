@@ -0,0 +1,136 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"privy/internal/repository"
+	"privy/internal/storage"
+	m "privy/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// recorder records the variants a pool saves and answers with replaced
+// and err.
+type recorder struct {
+	saved    chan []m.ImageVariant
+	replaced []m.ImageVariant
+	err      error
+}
+
+func (r *recorder) SaveImageVariants(_ context.Context, _ int, _ string, variants []m.ImageVariant) ([]m.ImageVariant, error) {
+	r.saved <- variants
+	return r.replaced, r.err
+}
+
+func newTestStore(t *testing.T) *storage.LocalStore {
+	t.Helper()
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("can't open store: %v", err)
+	}
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 800, 600)))
+	if err := store.Put(context.Background(), "abc.png", &buf, storage.Info{ContentType: "image/png"}); err != nil {
+		t.Fatalf("can't store image: %v", err)
+	}
+	return store
+}
+
+func exists(store storage.BlobStore, key string) bool {
+	blob, err := store.Get(context.Background(), key)
+	if err != nil {
+		return false
+	}
+	blob.Body.Close()
+	return true
+}
+
+func TestPool(t *testing.T) {
+	opts := Options{
+		Sizes:            []Size{{"thumbnail", 160}, {"large", 1280}},
+		Formats:          []string{"jpeg", "png"},
+		PlaceholderWidth: 16,
+		Quality:          80,
+		Workers:          1,
+		Queue:            1,
+	}
+
+	tests := []struct {
+		name     string
+		replaced []m.ImageVariant
+		err      error
+		kept     bool
+	}{
+		{
+			name:     "Records variants and drops the replaced ones",
+			replaced: []m.ImageVariant{{Name: "thumbnail", Key: "old-thumbnail.jpg"}},
+			kept:     true,
+		},
+		{
+			name: "Drops variants of a replaced image",
+			err:  repository.ErrImageReplaced,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestStore(t)
+			_ = store.Put(context.Background(), "old-thumbnail.jpg", strings.NewReader("old"), storage.Info{})
+			rec := &recorder{saved: make(chan []m.ImageVariant, 1), replaced: tt.replaced, err: tt.err}
+			pool, err := NewPool(store, rec, opts)
+			if err != nil {
+				t.Fatalf("NewPool() error = %v", err)
+			}
+
+			assert.Equal(t, true, pool.Enqueue(Job{CakeID: 1, Key: "abc.png", Source: "https://cdn.example.com/abc.png"}))
+			var variants []m.ImageVariant
+			select {
+			case variants = <-rec.saved:
+			case <-time.After(5 * time.Second):
+				t.Fatal("variants were never recorded")
+			}
+			// Wait for the job to finish before looking at the store.
+			_ = pool.Close()
+
+			got := make([]string, len(variants))
+			for i, v := range variants {
+				got[i] = v.Name + " " + v.Type + " " + v.URL
+			}
+			assert.Equal(t, []string{
+				"thumbnail image/jpeg https://cdn.example.com/abc-thumbnail.jpg",
+				"thumbnail image/png https://cdn.example.com/abc-thumbnail.png",
+				"large image/jpeg https://cdn.example.com/abc-large.jpg",
+				"large image/png https://cdn.example.com/abc-large.png",
+				"placeholder image/jpeg " + variants[4].URL,
+			}, got)
+			assert.Equal(t, [2]int{160, 120}, [2]int{variants[0].Width, variants[0].Height})
+			assert.Equal(t, [2]int{800, 600}, [2]int{variants[2].Width, variants[2].Height})
+
+			assert.Equal(t, tt.kept, exists(store, "abc-thumbnail.jpg"))
+			assert.Equal(t, tt.kept, exists(store, "abc-large.png"))
+			assert.Equal(t, !tt.kept, exists(store, "old-thumbnail.jpg"))
+			assert.Equal(t, true, exists(store, "abc.png"))
+		})
+	}
+}
+
+func TestPool_closed(t *testing.T) {
+	pool, err := NewPool(newTestStore(t), &recorder{}, Options{Workers: 1, Queue: 1})
+	if err != nil {
+		t.Fatalf("NewPool() error = %v", err)
+	}
+	_ = pool.Close()
+	assert.Equal(t, false, pool.Enqueue(Job{CakeID: 1, Key: "abc.png"}))
+}
+
+func TestNewPool_unknownFormat(t *testing.T) {
+	_, err := NewPool(newTestStore(t), &recorder{}, Options{Formats: []string{"avif"}, Workers: 1, Queue: 1})
+	if err == nil || !strings.Contains(err.Error(), "no encoder for avif") {
+		t.Errorf("NewPool() error = %v, want no avif encoder", err)
+	}
+}
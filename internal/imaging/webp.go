@@ -0,0 +1,20 @@
+//go:build cgo
+
+package imaging
+
+import (
+	"image"
+	"io"
+
+	"github.com/chai2010/webp"
+)
+
+// WebP variants are encoded by libwebp, which needs cgo; without it
+// "webp" has no encoder and NewPool refuses it.
+func init() {
+	encoders["webp"] = Encoder{ContentType: "image/webp", Ext: ".webp", Encode: encodeWEBP}
+}
+
+func encodeWEBP(w io.Writer, img image.Image, quality int) error {
+	return webp.Encode(w, img, &webp.Options{Quality: float32(quality)})
+}
@@ -0,0 +1,67 @@
+//go:build cgo
+
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	m "privy/models"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"golang.org/x/image/webp"
+)
+
+func TestPool_webp(t *testing.T) {
+	store := newTestStore(t)
+	rec := &recorder{saved: make(chan []m.ImageVariant, 1)}
+	pool, err := NewPool(store, rec, Options{Sizes: []Size{{"thumbnail", 160}}, Formats: []string{"webp"}, Quality: 80, Workers: 1, Queue: 1})
+	if err != nil {
+		t.Fatalf("NewPool() error = %v", err)
+	}
+	assert.Equal(t, true, pool.Enqueue(Job{CakeID: 1, Key: "abc.png", Source: "/images/abc.png"}))
+	var variants []m.ImageVariant
+	select {
+	case variants = <-rec.saved:
+	case <-time.After(5 * time.Second):
+		t.Fatal("variants were never recorded")
+	}
+	_ = pool.Close()
+
+	assert.Equal(t, 1, len(variants))
+	assert.Equal(t, "image/webp", variants[0].Type)
+	assert.Equal(t, "/images/abc-thumbnail.webp", variants[0].URL)
+
+	blob, err := store.Get(context.Background(), "abc-thumbnail.webp")
+	if err != nil {
+		t.Fatalf("can't get variant: %v", err)
+	}
+	defer blob.Body.Close()
+	img, err := webp.Decode(blob.Body)
+	if err != nil {
+		t.Fatalf("webp.Decode() error = %v", err)
+	}
+	assert.Equal(t, image.Rect(0, 0, 160, 120), img.Bounds())
+}
+
+func Test_encodeWEBP(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 30; y++ {
+			src.Set(x, y, color.RGBA{R: 200, G: 120, B: 40, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := encodeWEBP(&buf, src, 90); err != nil {
+		t.Fatalf("encodeWEBP() error = %v", err)
+	}
+	img, err := webp.Decode(&buf)
+	if err != nil {
+		t.Fatalf("webp.Decode() error = %v", err)
+	}
+	assert.Equal(t, src.Bounds(), img.Bounds())
+}
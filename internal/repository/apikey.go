@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"privy/database"
+	"privy/internal/apperror"
+	m "privy/models"
+	"strings"
+	"time"
+)
+
+// ErrAPIKeyNotFound is returned for keys that don't exist, and for hashes
+// no key has.
+var ErrAPIKeyNotFound = apperror.New(apperror.KindNotFound, "API key not found")
+
+func scanAPIKey(row scanner) (m.APIKey, error) {
+	var (
+		key                            m.APIKey
+		scopes                         string
+		expiresAt, lastUsedAt, revoked sql.NullTime
+	)
+	err := row.Scan(&key.Id, &key.Name, &key.Prefix, &scopes, &expiresAt, &lastUsedAt, &revoked, &key.CreatedAt)
+	if err != nil {
+		return m.APIKey{}, err
+	}
+	key.Scopes = strings.Fields(scopes)
+	key.ExpiresAt = utcOf(expiresAt)
+	key.LastUsedAt = utcOf(lastUsedAt)
+	key.RevokedAt = utcOf(revoked)
+	key.CreatedAt = key.CreatedAt.UTC()
+	return key, nil
+}
+
+func utcOf(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
+
+// CreateAPIKey stores key, whose Hash must be set, and returns it as
+// stored.
+func (r *repository) CreateAPIKey(ctx context.Context, key m.APIKey) (m.APIKey, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	stmts, err := r.prepareAll(ctx, database.InsertAPIKey, database.GetAPIKeyByID)
+	if err != nil {
+		log.Println("[CreateAPIKey] can't prepare statement, err:", err.Error())
+		return m.APIKey{}, wrapErr(ctx, err)
+	}
+	insertStmt, readStmt := stmts[0], stmts[1]
+
+	var expiresAt interface{}
+	if key.ExpiresAt != nil {
+		expiresAt = key.ExpiresAt.UTC()
+	}
+	rows, err := insertStmt.ExecContext(ctx, key.Name, key.Prefix, key.Hash, strings.Join(key.Scopes, " "), expiresAt)
+	if err != nil {
+		log.Println("[CreateAPIKey] can't insert key, err:", err.Error())
+		return m.APIKey{}, wrapErr(ctx, err)
+	}
+	id, err := rows.LastInsertId()
+	if err != nil {
+		log.Println("[CreateAPIKey] can't get inserted id, err:", err.Error())
+		return m.APIKey{}, wrapErr(ctx, err)
+	}
+
+	created, err := scanAPIKey(readStmt.QueryRowContext(ctx, int(id)))
+	if err != nil {
+		log.Println("[CreateAPIKey] can't read key, err:", err.Error())
+		return m.APIKey{}, wrapErr(ctx, err)
+	}
+	return created, nil
+}
+
+// GetAPIKeys lists every key, revoked and expired ones included, oldest
+// first.
+func (r *repository) GetAPIKeys(ctx context.Context) ([]m.APIKey, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	stmt, err := r.stmt(ctx, database.GetAPIKeys)
+	if err != nil {
+		log.Println("[GetAPIKeys] can't prepare statement, err:", err.Error())
+		return nil, wrapErr(ctx, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		log.Println("[GetAPIKeys] can't get keys, err:", err.Error())
+		return nil, wrapErr(ctx, err)
+	}
+	defer rows.Close()
+
+	keys := []m.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			log.Println("[GetAPIKeys] can't scan key, err:", err.Error())
+			return nil, wrapErr(ctx, err)
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println("[GetAPIKeys] can't iterate keys, err:", err.Error())
+		return nil, wrapErr(ctx, err)
+	}
+	return keys, nil
+}
+
+// GetAPIKeyByHash finds the key with hash, whether it is usable or not.
+func (r *repository) GetAPIKeyByHash(ctx context.Context, hash string) (m.APIKey, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	stmt, err := r.stmt(ctx, database.GetAPIKeyByHash)
+	if err != nil {
+		log.Println("[GetAPIKeyByHash] can't prepare statement, err:", err.Error())
+		return m.APIKey{}, wrapErr(ctx, err)
+	}
+
+	key, err := scanAPIKey(stmt.QueryRowContext(ctx, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return m.APIKey{}, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		log.Println("[GetAPIKeyByHash] can't get key, err:", err.Error())
+		return m.APIKey{}, wrapErr(ctx, err)
+	}
+	return key, nil
+}
+
+// RevokeAPIKey revokes a key for good. Revoking it again keeps the time of
+// the first revocation.
+func (r *repository) RevokeAPIKey(ctx context.Context, id int) (m.APIKey, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	stmts, err := r.prepareAll(ctx, database.RevokeAPIKeyByID, database.GetAPIKeyByID)
+	if err != nil {
+		log.Println("[RevokeAPIKey] can't prepare statement, err:", err.Error())
+		return m.APIKey{}, wrapErr(ctx, err)
+	}
+	revokeStmt, readStmt := stmts[0], stmts[1]
+
+	if _, err = revokeStmt.ExecContext(ctx, id); err != nil {
+		log.Println("[RevokeAPIKey] can't revoke key, err:", err.Error())
+		return m.APIKey{}, wrapErr(ctx, err)
+	}
+
+	key, err := scanAPIKey(readStmt.QueryRowContext(ctx, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return m.APIKey{}, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		log.Println("[RevokeAPIKey] can't read key, err:", err.Error())
+		return m.APIKey{}, wrapErr(ctx, err)
+	}
+	return key, nil
+}
+
+// TouchAPIKey records that a key was just used.
+func (r *repository) TouchAPIKey(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	stmt, err := r.stmt(ctx, database.TouchAPIKeyByID)
+	if err != nil {
+		log.Println("[TouchAPIKey] can't prepare statement, err:", err.Error())
+		return wrapErr(ctx, err)
+	}
+	if _, err = stmt.ExecContext(ctx, id); err != nil {
+		log.Println("[TouchAPIKey] can't touch key, err:", err.Error())
+		return wrapErr(ctx, err)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"privy/database"
+	m "privy/models"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const testKeyHash = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+var apiKeyColumns = []string{"id", "name", "prefix", "scopes", "expires_at", "last_used_at", "revoked_at", "created_at"}
+
+func Test_repository_CreateAPIKey(t *testing.T) {
+	ctx := context.Background()
+
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name    string
+		key     m.APIKey
+		want    m.APIKey
+		wantErr bool
+		mock    func()
+	}{
+		{
+			name: "Success",
+			key:  m.APIKey{Name: "partner", Prefix: "privy_abcdefgh", Hash: testKeyHash, Scopes: []string{"cakes:read", "cakes:write"}, ExpiresAt: &updatedAt},
+			want: m.APIKey{Id: 1, Name: "partner", Prefix: "privy_abcdefgh", Scopes: []string{"cakes:read", "cakes:write"}, ExpiresAt: &updatedAt, CreatedAt: createdAt},
+			mock: func() {
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.InsertAPIKey))
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetAPIKeyByID))
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.InsertAPIKey)).
+					WithArgs("partner", "privy_abcdefgh", testKeyHash, "cakes:read cakes:write", updatedAt).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				sqlMock.ExpectQuery(regexp.QuoteMeta(database.GetAPIKeyByID)).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+						AddRow(1, "partner", "privy_abcdefgh", "cakes:read cakes:write", updatedAt, nil, nil, createdAt))
+			},
+		},
+		{
+			name:    "Insert Error",
+			key:     m.APIKey{Name: "partner", Prefix: "privy_abcdefgh", Hash: testKeyHash, Scopes: []string{"cakes:admin"}},
+			wantErr: true,
+			mock: func() {
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.InsertAPIKey)).
+					WithArgs("partner", "privy_abcdefgh", testKeyHash, "cakes:admin", nil).
+					WillReturnError(errors.New("insert failed"))
+			},
+		},
+	}
+	r := &repository{db: db}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+
+			got, err := r.CreateAPIKey(ctx, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("repository.CreateAPIKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("repository.CreateAPIKey() = %v, want %v", got, tt.want)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_repository_GetAPIKeyByHash(t *testing.T) {
+	ctx := context.Background()
+
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name    string
+		want    m.APIKey
+		wantErr error
+		mock    func()
+	}{
+		{
+			name: "Revoked Key",
+			want: m.APIKey{Id: 2, Name: "old", Prefix: "privy_zyxwvuts", Scopes: []string{"cakes:read"}, LastUsedAt: &createdAt, RevokedAt: &updatedAt, CreatedAt: createdAt},
+			mock: func() {
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetAPIKeyByHash)).
+					ExpectQuery().WithArgs(testKeyHash).
+					WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+						AddRow(2, "old", "privy_zyxwvuts", "cakes:read", nil, createdAt, updatedAt, createdAt))
+			},
+		},
+		{
+			name:    "Unknown Hash",
+			wantErr: ErrAPIKeyNotFound,
+			mock: func() {
+				sqlMock.ExpectQuery(regexp.QuoteMeta(database.GetAPIKeyByHash)).WithArgs(testKeyHash).
+					WillReturnError(sql.ErrNoRows)
+			},
+		},
+	}
+	r := &repository{db: db}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+
+			got, err := r.GetAPIKeyByHash(ctx, testKeyHash)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("repository.GetAPIKeyByHash() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("repository.GetAPIKeyByHash() = %v, want %v", got, tt.want)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_repository_RevokeAPIKey(t *testing.T) {
+	ctx := context.Background()
+
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name    string
+		id      int
+		want    m.APIKey
+		wantErr error
+		mock    func()
+	}{
+		{
+			name: "Success",
+			id:   1,
+			want: m.APIKey{Id: 1, Name: "partner", Prefix: "privy_abcdefgh", Scopes: []string{"cakes:write"}, RevokedAt: &updatedAt, CreatedAt: createdAt},
+			mock: func() {
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.RevokeAPIKeyByID))
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetAPIKeyByID))
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.RevokeAPIKeyByID)).WithArgs(1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectQuery(regexp.QuoteMeta(database.GetAPIKeyByID)).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+						AddRow(1, "partner", "privy_abcdefgh", "cakes:write", nil, nil, updatedAt, createdAt))
+			},
+		},
+		{
+			name:    "Unknown Key",
+			id:      9,
+			wantErr: ErrAPIKeyNotFound,
+			mock: func() {
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.RevokeAPIKeyByID)).WithArgs(9).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				sqlMock.ExpectQuery(regexp.QuoteMeta(database.GetAPIKeyByID)).WithArgs(9).
+					WillReturnError(sql.ErrNoRows)
+			},
+		},
+	}
+	r := &repository{db: db}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+
+			got, err := r.RevokeAPIKey(ctx, tt.id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("repository.RevokeAPIKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("repository.RevokeAPIKey() = %v, want %v", got, tt.want)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"privy/database"
+	"privy/internal/apperror"
+	m "privy/models"
+)
+
+// ApplyBatch runs ops and returns their results in the same order. In
+// transactional mode the whole batch is one transaction: the first failing
+// operation rolls back every other and is returned, naming its index. In
+// best-effort mode each operation commits on its own and a failure only
+// lands in its result, so the error is always nil.
+//
+// Creates are inserted with multi-row INSERTs whatever the mode; updates
+// and deletes lock and check their cake one at a time, like PatchCake and
+// DeleteCake.
+func (r *repository) ApplyBatch(ctx context.Context, ops []m.BatchOperation, mode m.BatchMode) ([]m.BatchResult, error) {
+	if mode == m.BatchBestEffort {
+		return r.applyEach(ctx, ops), nil
+	}
+	return r.applyAll(ctx, ops)
+}
+
+func (r *repository) applyAll(ctx context.Context, ops []m.BatchOperation) ([]m.BatchResult, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	stmts, err := r.prepareAll(ctx, database.GetDetailsOfCakeByIDForUpdate, database.UpdateCakeByID, database.GetDetailsOfCakeByID, database.InsertCakeRevision, database.TrashCakeByID, database.GetAnyCakeByID)
+	if err != nil {
+		log.Println("[ApplyBatch] can't prepare statement, err:", err.Error())
+		return nil, wrapErr(ctx, err)
+	}
+	modifyStmts := stmts[:4]
+	trashStmts := []*sql.Stmt{stmts[0], stmts[4], stmts[5], stmts[3]}
+
+	creates, cakes := splitCreates(ops)
+	results := make([]m.BatchResult, len(ops))
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		// A multi-row INSERT doesn't tell which of its rows failed.
+		created, err := insertCakes(ctx, tx, cakes)
+		if err != nil {
+			return err
+		}
+		for i, cake := range created {
+			cake := cake
+			results[creates[i]].Cake = &cake
+		}
+
+		for i, op := range ops {
+			var cake m.Cake
+			switch op.Op {
+			case m.BatchUpdate:
+				cake, err = modifyInTx(ctx, tx, modifyStmts, "ApplyBatch", m.RevisionUpdate, op.Id, op.Version, op.Patch.Apply)
+				results[i].Cake = &cake
+			case m.BatchDelete:
+				_, err = moveInTx(ctx, tx, trashStmts, "ApplyBatch", m.RevisionDelete, op.Id, op.Version)
+			}
+			if err != nil {
+				return failedOp(ctx, i, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, wrapErr(ctx, err)
+	}
+
+	return results, nil
+}
+
+// applyEach tries the creates of ops as multi-row INSERTs and falls back
+// to inserting them one by one when they fail, so that only the offending
+// cakes fail. Updates and deletes run one by one.
+func (r *repository) applyEach(ctx context.Context, ops []m.BatchOperation) []m.BatchResult {
+	results := make([]m.BatchResult, len(ops))
+
+	creates, cakes := splitCreates(ops)
+	created, err := r.insertAll(ctx, cakes)
+	if err != nil {
+		log.Println("[ApplyBatch] can't insert cakes at once, inserting one by one, err:", err.Error())
+	}
+	for i, index := range creates {
+		if err != nil {
+			results[index] = batchResult(r.InsertCake(ctx, cakes[i]))
+			continue
+		}
+		cake := created[i]
+		results[index].Cake = &cake
+	}
+
+	for i, op := range ops {
+		switch op.Op {
+		case m.BatchUpdate:
+			results[i] = batchResult(r.PatchCake(ctx, op.Id, op.Version, op.Patch))
+		case m.BatchDelete:
+			results[i].Err = r.DeleteCake(ctx, op.Id, op.Version)
+		}
+	}
+
+	return results
+}
+
+// insertAll inserts cakes and their first revisions in one transaction.
+func (r *repository) insertAll(ctx context.Context, cakes []m.Cake) ([]m.Cake, error) {
+	if len(cakes) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	var created []m.Cake
+	err := r.inTx(ctx, func(tx *sql.Tx) (err error) {
+		created, err = insertCakes(ctx, tx, cakes)
+		return err
+	})
+	if err != nil {
+		return nil, wrapErr(ctx, err)
+	}
+	return created, nil
+}
+
+// insertChunk is how many cakes one INSERT adds at most.
+const insertChunk = 500
+
+// insertCakes inserts cakes with one statement per insertChunk of them,
+// reads them back, adds their images to their galleries and records their
+// first revisions. InnoDB hands the rows of one INSERT ids
+// auto_increment_increment apart from the first, unless
+// innodb_autoinc_lock_mode interleaves them with other inserts, so the ids
+// are worked out from that and the rows read back must be the ones
+// inserted.
+func insertCakes(ctx context.Context, tx *sql.Tx, cakes []m.Cake) ([]m.Cake, error) {
+	if len(cakes) == 0 {
+		return nil, nil
+	}
+
+	var increment int64
+	if err := tx.QueryRowContext(ctx, database.GetAutoIncrementIncrement).Scan(&increment); err != nil {
+		log.Println("[insertCakes] can't get auto_increment_increment, err:", err.Error())
+		return nil, err
+	}
+
+	ids := make([]interface{}, 0, len(cakes))
+	for from := 0; from < len(cakes); from += insertChunk {
+		chunk := cakes[from:]
+		if len(chunk) > insertChunk {
+			chunk = chunk[:insertChunk]
+		}
+
+		args := make([]interface{}, 0, 4*len(chunk))
+		for _, cake := range chunk {
+			args = append(args, cake.Title, cake.Description, cake.Rating, cake.Image)
+		}
+		rows, err := tx.ExecContext(ctx, multiRow(database.InsertCakes, database.InsertCakesRow, len(chunk)), args...)
+		if err != nil {
+			log.Println("[insertCakes] can't insert cakes, err:", err.Error())
+			return nil, err
+		}
+
+		first, err := rows.LastInsertId()
+		if err != nil {
+			log.Println("[insertCakes] can't get inserted id, err:", err.Error())
+			return nil, err
+		}
+		for i := range chunk {
+			ids = append(ids, first+int64(i)*increment)
+		}
+	}
+
+	created, err := readCakes(ctx, tx, ids)
+	if err != nil {
+		log.Println("[insertCakes] can't read inserted cakes, err:", err.Error())
+		return nil, err
+	}
+	if len(created) != len(cakes) {
+		return nil, fmt.Errorf("inserted %d cakes but read back %d", len(cakes), len(created))
+	}
+	for i, cake := range created {
+		want := cakes[i]
+		if int64(cake.Id) != ids[i].(int64) || cake.Title != want.Title || cake.Description != want.Description || cake.Rating != want.Rating || cake.Image != want.Image {
+			return nil, fmt.Errorf("cake %d read back from id %d isn't the one inserted", cake.Id, ids[i])
+		}
+	}
+
+	if err = insertPrimaryImages(ctx, tx, created); err != nil {
+		log.Println("[insertCakes] can't add primary images, err:", err.Error())
+		return nil, err
+	}
+
+	return created, recordCreations(ctx, tx, created)
+}
+
+// readCakes reads the cakes with ids, which must be ascending, in order.
+func readCakes(ctx context.Context, tx *sql.Tx, ids []interface{}) ([]m.Cake, error) {
+	query := fmt.Sprintf(database.GetCakesByIDs, multiRow("", "?", len(ids)))
+	rows, err := tx.QueryContext(ctx, query, ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cakes []m.Cake
+	for rows.Next() {
+		cake, err := scanCake(rows)
+		if err != nil {
+			return nil, err
+		}
+		cakes = append(cakes, cake)
+	}
+	return cakes, rows.Err()
+}
+
+// splitCreates returns the indexes of the creates in ops and the cakes
+// they insert.
+func splitCreates(ops []m.BatchOperation) ([]int, []m.Cake) {
+	var (
+		indexes []int
+		cakes   []m.Cake
+	)
+	for i, op := range ops {
+		if op.Op != m.BatchCreate {
+			continue
+		}
+		var cake m.Cake
+		op.Patch.Apply(&cake)
+		indexes = append(indexes, i)
+		cakes = append(cakes, cake)
+	}
+	return indexes, cakes
+}
+
+// failedOp names the operation that failed a transactional batch, keeping
+// the kind of its error.
+func failedOp(ctx context.Context, index int, err error) error {
+	err = wrapErr(ctx, err)
+	return apperror.Wrap(apperror.KindOf(err), fmt.Sprintf("operations[%d]: %s", index, apperror.MessageOf(err)), err)
+}
+
+func batchResult(cake m.Cake, err error) m.BatchResult {
+	if err != nil {
+		return m.BatchResult{Err: err}
+	}
+	return m.BatchResult{Cake: &cake}
+}
@@ -0,0 +1,328 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"privy/database"
+	"privy/internal/apperror"
+	m "privy/models"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+)
+
+func Test_repository_ApplyBatch(t *testing.T) {
+	ctx := context.Background()
+
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	title, renamed, desc, image := "title", "renamed", "desc", testImage
+	rating := float32(10)
+	create := m.BatchOperation{Op: m.BatchCreate, Patch: m.CakePatch{Title: &title, Description: &desc, Rating: &rating, Image: &image}}
+	created := func(id int) *m.Cake {
+		return &m.Cake{Id: id, Title: "title", Description: "desc", Rating: 10, Image: testImage, Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt}
+	}
+	readCreated := regexp.QuoteMeta(fmt.Sprintf(database.GetCakesByIDs, "?, ?"))
+	insertCakes := regexp.QuoteMeta(multiRow(database.InsertCakes, database.InsertCakesRow, 2))
+	insertImages := regexp.QuoteMeta(multiRow(database.InsertPrimaryImages, database.InsertPrimaryImagesRow, 2))
+	insertRevisions := regexp.QuoteMeta(multiRow(database.InsertFirstCakeRevisions, database.InsertFirstCakeRevisionsRow, 2))
+
+	expectPrepareAll := func() (lock, update, read, revision, trash, readAny *sqlmock.ExpectedPrepare) {
+		lock = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByIDForUpdate))
+		update = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.UpdateCakeByID))
+		read = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByID))
+		revision = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.InsertCakeRevision))
+		trash = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.TrashCakeByID))
+		readAny = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetAnyCakeByID))
+		return
+	}
+	// expectInsert expects the INSERT of two cakes under an
+	// auto_increment_increment of increment, the first given id first.
+	expectInsert := func(first, increment int) {
+		sqlMock.ExpectQuery(regexp.QuoteMeta(database.GetAutoIncrementIncrement)).
+			WillReturnRows(sqlmock.NewRows([]string{"@@auto_increment_increment"}).AddRow(increment))
+		sqlMock.ExpectExec(insertCakes).
+			WithArgs("title", "desc", float32(10), testImage, "title", "desc", float32(10), testImage).
+			WillReturnResult(sqlmock.NewResult(int64(first), 2))
+	}
+	// expectCreates expects two creates, given ids first and second.
+	expectCreates := func(first, second int) {
+		expectInsert(first, second-first)
+		sqlMock.ExpectQuery(readCreated).WithArgs(first, second).
+			WillReturnRows(sqlmock.NewRows(cakeColumns).
+				AddRow(first, "title", "desc", 10, testImage, 1, createdAt, createdAt, nil).
+				AddRow(second, "title", "desc", 10, testImage, 1, createdAt, createdAt, nil))
+		sqlMock.ExpectExec(insertImages).WithArgs(first, testImage, second, testImage).
+			WillReturnResult(sqlmock.NewResult(1, 2))
+		sqlMock.ExpectExec(insertRevisions).
+			WithArgs(first, "create", sqlmock.AnyArg(), sqlmock.AnyArg(), "anonymous", second, "create", sqlmock.AnyArg(), sqlmock.AnyArg(), "anonymous").
+			WillReturnResult(sqlmock.NewResult(1, 2))
+	}
+
+	// chunked creates one cake more than an INSERT takes, the last of them
+	// given an id after a gap.
+	var (
+		chunked     []m.BatchOperation
+		chunkedWant []m.BatchResult
+	)
+	for i := 0; i <= insertChunk; i++ {
+		chunked = append(chunked, create)
+		chunkedWant = append(chunkedWant, m.BatchResult{Cake: created(i + 1)})
+	}
+	chunkedWant[insertChunk].Cake = created(1000)
+
+	type args struct {
+		ops  []m.BatchOperation
+		mode m.BatchMode
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []m.BatchResult
+		wantErr error
+		mock    func()
+	}{
+		{
+			name: "Transactional Success",
+			args: args{
+				ops: []m.BatchOperation{
+					create,
+					{Op: m.BatchUpdate, Id: 3, Version: 2, Patch: m.CakePatch{Title: &renamed}},
+					create,
+					{Op: m.BatchDelete, Id: 4},
+				},
+				mode: m.BatchTransactional,
+			},
+			want: []m.BatchResult{
+				{Cake: created(10)},
+				{Cake: &m.Cake{Id: 3, Title: "renamed", Description: "desc", Rating: 10, Image: testImage, Version: 3, CreatedAt: createdAt, UpdatedAt: updatedAt}},
+				{Cake: created(11)},
+				{},
+			},
+			mock: func() {
+				lock, update, read, revision, trash, readAny := expectPrepareAll()
+				sqlMock.ExpectBegin()
+				expectCreates(10, 11)
+				lock.ExpectQuery().WithArgs(3).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(3, "title", "desc", 10, testImage, 2, createdAt, createdAt, nil))
+				update.ExpectExec().WithArgs("renamed", "desc", float32(10), testImage, 3, 2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				read.ExpectQuery().WithArgs(3).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(3, "renamed", "desc", 10, testImage, 3, createdAt, updatedAt, nil))
+				expectRevision(revision, 3, "update", `["title"]`)
+				lock.ExpectQuery().WithArgs(4).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(4, "title", "desc", 10, testImage, 1, createdAt, createdAt, nil))
+				trash.ExpectExec().WithArgs(4, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				readAny.ExpectQuery().WithArgs(4).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(4, "title", "desc", 10, testImage, 2, createdAt, createdAt, updatedAt))
+				expectRevision(revision, 4, "delete", `["deleted_at"]`)
+				sqlMock.ExpectCommit()
+			},
+		},
+		{
+			name: "Transactional Stale Version Rolls Back",
+			args: args{
+				ops: []m.BatchOperation{
+					create,
+					create,
+					{Op: m.BatchDelete, Id: 4, Version: 1},
+				},
+				mode: m.BatchTransactional,
+			},
+			wantErr: apperror.ErrPreconditionFailed,
+			mock: func() {
+				lock, _, _, _, _, _ := expectPrepareAll()
+				sqlMock.ExpectBegin()
+				expectCreates(10, 11)
+				lock.ExpectQuery().WithArgs(4).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(4, "title", "desc", 10, testImage, 2, createdAt, createdAt, nil))
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			name: "Transactional Ids Not Consecutive",
+			args: args{
+				ops:  []m.BatchOperation{create, create},
+				mode: m.BatchTransactional,
+			},
+			want: []m.BatchResult{{Cake: created(10)}, {Cake: created(12)}},
+			mock: func() {
+				expectPrepareAll()
+				sqlMock.ExpectBegin()
+				expectCreates(10, 12)
+				sqlMock.ExpectCommit()
+			},
+		},
+		{
+			name: "Transactional Creates In Chunks",
+			args: args{
+				ops:  chunked,
+				mode: m.BatchTransactional,
+			},
+			want: chunkedWant,
+			mock: func() {
+				expectPrepareAll()
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(regexp.QuoteMeta(database.GetAutoIncrementIncrement)).
+					WillReturnRows(sqlmock.NewRows([]string{"@@auto_increment_increment"}).AddRow(1))
+				sqlMock.ExpectExec(regexp.QuoteMeta(multiRow(database.InsertCakes, database.InsertCakesRow, insertChunk)) + "$").
+					WillReturnResult(sqlmock.NewResult(1, insertChunk))
+				sqlMock.ExpectExec(regexp.QuoteMeta(multiRow(database.InsertCakes, database.InsertCakesRow, 1)) + "$").
+					WillReturnResult(sqlmock.NewResult(1000, 1))
+				rows := sqlmock.NewRows(cakeColumns)
+				for _, result := range chunkedWant {
+					rows.AddRow(result.Cake.Id, "title", "desc", 10, testImage, 1, createdAt, createdAt, nil)
+				}
+				sqlMock.ExpectQuery(regexp.QuoteMeta("WHERE id IN (")).WillReturnRows(rows)
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.InsertPrimaryImages)).WillReturnResult(sqlmock.NewResult(1, insertChunk+1))
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.InsertFirstCakeRevisions)).WillReturnResult(sqlmock.NewResult(1, insertChunk+1))
+				sqlMock.ExpectCommit()
+			},
+		},
+		{
+			name: "Transactional Cakes Missing When Read Back",
+			args: args{
+				ops:  []m.BatchOperation{create, create},
+				mode: m.BatchTransactional,
+			},
+			wantErr: apperror.ErrInternal,
+			mock: func() {
+				expectPrepareAll()
+				sqlMock.ExpectBegin()
+				expectInsert(10, 2)
+				sqlMock.ExpectQuery(readCreated).WithArgs(10, 12).
+					WillReturnRows(sqlmock.NewRows(cakeColumns).
+						AddRow(10, "title", "desc", 10, testImage, 1, createdAt, createdAt, nil))
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			name: "Transactional Ids Interleaved With Other Inserts",
+			args: args{
+				ops:  []m.BatchOperation{create, create},
+				mode: m.BatchTransactional,
+			},
+			wantErr: apperror.ErrInternal,
+			mock: func() {
+				expectPrepareAll()
+				sqlMock.ExpectBegin()
+				expectInsert(10, 1)
+				sqlMock.ExpectQuery(readCreated).WithArgs(10, 11).
+					WillReturnRows(sqlmock.NewRows(cakeColumns).
+						AddRow(10, "title", "desc", 10, testImage, 1, createdAt, createdAt, nil).
+						AddRow(11, "another", "desc", 10, testImage, 1, createdAt, createdAt, nil))
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			name: "Best Effort Reports Each Failure",
+			args: args{
+				ops: []m.BatchOperation{
+					create,
+					{Op: m.BatchDelete, Id: 4},
+					create,
+				},
+				mode: m.BatchBestEffort,
+			},
+			want: []m.BatchResult{
+				{Cake: created(10)},
+				{Err: apperror.ErrNotFound},
+				{Cake: created(11)},
+			},
+			mock: func() {
+				sqlMock.ExpectBegin()
+				expectCreates(10, 11)
+				sqlMock.ExpectCommit()
+				lock := sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByIDForUpdate))
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.TrashCakeByID))
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetAnyCakeByID))
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.InsertCakeRevision))
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(4).WillReturnRows(sqlmock.NewRows(cakeColumns))
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			name: "Best Effort Falls Back To Single Inserts",
+			args: args{
+				ops:  []m.BatchOperation{create, create},
+				mode: m.BatchBestEffort,
+			},
+			want: []m.BatchResult{
+				{Err: apperror.ErrValidation},
+				{Cake: created(12)},
+			},
+			mock: func() {
+				tooLong := &mysql.MySQLError{Number: mysqlErrDataTooLong, Message: "Data too long"}
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(regexp.QuoteMeta(database.GetAutoIncrementIncrement)).
+					WillReturnRows(sqlmock.NewRows([]string{"@@auto_increment_increment"}).AddRow(1))
+				sqlMock.ExpectExec(insertCakes).WillReturnError(tooLong)
+				sqlMock.ExpectRollback()
+
+				insert := sqlMock.ExpectPrepare(regexp.QuoteMeta(database.InsertCake))
+				read := sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByID))
+				revision := sqlMock.ExpectPrepare(regexp.QuoteMeta(database.InsertCakeRevision))
+				sqlMock.ExpectBegin()
+				insert.ExpectExec().WillReturnError(tooLong)
+				sqlMock.ExpectRollback()
+				sqlMock.ExpectBegin()
+				insert.ExpectExec().WillReturnResult(sqlmock.NewResult(12, 1))
+				read.ExpectQuery().WithArgs(12).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(12, "title", "desc", 10, testImage, 1, createdAt, createdAt, nil))
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.AppendPrimaryImage)).WithArgs(12, testImage, 12).WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRevision(revision, 12, "create", `["title","description","rating","image"]`)
+				sqlMock.ExpectCommit()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+
+			r := &repository{
+				db: db,
+			}
+			got, err := r.ApplyBatch(ctx, tt.args.ops, tt.args.mode)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("repository.ApplyBatch() error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("repository.ApplyBatch() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("repository.ApplyBatch() = %d results, want %d", len(got), len(tt.want))
+			}
+			for i, result := range got {
+				if !reflect.DeepEqual(result.Cake, tt.want[i].Cake) {
+					t.Errorf("repository.ApplyBatch()[%d].Cake = %v, want %v", i, result.Cake, tt.want[i].Cake)
+				}
+				if (result.Err == nil) != (tt.want[i].Err == nil) || (result.Err != nil && !errors.Is(result.Err, tt.want[i].Err)) {
+					t.Errorf("repository.ApplyBatch()[%d].Err = %v, want %v", i, result.Err, tt.want[i].Err)
+				}
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_failedOp(t *testing.T) {
+	err := failedOp(context.Background(), 3, apperror.New(apperror.KindNotFound, "cake not found"))
+	if !errors.Is(err, apperror.ErrNotFound) {
+		t.Errorf("failedOp() = %v, want not found", err)
+	}
+	if got, want := apperror.MessageOf(err), "operations[3]: cake not found"; got != want {
+		t.Errorf("MessageOf(failedOp()) = %q, want %q", got, want)
+	}
+}
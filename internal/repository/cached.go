@@ -0,0 +1,398 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"privy/internal/apperror"
+	m "privy/models"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// generationKey counts the writes to cakes. List pages and summaries are
+// cached under the generation they were read at, so one increment outdates
+// all of them.
+const generationKey = "cakes:generation"
+
+var DefaultCacheTTL = 30 * time.Second
+
+var _ Repository = (*CachedRepository)(nil)
+
+// CachedRepository serves cake reads from a Store in front of another
+// Repository. A single cake is dropped from the cache when it is written;
+// list pages and summaries when any cake is. Concurrent misses of one key
+// share a single load. Revisions, galleries, exports and API keys are read
+// straight from the inner Repository, so a revoked key stops working at
+// once, and a Store that fails is bypassed rather than failing reads.
+//
+// A load that overlaps a write is not cached. Within a process that is
+// exact. Across instances sharing a Store, the load is checked against the
+// generation in the Store just before it is cached, so a write landing
+// between that check and the Set can still leave a stale entry, for at
+// most the ttl.
+type CachedRepository struct {
+	inner       Repository
+	store       Store
+	ttl         time.Duration
+	loadTimeout time.Duration
+	group       singleflight.Group
+
+	// mu orders storing a loaded value against invalidations in this
+	// process: a load that started before a write is never stored after it.
+	mu    sync.RWMutex
+	epoch uint64
+
+	hits, misses, shared, errors uint64
+}
+
+// CacheStats counts how reads were answered. Shared reads waited for the
+// load of a concurrent miss instead of running their own; Errors are Store
+// failures.
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Shared uint64 `json:"shared"`
+	Errors uint64 `json:"errors"`
+}
+
+type CacheOption func(*CachedRepository)
+
+func WithTTL(ttl time.Duration) CacheOption {
+	return func(c *CachedRepository) {
+		c.ttl = ttl
+	}
+}
+
+// WithLoadTimeout bounds a load shared by concurrent misses. The load runs
+// apart from the request that started it, so it outlives that request
+// being cancelled.
+func WithLoadTimeout(timeout time.Duration) CacheOption {
+	return func(c *CachedRepository) {
+		c.loadTimeout = timeout
+	}
+}
+
+func NewCached(inner Repository, store Store, opts ...CacheOption) *CachedRepository {
+	c := &CachedRepository{
+		inner:       inner,
+		store:       store,
+		ttl:         DefaultCacheTTL,
+		loadTimeout: DefaultTimeouts.Read,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *CachedRepository) Stats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+		Shared: atomic.LoadUint64(&c.shared),
+		Errors: atomic.LoadUint64(&c.errors),
+	}
+}
+
+// Close closes the inner Repository and the Store, when they can be.
+func (c *CachedRepository) Close() error {
+	var err error
+	for _, v := range []interface{}{c.inner, c.store} {
+		if closer, ok := v.(io.Closer); ok {
+			if closeErr := closer.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	}
+	return err
+}
+
+func (c *CachedRepository) GetListOfCakes(ctx context.Context, query m.CakeQuery) ([]m.Cake, error) {
+	key, ok := c.listKey(ctx, "list", query)
+	if !ok {
+		return c.inner.GetListOfCakes(ctx, query)
+	}
+	return readThrough(ctx, c, key, func(ctx context.Context) ([]m.Cake, error) {
+		return c.inner.GetListOfCakes(ctx, query)
+	})
+}
+func (c *CachedRepository) SummarizeCakes(ctx context.Context, filter m.CakeFilter) (m.CakeSummary, error) {
+	key, ok := c.listKey(ctx, "summary", filter)
+	if !ok {
+		return c.inner.SummarizeCakes(ctx, filter)
+	}
+	return readThrough(ctx, c, key, func(ctx context.Context) (m.CakeSummary, error) {
+		return c.inner.SummarizeCakes(ctx, filter)
+	})
+}
+func (c *CachedRepository) GetDetailsOfCake(ctx context.Context, id int) (m.Cake, error) {
+	return readThrough(ctx, c, cakeKey(id), func(ctx context.Context) (m.Cake, error) {
+		return c.inner.GetDetailsOfCake(ctx, id)
+	})
+}
+func (c *CachedRepository) GetAnyCake(ctx context.Context, id int) (m.Cake, error) {
+	return c.inner.GetAnyCake(ctx, id)
+}
+func (c *CachedRepository) InsertCake(ctx context.Context, cake m.Cake) (m.Cake, error) {
+	cake, err := c.inner.InsertCake(ctx, cake)
+	c.invalidate(ctx, err)
+	return cake, err
+}
+func (c *CachedRepository) ExportCakes(ctx context.Context, fn func(m.Cake) error) error {
+	return c.inner.ExportCakes(ctx, fn)
+}
+func (c *CachedRepository) UpdateCake(ctx context.Context, cake m.Cake, version int) (m.Cake, error) {
+	updated, err := c.inner.UpdateCake(ctx, cake, version)
+	c.invalidate(ctx, err, cake.Id)
+	return updated, err
+}
+func (c *CachedRepository) PatchCake(ctx context.Context, id, version int, patch m.CakePatch) (m.Cake, error) {
+	cake, err := c.inner.PatchCake(ctx, id, version, patch)
+	c.invalidate(ctx, err, id)
+	return cake, err
+}
+func (c *CachedRepository) DeleteCake(ctx context.Context, id, version int) error {
+	err := c.inner.DeleteCake(ctx, id, version)
+	c.invalidate(ctx, err, id)
+	return err
+}
+func (c *CachedRepository) RestoreCake(ctx context.Context, id int) (m.Cake, error) {
+	cake, err := c.inner.RestoreCake(ctx, id)
+	c.invalidate(ctx, err, id)
+	return cake, err
+}
+func (c *CachedRepository) PurgeCake(ctx context.Context, id int) error {
+	err := c.inner.PurgeCake(ctx, id)
+	c.invalidate(ctx, err, id)
+	return err
+}
+func (c *CachedRepository) GetRevisions(ctx context.Context, id, limit, offset int) ([]m.Revision, error) {
+	return c.inner.GetRevisions(ctx, id, limit, offset)
+}
+func (c *CachedRepository) CountRevisions(ctx context.Context, id int) (int, error) {
+	return c.inner.CountRevisions(ctx, id)
+}
+func (c *CachedRepository) GetRevision(ctx context.Context, id, number int) (m.Revision, error) {
+	return c.inner.GetRevision(ctx, id, number)
+}
+func (c *CachedRepository) RevertCake(ctx context.Context, id, version, number int) (m.Cake, error) {
+	cake, err := c.inner.RevertCake(ctx, id, version, number)
+	c.invalidate(ctx, err, id)
+	return cake, err
+}
+func (c *CachedRepository) ApplyBatch(ctx context.Context, ops []m.BatchOperation, mode m.BatchMode) ([]m.BatchResult, error) {
+	results, err := c.inner.ApplyBatch(ctx, ops, mode)
+	ids := make([]int, 0, len(ops))
+	for _, op := range ops {
+		if op.Op != m.BatchCreate {
+			ids = append(ids, op.Id)
+		}
+	}
+	c.invalidate(ctx, err, ids...)
+	return results, err
+}
+func (c *CachedRepository) SaveImageVariants(ctx context.Context, id int, source string, variants []m.ImageVariant) ([]m.ImageVariant, error) {
+	replaced, err := c.inner.SaveImageVariants(ctx, id, source, variants)
+	c.invalidate(ctx, err, id)
+	return replaced, err
+}
+func (c *CachedRepository) GetCakeImages(ctx context.Context, id int) (m.Cake, []m.CakeImage, error) {
+	return c.inner.GetCakeImages(ctx, id)
+}
+func (c *CachedRepository) AddCakeImage(ctx context.Context, id, version int, image m.CakeImage) (m.Cake, []m.CakeImage, error) {
+	cake, images, err := c.inner.AddCakeImage(ctx, id, version, image)
+	c.invalidate(ctx, err, id)
+	return cake, images, err
+}
+func (c *CachedRepository) ReorderCakeImages(ctx context.Context, id, version int, order []int) (m.Cake, []m.CakeImage, error) {
+	cake, images, err := c.inner.ReorderCakeImages(ctx, id, version, order)
+	c.invalidate(ctx, err, id)
+	return cake, images, err
+}
+func (c *CachedRepository) UpdateCakeImage(ctx context.Context, id, version, imageID int, patch m.CakeImagePatch) (m.Cake, []m.CakeImage, error) {
+	cake, images, err := c.inner.UpdateCakeImage(ctx, id, version, imageID, patch)
+	c.invalidate(ctx, err, id)
+	return cake, images, err
+}
+func (c *CachedRepository) DeleteCakeImage(ctx context.Context, id, version, imageID int) (m.Cake, []m.CakeImage, error) {
+	cake, images, err := c.inner.DeleteCakeImage(ctx, id, version, imageID)
+	c.invalidate(ctx, err, id)
+	return cake, images, err
+}
+func (c *CachedRepository) CreateAPIKey(ctx context.Context, key m.APIKey) (m.APIKey, error) {
+	return c.inner.CreateAPIKey(ctx, key)
+}
+func (c *CachedRepository) GetAPIKeys(ctx context.Context) ([]m.APIKey, error) {
+	return c.inner.GetAPIKeys(ctx)
+}
+func (c *CachedRepository) GetAPIKeyByHash(ctx context.Context, hash string) (m.APIKey, error) {
+	return c.inner.GetAPIKeyByHash(ctx, hash)
+}
+func (c *CachedRepository) RevokeAPIKey(ctx context.Context, id int) (m.APIKey, error) {
+	return c.inner.RevokeAPIKey(ctx, id)
+}
+func (c *CachedRepository) TouchAPIKey(ctx context.Context, id int) error {
+	return c.inner.TouchAPIKey(ctx, id)
+}
+
+// readThrough answers from the entry at key or runs load, sharing it with
+// concurrent callers missing the same key, and caches its result. Errors
+// aren't cached. A caller that gives up stops waiting, but the load goes on
+// for the others.
+func readThrough[T any](ctx context.Context, c *CachedRepository, key string, load func(context.Context) (T, error)) (T, error) {
+	var value T
+
+	raw, ok, err := c.store.Get(ctx, key)
+	if err != nil {
+		c.storeFailed("Get", err)
+		return load(ctx)
+	}
+	if ok {
+		if err := json.Unmarshal(raw, &value); err == nil {
+			atomic.AddUint64(&c.hits, 1)
+			return value, nil
+		}
+		log.Println("[CachedRepository][readThrough] can't decode cached", key, "err:", err.Error())
+	}
+
+	leader := false
+	ch := c.group.DoChan(key, func() (interface{}, error) {
+		leader = true
+		atomic.AddUint64(&c.misses, 1)
+
+		loadCtx, cancel := withTimeout(detached{ctx}, c.loadTimeout)
+		defer cancel()
+
+		c.mu.RLock()
+		epoch := c.epoch
+		c.mu.RUnlock()
+		generation, ok := c.generation(loadCtx)
+
+		value, err := load(loadCtx)
+		if err != nil {
+			return value, err
+		}
+		if ok {
+			c.set(loadCtx, key, value, epoch, generation)
+		}
+		return value, nil
+	})
+
+	select {
+	case res := <-ch:
+		if !leader {
+			atomic.AddUint64(&c.shared, 1)
+		}
+		if res.Err != nil {
+			return value, res.Err
+		}
+		return res.Val.(T), nil
+	case <-ctx.Done():
+		return value, wrapErr(ctx, ctx.Err())
+	}
+}
+
+// generation reads the write counter shared by every instance using the
+// Store. It reports false when it can't be read.
+func (c *CachedRepository) generation(ctx context.Context) (string, bool) {
+	raw, _, err := c.store.Get(ctx, generationKey)
+	if err != nil {
+		c.storeFailed("Get", err)
+		return "", false
+	}
+	return string(raw), true
+}
+
+// set caches value at key, unless a write happened since epoch in this
+// process or since generation in any.
+func (c *CachedRepository) set(ctx context.Context, key string, value interface{}, epoch uint64, generation string) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		log.Println("[CachedRepository][set] can't encode", key, "err:", err.Error())
+		return
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.epoch != epoch {
+		return
+	}
+	if current, ok := c.generation(ctx); !ok || current != generation {
+		return
+	}
+	if err := c.store.Set(ctx, key, raw, c.ttl); err != nil {
+		c.storeFailed("Set", err)
+	}
+}
+
+// detached carries the values of a context but not its deadline or
+// cancellation, so a shared load doesn't fail with the request that
+// started it.
+type detached struct{ context.Context }
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
+// invalidate drops the cakes with ids and outdates every list page and
+// summary after a write. Writes that failed without touching the database
+// leave the cache alone; timeouts and other unexpected failures may still
+// have been applied.
+func (c *CachedRepository) invalidate(ctx context.Context, err error, ids ...int) {
+	switch apperror.KindOf(err) {
+	case apperror.KindNotFound, apperror.KindConflict, apperror.KindValidation, apperror.KindPreconditionFailed:
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch++
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = cakeKey(id)
+		c.group.Forget(keys[i])
+	}
+	if len(keys) > 0 {
+		if err := c.store.Delete(ctx, keys...); err != nil {
+			c.storeFailed("Delete", err)
+		}
+	}
+	if _, err := c.store.Incr(ctx, generationKey); err != nil {
+		c.storeFailed("Incr", err)
+	}
+}
+
+// listKey is the key of the list page or summary described by spec at the
+// current generation. It reports false when the generation can't be read.
+func (c *CachedRepository) listKey(ctx context.Context, kind string, spec interface{}) (string, bool) {
+	generation, _, err := c.store.Get(ctx, generationKey)
+	if err != nil {
+		c.storeFailed("Get", err)
+		return "", false
+	}
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		log.Println("[CachedRepository][listKey] can't encode", kind, "err:", err.Error())
+		return "", false
+	}
+	sum := sha256.Sum256(raw)
+	return fmt.Sprintf("cakes:%s:%s:%x", kind, generation, sum[:16]), true
+}
+
+func (c *CachedRepository) storeFailed(op string, err error) {
+	atomic.AddUint64(&c.errors, 1)
+	log.Printf("[CachedRepository][%s] cache store failed, err: %s", op, err.Error())
+}
+
+func cakeKey(id int) string {
+	return "cakes:" + strconv.Itoa(id)
+}
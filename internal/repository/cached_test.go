@@ -0,0 +1,305 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"privy/internal/apperror"
+	mock_repo "privy/mock/repository"
+	m "privy/models"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/golang/mock/gomock"
+)
+
+func TestCachedRepository(t *testing.T) {
+	ctx := context.Background()
+	cake := m.Cake{Id: 1, Title: "title", Rating: 9, Version: 1, CreatedAt: createdAt, UpdatedAt: updatedAt}
+	page := []m.Cake{cake, {Id: 2, Title: "other", Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt}}
+
+	stores := map[string]func(t *testing.T) Store{
+		"Memory": func(t *testing.T) Store { return NewMemoryStore(100) },
+		"Redis": func(t *testing.T) Store {
+			store, _ := newTestRedisStore(t)
+			return store
+		},
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			inner := mock_repo.NewMockRepository(ctrl)
+			cached := NewCached(inner, newStore(t))
+
+			inner.EXPECT().GetDetailsOfCake(gomock.Any(), 1).Return(cake, nil)
+			inner.EXPECT().GetListOfCakes(gomock.Any(), m.CakeQuery{Limit: 10}).Return(page, nil)
+			inner.EXPECT().GetListOfCakes(gomock.Any(), m.CakeQuery{Limit: 20}).Return(page, nil)
+			for i := 0; i < 2; i++ {
+				got, err := cached.GetDetailsOfCake(ctx, 1)
+				assert.Equal(t, nil, err)
+				assert.Equal(t, cake, got)
+
+				list, err := cached.GetListOfCakes(ctx, m.CakeQuery{Limit: 10})
+				assert.Equal(t, nil, err)
+				assert.Equal(t, page, list)
+			}
+			if _, err := cached.GetListOfCakes(ctx, m.CakeQuery{Limit: 20}); err != nil {
+				t.Fatalf("GetListOfCakes() error = %v", err)
+			}
+			assert.Equal(t, CacheStats{Hits: 2, Misses: 3}, cached.Stats())
+
+			// A refused write leaves the cache alone.
+			inner.EXPECT().DeleteCake(gomock.Any(), 1, 5).Return(apperror.ErrPreconditionFailed)
+			_ = cached.DeleteCake(ctx, 1, 5)
+			_, _ = cached.GetDetailsOfCake(ctx, 1)
+			_, _ = cached.GetListOfCakes(ctx, m.CakeQuery{Limit: 10})
+			assert.Equal(t, CacheStats{Hits: 4, Misses: 3}, cached.Stats())
+
+			// Writing cake 2 outdates the lists but not cake 1.
+			updated := m.Cake{Id: 2, Title: "renamed", Version: 2}
+			inner.EXPECT().PatchCake(gomock.Any(), 2, 0, gomock.Any()).Return(updated, nil)
+			if _, err := cached.PatchCake(ctx, 2, 0, m.CakePatch{}); err != nil {
+				t.Fatalf("PatchCake() error = %v", err)
+			}
+			inner.EXPECT().GetListOfCakes(gomock.Any(), m.CakeQuery{Limit: 10}).Return([]m.Cake{cake, updated}, nil)
+			list, _ := cached.GetListOfCakes(ctx, m.CakeQuery{Limit: 10})
+			assert.Equal(t, "renamed", list[1].Title)
+			_, _ = cached.GetDetailsOfCake(ctx, 1)
+			assert.Equal(t, CacheStats{Hits: 5, Misses: 4}, cached.Stats())
+
+			// Writing cake 1 drops it.
+			inner.EXPECT().DeleteCake(gomock.Any(), 1, 0).Return(nil)
+			if err := cached.DeleteCake(ctx, 1, 0); err != nil {
+				t.Fatalf("DeleteCake() error = %v", err)
+			}
+			inner.EXPECT().GetDetailsOfCake(gomock.Any(), 1).Return(m.Cake{}, apperror.ErrNotFound).Times(2)
+			for i := 0; i < 2; i++ {
+				if _, err := cached.GetDetailsOfCake(ctx, 1); !errors.Is(err, apperror.ErrNotFound) {
+					t.Fatalf("GetDetailsOfCake() error = %v, want not found", err)
+				}
+			}
+		})
+	}
+}
+
+func TestCachedRepository_sharesConcurrentMisses(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	inner := mock_repo.NewMockRepository(ctrl)
+	cached := NewCached(inner, NewMemoryStore(10))
+
+	release := make(chan struct{})
+	inner.EXPECT().GetDetailsOfCake(gomock.Any(), 1).DoAndReturn(func(ctx context.Context, id int) (m.Cake, error) {
+		<-release
+		return m.Cake{Id: id}, nil
+	})
+
+	const readers = 8
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if cake, err := cached.GetDetailsOfCake(context.Background(), 1); err != nil || cake.Id != 1 {
+				t.Errorf("GetDetailsOfCake() = %v, %v", cake, err)
+			}
+		}()
+	}
+	// Give every reader the time to join the load before it finishes.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, CacheStats{Misses: 1, Shared: readers - 1}, cached.Stats())
+}
+
+func TestCachedRepository_dropsLoadOverlappingWrite(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	inner := mock_repo.NewMockRepository(ctrl)
+	cached := NewCached(inner, NewMemoryStore(10))
+
+	stale := m.Cake{Id: 1, Title: "old", Version: 1}
+	fresh := m.Cake{Id: 1, Title: "new", Version: 2}
+	inner.EXPECT().GetDetailsOfCake(gomock.Any(), 1).DoAndReturn(func(ctx context.Context, id int) (m.Cake, error) {
+		// The cake is written while its old state is being read.
+		if _, err := cached.UpdateCake(ctx, fresh, 1); err != nil {
+			t.Fatalf("UpdateCake() error = %v", err)
+		}
+		return stale, nil
+	})
+	inner.EXPECT().UpdateCake(gomock.Any(), fresh, 1).Return(fresh, nil)
+	inner.EXPECT().GetDetailsOfCake(gomock.Any(), 1).Return(fresh, nil)
+
+	got, _ := cached.GetDetailsOfCake(ctx, 1)
+	assert.Equal(t, stale, got)
+	got, _ = cached.GetDetailsOfCake(ctx, 1)
+	assert.Equal(t, fresh, got)
+}
+
+func TestCachedRepository_dropsLoadOverlappingWriteOfOtherInstance(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	store := NewMemoryStore(10)
+	inner := mock_repo.NewMockRepository(ctrl)
+	cached, other := NewCached(inner, store), NewCached(inner, store)
+
+	stale := m.Cake{Id: 1, Title: "old", Version: 1}
+	fresh := m.Cake{Id: 1, Title: "new", Version: 2}
+	inner.EXPECT().GetDetailsOfCake(gomock.Any(), 1).DoAndReturn(func(ctx context.Context, id int) (m.Cake, error) {
+		// Another instance sharing the store writes the cake meanwhile.
+		if _, err := other.UpdateCake(ctx, fresh, 1); err != nil {
+			t.Fatalf("UpdateCake() error = %v", err)
+		}
+		return stale, nil
+	})
+	inner.EXPECT().UpdateCake(gomock.Any(), fresh, 1).Return(fresh, nil)
+	inner.EXPECT().GetDetailsOfCake(gomock.Any(), 1).Return(fresh, nil)
+
+	got, _ := cached.GetDetailsOfCake(ctx, 1)
+	assert.Equal(t, stale, got)
+	got, _ = cached.GetDetailsOfCake(ctx, 1)
+	assert.Equal(t, fresh, got)
+}
+
+func TestCachedRepository_sharedLoadOutlivesLeader(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	inner := mock_repo.NewMockRepository(ctrl)
+	cached := NewCached(inner, NewMemoryStore(10))
+
+	started, release := make(chan struct{}), make(chan struct{})
+	inner.EXPECT().GetDetailsOfCake(gomock.Any(), 1).DoAndReturn(func(ctx context.Context, id int) (m.Cake, error) {
+		close(started)
+		<-release
+		return m.Cake{Id: id}, ctx.Err()
+	})
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := cached.GetDetailsOfCake(leaderCtx, 1)
+		leaderErr <- err
+	}()
+	<-started
+
+	waiter := make(chan error, 1)
+	go func() {
+		cake, err := cached.GetDetailsOfCake(context.Background(), 1)
+		if err == nil && cake.Id != 1 {
+			err = errors.New("wrong cake")
+		}
+		waiter <- err
+	}()
+	// Give the waiter the time to join the load before the leader leaves.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-leaderErr; err == nil {
+		t.Errorf("GetDetailsOfCake() of the cancelled leader error = nil")
+	}
+	close(release)
+
+	assert.Equal(t, nil, <-waiter)
+	got, err := cached.GetDetailsOfCake(context.Background(), 1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, got.Id)
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 1, Shared: 1}, cached.Stats())
+}
+
+// failingStore is a Store that is down.
+type failingStore struct{}
+
+var errStoreDown = errors.New("store down")
+
+func (failingStore) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errStoreDown
+}
+func (failingStore) Set(context.Context, string, []byte, time.Duration) error {
+	return errStoreDown
+}
+func (failingStore) Delete(context.Context, ...string) error     { return errStoreDown }
+func (failingStore) Incr(context.Context, string) (int64, error) { return 0, errStoreDown }
+
+func TestCachedRepository_bypassesFailingStore(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	inner := mock_repo.NewMockRepository(ctrl)
+	cached := NewCached(inner, failingStore{})
+
+	inner.EXPECT().GetDetailsOfCake(gomock.Any(), 1).Return(m.Cake{Id: 1}, nil)
+	inner.EXPECT().SummarizeCakes(gomock.Any(), m.CakeFilter{}).Return(m.CakeSummary{Total: 1}, nil)
+	inner.EXPECT().InsertCake(gomock.Any(), gomock.Any()).Return(m.Cake{Id: 2}, nil)
+
+	if _, err := cached.GetDetailsOfCake(ctx, 1); err != nil {
+		t.Errorf("GetDetailsOfCake() error = %v", err)
+	}
+	if _, err := cached.SummarizeCakes(ctx, m.CakeFilter{}); err != nil {
+		t.Errorf("SummarizeCakes() error = %v", err)
+	}
+	if _, err := cached.InsertCake(ctx, m.Cake{}); err != nil {
+		t.Errorf("InsertCake() error = %v", err)
+	}
+	assert.Equal(t, CacheStats{Errors: 3}, cached.Stats())
+}
+
+func TestCachedRepository_ApplyBatchDropsWrittenCakes(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	inner := mock_repo.NewMockRepository(ctrl)
+	cached := NewCached(inner, NewMemoryStore(10))
+
+	ops := []m.BatchOperation{{Op: m.BatchCreate}, {Op: m.BatchDelete, Id: 1}}
+	inner.EXPECT().GetDetailsOfCake(gomock.Any(), 1).Return(m.Cake{Id: 1}, nil).Times(2)
+	inner.EXPECT().GetDetailsOfCake(gomock.Any(), 2).Return(m.Cake{Id: 2}, nil)
+	inner.EXPECT().ApplyBatch(gomock.Any(), ops, m.BatchBestEffort).Return(make([]m.BatchResult, 2), nil)
+
+	_, _ = cached.GetDetailsOfCake(ctx, 1)
+	_, _ = cached.GetDetailsOfCake(ctx, 2)
+	if _, err := cached.ApplyBatch(ctx, ops, m.BatchBestEffort); err != nil {
+		t.Fatalf("ApplyBatch() error = %v", err)
+	}
+	_, _ = cached.GetDetailsOfCake(ctx, 1)
+	_, _ = cached.GetDetailsOfCake(ctx, 2)
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 3}, cached.Stats())
+}
+
+func TestCachedRepository_SaveImageVariantsDropsCake(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	inner := mock_repo.NewMockRepository(ctrl)
+	cached := NewCached(inner, NewMemoryStore(10))
+
+	images := &m.CakeImages{Variants: []m.ImageVariant{{Name: "thumbnail", Type: "image/jpeg", Width: 160, URL: "a-thumbnail.jpg"}}}
+	gomock.InOrder(
+		inner.EXPECT().GetDetailsOfCake(gomock.Any(), 1).Return(m.Cake{Id: 1, Version: 1}, nil),
+		inner.EXPECT().SaveImageVariants(gomock.Any(), 1, "a.png", images.Variants).Return(nil, nil),
+		inner.EXPECT().GetDetailsOfCake(gomock.Any(), 1).Return(m.Cake{Id: 1, Version: 2, Images: images}, nil),
+	)
+
+	_, _ = cached.GetDetailsOfCake(ctx, 1)
+	if _, err := cached.SaveImageVariants(ctx, 1, "a.png", images.Variants); err != nil {
+		t.Fatalf("SaveImageVariants() error = %v", err)
+	}
+	got, _ := cached.GetDetailsOfCake(ctx, 1)
+	assert.Equal(t, 2, got.Version)
+	assert.Equal(t, images, got.Images)
+}
+
+func TestCachedRepository_GalleryWritesDropCake(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	inner := mock_repo.NewMockRepository(ctrl)
+	cached := NewCached(inner, NewMemoryStore(10))
+
+	gomock.InOrder(
+		inner.EXPECT().GetDetailsOfCake(gomock.Any(), 1).Return(m.Cake{Id: 1, Image: "a.png", Version: 1}, nil),
+		inner.EXPECT().DeleteCakeImage(gomock.Any(), 1, 0, 1).Return(m.Cake{Id: 1, Image: "b.png", Version: 2}, []m.CakeImage{{Id: 2, URL: "b.png", Primary: true}}, nil),
+		inner.EXPECT().GetDetailsOfCake(gomock.Any(), 1).Return(m.Cake{Id: 1, Image: "b.png", Version: 2}, nil),
+	)
+
+	_, _ = cached.GetDetailsOfCake(ctx, 1)
+	if _, _, err := cached.DeleteCakeImage(ctx, 1, 0, 1); err != nil {
+		t.Fatalf("DeleteCakeImage() error = %v", err)
+	}
+	got, _ := cached.GetDetailsOfCake(ctx, 1)
+	assert.Equal(t, "b.png", got.Image)
+}
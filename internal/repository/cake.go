@@ -3,57 +3,248 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
-	"fmt"
 	"log"
+	"net"
 	"privy/database"
+	"privy/internal/apperror"
 	m "privy/models"
+	"sync"
 	"time"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 var (
-	ErrNotFound = errors.New("not found")
+	ErrNotFound = apperror.ErrNotFound
+	ErrTimeout  = apperror.ErrTimeout
+)
+
+// MySQL server error numbers that map onto the error taxonomy.
+const (
+	mysqlErrDupEntry          = 1062
+	mysqlErrDataTooLong       = 1406
+	mysqlErrLockWaitTimeout   = 1205
+	mysqlErrQueryInterrupted  = 3024
+	mysqlErrTooManyConns      = 1040
+	mysqlErrServerShutdown    = 1053
+	mysqlErrBadNull           = 1048
+	mysqlErrTruncatedWrongVal = 1366
 )
 
+// Timeouts bounds how long a single repository call may spend in the
+// database. A zero value disables the deadline for that kind of call.
+type Timeouts struct {
+	Read  time.Duration
+	Write time.Duration
+}
+
+var DefaultTimeouts = Timeouts{
+	Read:  5 * time.Second,
+	Write: 10 * time.Second,
+}
+
+type Option func(*repository)
+
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(r *repository) {
+		r.timeouts = timeouts
+	}
+}
+
 type Repository interface {
-	GetListOfCakes(ctx context.Context, limit int, offset int) ([]m.Cake, error)
+	GetListOfCakes(ctx context.Context, query m.CakeQuery) ([]m.Cake, error)
+	SummarizeCakes(ctx context.Context, filter m.CakeFilter) (m.CakeSummary, error)
 	GetDetailsOfCake(ctx context.Context, id int) (m.Cake, error)
+	GetAnyCake(ctx context.Context, id int) (m.Cake, error)
 	InsertCake(ctx context.Context, cake m.Cake) (m.Cake, error)
-	UpdateCake(ctx context.Context, cake m.Cake) (m.Cake, error)
-	DeleteCake(ctx context.Context, id int) error
+	ExportCakes(ctx context.Context, fn func(m.Cake) error) error
+	UpdateCake(ctx context.Context, cake m.Cake, version int) (m.Cake, error)
+	PatchCake(ctx context.Context, id, version int, patch m.CakePatch) (m.Cake, error)
+	DeleteCake(ctx context.Context, id, version int) error
+	RestoreCake(ctx context.Context, id int) (m.Cake, error)
+	PurgeCake(ctx context.Context, id int) error
+	GetRevisions(ctx context.Context, id, limit, offset int) ([]m.Revision, error)
+	CountRevisions(ctx context.Context, id int) (int, error)
+	GetRevision(ctx context.Context, id, number int) (m.Revision, error)
+	RevertCake(ctx context.Context, id, version, number int) (m.Cake, error)
+	ApplyBatch(ctx context.Context, ops []m.BatchOperation, mode m.BatchMode) ([]m.BatchResult, error)
+	SaveImageVariants(ctx context.Context, id int, source string, variants []m.ImageVariant) ([]m.ImageVariant, error)
+	GetCakeImages(ctx context.Context, id int) (m.Cake, []m.CakeImage, error)
+	AddCakeImage(ctx context.Context, id, version int, image m.CakeImage) (m.Cake, []m.CakeImage, error)
+	ReorderCakeImages(ctx context.Context, id, version int, order []int) (m.Cake, []m.CakeImage, error)
+	UpdateCakeImage(ctx context.Context, id, version, imageID int, patch m.CakeImagePatch) (m.Cake, []m.CakeImage, error)
+	DeleteCakeImage(ctx context.Context, id, version, imageID int) (m.Cake, []m.CakeImage, error)
+	CreateAPIKey(ctx context.Context, key m.APIKey) (m.APIKey, error)
+	GetAPIKeys(ctx context.Context) ([]m.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, hash string) (m.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int) (m.APIKey, error)
+	TouchAPIKey(ctx context.Context, id int) error
 }
 
 type repository struct {
-	db *sql.DB
+	db       *sql.DB
+	timeouts Timeouts
+	mu       sync.Mutex
+	stmts    map[string]*sql.Stmt
+}
+
+func New(db *sql.DB, opts ...Option) Repository {
+	r := &repository{
+		db:       db,
+		timeouts: DefaultTimeouts,
+		stmts:    make(map[string]*sql.Stmt),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// withTimeout derives the context a single call runs under.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// wrapErr translates a driver error into the apperror taxonomy. Deadlines
+// are reported differently by each driver, so the context is checked too.
+func wrapErr(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var appErr *apperror.Error
+	if errors.As(err, &appErr) {
+		return err
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return apperror.Wrap(apperror.KindTimeout, ErrTimeout.Message, err)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return apperror.Wrap(apperror.KindNotFound, "cake not found", err)
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, sql.ErrConnDone) {
+		return apperror.Wrap(apperror.KindUnavailable, apperror.ErrUnavailable.Message, err)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return apperror.Wrap(apperror.KindUnavailable, apperror.ErrUnavailable.Message, err)
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case mysqlErrDupEntry:
+			return apperror.Wrap(apperror.KindConflict, "cake already exists", err)
+		case mysqlErrDataTooLong, mysqlErrBadNull, mysqlErrTruncatedWrongVal:
+			return apperror.Wrap(apperror.KindValidation, "cake has an invalid field value", err)
+		case mysqlErrLockWaitTimeout, mysqlErrQueryInterrupted:
+			return apperror.Wrap(apperror.KindTimeout, ErrTimeout.Message, err)
+		case mysqlErrTooManyConns, mysqlErrServerShutdown:
+			return apperror.Wrap(apperror.KindUnavailable, apperror.ErrUnavailable.Message, err)
+		}
+	}
+
+	return apperror.Wrap(apperror.KindInternal, apperror.ErrInternal.Message, err)
+}
+
+// stmt returns the prepared statement for query, preparing it on first use.
+// Statements are cached for the lifetime of the repository. The statement
+// is prepared outside the lock, so a slow prepare doesn't hold up queries
+// whose statements are cached already.
+func (r *repository) stmt(ctx context.Context, query string) (*sql.Stmt, error) {
+	r.mu.Lock()
+	stmt, ok := r.stmts[query]
+	r.mu.Unlock()
+	if ok {
+		return stmt, nil
+	}
+
+	stmt, err := r.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cached, ok := r.stmts[query]; ok {
+		_ = stmt.Close()
+		return cached, nil
+	}
+	if r.stmts == nil {
+		r.stmts = make(map[string]*sql.Stmt)
+	}
+	r.stmts[query] = stmt
+	return stmt, nil
 }
 
-func New(db *sql.DB) Repository {
-	return &repository{
-		db: db,
+// Close releases every prepared statement held by the repository.
+func (r *repository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var firstErr error
+	for query, stmt := range r.stmts {
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(r.stmts, query)
 	}
+	return firstErr
 }
-func (r *repository) GetListOfCakes(ctx context.Context, limit int, offset int) ([]m.Cake, error) {
+
+// readCake loads a cake by id, so callers return the values the database
+// stored rather than the ones they sent.
+func (r *repository) readCake(ctx context.Context, id int) (m.Cake, error) {
+	stmt, err := r.stmt(ctx, database.GetDetailsOfCakeByID)
+	if err != nil {
+		return m.Cake{}, err
+	}
+	return scanCake(stmt.QueryRowContext(ctx, id))
+}
+
+// GetListOfCakes runs a query built from a fixed set of clauses. The
+// number of filter and sort combinations is too large to keep prepared, so
+// it isn't cached like the other statements.
+func (r *repository) GetListOfCakes(ctx context.Context, query m.CakeQuery) ([]m.Cake, error) {
 	var (
 		err  error
 		rows *sql.Rows
 		data []m.Cake
 	)
 
-	query := fmt.Sprintf(database.GetListOfCakes, limit, offset)
-	rows, err = r.db.Query(query)
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	statement, args, err := buildListCakes(query)
 	if err != nil {
-		log.Println("[GetListOfCakes] can't get list of cakes, err:", err.Error())
 		return nil, err
 	}
 
+	rows, err = r.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		log.Println("[GetListOfCakes] can't get list of cakes, err:", err.Error())
+		return nil, wrapErr(ctx, err)
+	}
+	defer rows.Close()
+
 	for rows.Next() {
-		var temp = m.Cake{}
-		if err := rows.Scan(&temp.Id, &temp.Title, &temp.Description, &temp.Rating, &temp.Image, &temp.CreatedAt, &temp.UpdatedAt); err != nil {
-			log.Println("Error query :", err)
-			return nil, err
+		temp, err := scanCake(rows)
+		if err != nil {
+			return nil, wrapErr(ctx, err)
 		}
 		data = append(data, temp)
 	}
+	if err = rows.Err(); err != nil {
+		log.Println("[GetListOfCakes] can't iterate cakes, err:", err.Error())
+		return nil, wrapErr(ctx, err)
+	}
 
 	if len(data) > 0 {
 		return data, nil
@@ -61,103 +252,336 @@ func (r *repository) GetListOfCakes(ctx context.Context, limit int, offset int)
 		return []m.Cake{}, nil
 	}
 }
-func (r *repository) GetDetailsOfCake(ctx context.Context, id int) (m.Cake, error) {
+func (r *repository) SummarizeCakes(ctx context.Context, filter m.CakeFilter) (m.CakeSummary, error) {
 	var (
-		err  error
-		cake m.Cake
+		summary      m.CakeSummary
+		lastModified sql.NullTime
 	)
 
-	query := fmt.Sprintf(database.GetDetailsOfCakeByID, id)
-	err = r.db.QueryRow(query).Scan(&cake.Id, &cake.Title, &cake.Description, &cake.Rating, &cake.Image, &cake.CreatedAt, &cake.UpdatedAt)
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	statement, args := buildSummarizeCakes(filter)
+	if err := r.db.QueryRowContext(ctx, statement, args...).Scan(&summary.Total, &lastModified, &summary.Versions); err != nil {
+		log.Println("[SummarizeCakes] can't summarize cakes, err:", err.Error())
+		return m.CakeSummary{}, wrapErr(ctx, err)
+	}
+	summary.LastModified = lastModified.Time
+
+	return summary, nil
+}
+
+// GetDetailsOfCake reads a live cake along with the variants of its image.
+func (r *repository) GetDetailsOfCake(ctx context.Context, id int) (m.Cake, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	cake, err := r.readCake(ctx, id)
 	if err != nil {
 		log.Println("[GetDetailsOfCake] can't get details of cake, err:", err.Error())
-		return m.Cake{}, err
+		return m.Cake{}, wrapErr(ctx, err)
+	}
+	if err = r.loadImages(ctx, &cake); err != nil {
+		log.Println("[GetDetailsOfCake] can't get image variants, err:", err.Error())
+		return m.Cake{}, wrapErr(ctx, err)
 	}
 
 	return cake, nil
 }
+
+// GetAnyCake loads a cake by id, in the trash or not, without its images.
+func (r *repository) GetAnyCake(ctx context.Context, id int) (m.Cake, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	stmt, err := r.stmt(ctx, database.GetAnyCakeByID)
+	if err != nil {
+		log.Println("[GetAnyCake] can't prepare statement, err:", err.Error())
+		return m.Cake{}, wrapErr(ctx, err)
+	}
+	cake, err := scanCake(stmt.QueryRowContext(ctx, id))
+	if err != nil {
+		log.Println("[GetAnyCake] can't get cake, err:", err.Error())
+		return m.Cake{}, wrapErr(ctx, err)
+	}
+	return cake, nil
+}
+
+// InsertCake adds a cake. It takes cake.Id when set, as imports do, and
+// lets the database pick one otherwise.
 func (r *repository) InsertCake(ctx context.Context, cake m.Cake) (m.Cake, error) {
-	currentTime := time.Now().String()
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
 
-	cake.CreatedAt = currentTime
-	cake.UpdatedAt = currentTime
+	insertQuery, args := database.InsertCake, []interface{}{cake.Title, cake.Description, cake.Rating, cake.Image}
+	if cake.Id != 0 {
+		insertQuery, args = database.InsertCakeWithID, append([]interface{}{cake.Id}, args...)
+	}
 
-	query := fmt.Sprintf(database.InsertCake, cake.Id, cake.Title, cake.Description, cake.Rating, cake.Image, currentTime, currentTime)
-	rows, err := r.db.Exec(query)
+	stmts, err := r.prepareAll(ctx, insertQuery, database.GetDetailsOfCakeByID, database.InsertCakeRevision)
 	if err != nil {
-		log.Println("[InsertCake] can't insert cake, err:", err.Error())
-		return m.Cake{}, err
+		log.Println("[InsertCake] can't prepare statement, err:", err.Error())
+		return m.Cake{}, wrapErr(ctx, err)
 	}
+	insertStmt, readStmt, revisionStmt := stmts[0], stmts[1], stmts[2]
 
-	id, _ := rows.LastInsertId()
-	cake.Id = int(id)
-	cake.CreatedAt = fmt.Sprintf("%d-%d-%d %d:%d:%d", time.Now().Year(), time.Now().Month(), time.Now().Day(), time.Now().Hour(), time.Now().Minute(), time.Now().Second())
-	cake.UpdatedAt = fmt.Sprintf("%d-%d-%d %d:%d:%d", time.Now().Year(), time.Now().Month(), time.Now().Day(), time.Now().Hour(), time.Now().Minute(), time.Now().Second())
+	var inserted m.Cake
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.StmtContext(ctx, insertStmt).ExecContext(ctx, args...)
+		if err != nil {
+			log.Println("[InsertCake] can't insert cake, err:", err.Error())
+			return err
+		}
 
-	return cake, nil
+		id, err := rows.LastInsertId()
+		if err != nil {
+			log.Println("[InsertCake] can't get inserted id, err:", err.Error())
+			return err
+		}
+
+		inserted, err = scanCake(tx.StmtContext(ctx, readStmt).QueryRowContext(ctx, int(id)))
+		if err != nil {
+			log.Println("[InsertCake] can't read inserted cake, err:", err.Error())
+			return err
+		}
+
+		if err = syncPrimaryImage(ctx, tx, inserted.Id, "", inserted.Image); err != nil {
+			log.Println("[InsertCake] can't add primary image, err:", err.Error())
+			return err
+		}
+
+		return recordRevision(ctx, tx.StmtContext(ctx, revisionStmt), m.RevisionCreate, m.Cake{}, inserted)
+	})
+	if err != nil {
+		return m.Cake{}, wrapErr(ctx, err)
+	}
+
+	return inserted, nil
 }
-func (r *repository) UpdateCake(ctx context.Context, cake m.Cake) (m.Cake, error) {
-	var (
-		err        error
-		cakeTemp   m.Cake
-		created_at string
-		updated_at string
-	)
-	currentTime := time.Now().String()
 
-	query := fmt.Sprintf(database.GetDetailsOfCakeByID, cake.Id)
-	err = r.db.QueryRow(query).Scan(&cakeTemp.Id, &cakeTemp.Title, &cakeTemp.Description, &cakeTemp.Rating, &cakeTemp.Image, &cakeTemp.CreatedAt, &cakeTemp.UpdatedAt)
+// ExportCakes calls fn with every live cake, by id, while reading them.
+// It isn't bound by the read timeout, since it lasts as long as fn takes to
+// pass the cakes on, and stops at the first error fn returns.
+func (r *repository) ExportCakes(ctx context.Context, fn func(m.Cake) error) error {
+	stmt, err := r.stmt(ctx, database.ExportCakes)
 	if err != nil {
-		log.Println("[UpdateCake] can't update cake, err:", err.Error())
-		return m.Cake{}, ErrNotFound
+		log.Println("[ExportCakes] can't prepare statement, err:", err.Error())
+		return wrapErr(ctx, err)
 	}
 
-	if cake.Title == "" {
-		cake.Title = cakeTemp.Title
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		log.Println("[ExportCakes] can't export cakes, err:", err.Error())
+		return wrapErr(ctx, err)
 	}
-	if cake.Description == "" {
-		cake.Description = cakeTemp.Description
+	defer rows.Close()
+
+	for rows.Next() {
+		cake, err := scanCake(rows)
+		if err != nil {
+			log.Println("[ExportCakes] can't scan cake, err:", err.Error())
+			return wrapErr(ctx, err)
+		}
+		if err = fn(cake); err != nil {
+			return err
+		}
 	}
-	if cake.Rating == 0 {
-		cake.Rating = cakeTemp.Rating
+	if err = rows.Err(); err != nil {
+		log.Println("[ExportCakes] can't iterate cakes, err:", err.Error())
+		return wrapErr(ctx, err)
 	}
-	if cake.Image == "" {
-		cake.Image = cakeTemp.Image
+	return nil
+}
+
+// UpdateCake replaces every writable field of the cake with cake.Id.
+// Writes that take a version fail with KindPreconditionFailed unless the
+// cake is still at that version; a zero version skips the check.
+func (r *repository) UpdateCake(ctx context.Context, cake m.Cake, version int) (m.Cake, error) {
+	return r.modifyCake(ctx, "UpdateCake", m.RevisionUpdate, cake.Id, version, func(current *m.Cake) {
+		current.Title = cake.Title
+		current.Description = cake.Description
+		current.Rating = cake.Rating
+		current.Image = cake.Image
+	})
+}
+
+// PatchCake changes only the fields present in patch.
+func (r *repository) PatchCake(ctx context.Context, id, version int, patch m.CakePatch) (m.Cake, error) {
+	return r.modifyCake(ctx, "PatchCake", m.RevisionUpdate, id, version, patch.Apply)
+}
+
+// modifyCake locks the row, lets apply change the stored values and writes
+// them back in one transaction, so concurrent writers are serialised.
+func (r *repository) modifyCake(ctx context.Context, op, action string, id, version int, apply func(*m.Cake)) (m.Cake, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	stmts, err := r.prepareAll(ctx, database.GetDetailsOfCakeByIDForUpdate, database.UpdateCakeByID, database.GetDetailsOfCakeByID, database.InsertCakeRevision)
+	if err != nil {
+		log.Printf("[%s] can't prepare statement, err: %s", op, err.Error())
+		return m.Cake{}, wrapErr(ctx, err)
 	}
 
-	created_at = cakeTemp.UpdatedAt
-	updated_at = currentTime
+	var updated m.Cake
+	err = r.inTx(ctx, func(tx *sql.Tx) (err error) {
+		updated, err = modifyInTx(ctx, tx, stmts, op, action, id, version, apply)
+		return err
+	})
+	if err != nil {
+		return m.Cake{}, wrapErr(ctx, err)
+	}
+
+	return updated, nil
+}
+
+// modifyInTx runs the change of modifyCake in tx with the statements
+// modifyCake prepares, in the same order.
+func modifyInTx(ctx context.Context, tx *sql.Tx, stmts []*sql.Stmt, op, action string, id, version int, apply func(*m.Cake)) (m.Cake, error) {
+	lockStmt, updateStmt, readStmt, revisionStmt := stmts[0], stmts[1], stmts[2], stmts[3]
 
-	query = fmt.Sprintf(database.UpdateCakeByID, cake.Title, cake.Description, cake.Rating, cake.Image, created_at, updated_at, cake.Id)
-	rows, err := r.db.Exec(query)
+	current, err := scanCake(tx.StmtContext(ctx, lockStmt).QueryRowContext(ctx, id))
 	if err != nil {
-		log.Println("[UpdateCake] can't update cake, err:", err.Error())
-		return m.Cake{}, nil
+		log.Printf("[%s] can't lock cake, err: %s", op, err.Error())
+		return m.Cake{}, err
 	}
 
-	cake.CreatedAt = created_at
-	cake.UpdatedAt = fmt.Sprintf("%d-%d-%d %d:%d:%d", time.Now().Year(), time.Now().Month(), time.Now().Day(), time.Now().Hour(), time.Now().Minute(), time.Now().Second())
+	if err = checkVersion(current, version); err != nil {
+		log.Printf("[%s] can't update cake, err: %s", op, err.Error())
+		return m.Cake{}, err
+	}
 
-	rowsAffected, _ := rows.RowsAffected()
-	if rowsAffected > 0 {
-		return cake, nil
+	cake := current
+	apply(&cake)
+
+	rows, err := tx.StmtContext(ctx, updateStmt).ExecContext(ctx, cake.Title, cake.Description, cake.Rating, cake.Image, id, current.Version)
+	if err == nil {
+		err = checkAffected(rows)
+	}
+	if err != nil {
+		log.Printf("[%s] can't update cake, err: %s", op, err.Error())
+		return m.Cake{}, err
 	}
 
-	return cake, nil
+	if err = syncPrimaryImage(ctx, tx, id, current.Image, cake.Image); err != nil {
+		log.Printf("[%s] can't update primary image, err: %s", op, err.Error())
+		return m.Cake{}, err
+	}
+
+	updated, err := scanCake(tx.StmtContext(ctx, readStmt).QueryRowContext(ctx, id))
+	if err != nil {
+		log.Printf("[%s] can't read updated cake, err: %s", op, err.Error())
+		return m.Cake{}, err
+	}
+
+	return updated, recordRevision(ctx, tx.StmtContext(ctx, revisionStmt), action, current, updated)
 }
-func (r *repository) DeleteCake(ctx context.Context, id int) (err error) {
-	query := fmt.Sprintf(database.DeleteCakeByID, id)
-	rows, err := r.db.Exec(query)
+
+// DeleteCake moves the cake to the trash. It keeps its row, and
+// updated_at, until it is purged.
+func (r *repository) DeleteCake(ctx context.Context, id, version int) error {
+	_, err := r.moveCake(ctx, "DeleteCake", m.RevisionDelete, database.GetDetailsOfCakeByIDForUpdate, database.TrashCakeByID, id, version)
+	return err
+}
+
+// RestoreCake takes the cake out of the trash.
+func (r *repository) RestoreCake(ctx context.Context, id int) (m.Cake, error) {
+	return r.moveCake(ctx, "RestoreCake", m.RevisionRestore, database.GetDetailsOfTrashedCakeByIDForUpdate, database.RestoreCakeByID, id, 0)
+}
+
+// PurgeCake deletes a cake in the trash for good, with its gallery. Its
+// revisions are kept.
+func (r *repository) PurgeCake(ctx context.Context, id int) error {
+	_, err := r.moveCake(ctx, "PurgeCake", m.RevisionPurge, database.GetDetailsOfTrashedCakeByIDForUpdate, database.PurgeCakeByID, id, 0)
+	return err
+}
+
+// moveCake locks the cake with lockQuery, which also checks that the cake
+// is where the move starts from, runs changeQuery on it and records the
+// revision in one transaction. A purge leaves nothing to read back, so its
+// revision holds the last state of the cake.
+func (r *repository) moveCake(ctx context.Context, op, action, lockQuery, changeQuery string, id, version int) (m.Cake, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	stmts, err := r.prepareAll(ctx, lockQuery, changeQuery, database.GetAnyCakeByID, database.InsertCakeRevision)
 	if err != nil {
-		log.Println("[DeleteCake] can't delete cake, err:", err.Error())
+		log.Printf("[%s] can't prepare statement, err: %s", op, err.Error())
+		return m.Cake{}, wrapErr(ctx, err)
+	}
+
+	var moved m.Cake
+	err = r.inTx(ctx, func(tx *sql.Tx) (err error) {
+		moved, err = moveInTx(ctx, tx, stmts, op, action, id, version)
 		return err
+	})
+	if err != nil {
+		return m.Cake{}, wrapErr(ctx, err)
 	}
 
-	rowsAffected, _ := rows.RowsAffected()
-	if rowsAffected > 0 {
-		return nil
-	} else {
-		log.Println("[DeleteCake] can't delete cake, err:", ErrNotFound.Error())
-		return ErrNotFound
+	return moved, nil
+}
+
+// moveInTx runs the move of moveCake in tx with the statements moveCake
+// prepares, in the same order.
+func moveInTx(ctx context.Context, tx *sql.Tx, stmts []*sql.Stmt, op, action string, id, version int) (m.Cake, error) {
+	lockStmt, changeStmt, readStmt, revisionStmt := stmts[0], stmts[1], stmts[2], stmts[3]
+
+	current, err := scanCake(tx.StmtContext(ctx, lockStmt).QueryRowContext(ctx, id))
+	if err != nil {
+		log.Printf("[%s] can't lock cake, err: %s", op, err.Error())
+		return m.Cake{}, err
+	}
+
+	if err = checkVersion(current, version); err != nil {
+		log.Printf("[%s] can't change cake, err: %s", op, err.Error())
+		return m.Cake{}, err
+	}
+
+	rows, err := tx.StmtContext(ctx, changeStmt).ExecContext(ctx, id, current.Version)
+	if err == nil {
+		err = checkAffected(rows)
+	}
+	if err != nil {
+		log.Printf("[%s] can't change cake, err: %s", op, err.Error())
+		return m.Cake{}, err
+	}
+
+	if action == m.RevisionPurge {
+		if _, err = tx.ExecContext(ctx, database.DeleteCakeImages, id); err != nil {
+			log.Printf("[%s] can't delete images, err: %s", op, err.Error())
+			return m.Cake{}, err
+		}
+	}
+
+	moved := current
+	if action != m.RevisionPurge {
+		moved, err = scanCake(tx.StmtContext(ctx, readStmt).QueryRowContext(ctx, id))
+		if err != nil {
+			log.Printf("[%s] can't read changed cake, err: %s", op, err.Error())
+			return m.Cake{}, err
+		}
+	}
+
+	return moved, recordRevision(ctx, tx.StmtContext(ctx, revisionStmt), action, current, moved)
+}
+
+// checkVersion fails unless cake is at version. A zero version matches any.
+func checkVersion(cake m.Cake, version int) error {
+	if version != 0 && cake.Version != version {
+		return apperror.New(apperror.KindPreconditionFailed, "cake has been changed since it was read")
+	}
+	return nil
+}
+
+// checkAffected fails when a version-checked write matched no row. The row
+// lock makes this unreachable unless something bypasses it.
+func checkAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return apperror.New(apperror.KindPreconditionFailed, "cake has been changed since it was read")
 	}
+	return nil
 }
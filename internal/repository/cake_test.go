@@ -4,7 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
+	"privy/database"
+	"privy/internal/apperror"
 	m "privy/models"
 	"reflect"
 	"regexp"
@@ -12,9 +13,27 @@ import (
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
 	"github.com/golang/mock/gomock"
 )
 
+const testImage = "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg"
+
+var (
+	revisionColumns = []string{"cake_id", "revision", "action", "snapshot", "changed", "actor", "created_at"}
+	cakeColumns     = []string{"id", "title", "description", "rating", "image", "version", "created_at", "updated_at", "deleted_at"}
+	createdAt       = time.Date(2022, 12, 1, 20, 29, 0, 0, time.UTC)
+	updatedAt       = time.Date(2022, 12, 2, 8, 15, 0, 0, time.UTC)
+)
+
+// expectRevision expects the revision recorded by a change to the cake
+// with id, made without an actor.
+func expectRevision(revision *sqlmock.ExpectedPrepare, id int, action, changed string) {
+	revision.ExpectExec().
+		WithArgs(id, action, sqlmock.AnyArg(), []byte(changed), "anonymous", id).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
 func TestNew(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -45,6 +64,48 @@ func TestNew(t *testing.T) {
 		})
 	}
 }
+func Test_repository_stmt(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectPrepare("SELECT 1")
+	mock.ExpectPrepare("SELECT 2").WillDelayFor(500 * time.Millisecond)
+
+	r := &repository{db: db, stmts: make(map[string]*sql.Stmt)}
+	ctx := context.Background()
+	cached, err := r.stmt(ctx, "SELECT 1")
+	if err != nil {
+		t.Fatalf("stmt() error = %v", err)
+	}
+
+	slow := make(chan struct{})
+	go func() {
+		defer close(slow)
+		if _, err := r.stmt(ctx, "SELECT 2"); err != nil {
+			t.Errorf("stmt() error = %v", err)
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	got, err := r.stmt(ctx, "SELECT 1")
+	if err != nil || got != cached {
+		t.Errorf("stmt() = %v, %v, want the cached statement", got, err)
+	}
+	select {
+	case <-slow:
+		t.Errorf("stmt() waited for a slow prepare of another query")
+	default:
+	}
+	<-slow
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func Test_repository_GetListOfCakes(t *testing.T) {
 	ctx := context.Background()
 
@@ -54,10 +115,12 @@ func Test_repository_GetListOfCakes(t *testing.T) {
 	}
 	defer db.Close()
 
+	listQuery := regexp.QuoteMeta(database.SelectCakes + " WHERE deleted_at IS NULL ORDER BY rating DESC, title ASC, id ASC LIMIT ? OFFSET ?")
+	deletedAt := createdAt.Add(time.Hour)
+
 	type args struct {
-		ctx    context.Context
-		limit  int
-		offset int
+		ctx   context.Context
+		query m.CakeQuery
 	}
 	tests := []struct {
 		name    string
@@ -69,62 +132,120 @@ func Test_repository_GetListOfCakes(t *testing.T) {
 		{
 			name: "Success",
 			args: args{
-				ctx:    ctx,
-				limit:  10,
-				offset: 0,
+				ctx:   ctx,
+				query: m.CakeQuery{Limit: 10},
+			},
+			want: []m.Cake{
+				{Id: 1, Title: "title", Description: "description", Rating: 10, Image: "https://www.abc.com/abc.jpeg", Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt},
+				{Id: 2, Title: "title2", Description: "description2", Rating: 20, Image: "https://www.abc.com/abc.jpeg", Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt},
+			},
+			wantErr: false,
+			mock: func() {
+				rows := sqlmock.NewRows(cakeColumns).
+					AddRow(1, "title", "description", 10, "https://www.abc.com/abc.jpeg", 1, createdAt, createdAt, nil).
+					AddRow(2, "title2", "description2", 20, "https://www.abc.com/abc.jpeg", 1, createdAt, createdAt, nil)
+				sqlMock.ExpectQuery(listQuery).WithArgs(10, 0).WillReturnRows(rows)
+			},
+		},
+		{
+			name: "Filtered",
+			args: args{
+				ctx: ctx,
+				query: m.CakeQuery{
+					CakeFilter: m.CakeFilter{Search: "lemon", CreatedFrom: createdAt},
+					Sort:       []m.SortField{{Field: "created_at", Desc: true}},
+					Limit:      5,
+					Offset:     5,
+				},
+			},
+			want: []m.Cake{
+				{Id: 1, Title: "title", Description: "description", Rating: 10, Image: "https://www.abc.com/abc.jpeg", Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt},
+			},
+			wantErr: false,
+			mock: func() {
+				rows := sqlmock.NewRows(cakeColumns).
+					AddRow(1, "title", "description", 10, "https://www.abc.com/abc.jpeg", 1, createdAt, createdAt, nil)
+				sqlMock.ExpectQuery(regexp.QuoteMeta(database.SelectCakes+
+					" WHERE deleted_at IS NULL AND MATCH (title, description) AGAINST (? IN NATURAL LANGUAGE MODE) AND created_at >= ?"+
+					" ORDER BY created_at DESC, id ASC LIMIT ? OFFSET ?")).
+					WithArgs("lemon", createdAt, 5, 5).WillReturnRows(rows)
+			},
+		},
+		{
+			name: "Trash",
+			args: args{
+				ctx:   ctx,
+				query: m.CakeQuery{CakeFilter: m.CakeFilter{Trashed: true}, Limit: 10},
 			},
 			want: []m.Cake{
-				{Id: 1, Title: "title", Description: "description", Rating: 10, Image: "https://www.abc.com/abc.jpeg", CreatedAt: "2022-12-01 20:29:00", UpdatedAt: "2022-12-01 20:29:00"},
-				{Id: 2, Title: "title2", Description: "description2", Rating: 20, Image: "https://www.abc.com/abc.jpeg", CreatedAt: "2022-12-01 20:29:00", UpdatedAt: "2022-12-01 20:29:00"},
+				{Id: 1, Title: "title", Description: "description", Rating: 10, Image: "https://www.abc.com/abc.jpeg", Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt, DeletedAt: &deletedAt},
 			},
 			wantErr: false,
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"id", "title", "description", "rating", "image", "created_at", "updated_at"}).
-					AddRow(1, "title", "description", 10, "https://www.abc.com/abc.jpeg", "2022-12-01 20:29:00", "2022-12-01 20:29:00").
-					AddRow(2, "title2", "description2", 20, "https://www.abc.com/abc.jpeg", "2022-12-01 20:29:00", "2022-12-01 20:29:00")
-				sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM privy_cakes ORDER BY rating DESC, title ASC LIMIT 10 OFFSET 0`)).WillReturnRows(rows)
+				rows := sqlmock.NewRows(cakeColumns).
+					AddRow(1, "title", "description", 10, "https://www.abc.com/abc.jpeg", 1, createdAt, createdAt, deletedAt)
+				sqlMock.ExpectQuery(regexp.QuoteMeta(database.SelectCakes+
+					" WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id ASC LIMIT ? OFFSET ?")).
+					WithArgs(10, 0).WillReturnRows(rows)
+			},
+		},
+		{
+			name: "Trash Only Sort Field",
+			args: args{
+				ctx:   ctx,
+				query: m.CakeQuery{Sort: []m.SortField{{Field: "deleted_at"}}, Limit: 10},
+			},
+			want:    nil,
+			wantErr: true,
+			mock:    func() {},
+		},
+		{
+			name: "Unknown Sort Field",
+			args: args{
+				ctx:   ctx,
+				query: m.CakeQuery{Sort: []m.SortField{{Field: "image"}}, Limit: 10},
 			},
+			want:    nil,
+			wantErr: true,
+			mock:    func() {},
 		},
 		{
 			name: "Query error",
 			args: args{
-				ctx:    ctx,
-				limit:  10,
-				offset: 0,
+				ctx:   ctx,
+				query: m.CakeQuery{Limit: 10},
 			},
 			want:    nil,
 			wantErr: true,
 			mock: func() {
-				sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM privy_cakes ORDER BY rating DESC, title ASC LIMIT 10 OFFSET 0`)).WillReturnError(errors.New("query error"))
+				sqlMock.ExpectQuery(listQuery).WithArgs(10, 0).WillReturnError(errors.New("query error"))
 			},
 		},
 		{
 			name: "Scan error",
 			args: args{
-				ctx:    ctx,
-				limit:  10,
-				offset: 0,
+				ctx:   ctx,
+				query: m.CakeQuery{Limit: 10},
 			},
 			want:    nil,
 			wantErr: true,
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"id", "title", "description", "rating", "image", "created_at", "updated_at"}).
-					AddRow("not number", "title", "description", 10, "https://www.abc.com/abc.jpeg", "2022-12-01 20:29:00", "2022-12-01 20:29:00")
-				sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM privy_cakes ORDER BY rating DESC, title ASC LIMIT 10 OFFSET 0`)).WillReturnRows(rows)
+				rows := sqlmock.NewRows(cakeColumns).
+					AddRow("not number", "title", "description", 10, "https://www.abc.com/abc.jpeg", 1, createdAt, createdAt, nil)
+				sqlMock.ExpectQuery(listQuery).WithArgs(10, 0).WillReturnRows(rows)
 			},
 		},
 		{
 			name: "Success",
 			args: args{
-				ctx:    ctx,
-				limit:  10,
-				offset: 0,
+				ctx:   ctx,
+				query: m.CakeQuery{Limit: 10},
 			},
 			want:    []m.Cake{},
 			wantErr: false,
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"id", "title", "description", "rating", "image", "created_at", "updated_at"})
-				sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM privy_cakes ORDER BY rating DESC, title ASC LIMIT 10 OFFSET 0`)).WillReturnRows(rows)
+				rows := sqlmock.NewRows(cakeColumns)
+				sqlMock.ExpectQuery(listQuery).WithArgs(10, 0).WillReturnRows(rows)
 			},
 		},
 	}
@@ -135,7 +256,7 @@ func Test_repository_GetListOfCakes(t *testing.T) {
 			r := &repository{
 				db: db,
 			}
-			got, err := r.GetListOfCakes(tt.args.ctx, tt.args.limit, tt.args.offset)
+			got, err := r.GetListOfCakes(tt.args.ctx, tt.args.query)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("repository.GetListOfCakes() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -143,6 +264,83 @@ func Test_repository_GetListOfCakes(t *testing.T) {
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("repository.GetListOfCakes() = %v, want %v", got, tt.want)
 			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+func Test_repository_SummarizeCakes(t *testing.T) {
+	ctx := context.Background()
+
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	minRating := float32(8)
+	summaryColumns := []string{"COUNT(*)", "MAX(updated_at)", "COALESCE(SUM(version), 0)"}
+	tests := []struct {
+		name    string
+		filter  m.CakeFilter
+		want    m.CakeSummary
+		wantErr bool
+		mock    func()
+	}{
+		{
+			name:    "Success",
+			want:    m.CakeSummary{Total: 42, LastModified: updatedAt, Versions: 57},
+			wantErr: false,
+			mock: func() {
+				sqlMock.ExpectQuery(regexp.QuoteMeta(database.SummarizeCakes + " WHERE deleted_at IS NULL")).
+					WillReturnRows(sqlmock.NewRows(summaryColumns).AddRow(42, updatedAt, 57))
+			},
+		},
+		{
+			name:    "Filtered",
+			filter:  m.CakeFilter{MinRating: &minRating},
+			want:    m.CakeSummary{Total: 3, LastModified: updatedAt, Versions: 3},
+			wantErr: false,
+			mock: func() {
+				sqlMock.ExpectQuery(regexp.QuoteMeta(database.SummarizeCakes + " WHERE deleted_at IS NULL AND rating >= ?")).
+					WithArgs(minRating).WillReturnRows(sqlmock.NewRows(summaryColumns).AddRow(3, updatedAt, 3))
+			},
+		},
+		{
+			name:    "No Cakes",
+			want:    m.CakeSummary{},
+			wantErr: false,
+			mock: func() {
+				sqlMock.ExpectQuery(regexp.QuoteMeta(database.SummarizeCakes + " WHERE deleted_at IS NULL")).
+					WillReturnRows(sqlmock.NewRows(summaryColumns).AddRow(0, nil, 0))
+			},
+		},
+		{
+			name:    "Query Error",
+			want:    m.CakeSummary{},
+			wantErr: true,
+			mock: func() {
+				sqlMock.ExpectQuery(regexp.QuoteMeta(database.SummarizeCakes)).
+					WillReturnError(errors.New("query error"))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+
+			r := &repository{
+				db: db,
+			}
+			got, err := r.SummarizeCakes(ctx, tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("repository.SummarizeCakes() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("repository.SummarizeCakes() = %v, want %v", got, tt.want)
+			}
 		})
 	}
 }
@@ -172,12 +370,61 @@ func Test_repository_GetDetailsOfCake(t *testing.T) {
 				ctx: ctx,
 				id:  1,
 			},
-			want:    m.Cake{Id: 1, Title: "title", Description: "description", Rating: 10, Image: "https://www.abc.com/abc.jpeg", CreatedAt: "2022-12-01 20:29:00", UpdatedAt: "2022-12-01 20:29:00"},
+			want:    m.Cake{Id: 1, Title: "title", Description: "description", Rating: 10, Image: "https://www.abc.com/abc.jpeg", Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt},
+			wantErr: false,
+			mock: func() {
+				rows := sqlmock.NewRows(cakeColumns).
+					AddRow(1, "title", "description", 10, "https://www.abc.com/abc.jpeg", 1, createdAt, createdAt, nil)
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByID)).
+					ExpectQuery().WithArgs(1).WillReturnRows(rows)
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetImageVariants)).
+					ExpectQuery().WithArgs(1, "https://www.abc.com/abc.jpeg").WillReturnRows(sqlmock.NewRows(variantColumns))
+			},
+		},
+		{
+			name: "With Image Variants",
+			args: args{
+				ctx: ctx,
+				id:  1,
+			},
+			want: m.Cake{Id: 1, Title: "title", Description: "description", Rating: 10, Image: "https://www.abc.com/images/a.png", Version: 2, CreatedAt: createdAt, UpdatedAt: createdAt, Images: &m.CakeImages{
+				Placeholder: "data:image/jpeg;base64,AAAA",
+				Variants: []m.ImageVariant{
+					{Name: "thumbnail", Type: "image/jpeg", Width: 160, Height: 120, URL: "https://www.abc.com/images/a-thumbnail.jpg", Key: "a-thumbnail.jpg"},
+					{Name: "medium", Type: "image/jpeg", Width: 640, Height: 480, URL: "https://www.abc.com/images/a-medium.jpg", Key: "a-medium.jpg"},
+				},
+				Srcset: map[string]string{"image/jpeg": "https://www.abc.com/images/a-thumbnail.jpg 160w, https://www.abc.com/images/a-medium.jpg 640w"},
+			}},
+			wantErr: false,
+			mock: func() {
+				rows := sqlmock.NewRows(cakeColumns).
+					AddRow(1, "title", "description", 10, "https://www.abc.com/images/a.png", 2, createdAt, createdAt, nil)
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByID)).
+					ExpectQuery().WithArgs(1).WillReturnRows(rows)
+				variants := sqlmock.NewRows(variantColumns).
+					AddRow("medium", "image/jpeg", 640, 480, "https://www.abc.com/images/a-medium.jpg", "a-medium.jpg").
+					AddRow("thumbnail", "image/jpeg", 160, 120, "https://www.abc.com/images/a-thumbnail.jpg", "a-thumbnail.jpg").
+					AddRow("placeholder", "image/jpeg", 16, 12, "data:image/jpeg;base64,AAAA", "")
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetImageVariants)).
+					ExpectQuery().WithArgs(1, "https://www.abc.com/images/a.png").WillReturnRows(variants)
+			},
+		},
+		{
+			name: "Timestamps Normalised To UTC",
+			args: args{
+				ctx: ctx,
+				id:  1,
+			},
+			want:    m.Cake{Id: 1, Title: "title", Description: "description", Rating: 10, Image: "https://www.abc.com/abc.jpeg", Version: 1, CreatedAt: createdAt, UpdatedAt: updatedAt},
 			wantErr: false,
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"id", "title", "description", "rating", "image", "created_at", "updated_at"}).
-					AddRow(1, "title", "description", 10, "https://www.abc.com/abc.jpeg", "2022-12-01 20:29:00", "2022-12-01 20:29:00")
-				sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM privy_cakes WHERE id='1'`)).WillReturnRows(rows)
+				jakarta := time.FixedZone("WIB", 7*60*60)
+				rows := sqlmock.NewRows(cakeColumns).
+					AddRow(1, "title", "description", 10, "https://www.abc.com/abc.jpeg", 1, createdAt.In(jakarta), updatedAt.In(jakarta), nil)
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByID)).
+					ExpectQuery().WithArgs(1).WillReturnRows(rows)
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetImageVariants)).
+					ExpectQuery().WithArgs(1, "https://www.abc.com/abc.jpeg").WillReturnRows(sqlmock.NewRows(variantColumns))
 			},
 		},
 		{
@@ -189,7 +436,8 @@ func Test_repository_GetDetailsOfCake(t *testing.T) {
 			want:    m.Cake{},
 			wantErr: true,
 			mock: func() {
-				sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM privy_cakes WHERE id='1'`)).WillReturnError(errors.New("query error"))
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByID)).
+					ExpectQuery().WithArgs(1).WillReturnError(errors.New("query error"))
 			},
 		},
 	}
@@ -211,10 +459,8 @@ func Test_repository_GetDetailsOfCake(t *testing.T) {
 		})
 	}
 }
-func Test_repository_InsertCake(t *testing.T) {
+func Test_repository_GetAnyCake(t *testing.T) {
 	ctx := context.Background()
-	ct := time.Now()
-	currentTime := fmt.Sprintf("%d-%d-%d %d:%d:%d", ct.Year(), ct.Month(), ct.Day(), ct.Hour(), ct.Minute(), ct.Second())
 
 	db, sqlMock, err := sqlmock.New()
 	if err != nil {
@@ -222,57 +468,94 @@ func Test_repository_InsertCake(t *testing.T) {
 	}
 	defer db.Close()
 
-	type args struct {
-		ctx  context.Context
-		cake m.Cake
-	}
 	tests := []struct {
 		name    string
-		args    args
 		want    m.Cake
-		wantErr bool
+		wantErr error
+		mock    func(read *sqlmock.ExpectedPrepare)
+	}{
+		{
+			name: "In The Trash",
+			want: m.Cake{Id: 1, Title: "title", Description: "description", Rating: 10, Image: testImage, Version: 2, CreatedAt: createdAt, UpdatedAt: updatedAt, DeletedAt: &updatedAt},
+			mock: func(read *sqlmock.ExpectedPrepare) {
+				read.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(1, "title", "description", 10, testImage, 2, createdAt, updatedAt, updatedAt))
+			},
+		},
+		{
+			name:    "Not Found",
+			wantErr: apperror.ErrNotFound,
+			mock: func(read *sqlmock.ExpectedPrepare) {
+				read.ExpectQuery().WithArgs(1).WillReturnError(sql.ErrNoRows)
+			},
+		},
+	}
+	read := sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetAnyCakeByID))
+	r := &repository{db: db}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock(read)
+
+			got, err := r.GetAnyCake(ctx, 1)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("repository.GetAnyCake() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("repository.GetAnyCake() = %v, want %v", got, tt.want)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_repository_ExportCakes(t *testing.T) {
+	ctx := context.Background()
+
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	errStop := errors.New("client went away")
+	tests := []struct {
+		name    string
+		fail    int
+		want    []int
+		wantErr error
 		mock    func()
 	}{
 		{
 			name: "Success",
-			args: args{
-				ctx: ctx,
-				cake: m.Cake{
-					Id:          1,
-					Title:       "title",
-					Description: "desc",
-					Rating:      10,
-					Image:       "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
-					CreatedAt:   currentTime,
-					UpdatedAt:   currentTime,
-				},
-			},
-			want:    m.Cake{Id: 1, Title: "title", Description: "desc", Rating: 10, Image: "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg", CreatedAt: currentTime, UpdatedAt: currentTime},
-			wantErr: false,
+			want: []int{1, 2, 3},
 			mock: func() {
-				query := `INSERT INTO privy_cakes`
-				sqlMock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(int64(1), int64(1)))
+				rows := sqlmock.NewRows(cakeColumns)
+				for id := 1; id <= 3; id++ {
+					rows.AddRow(id, "title", "desc", 10, testImage, 1, createdAt, createdAt, nil)
+				}
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.ExportCakes)).ExpectQuery().WillReturnRows(rows)
 			},
 		},
 		{
-			name: "Query Error",
-			args: args{
-				ctx: ctx,
-				cake: m.Cake{
-					Id:          1,
-					Title:       "title",
-					Description: "desc",
-					Rating:      10,
-					Image:       "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
-					CreatedAt:   currentTime,
-					UpdatedAt:   currentTime,
-				},
+			name:    "Callback Error Stops",
+			fail:    2,
+			want:    []int{1, 2},
+			wantErr: errStop,
+			mock: func() {
+				rows := sqlmock.NewRows(cakeColumns)
+				for id := 1; id <= 3; id++ {
+					rows.AddRow(id, "title", "desc", 10, testImage, 1, createdAt, createdAt, nil)
+				}
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.ExportCakes)).ExpectQuery().WillReturnRows(rows)
 			},
-			want:    m.Cake{},
-			wantErr: true,
+		},
+		{
+			name:    "Query Error",
+			wantErr: apperror.ErrInternal,
 			mock: func() {
-				query := `UPDATE INTO privy_cakes`
-				sqlMock.ExpectExec(query).WillReturnError(errors.New("Query Error"))
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.ExportCakes)).ExpectQuery().WillReturnError(errors.New("query error"))
 			},
 		},
 	}
@@ -283,21 +566,28 @@ func Test_repository_InsertCake(t *testing.T) {
 			r := &repository{
 				db: db,
 			}
-			got, err := r.InsertCake(tt.args.ctx, tt.args.cake)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("repository.InsertCake() error = %v, wantErr %v", err, tt.wantErr)
-				return
+			var got []int
+			err := r.ExportCakes(ctx, func(cake m.Cake) error {
+				got = append(got, cake.Id)
+				if cake.Id == tt.fail {
+					return errStop
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("repository.ExportCakes() error = %v, want %v", err, tt.wantErr)
 			}
 			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("repository.InsertCake() = %v, want %v", got, tt.want)
+				t.Errorf("repository.ExportCakes() exported %v, want %v", got, tt.want)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
 			}
 		})
 	}
 }
-func Test_repository_UpdateCake(t *testing.T) {
+func Test_repository_InsertCake(t *testing.T) {
 	ctx := context.Background()
-	ct := time.Now()
-	currentTime := fmt.Sprintf("%d-%d-%d %d:%d:%d", ct.Year(), ct.Month(), ct.Day(), ct.Hour(), ct.Minute(), ct.Second())
 
 	db, sqlMock, err := sqlmock.New()
 	if err != nil {
@@ -305,6 +595,13 @@ func Test_repository_UpdateCake(t *testing.T) {
 	}
 	defer db.Close()
 
+	expectPrepare := func() (insert, read, revision *sqlmock.ExpectedPrepare) {
+		insert = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.InsertCake))
+		read = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByID))
+		revision = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.InsertCakeRevision))
+		return
+	}
+
 	type args struct {
 		ctx  context.Context
 		cake m.Cake
@@ -321,195 +618,526 @@ func Test_repository_UpdateCake(t *testing.T) {
 			args: args{
 				ctx: ctx,
 				cake: m.Cake{
-					Id:          1,
-					Title:       "newtitle",
-					Description: "newdesc",
+					Title:       "title",
+					Description: "desc",
 					Rating:      10,
-					Image:       "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
-					CreatedAt:   "2022-12-01 20:29:00",
-					UpdatedAt:   "2022-12-01 20:29:00",
+					Image:       testImage,
 				},
 			},
-			want:    m.Cake{Id: 1, Title: "newtitle", Description: "newdesc", Rating: 10, Image: "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg", CreatedAt: "2022-12-01 20:29:00", UpdatedAt: currentTime},
+			want:    m.Cake{Id: 1, Title: "title", Description: "desc", Rating: 10, Image: testImage, Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt},
 			wantErr: false,
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"id", "title", "description", "rating", "image", "created_at", "updated_at"}).
-					AddRow(1, "title", "description", 10, "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg", "2022-12-01 20:29:00", "2022-12-01 20:29:00")
-				sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM privy_cakes`)).WillReturnRows(rows)
-				sqlMock.ExpectExec("UPDATE privy_cakes").WillReturnResult(sqlmock.NewResult(1, 1))
+				insert, read, revision := expectPrepare()
+				sqlMock.ExpectBegin()
+				insert.ExpectExec().
+					WithArgs("title", "desc", float32(10), testImage).
+					WillReturnResult(sqlmock.NewResult(int64(1), int64(1)))
+				rows := sqlmock.NewRows(cakeColumns).
+					AddRow(1, "title", "desc", 10, testImage, 1, createdAt, createdAt, nil)
+				read.ExpectQuery().WithArgs(1).WillReturnRows(rows)
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.AppendPrimaryImage)).WithArgs(1, testImage, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRevision(revision, 1, "create", `["title","description","rating","image"]`)
+				sqlMock.ExpectCommit()
 			},
 		},
 		{
-			name: "Success With Empty Title",
+			name: "Success With Quote In Description",
 			args: args{
 				ctx: ctx,
 				cake: m.Cake{
-					Id:          1,
-					Title:       "",
-					Description: "newdesc",
+					Title:       "title",
+					Description: "grandma's recipe'); DROP TABLE privy_cakes; --",
 					Rating:      10,
-					Image:       "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
-					CreatedAt:   "2022-12-01 20:29:00",
-					UpdatedAt:   "2022-12-01 20:29:00",
+					Image:       testImage,
 				},
 			},
-			want:    m.Cake{Id: 1, Title: "title", Description: "newdesc", Rating: 10, Image: "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg", CreatedAt: "2022-12-01 20:29:00", UpdatedAt: currentTime},
+			want:    m.Cake{Id: 2, Title: "title", Description: "grandma's recipe'); DROP TABLE privy_cakes; --", Rating: 10, Image: testImage, Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt},
 			wantErr: false,
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"id", "title", "description", "rating", "image", "created_at", "updated_at"}).
-					AddRow(1, "title", "description", 10, "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg", "2022-12-01 20:29:00", "2022-12-01 20:29:00")
-				sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM privy_cakes`)).WillReturnRows(rows)
-				sqlMock.ExpectExec("UPDATE privy_cakes").WillReturnResult(sqlmock.NewResult(1, 1))
+				insert, read, revision := expectPrepare()
+				sqlMock.ExpectBegin()
+				insert.ExpectExec().
+					WithArgs("title", "grandma's recipe'); DROP TABLE privy_cakes; --", float32(10), testImage).
+					WillReturnResult(sqlmock.NewResult(int64(2), int64(1)))
+				rows := sqlmock.NewRows(cakeColumns).
+					AddRow(2, "title", "grandma's recipe'); DROP TABLE privy_cakes; --", 10, testImage, 1, createdAt, createdAt, nil)
+				read.ExpectQuery().WithArgs(2).WillReturnRows(rows)
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.AppendPrimaryImage)).WithArgs(2, testImage, 2).WillReturnResult(sqlmock.NewResult(2, 1))
+				expectRevision(revision, 2, "create", `["title","description","rating","image"]`)
+				sqlMock.ExpectCommit()
 			},
 		},
 		{
-			name: "Success With Empty Desc",
+			name: "Success With Id",
 			args: args{
 				ctx: ctx,
 				cake: m.Cake{
-					Id:          1,
-					Title:       "newtitle",
-					Description: "",
+					Id:          7,
+					Title:       "title",
+					Description: "desc",
 					Rating:      10,
-					Image:       "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
-					CreatedAt:   "2022-12-01 20:29:00",
-					UpdatedAt:   "2022-12-01 20:29:00",
-				},
-			},
-			want:    m.Cake{Id: 1, Title: "newtitle", Description: "description", Rating: 10, Image: "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg", CreatedAt: "2022-12-01 20:29:00", UpdatedAt: currentTime},
-			wantErr: false,
-			mock: func() {
-				rows := sqlmock.NewRows([]string{"id", "title", "description", "rating", "image", "created_at", "updated_at"}).
-					AddRow(1, "title", "description", 10, "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg", "2022-12-01 20:29:00", "2022-12-01 20:29:00")
-				sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM privy_cakes`)).WillReturnRows(rows)
-				sqlMock.ExpectExec("UPDATE privy_cakes").WillReturnResult(sqlmock.NewResult(1, 1))
-			},
-		},
-		{
-			name: "Success With Empty Rating",
-			args: args{
-				ctx: ctx,
-				cake: m.Cake{
-					Id:          1,
-					Title:       "newtitle",
-					Description: "newdesc",
-					Rating:      0,
-					Image:       "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
-					CreatedAt:   "2022-12-01 20:29:00",
-					UpdatedAt:   "2022-12-01 20:29:00",
+					Image:       testImage,
 				},
 			},
-			want:    m.Cake{Id: 1, Title: "newtitle", Description: "newdesc", Rating: 10, Image: "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg", CreatedAt: "2022-12-01 20:29:00", UpdatedAt: currentTime},
+			want:    m.Cake{Id: 7, Title: "title", Description: "desc", Rating: 10, Image: testImage, Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt},
 			wantErr: false,
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"id", "title", "description", "rating", "image", "created_at", "updated_at"}).
-					AddRow(1, "title", "description", 10, "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg", "2022-12-01 20:29:00", "2022-12-01 20:29:00")
-				sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM privy_cakes`)).WillReturnRows(rows)
-				sqlMock.ExpectExec("UPDATE privy_cakes").WillReturnResult(sqlmock.NewResult(1, 1))
+				insert := sqlMock.ExpectPrepare(regexp.QuoteMeta(database.InsertCakeWithID))
+				read := sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByID))
+				revision := sqlMock.ExpectPrepare(regexp.QuoteMeta(database.InsertCakeRevision))
+				sqlMock.ExpectBegin()
+				insert.ExpectExec().
+					WithArgs(7, "title", "desc", float32(10), testImage).
+					WillReturnResult(sqlmock.NewResult(int64(7), int64(1)))
+				read.ExpectQuery().WithArgs(7).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(7, "title", "desc", 10, testImage, 1, createdAt, createdAt, nil))
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.AppendPrimaryImage)).WithArgs(7, testImage, 7).WillReturnResult(sqlmock.NewResult(7, 1))
+				expectRevision(revision, 7, "create", `["title","description","rating","image"]`)
+				sqlMock.ExpectCommit()
 			},
 		},
 		{
-			name: "Success With Empty Image",
+			name: "Query Error",
 			args: args{
 				ctx: ctx,
 				cake: m.Cake{
-					Id:          1,
-					Title:       "newtitle",
-					Description: "newdesc",
+					Title:       "title",
+					Description: "desc",
 					Rating:      10,
-					Image:       "",
-					CreatedAt:   "2022-12-01 20:29:00",
-					UpdatedAt:   "2022-12-01 20:29:00",
+					Image:       testImage,
 				},
 			},
-			want:    m.Cake{Id: 1, Title: "newtitle", Description: "newdesc", Rating: 10, Image: "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg", CreatedAt: "2022-12-01 20:29:00", UpdatedAt: currentTime},
-			wantErr: false,
+			want:    m.Cake{},
+			wantErr: true,
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"id", "title", "description", "rating", "image", "created_at", "updated_at"}).
-					AddRow(1, "title", "description", 10, "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg", "2022-12-01 20:29:00", "2022-12-01 20:29:00")
-				sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM privy_cakes`)).WillReturnRows(rows)
-				sqlMock.ExpectExec("UPDATE privy_cakes").WillReturnResult(sqlmock.NewResult(1, 1))
+				insert, _, _ := expectPrepare()
+				sqlMock.ExpectBegin()
+				insert.ExpectExec().
+					WithArgs("title", "desc", float32(10), testImage).
+					WillReturnError(errors.New("Query Error"))
+				sqlMock.ExpectRollback()
 			},
 		},
 		{
-			name: "wrong select query",
+			name: "Read Back Error",
 			args: args{
 				ctx: ctx,
 				cake: m.Cake{
-					Id:          1,
-					Title:       "newtitle",
-					Description: "newdesc",
+					Title:       "title",
+					Description: "desc",
 					Rating:      10,
-					Image:       "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
-					CreatedAt:   "2022-12-01 20:29:00",
-					UpdatedAt:   "2022-12-01 20:29:00",
+					Image:       testImage,
 				},
 			},
 			want:    m.Cake{},
 			wantErr: true,
 			mock: func() {
-				sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECTTT *  FROM privy_cakes`)).WillReturnError(errors.New("query error"))
+				insert, read, _ := expectPrepare()
+				sqlMock.ExpectBegin()
+				insert.ExpectExec().
+					WithArgs("title", "desc", float32(10), testImage).
+					WillReturnResult(sqlmock.NewResult(int64(1), int64(1)))
+				read.ExpectQuery().WithArgs(1).WillReturnError(errors.New("query error"))
+				sqlMock.ExpectRollback()
 			},
 		},
 		{
-			name: "wrong update query",
+			name: "Revision Error Rolls Back",
 			args: args{
 				ctx: ctx,
 				cake: m.Cake{
-					Id:          1,
-					Title:       "newtitle",
-					Description: "newdesc",
+					Title:       "title",
+					Description: "desc",
 					Rating:      10,
-					Image:       "https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg",
-					CreatedAt:   "2022-12-01 20:29:00",
-					UpdatedAt:   "2022-12-01 20:29:00",
+					Image:       testImage,
 				},
 			},
 			want:    m.Cake{},
 			wantErr: true,
 			mock: func() {
-				sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECTTT *  FROM privy_cakes`)).WillReturnError(errors.New("query error"))
-				sqlMock.ExpectExec("UPDATE XYZ privy_cakes").WillReturnError(errors.New("query error"))
+				insert, read, revision := expectPrepare()
+				sqlMock.ExpectBegin()
+				insert.ExpectExec().
+					WithArgs("title", "desc", float32(10), testImage).
+					WillReturnResult(sqlmock.NewResult(int64(1), int64(1)))
+				read.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(1, "title", "desc", 10, testImage, 1, createdAt, createdAt, nil))
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.AppendPrimaryImage)).WithArgs(1, testImage, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+				revision.ExpectExec().WillReturnError(errors.New("query error"))
+				sqlMock.ExpectRollback()
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			t.Run(tt.name, func(t *testing.T) {
-				tt.mock()
-
-				r := &repository{
-					db: db,
-				}
-				got, err := r.UpdateCake(tt.args.ctx, tt.args.cake)
-				if (err != nil) != tt.wantErr {
-					t.Errorf("repository.UpdateCake() error = %v, wantErr %v", err, tt.wantErr)
-					return
-				}
-				if !reflect.DeepEqual(got, tt.want) {
-					t.Errorf("repository.UpdateCake() = %v, want %v", got, tt.want)
-				}
-			})
-		})
-	}
-}
-func Test_repository_DeleteCake(t *testing.T) {
-	ctx := context.Background()
+			tt.mock()
 
-	db, sqlMock, err := sqlmock.New()
-	if err != nil {
+			r := &repository{
+				db: db,
+			}
+			got, err := r.InsertCake(tt.args.ctx, tt.args.cake)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("repository.InsertCake() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("repository.InsertCake() = %v, want %v", got, tt.want)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+func Test_repository_UpdateCake(t *testing.T) {
+	ctx := context.Background()
+
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
 		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 	}
 	defer db.Close()
 
+	expectPrepare := func() (lock, update, read, revision *sqlmock.ExpectedPrepare) {
+		lock = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByIDForUpdate))
+		update = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.UpdateCakeByID))
+		read = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByID))
+		revision = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.InsertCakeRevision))
+		return
+	}
+	currentRow := func() *sqlmock.Rows {
+		return sqlmock.NewRows(cakeColumns).
+			AddRow(1, "title", "description", 10, testImage, 1, createdAt, createdAt, nil)
+	}
+
 	type args struct {
-		ctx context.Context
-		id  int
+		ctx     context.Context
+		cake    m.Cake
+		version int
 	}
 	tests := []struct {
 		name    string
 		args    args
-		wantErr bool
+		want    m.Cake
+		wantErr error
+		mock    func()
+	}{
+		{
+			name: "Success",
+			args: args{
+				ctx: ctx,
+				cake: m.Cake{
+					Id:          1,
+					Title:       "newtitle",
+					Description: "newdesc",
+					Rating:      10,
+					Image:       testImage,
+				},
+			},
+			want: m.Cake{Id: 1, Title: "newtitle", Description: "newdesc", Rating: 10, Image: testImage, Version: 1, CreatedAt: createdAt, UpdatedAt: updatedAt},
+			mock: func() {
+				lock, update, read, revision := expectPrepare()
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnRows(currentRow())
+				update.ExpectExec().
+					WithArgs("newtitle", "newdesc", float32(10), testImage, 1, 1).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				read.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(1, "newtitle", "newdesc", 10, testImage, 1, createdAt, updatedAt, nil))
+				expectRevision(revision, 1, "update", `["title","description"]`)
+				sqlMock.ExpectCommit()
+			},
+		},
+		{
+			name: "Empty Fields Replace Stored Values",
+			args: args{
+				ctx: ctx,
+				cake: m.Cake{
+					Id:    1,
+					Title: "newtitle",
+				},
+			},
+			want: m.Cake{Id: 1, Title: "newtitle", Version: 1, CreatedAt: createdAt, UpdatedAt: updatedAt},
+			mock: func() {
+				lock, update, read, revision := expectPrepare()
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnRows(currentRow())
+				update.ExpectExec().
+					WithArgs("newtitle", "", float32(0), "", 1, 1).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.ClearPrimaryImage)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				read.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(1, "newtitle", "", 0, "", 1, createdAt, updatedAt, nil))
+				expectRevision(revision, 1, "update", `["title","description","rating","image"]`)
+				sqlMock.ExpectCommit()
+			},
+		},
+		{
+			name: "Matching Version",
+			args: args{
+				ctx:     ctx,
+				cake:    m.Cake{Id: 1, Title: "newtitle", Description: "newdesc", Rating: 10, Image: testImage},
+				version: 1,
+			},
+			want: m.Cake{Id: 1, Title: "newtitle", Description: "newdesc", Rating: 10, Image: testImage, Version: 2, CreatedAt: createdAt, UpdatedAt: updatedAt},
+			mock: func() {
+				lock, update, read, revision := expectPrepare()
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnRows(currentRow())
+				update.ExpectExec().
+					WithArgs("newtitle", "newdesc", float32(10), testImage, 1, 1).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				read.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(1, "newtitle", "newdesc", 10, testImage, 2, createdAt, updatedAt, nil))
+				expectRevision(revision, 1, "update", `["title","description"]`)
+				sqlMock.ExpectCommit()
+			},
+		},
+		{
+			name: "Stale Version",
+			args: args{
+				ctx:     ctx,
+				cake:    m.Cake{Id: 1, Title: "newtitle"},
+				version: 3,
+			},
+			want:    m.Cake{},
+			wantErr: apperror.ErrPreconditionFailed,
+			mock: func() {
+				lock, _, _, _ := expectPrepare()
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnRows(currentRow())
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			name: "Version Check Matches No Row",
+			args: args{
+				ctx:  ctx,
+				cake: m.Cake{Id: 1, Title: "newtitle"},
+			},
+			want:    m.Cake{},
+			wantErr: apperror.ErrPreconditionFailed,
+			mock: func() {
+				lock, update, _, _ := expectPrepare()
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnRows(currentRow())
+				update.ExpectExec().
+					WithArgs("newtitle", "", float32(0), "", 1, 1).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			name: "Not Found",
+			args: args{
+				ctx:  ctx,
+				cake: m.Cake{Id: 1, Title: "newtitle"},
+			},
+			want:    m.Cake{},
+			wantErr: ErrNotFound,
+			mock: func() {
+				lock, _, _, _ := expectPrepare()
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnError(sql.ErrNoRows)
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			name: "Update Error Is Returned",
+			args: args{
+				ctx:  ctx,
+				cake: m.Cake{Id: 1, Title: "newtitle"},
+			},
+			want:    m.Cake{},
+			wantErr: apperror.ErrInternal,
+			mock: func() {
+				lock, update, _, _ := expectPrepare()
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnRows(currentRow())
+				update.ExpectExec().
+					WithArgs("newtitle", "", float32(0), "", 1, 1).
+					WillReturnError(errors.New("query error"))
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			name: "Begin Error",
+			args: args{
+				ctx:  ctx,
+				cake: m.Cake{Id: 1, Title: "newtitle"},
+			},
+			want:    m.Cake{},
+			wantErr: apperror.ErrUnavailable,
+			mock: func() {
+				expectPrepare()
+				sqlMock.ExpectBegin().WillReturnError(mysql.ErrInvalidConn)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+
+			r := &repository{
+				db: db,
+			}
+			got, err := r.UpdateCake(tt.args.ctx, tt.args.cake, tt.args.version)
+			if (err != nil) != (tt.wantErr != nil) || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+				t.Errorf("repository.UpdateCake() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("repository.UpdateCake() = %v, want %v", got, tt.want)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+func Test_repository_PatchCake(t *testing.T) {
+	ctx := context.Background()
+
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	str := func(s string) *string { return &s }
+	rating := func(f float32) *float32 { return &f }
+	expectPrepare := func() (lock, update, read, revision *sqlmock.ExpectedPrepare) {
+		lock = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByIDForUpdate))
+		update = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.UpdateCakeByID))
+		read = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByID))
+		revision = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.InsertCakeRevision))
+		return
+	}
+	currentRow := func() *sqlmock.Rows {
+		return sqlmock.NewRows(cakeColumns).
+			AddRow(1, "title", "description", 10, testImage, 1, createdAt, createdAt, nil)
+	}
+
+	type args struct {
+		ctx     context.Context
+		id      int
+		version int
+		patch   m.CakePatch
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    m.Cake
+		wantErr error
+		mock    func()
+	}{
+		{
+			name: "Only Present Fields Change",
+			args: args{
+				ctx:   ctx,
+				id:    1,
+				patch: m.CakePatch{Title: str("newtitle")},
+			},
+			want: m.Cake{Id: 1, Title: "newtitle", Description: "description", Rating: 10, Image: testImage, Version: 1, CreatedAt: createdAt, UpdatedAt: updatedAt},
+			mock: func() {
+				lock, update, read, revision := expectPrepare()
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnRows(currentRow())
+				update.ExpectExec().
+					WithArgs("newtitle", "description", float32(10), testImage, 1, 1).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				read.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(1, "newtitle", "description", 10, testImage, 1, createdAt, updatedAt, nil))
+				expectRevision(revision, 1, "update", `["title"]`)
+				sqlMock.ExpectCommit()
+			},
+		},
+		{
+			name: "Zero Rating And Cleared Description",
+			args: args{
+				ctx:   ctx,
+				id:    1,
+				patch: m.CakePatch{Description: str(""), Rating: rating(0)},
+			},
+			want: m.Cake{Id: 1, Title: "title", Description: "", Rating: 0, Image: testImage, Version: 1, CreatedAt: createdAt, UpdatedAt: updatedAt},
+			mock: func() {
+				lock, update, read, revision := expectPrepare()
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnRows(currentRow())
+				update.ExpectExec().
+					WithArgs("title", "", float32(0), testImage, 1, 1).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				read.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(1, "title", "", 0, testImage, 1, createdAt, updatedAt, nil))
+				expectRevision(revision, 1, "update", `["description","rating"]`)
+				sqlMock.ExpectCommit()
+			},
+		},
+		{
+			name: "Not Found",
+			args: args{
+				ctx:   ctx,
+				id:    1,
+				patch: m.CakePatch{Title: str("newtitle")},
+			},
+			want:    m.Cake{},
+			wantErr: ErrNotFound,
+			mock: func() {
+				lock, _, _, _ := expectPrepare()
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnError(sql.ErrNoRows)
+				sqlMock.ExpectRollback()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+
+			r := &repository{
+				db: db,
+			}
+			got, err := r.PatchCake(tt.args.ctx, tt.args.id, tt.args.version, tt.args.patch)
+			if (err != nil) != (tt.wantErr != nil) || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+				t.Errorf("repository.PatchCake() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("repository.PatchCake() = %v, want %v", got, tt.want)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+func Test_repository_DeleteCake(t *testing.T) {
+	ctx := context.Background()
+
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	deletedAt := updatedAt
+	expectPrepare := func() (lock, trash, read, revision *sqlmock.ExpectedPrepare) {
+		lock = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByIDForUpdate))
+		trash = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.TrashCakeByID))
+		read = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetAnyCakeByID))
+		revision = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.InsertCakeRevision))
+		return
+	}
+
+	type args struct {
+		ctx     context.Context
+		id      int
+		version int
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr error
 		mock    func()
 	}{
 		{
@@ -518,11 +1146,17 @@ func Test_repository_DeleteCake(t *testing.T) {
 				ctx: ctx,
 				id:  1,
 			},
-			wantErr: false,
 			mock: func() {
-				sqlMock.ExpectExec(`DELETE FROM privy_cakes`).
-					WillDelayFor(time.Second).
-					WillReturnResult(sqlmock.NewResult(int64(1), int64(1)))
+				lock, trash, read, revision := expectPrepare()
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(1, "title", "description", 10, testImage, 1, createdAt, createdAt, nil))
+				trash.ExpectExec().WithArgs(1, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				read.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(1, "title", "description", 10, testImage, 1, createdAt, createdAt, deletedAt))
+				expectRevision(revision, 1, "delete", `["deleted_at"]`)
+				sqlMock.ExpectCommit()
 			},
 		},
 		{
@@ -531,24 +1165,45 @@ func Test_repository_DeleteCake(t *testing.T) {
 				ctx: ctx,
 				id:  1,
 			},
-			wantErr: true,
+			wantErr: apperror.ErrInternal,
 			mock: func() {
-				sqlMock.ExpectExec(`SELECT FROM privy_cakes`).
-					WillDelayFor(time.Second).
-					WillReturnResult(sqlmock.NewErrorResult(errors.New("Query Error")))
+				lock, trash, _, _ := expectPrepare()
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(1, "title", "description", 10, testImage, 1, createdAt, createdAt, nil))
+				trash.ExpectExec().WithArgs(1, 1).
+					WillReturnError(errors.New("Query Error"))
+				sqlMock.ExpectRollback()
 			},
 		},
 		{
-			name: "No Rows Affected",
+			name: "Stale Version",
+			args: args{
+				ctx:     ctx,
+				id:      1,
+				version: 2,
+			},
+			wantErr: apperror.ErrPreconditionFailed,
+			mock: func() {
+				lock, _, _, _ := expectPrepare()
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(1, "title", "description", 10, testImage, 1, createdAt, createdAt, nil))
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			name: "Not Found Or Already In Trash",
 			args: args{
 				ctx: ctx,
 				id:  1,
 			},
-			wantErr: true,
+			wantErr: ErrNotFound,
 			mock: func() {
-				sqlMock.ExpectExec(`DELETE FROM privy_cakes`).
-					WillDelayFor(time.Second).
-					WillReturnResult(sqlmock.NewResult(int64(1), int64(0)))
+				lock, _, _, _ := expectPrepare()
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnError(sql.ErrNoRows)
+				sqlMock.ExpectRollback()
 			},
 		},
 	}
@@ -559,10 +1214,248 @@ func Test_repository_DeleteCake(t *testing.T) {
 			r := &repository{
 				db: db,
 			}
-			err := r.DeleteCake(tt.args.ctx, tt.args.id)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("repository.DeleteCake() error = %v, wantErr %v", err, tt.wantErr)
-				return
+			err := r.DeleteCake(tt.args.ctx, tt.args.id, tt.args.version)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("repository.DeleteCake() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+func Test_repository_RestoreCake(t *testing.T) {
+	ctx := context.Background()
+
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	deletedAt := updatedAt
+	expectPrepare := func() (lock, restore, read, revision *sqlmock.ExpectedPrepare) {
+		lock = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfTrashedCakeByIDForUpdate))
+		restore = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.RestoreCakeByID))
+		read = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetAnyCakeByID))
+		revision = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.InsertCakeRevision))
+		return
+	}
+
+	tests := []struct {
+		name    string
+		id      int
+		want    m.Cake
+		wantErr error
+		mock    func()
+	}{
+		{
+			name: "Success",
+			id:   1,
+			want: m.Cake{Id: 1, Title: "title", Description: "description", Rating: 10, Image: testImage, Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt},
+			mock: func() {
+				lock, restore, read, revision := expectPrepare()
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(1, "title", "description", 10, testImage, 1, createdAt, createdAt, deletedAt))
+				restore.ExpectExec().WithArgs(1, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				read.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(1, "title", "description", 10, testImage, 1, createdAt, createdAt, nil))
+				expectRevision(revision, 1, "restore", `["deleted_at"]`)
+				sqlMock.ExpectCommit()
+			},
+		},
+		{
+			name:    "Not In Trash",
+			id:      1,
+			wantErr: apperror.ErrNotFound,
+			mock: func() {
+				lock, _, _, _ := expectPrepare()
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnError(sql.ErrNoRows)
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			name:    "Query Error",
+			id:      1,
+			wantErr: apperror.ErrInternal,
+			mock: func() {
+				lock, restore, _, _ := expectPrepare()
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(1, "title", "description", 10, testImage, 1, createdAt, createdAt, deletedAt))
+				restore.ExpectExec().WithArgs(1, 1).
+					WillReturnError(errors.New("Query Error"))
+				sqlMock.ExpectRollback()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+
+			r := &repository{
+				db: db,
+			}
+			got, err := r.RestoreCake(ctx, tt.id)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("repository.RestoreCake() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("repository.RestoreCake() = %v, want %v", got, tt.want)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+func Test_repository_PurgeCake(t *testing.T) {
+	ctx := context.Background()
+
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	deletedAt := updatedAt
+	expectPrepare := func() (lock, purge, revision *sqlmock.ExpectedPrepare) {
+		lock = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfTrashedCakeByIDForUpdate))
+		purge = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.PurgeCakeByID))
+		sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetAnyCakeByID))
+		revision = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.InsertCakeRevision))
+		return
+	}
+
+	tests := []struct {
+		name    string
+		id      int
+		wantErr error
+		mock    func()
+	}{
+		{
+			name: "Success Records Last State",
+			id:   1,
+			mock: func() {
+				lock, purge, revision := expectPrepare()
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(1, "title", "description", 10, testImage, 1, createdAt, createdAt, deletedAt))
+				purge.ExpectExec().WithArgs(1, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.DeleteCakeImages)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectRevision(revision, 1, "purge", `[]`)
+				sqlMock.ExpectCommit()
+			},
+		},
+		{
+			name:    "Not In Trash",
+			id:      1,
+			wantErr: apperror.ErrNotFound,
+			mock: func() {
+				lock, _, _ := expectPrepare()
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnError(sql.ErrNoRows)
+				sqlMock.ExpectRollback()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+
+			r := &repository{
+				db: db,
+			}
+			err := r.PurgeCake(ctx, tt.id)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("repository.PurgeCake() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+func Test_repository_Timeout(t *testing.T) {
+	ctx := context.Background()
+
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows(cakeColumns)
+	sqlMock.ExpectQuery(regexp.QuoteMeta(database.SelectCakes)).
+		WithArgs(10, 0).
+		WillDelayFor(time.Second).
+		WillReturnRows(rows)
+
+	r := New(db, WithTimeouts(Timeouts{Read: 10 * time.Millisecond}))
+	_, err = r.GetListOfCakes(ctx, m.CakeQuery{Limit: 10})
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("repository.GetListOfCakes() error = %v, want %v", err, ErrTimeout)
+	}
+}
+func Test_wrapErr(t *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want apperror.Kind
+	}{
+		{
+			name: "no rows",
+			ctx:  context.Background(),
+			err:  sql.ErrNoRows,
+			want: apperror.KindNotFound,
+		},
+		{
+			name: "duplicate key",
+			ctx:  context.Background(),
+			err:  &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"},
+			want: apperror.KindConflict,
+		},
+		{
+			name: "data too long",
+			ctx:  context.Background(),
+			err:  &mysql.MySQLError{Number: 1406, Message: "Data too long for column 'title'"},
+			want: apperror.KindValidation,
+		},
+		{
+			name: "deadline exceeded",
+			ctx:  expired,
+			err:  errors.New("canceling query due to user request"),
+			want: apperror.KindTimeout,
+		},
+		{
+			name: "bad connection",
+			ctx:  context.Background(),
+			err:  mysql.ErrInvalidConn,
+			want: apperror.KindUnavailable,
+		},
+		{
+			name: "unknown",
+			ctx:  context.Background(),
+			err:  errors.New("unknown"),
+			want: apperror.KindInternal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := wrapErr(tt.ctx, tt.err)
+			if apperror.KindOf(got) != tt.want {
+				t.Errorf("wrapErr() kind = %v, want %v", apperror.KindOf(got), tt.want)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Errorf("wrapErr() = %v, does not wrap %v", got, tt.err)
 			}
 		})
 	}
@@ -0,0 +1,337 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"privy/database"
+	"privy/internal/apperror"
+	m "privy/models"
+)
+
+var ErrImageNotFound = apperror.New(apperror.KindNotFound, "image not found")
+
+// GetCakeImages reads a live cake and its gallery, in display order.
+func (r *repository) GetCakeImages(ctx context.Context, id int) (m.Cake, []m.CakeImage, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	cake, err := r.readCake(ctx, id)
+	if err != nil {
+		log.Println("[GetCakeImages] can't get details of cake, err:", err.Error())
+		return m.Cake{}, nil, wrapErr(ctx, err)
+	}
+
+	stmt, err := r.stmt(ctx, database.GetCakeImages)
+	if err != nil {
+		log.Println("[GetCakeImages] can't prepare statement, err:", err.Error())
+		return m.Cake{}, nil, wrapErr(ctx, err)
+	}
+	images, err := readCakeImages(ctx, stmt, id)
+	if err != nil {
+		log.Println("[GetCakeImages] can't get images, err:", err.Error())
+		return m.Cake{}, nil, wrapErr(ctx, err)
+	}
+
+	return cake, images, nil
+}
+
+// AddCakeImage adds image to the gallery at image.Position, moving the
+// images from there on down, or at the end when the position is zero or
+// past it. The image becomes primary when it asks to or when the gallery
+// has no primary image yet.
+func (r *repository) AddCakeImage(ctx context.Context, id, version int, image m.CakeImage) (m.Cake, []m.CakeImage, error) {
+	return r.changeGallery(ctx, "AddCakeImage", id, version, func(images []m.CakeImage) ([]m.CakeImage, error) {
+		if len(images) >= m.MaxCakeImages {
+			return nil, apperror.New(apperror.KindConflict, fmt.Sprintf("cake already has %d images", m.MaxCakeImages))
+		}
+
+		at := image.Position - 1
+		if at < 0 || at > len(images) {
+			at = len(images)
+		}
+		image.Id = 0
+		image.CakeId = id
+		images = append(images[:at], append([]m.CakeImage{image}, images[at:]...)...)
+
+		if image.Primary || primaryIndex(images) < 0 {
+			setPrimary(images, at)
+		}
+		return images, nil
+	})
+}
+
+// ReorderCakeImages puts the gallery in the order of the image ids in
+// order, which must list every image of the cake once.
+func (r *repository) ReorderCakeImages(ctx context.Context, id, version int, order []int) (m.Cake, []m.CakeImage, error) {
+	return r.changeGallery(ctx, "ReorderCakeImages", id, version, func(images []m.CakeImage) ([]m.CakeImage, error) {
+		invalid := apperror.New(apperror.KindValidation, "order must list every image of the cake once")
+		if len(order) != len(images) {
+			return nil, invalid
+		}
+
+		byID := make(map[int]m.CakeImage, len(images))
+		for _, image := range images {
+			byID[image.Id] = image
+		}
+		ordered := make([]m.CakeImage, 0, len(order))
+		for _, imageID := range order {
+			image, ok := byID[imageID]
+			if !ok {
+				return nil, invalid
+			}
+			delete(byID, imageID)
+			ordered = append(ordered, image)
+		}
+		return ordered, nil
+	})
+}
+
+// UpdateCakeImage changes the alt text of an image or makes it primary.
+func (r *repository) UpdateCakeImage(ctx context.Context, id, version, imageID int, patch m.CakeImagePatch) (m.Cake, []m.CakeImage, error) {
+	return r.changeGallery(ctx, "UpdateCakeImage", id, version, func(images []m.CakeImage) ([]m.CakeImage, error) {
+		i := imageIndex(images, imageID)
+		if i < 0 {
+			return nil, ErrImageNotFound
+		}
+		if patch.Alt != nil {
+			images[i].Alt = *patch.Alt
+		}
+		if patch.Primary {
+			setPrimary(images, i)
+		}
+		return images, nil
+	})
+}
+
+// DeleteCakeImage takes an image out of the gallery. When it was primary,
+// the first image left takes its place.
+func (r *repository) DeleteCakeImage(ctx context.Context, id, version, imageID int) (m.Cake, []m.CakeImage, error) {
+	return r.changeGallery(ctx, "DeleteCakeImage", id, version, func(images []m.CakeImage) ([]m.CakeImage, error) {
+		i := imageIndex(images, imageID)
+		if i < 0 {
+			return nil, ErrImageNotFound
+		}
+		wasPrimary := images[i].Primary
+		images = append(images[:i], images[i+1:]...)
+		if wasPrimary && len(images) > 0 {
+			setPrimary(images, 0)
+		}
+		return images, nil
+	})
+}
+
+// changeGallery locks the cake, lets change rearrange its gallery and
+// writes what changed in one transaction. Positions are renumbered from 1
+// in the order change leaves the images in. When the primary image
+// changes, so does the image of the cake, with a revision; otherwise only
+// the version of the cake is bumped, so its ETag covers the gallery.
+func (r *repository) changeGallery(ctx context.Context, op string, id, version int, change func([]m.CakeImage) ([]m.CakeImage, error)) (m.Cake, []m.CakeImage, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	stmts, err := r.prepareAll(ctx,
+		database.GetDetailsOfCakeByIDForUpdate, database.GetCakeImages, database.DeleteCakeImage, database.UpdateCakeImage, database.InsertCakeImage,
+		database.UpdateCakeByID, database.TouchCakeByID, database.GetDetailsOfCakeByID, database.InsertCakeRevision)
+	if err != nil {
+		log.Printf("[%s] can't prepare statement, err: %s", op, err.Error())
+		return m.Cake{}, nil, wrapErr(ctx, err)
+	}
+	lockStmt, imagesStmt, deleteStmt, updateStmt, insertStmt := stmts[0], stmts[1], stmts[2], stmts[3], stmts[4]
+	updateCakeStmt, touchStmt, readStmt, revisionStmt := stmts[5], stmts[6], stmts[7], stmts[8]
+
+	var (
+		updated m.Cake
+		images  []m.CakeImage
+	)
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		current, err := scanCake(tx.StmtContext(ctx, lockStmt).QueryRowContext(ctx, id))
+		if err != nil {
+			log.Printf("[%s] can't lock cake, err: %s", op, err.Error())
+			return err
+		}
+		if err = checkVersion(current, version); err != nil {
+			log.Printf("[%s] can't change images, err: %s", op, err.Error())
+			return err
+		}
+
+		before, err := readCakeImages(ctx, tx.StmtContext(ctx, imagesStmt), id)
+		if err != nil {
+			log.Printf("[%s] can't read images, err: %s", op, err.Error())
+			return err
+		}
+		after, err := change(append([]m.CakeImage(nil), before...))
+		if err != nil {
+			return err
+		}
+		for i := range after {
+			after[i].Position = i + 1
+		}
+
+		if err = writeGallery(ctx, tx, tx.StmtContext(ctx, deleteStmt), tx.StmtContext(ctx, updateStmt), tx.StmtContext(ctx, insertStmt), before, after); err != nil {
+			log.Printf("[%s] can't write images, err: %s", op, err.Error())
+			return err
+		}
+
+		image := ""
+		if i := primaryIndex(after); i >= 0 {
+			image = after[i].URL
+		}
+		var rows sql.Result
+		if image != current.Image {
+			rows, err = tx.StmtContext(ctx, updateCakeStmt).ExecContext(ctx, current.Title, current.Description, current.Rating, image, id, current.Version)
+		} else {
+			rows, err = tx.StmtContext(ctx, touchStmt).ExecContext(ctx, id, current.Version)
+		}
+		if err == nil {
+			err = checkAffected(rows)
+		}
+		if err != nil {
+			log.Printf("[%s] can't update cake, err: %s", op, err.Error())
+			return err
+		}
+
+		if updated, err = scanCake(tx.StmtContext(ctx, readStmt).QueryRowContext(ctx, id)); err != nil {
+			log.Printf("[%s] can't read updated cake, err: %s", op, err.Error())
+			return err
+		}
+		if images, err = readCakeImages(ctx, tx.StmtContext(ctx, imagesStmt), id); err != nil {
+			log.Printf("[%s] can't read images, err: %s", op, err.Error())
+			return err
+		}
+		if image == current.Image {
+			return nil
+		}
+		return recordRevision(ctx, tx.StmtContext(ctx, revisionStmt), m.RevisionUpdate, current, updated)
+	})
+	if err != nil {
+		return m.Cake{}, nil, wrapErr(ctx, err)
+	}
+
+	if err = r.loadImages(ctx, &updated); err != nil {
+		log.Printf("[%s] can't get image variants, err: %s", op, err.Error())
+		return m.Cake{}, nil, wrapErr(ctx, err)
+	}
+	return updated, images, nil
+}
+
+// writeGallery turns the rows of before into after: images missing from
+// after are deleted, images without an id inserted and the others updated
+// when they changed.
+func writeGallery(ctx context.Context, tx *sql.Tx, deleteStmt, updateStmt, insertStmt *sql.Stmt, before, after []m.CakeImage) error {
+	kept := make(map[int]m.CakeImage, len(after))
+	for _, image := range after {
+		if image.Id != 0 {
+			kept[image.Id] = image
+		}
+	}
+
+	for _, image := range before {
+		changed, ok := kept[image.Id]
+		var err error
+		switch {
+		case !ok:
+			_, err = deleteStmt.ExecContext(ctx, image.Id)
+		case changed.Alt != image.Alt || changed.Position != image.Position || changed.Primary != image.Primary:
+			_, err = updateStmt.ExecContext(ctx, changed.Alt, changed.Position, changed.Primary, image.Id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, image := range after {
+		if image.Id != 0 {
+			continue
+		}
+		if _, err := insertStmt.ExecContext(ctx, image.CakeId, image.URL, image.Alt, image.Position, image.Primary); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncPrimaryImage carries a write of the image of cake id, from before to
+// after, over to its gallery: the primary image takes the new URL, or is
+// added when there is none, and stops being primary when the image is
+// cleared.
+func syncPrimaryImage(ctx context.Context, tx *sql.Tx, id int, before, after string) error {
+	if before == after {
+		return nil
+	}
+	if after == "" {
+		_, err := tx.ExecContext(ctx, database.ClearPrimaryImage, id)
+		return err
+	}
+	if before != "" {
+		rows, err := tx.ExecContext(ctx, database.SetPrimaryImageURL, after, id)
+		if err != nil {
+			return err
+		}
+		if affected, err := rows.RowsAffected(); err != nil || affected > 0 {
+			return err
+		}
+	}
+	_, err := tx.ExecContext(ctx, database.AppendPrimaryImage, id, after, id)
+	return err
+}
+
+// insertPrimaryImages adds the images of freshly inserted cakes to their
+// empty galleries, as primary.
+func insertPrimaryImages(ctx context.Context, tx *sql.Tx, cakes []m.Cake) error {
+	var args []interface{}
+	for _, cake := range cakes {
+		if cake.Image != "" {
+			args = append(args, cake.Id, cake.Image)
+		}
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, multiRow(database.InsertPrimaryImages, database.InsertPrimaryImagesRow, len(args)/2), args...)
+	return err
+}
+
+func readCakeImages(ctx context.Context, stmt *sql.Stmt, id int) ([]m.CakeImage, error) {
+	rows, err := stmt.QueryContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []m.CakeImage{}
+	for rows.Next() {
+		var image m.CakeImage
+		if err := rows.Scan(&image.Id, &image.CakeId, &image.URL, &image.Alt, &image.Position, &image.Primary, &image.CreatedAt); err != nil {
+			return nil, err
+		}
+		image.CreatedAt = image.CreatedAt.UTC()
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+func imageIndex(images []m.CakeImage, id int) int {
+	for i, image := range images {
+		if image.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func primaryIndex(images []m.CakeImage) int {
+	for i, image := range images {
+		if image.Primary {
+			return i
+		}
+	}
+	return -1
+}
+
+func setPrimary(images []m.CakeImage, at int) {
+	for i := range images {
+		images[i].Primary = i == at
+	}
+}
@@ -0,0 +1,373 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"privy/database"
+	"privy/internal/apperror"
+	m "privy/models"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var imageColumns = []string{"id", "cake_id", "url", "alt", "position", "is_primary", "created_at"}
+
+func Test_repository_GetCakeImages(t *testing.T) {
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByID)).ExpectQuery().WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(cakeColumns).AddRow(1, "title", "description", 10, testImage, 3, createdAt, updatedAt, nil))
+	sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetCakeImages)).ExpectQuery().WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(imageColumns).
+			AddRow(1, 1, testImage, "a lemon cheesecake", 1, true, createdAt).
+			AddRow(2, 1, "https://www.abc.com/b.png", "", 2, false, updatedAt))
+
+	r := &repository{db: db}
+	cake, images, err := r.GetCakeImages(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("repository.GetCakeImages() error = %v", err)
+	}
+	if cake.Version != 3 {
+		t.Errorf("repository.GetCakeImages() version = %d, want 3", cake.Version)
+	}
+	want := []m.CakeImage{
+		{Id: 1, CakeId: 1, URL: testImage, Alt: "a lemon cheesecake", Position: 1, Primary: true, CreatedAt: createdAt},
+		{Id: 2, CakeId: 1, URL: "https://www.abc.com/b.png", Position: 2, CreatedAt: updatedAt},
+	}
+	if !reflect.DeepEqual(images, want) {
+		t.Errorf("repository.GetCakeImages() = %v, want %v", images, want)
+	}
+	if err := sqlMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_repository_changeGallery(t *testing.T) {
+	ctx := context.Background()
+
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	other := "https://www.abc.com/b.png"
+	type statements struct {
+		lock, images, remove, update, insert, updateCake, touch, read, revision *sqlmock.ExpectedPrepare
+	}
+	expectPrepare := func() (s statements) {
+		s.lock = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByIDForUpdate))
+		s.images = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetCakeImages))
+		s.remove = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.DeleteCakeImage))
+		s.update = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.UpdateCakeImage))
+		s.insert = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.InsertCakeImage))
+		s.updateCake = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.UpdateCakeByID))
+		s.touch = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.TouchCakeByID))
+		s.read = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByID))
+		s.revision = sqlMock.ExpectPrepare(regexp.QuoteMeta(database.InsertCakeRevision))
+		return s
+	}
+	cakeRow := func(image string, version int) *sqlmock.Rows {
+		return sqlmock.NewRows(cakeColumns).AddRow(1, "title", "description", 10, image, version, createdAt, updatedAt, nil)
+	}
+	galleryRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows(imageColumns).
+			AddRow(1, 1, testImage, "", 1, true, createdAt).
+			AddRow(2, 1, other, "", 2, false, createdAt)
+	}
+	expectVariants := func(image string) {
+		sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetImageVariants)).ExpectQuery().WithArgs(1, image).
+			WillReturnRows(sqlmock.NewRows(variantColumns))
+	}
+
+	tests := []struct {
+		name       string
+		call       func(r *repository) (m.Cake, []m.CakeImage, error)
+		wantImage  string
+		wantImages int
+		wantKind   apperror.Kind
+		wantErr    bool
+		mock       func()
+	}{
+		{
+			name: "Add To Empty Gallery Makes It Primary",
+			call: func(r *repository) (m.Cake, []m.CakeImage, error) {
+				return r.AddCakeImage(ctx, 1, 1, m.CakeImage{URL: testImage, Alt: "a lemon cheesecake"})
+			},
+			wantImage:  testImage,
+			wantImages: 1,
+			mock: func() {
+				s := expectPrepare()
+				sqlMock.ExpectBegin()
+				s.lock.ExpectQuery().WithArgs(1).WillReturnRows(cakeRow("", 1))
+				s.images.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(imageColumns))
+				s.insert.ExpectExec().WithArgs(1, testImage, "a lemon cheesecake", 1, true).WillReturnResult(sqlmock.NewResult(1, 1))
+				s.updateCake.ExpectExec().WithArgs("title", "description", float32(10), testImage, 1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				s.read.ExpectQuery().WithArgs(1).WillReturnRows(cakeRow(testImage, 2))
+				s.images.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(imageColumns).
+					AddRow(1, 1, testImage, "a lemon cheesecake", 1, true, createdAt))
+				expectRevision(s.revision, 1, "update", `["image"]`)
+				sqlMock.ExpectCommit()
+				expectVariants(testImage)
+			},
+		},
+		{
+			name: "Add First Moves The Others Down",
+			call: func(r *repository) (m.Cake, []m.CakeImage, error) {
+				return r.AddCakeImage(ctx, 1, 0, m.CakeImage{URL: "https://www.abc.com/c.png", Position: 1})
+			},
+			wantImage:  testImage,
+			wantImages: 3,
+			mock: func() {
+				s := expectPrepare()
+				sqlMock.ExpectBegin()
+				s.lock.ExpectQuery().WithArgs(1).WillReturnRows(cakeRow(testImage, 1))
+				s.images.ExpectQuery().WithArgs(1).WillReturnRows(galleryRows())
+				s.update.ExpectExec().WithArgs("", 2, true, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				s.update.ExpectExec().WithArgs("", 3, false, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+				s.insert.ExpectExec().WithArgs(1, "https://www.abc.com/c.png", "", 1, false).WillReturnResult(sqlmock.NewResult(3, 1))
+				s.touch.ExpectExec().WithArgs(1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				s.read.ExpectQuery().WithArgs(1).WillReturnRows(cakeRow(testImage, 2))
+				s.images.ExpectQuery().WithArgs(1).WillReturnRows(galleryRows().AddRow(3, 1, "https://www.abc.com/c.png", "", 1, false, createdAt))
+				sqlMock.ExpectCommit()
+				expectVariants(testImage)
+			},
+		},
+		{
+			name: "Add To Full Gallery",
+			call: func(r *repository) (m.Cake, []m.CakeImage, error) {
+				return r.AddCakeImage(ctx, 1, 0, m.CakeImage{URL: other})
+			},
+			wantKind: apperror.KindConflict,
+			wantErr:  true,
+			mock: func() {
+				s := expectPrepare()
+				sqlMock.ExpectBegin()
+				s.lock.ExpectQuery().WithArgs(1).WillReturnRows(cakeRow(testImage, 1))
+				rows := sqlmock.NewRows(imageColumns)
+				for i := 1; i <= m.MaxCakeImages; i++ {
+					rows.AddRow(i, 1, testImage, "", i, i == 1, createdAt)
+				}
+				s.images.ExpectQuery().WithArgs(1).WillReturnRows(rows)
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			name: "Reorder Only Touches The Cake",
+			call: func(r *repository) (m.Cake, []m.CakeImage, error) {
+				return r.ReorderCakeImages(ctx, 1, 1, []int{2, 1})
+			},
+			wantImage:  testImage,
+			wantImages: 2,
+			mock: func() {
+				s := expectPrepare()
+				sqlMock.ExpectBegin()
+				s.lock.ExpectQuery().WithArgs(1).WillReturnRows(cakeRow(testImage, 1))
+				s.images.ExpectQuery().WithArgs(1).WillReturnRows(galleryRows())
+				s.update.ExpectExec().WithArgs("", 2, true, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				s.update.ExpectExec().WithArgs("", 1, false, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+				s.touch.ExpectExec().WithArgs(1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				s.read.ExpectQuery().WithArgs(1).WillReturnRows(cakeRow(testImage, 2))
+				s.images.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(imageColumns).
+					AddRow(2, 1, other, "", 1, false, createdAt).
+					AddRow(1, 1, testImage, "", 2, true, createdAt))
+				sqlMock.ExpectCommit()
+				expectVariants(testImage)
+			},
+		},
+		{
+			name: "Reorder Must List Every Image Once",
+			call: func(r *repository) (m.Cake, []m.CakeImage, error) {
+				return r.ReorderCakeImages(ctx, 1, 0, []int{1, 1})
+			},
+			wantKind: apperror.KindValidation,
+			wantErr:  true,
+			mock: func() {
+				s := expectPrepare()
+				sqlMock.ExpectBegin()
+				s.lock.ExpectQuery().WithArgs(1).WillReturnRows(cakeRow(testImage, 1))
+				s.images.ExpectQuery().WithArgs(1).WillReturnRows(galleryRows())
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			name: "Set Primary Changes The Image",
+			call: func(r *repository) (m.Cake, []m.CakeImage, error) {
+				alt := "a chocolate cake"
+				return r.UpdateCakeImage(ctx, 1, 1, 2, m.CakeImagePatch{Alt: &alt, Primary: true})
+			},
+			wantImage:  other,
+			wantImages: 2,
+			mock: func() {
+				s := expectPrepare()
+				sqlMock.ExpectBegin()
+				s.lock.ExpectQuery().WithArgs(1).WillReturnRows(cakeRow(testImage, 1))
+				s.images.ExpectQuery().WithArgs(1).WillReturnRows(galleryRows())
+				s.update.ExpectExec().WithArgs("", 1, false, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				s.update.ExpectExec().WithArgs("a chocolate cake", 2, true, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+				s.updateCake.ExpectExec().WithArgs("title", "description", float32(10), other, 1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				s.read.ExpectQuery().WithArgs(1).WillReturnRows(cakeRow(other, 2))
+				s.images.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(imageColumns).
+					AddRow(1, 1, testImage, "", 1, false, createdAt).
+					AddRow(2, 1, other, "a chocolate cake", 2, true, createdAt))
+				expectRevision(s.revision, 1, "update", `["image"]`)
+				sqlMock.ExpectCommit()
+				expectVariants(other)
+			},
+		},
+		{
+			name: "Update Missing Image",
+			call: func(r *repository) (m.Cake, []m.CakeImage, error) {
+				return r.UpdateCakeImage(ctx, 1, 0, 9, m.CakeImagePatch{Primary: true})
+			},
+			wantKind: apperror.KindNotFound,
+			wantErr:  true,
+			mock: func() {
+				s := expectPrepare()
+				sqlMock.ExpectBegin()
+				s.lock.ExpectQuery().WithArgs(1).WillReturnRows(cakeRow(testImage, 1))
+				s.images.ExpectQuery().WithArgs(1).WillReturnRows(galleryRows())
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			name: "Delete Primary Promotes The Next",
+			call: func(r *repository) (m.Cake, []m.CakeImage, error) {
+				return r.DeleteCakeImage(ctx, 1, 1, 1)
+			},
+			wantImage:  other,
+			wantImages: 1,
+			mock: func() {
+				s := expectPrepare()
+				sqlMock.ExpectBegin()
+				s.lock.ExpectQuery().WithArgs(1).WillReturnRows(cakeRow(testImage, 1))
+				s.images.ExpectQuery().WithArgs(1).WillReturnRows(galleryRows())
+				s.remove.ExpectExec().WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				s.update.ExpectExec().WithArgs("", 1, true, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+				s.updateCake.ExpectExec().WithArgs("title", "description", float32(10), other, 1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				s.read.ExpectQuery().WithArgs(1).WillReturnRows(cakeRow(other, 2))
+				s.images.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(imageColumns).
+					AddRow(2, 1, other, "", 1, true, createdAt))
+				expectRevision(s.revision, 1, "update", `["image"]`)
+				sqlMock.ExpectCommit()
+				expectVariants(other)
+			},
+		},
+		{
+			name: "Stale Version",
+			call: func(r *repository) (m.Cake, []m.CakeImage, error) {
+				return r.DeleteCakeImage(ctx, 1, 3, 1)
+			},
+			wantKind: apperror.KindPreconditionFailed,
+			wantErr:  true,
+			mock: func() {
+				s := expectPrepare()
+				sqlMock.ExpectBegin()
+				s.lock.ExpectQuery().WithArgs(1).WillReturnRows(cakeRow(testImage, 1))
+				sqlMock.ExpectRollback()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+
+			r := &repository{
+				db: db,
+			}
+			cake, images, err := tt.call(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("repository gallery change error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && apperror.KindOf(err) != tt.wantKind {
+				t.Errorf("repository gallery change kind = %v, want %v", apperror.KindOf(err), tt.wantKind)
+			}
+			if cake.Image != tt.wantImage || len(images) != tt.wantImages {
+				t.Errorf("repository gallery change = %q with %d images, want %q with %d", cake.Image, len(images), tt.wantImage, tt.wantImages)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_syncPrimaryImage(t *testing.T) {
+	ctx := context.Background()
+	other := "https://www.abc.com/b.png"
+
+	tests := []struct {
+		name          string
+		before, after string
+		mock          func(sqlMock sqlmock.Sqlmock)
+	}{
+		{
+			name:   "Unchanged",
+			before: testImage,
+			after:  testImage,
+			mock:   func(sqlMock sqlmock.Sqlmock) {},
+		},
+		{
+			name:   "Cleared",
+			before: testImage,
+			mock: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.ClearPrimaryImage)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:   "Replaced",
+			before: testImage,
+			after:  other,
+			mock: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.SetPrimaryImageURL)).WithArgs(other, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:   "Replaced Without A Primary Image",
+			before: testImage,
+			after:  other,
+			mock: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.SetPrimaryImageURL)).WithArgs(other, 1).WillReturnResult(sqlmock.NewResult(0, 0))
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.AppendPrimaryImage)).WithArgs(1, other, 1).WillReturnResult(sqlmock.NewResult(3, 1))
+			},
+		},
+		{
+			name:  "Added",
+			after: other,
+			mock: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.AppendPrimaryImage)).WithArgs(1, other, 1).WillReturnResult(sqlmock.NewResult(3, 1))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, sqlMock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			sqlMock.ExpectBegin()
+			tt.mock(sqlMock)
+			sqlMock.ExpectCommit()
+
+			r := &repository{db: db}
+			err = r.inTx(ctx, func(tx *sql.Tx) error {
+				return syncPrimaryImage(ctx, tx, 1, tt.before, tt.after)
+			})
+			if err != nil {
+				t.Errorf("syncPrimaryImage() error = %v", err)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"privy/database"
+	"privy/internal/apperror"
+	m "privy/models"
+)
+
+// ErrImageReplaced is returned when variants are recorded for an image the
+// cake no longer shows.
+var ErrImageReplaced = apperror.New(apperror.KindConflict, "cake no longer shows the image")
+
+// ImageVariantRecorder is the part of the repository the image pipeline
+// writes to.
+type ImageVariantRecorder interface {
+	SaveImageVariants(ctx context.Context, id int, source string, variants []m.ImageVariant) ([]m.ImageVariant, error)
+}
+
+// SaveImageVariants replaces the variants of the cake with those built
+// from source, provided the cake still shows it, and returns the variants
+// it replaced so their files can go. It bumps the version of the cake,
+// whose representation now carries the variants, but records no revision:
+// none of its fields changed.
+func (r *repository) SaveImageVariants(ctx context.Context, id int, source string, variants []m.ImageVariant) ([]m.ImageVariant, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	stmts, err := r.prepareAll(ctx, database.TouchCakeImage, database.GetAllImageVariants, database.DeleteImageVariants)
+	if err != nil {
+		log.Println("[SaveImageVariants] can't prepare statement, err:", err.Error())
+		return nil, wrapErr(ctx, err)
+	}
+	touchStmt, readStmt, deleteStmt := stmts[0], stmts[1], stmts[2]
+
+	var replaced []m.ImageVariant
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.StmtContext(ctx, touchStmt).ExecContext(ctx, id, source)
+		if err != nil {
+			log.Println("[SaveImageVariants] can't touch cake, err:", err.Error())
+			return err
+		}
+		if affected, err := rows.RowsAffected(); err != nil || affected == 0 {
+			if err == nil {
+				err = ErrImageReplaced
+			}
+			return err
+		}
+
+		if replaced, err = readImageVariants(ctx, tx.StmtContext(ctx, readStmt), id); err != nil {
+			log.Println("[SaveImageVariants] can't read variants, err:", err.Error())
+			return err
+		}
+		if _, err = tx.StmtContext(ctx, deleteStmt).ExecContext(ctx, id); err != nil {
+			log.Println("[SaveImageVariants] can't delete variants, err:", err.Error())
+			return err
+		}
+		if len(variants) == 0 {
+			return nil
+		}
+
+		args := make([]interface{}, 0, len(variants)*8)
+		for _, v := range variants {
+			args = append(args, id, source, v.Name, v.Type, v.Width, v.Height, v.URL, v.Key)
+		}
+		if _, err = tx.ExecContext(ctx, multiRow(database.InsertImageVariants, database.InsertImageVariantsRow, len(variants)), args...); err != nil {
+			log.Println("[SaveImageVariants] can't insert variants, err:", err.Error())
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, wrapErr(ctx, err)
+	}
+
+	return replaced, nil
+}
+
+// loadImages attaches the variants of the image the cake shows.
+func (r *repository) loadImages(ctx context.Context, cake *m.Cake) error {
+	if cake.Image == "" {
+		return nil
+	}
+	stmt, err := r.stmt(ctx, database.GetImageVariants)
+	if err != nil {
+		return err
+	}
+	variants, err := readImageVariants(ctx, stmt, cake.Id, cake.Image)
+	if err != nil {
+		return err
+	}
+	cake.Images = m.NewCakeImages(variants)
+	return nil
+}
+
+func readImageVariants(ctx context.Context, stmt *sql.Stmt, args ...interface{}) ([]m.ImageVariant, error) {
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var variants []m.ImageVariant
+	for rows.Next() {
+		var v m.ImageVariant
+		if err := rows.Scan(&v.Name, &v.Type, &v.Width, &v.Height, &v.URL, &v.Key); err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+	return variants, rows.Err()
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"privy/database"
+	"privy/internal/apperror"
+	m "privy/models"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var variantColumns = []string{"name", "content_type", "width", "height", "url", "key"}
+
+func Test_repository_SaveImageVariants(t *testing.T) {
+	ctx := context.Background()
+
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	source := "https://www.abc.com/images/b.png"
+	variants := []m.ImageVariant{
+		{Name: "thumbnail", Type: "image/jpeg", Width: 160, Height: 120, URL: "https://www.abc.com/images/b-thumbnail.jpg", Key: "b-thumbnail.jpg"},
+		{Name: "placeholder", Type: "image/jpeg", Width: 16, Height: 12, URL: "data:image/jpeg;base64,AAAA"},
+	}
+	insert := multiRow(database.InsertImageVariants, database.InsertImageVariantsRow, 2)
+	expectPrepares := func() {
+		sqlMock.ExpectPrepare(regexp.QuoteMeta(database.TouchCakeImage))
+		sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetAllImageVariants))
+		sqlMock.ExpectPrepare(regexp.QuoteMeta(database.DeleteImageVariants))
+	}
+
+	tests := []struct {
+		name     string
+		want     []m.ImageVariant
+		wantKind apperror.Kind
+		wantErr  bool
+		mock     func()
+	}{
+		{
+			name: "Success",
+			want: []m.ImageVariant{{Name: "thumbnail", Type: "image/jpeg", Width: 160, Height: 120, URL: "https://www.abc.com/images/a-thumbnail.jpg", Key: "a-thumbnail.jpg"}},
+			mock: func() {
+				expectPrepares()
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.TouchCakeImage)).WithArgs(1, source).WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectQuery(regexp.QuoteMeta(database.GetAllImageVariants)).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(variantColumns).AddRow("thumbnail", "image/jpeg", 160, 120, "https://www.abc.com/images/a-thumbnail.jpg", "a-thumbnail.jpg"))
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.DeleteImageVariants)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta(insert)).
+					WithArgs(1, source, "thumbnail", "image/jpeg", 160, 120, "https://www.abc.com/images/b-thumbnail.jpg", "b-thumbnail.jpg",
+						1, source, "placeholder", "image/jpeg", 16, 12, "data:image/jpeg;base64,AAAA", "").
+					WillReturnResult(sqlmock.NewResult(1, 2))
+				sqlMock.ExpectCommit()
+			},
+		},
+		{
+			name:     "Image Replaced",
+			wantKind: apperror.KindConflict,
+			wantErr:  true,
+			mock: func() {
+				expectPrepares()
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.TouchCakeImage)).WithArgs(1, source).WillReturnResult(sqlmock.NewResult(0, 0))
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			name:     "Insert Error",
+			wantKind: apperror.KindInternal,
+			wantErr:  true,
+			mock: func() {
+				expectPrepares()
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.TouchCakeImage)).WithArgs(1, source).WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectQuery(regexp.QuoteMeta(database.GetAllImageVariants)).WithArgs(1).WillReturnRows(sqlmock.NewRows(variantColumns))
+				sqlMock.ExpectExec(regexp.QuoteMeta(database.DeleteImageVariants)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+				sqlMock.ExpectExec(regexp.QuoteMeta(insert)).WillReturnError(errors.New("query error"))
+				sqlMock.ExpectRollback()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+
+			r := &repository{
+				db: db,
+			}
+			got, err := r.SaveImageVariants(ctx, 1, source, variants)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("repository.SaveImageVariants() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && apperror.KindOf(err) != tt.wantKind {
+				t.Errorf("repository.SaveImageVariants() kind = %v, want %v", apperror.KindOf(err), tt.wantKind)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("repository.SaveImageVariants() = %v, want %v", got, tt.want)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
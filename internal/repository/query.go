@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"fmt"
+	"privy/database"
+	"privy/internal/apperror"
+	m "privy/models"
+	"strings"
+)
+
+// sortColumns whitelists the fields a listing can be sorted by. Only these
+// column names ever reach the ORDER BY clause; values are always bound as
+// arguments.
+var sortColumns = map[string]sortColumn{
+	"id":         {"id", func(k m.CakeKey) interface{} { return k.Id }, false},
+	"title":      {"title", func(k m.CakeKey) interface{} { return k.Title }, false},
+	"rating":     {"rating", func(k m.CakeKey) interface{} { return k.Rating }, false},
+	"created_at": {"created_at", func(k m.CakeKey) interface{} { return k.CreatedAt.UTC() }, false},
+	"updated_at": {"updated_at", func(k m.CakeKey) interface{} { return k.UpdatedAt.UTC() }, false},
+	"deleted_at": {"deleted_at", func(k m.CakeKey) interface{} { return k.DeletedAt.UTC() }, true},
+}
+
+// sortColumn is a sortable column. A trashOnly column is NULL for live
+// cakes, where it neither orders rows nor works in a keyset condition.
+type sortColumn struct {
+	name      string
+	value     func(m.CakeKey) interface{}
+	trashOnly bool
+}
+
+const matchSearch = "MATCH (title, description) AGAINST (? IN NATURAL LANGUAGE MODE)"
+
+// buildListCakes returns the statement and arguments selecting one page of
+// cakes for q.
+func buildListCakes(q m.CakeQuery) (string, []interface{}, error) {
+	order, err := sortColumnsOf(q.OrderBy(), q.Trashed)
+	if err != nil {
+		return "", nil, err
+	}
+
+	conditions, args := filterCakes(q.CakeFilter)
+	if q.After != nil {
+		keyset, keysetArgs := afterKey(order, *q.After)
+		conditions = append(conditions, keyset)
+		args = append(args, keysetArgs...)
+	}
+
+	var terms []string
+	if q.ByRelevance() {
+		terms = append(terms, matchSearch+" DESC")
+		args = append(args, q.Search)
+	}
+	for _, o := range order {
+		terms = append(terms, o.name+o.direction())
+	}
+
+	query := database.SelectCakes + where(conditions) + " ORDER BY " + strings.Join(terms, ", ")
+	if q.After != nil {
+		return query + " LIMIT ?", append(args, q.Limit), nil
+	}
+	return query + " LIMIT ? OFFSET ?", append(args, q.Limit, q.Offset), nil
+}
+
+// buildSummarizeCakes returns the statement and arguments summarizing
+// every cake matched by f.
+func buildSummarizeCakes(f m.CakeFilter) (string, []interface{}) {
+	conditions, args := filterCakes(f)
+	return database.SummarizeCakes + where(conditions), args
+}
+
+// multiRow returns an INSERT of n rows, each bound through row.
+func multiRow(prefix, row string, n int) string {
+	return prefix + strings.TrimSuffix(strings.Repeat(row+", ", n), ", ")
+}
+
+func filterCakes(f m.CakeFilter) ([]string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+
+	if f.Trashed {
+		conditions = append(conditions, "deleted_at IS NOT NULL")
+	} else {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	if f.Search != "" {
+		conditions = append(conditions, matchSearch)
+		args = append(args, f.Search)
+	}
+	if f.MinRating != nil {
+		conditions = append(conditions, "rating >= ?")
+		args = append(args, *f.MinRating)
+	}
+	if f.MaxRating != nil {
+		conditions = append(conditions, "rating <= ?")
+		args = append(args, *f.MaxRating)
+	}
+	if !f.CreatedFrom.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, f.CreatedFrom.UTC())
+	}
+	if !f.CreatedTo.IsZero() {
+		conditions = append(conditions, "created_at <= ?")
+		args = append(args, f.CreatedTo.UTC())
+	}
+	if !f.UpdatedFrom.IsZero() {
+		conditions = append(conditions, "updated_at >= ?")
+		args = append(args, f.UpdatedFrom.UTC())
+	}
+	if !f.UpdatedTo.IsZero() {
+		conditions = append(conditions, "updated_at <= ?")
+		args = append(args, f.UpdatedTo.UTC())
+	}
+
+	return conditions, args
+}
+
+func where(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+type orderColumn struct {
+	sortColumn
+	desc bool
+}
+
+func (o orderColumn) direction() string {
+	if o.desc {
+		return " DESC"
+	}
+	return " ASC"
+}
+
+func sortColumnsOf(sort []m.SortField, trashed bool) ([]orderColumn, error) {
+	order := make([]orderColumn, len(sort))
+	for i, s := range sort {
+		column, ok := sortColumns[s.Field]
+		if !ok || (column.trashOnly && !trashed) {
+			return nil, apperror.New(apperror.KindValidation, fmt.Sprintf("can't sort by %q", s.Field))
+		}
+		order[i] = orderColumn{sortColumn: column, desc: s.Desc}
+	}
+	return order, nil
+}
+
+// afterKey selects the rows that sort after key. Columns may be sorted in
+// different directions, so instead of a row comparison the condition is
+// spelled out as (a > ?) OR (a = ? AND b > ?) OR ...
+func afterKey(order []orderColumn, key m.CakeKey) (string, []interface{}) {
+	var (
+		alternatives []string
+		args         []interface{}
+	)
+
+	for i, o := range order {
+		var terms []string
+		for _, prev := range order[:i] {
+			terms = append(terms, prev.name+" = ?")
+			args = append(args, prev.value(key))
+		}
+		if o.desc {
+			terms = append(terms, o.name+" < ?")
+		} else {
+			terms = append(terms, o.name+" > ?")
+		}
+		args = append(args, o.value(key))
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"errors"
+	"privy/database"
+	"privy/internal/apperror"
+	m "privy/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_buildListCakes(t *testing.T) {
+	min, max := float32(7), float32(9.5)
+	from := time.Date(2022, 12, 1, 7, 0, 0, 0, time.FixedZone("WIB", 7*60*60))
+	to := time.Date(2022, 12, 31, 23, 59, 59, 0, time.UTC)
+	key := m.CakeKey{Id: 7, Title: "Lemon Cheesecake", Rating: 8.2, CreatedAt: to, UpdatedAt: to, DeletedAt: to}
+
+	tests := []struct {
+		name     string
+		query    m.CakeQuery
+		want     string
+		wantArgs []interface{}
+		wantErr  error
+	}{
+		{
+			name:     "Default Order",
+			query:    m.CakeQuery{Limit: 10, Offset: 20},
+			want:     database.SelectCakes + " WHERE deleted_at IS NULL ORDER BY rating DESC, title ASC, id ASC LIMIT ? OFFSET ?",
+			wantArgs: []interface{}{10, 20},
+		},
+		{
+			name:  "Search Orders By Relevance",
+			query: m.CakeQuery{CakeFilter: m.CakeFilter{Search: "lemon"}, Limit: 10},
+			want: database.SelectCakes +
+				" WHERE deleted_at IS NULL AND MATCH (title, description) AGAINST (? IN NATURAL LANGUAGE MODE)" +
+				" ORDER BY MATCH (title, description) AGAINST (? IN NATURAL LANGUAGE MODE) DESC, rating DESC, title ASC, id ASC LIMIT ? OFFSET ?",
+			wantArgs: []interface{}{"lemon", "lemon", 10, 0},
+		},
+		{
+			name: "Every Filter",
+			query: m.CakeQuery{
+				CakeFilter: m.CakeFilter{
+					MinRating:   &min,
+					MaxRating:   &max,
+					CreatedFrom: from,
+					CreatedTo:   to,
+					UpdatedFrom: from,
+					UpdatedTo:   to,
+				},
+				Limit: 10,
+			},
+			want: database.SelectCakes +
+				" WHERE deleted_at IS NULL AND rating >= ? AND rating <= ? AND created_at >= ? AND created_at <= ? AND updated_at >= ? AND updated_at <= ?" +
+				" ORDER BY rating DESC, title ASC, id ASC LIMIT ? OFFSET ?",
+			wantArgs: []interface{}{min, max, from.UTC(), to, from.UTC(), to, 10, 0},
+		},
+		{
+			name: "Explicit Sort Replaces Relevance",
+			query: m.CakeQuery{
+				CakeFilter: m.CakeFilter{Search: "lemon"},
+				Sort:       []m.SortField{{Field: "updated_at", Desc: true}, {Field: "title"}, {Field: "updated_at"}},
+				Limit:      10,
+			},
+			want: database.SelectCakes +
+				" WHERE deleted_at IS NULL AND MATCH (title, description) AGAINST (? IN NATURAL LANGUAGE MODE)" +
+				" ORDER BY updated_at DESC, title ASC, id ASC LIMIT ? OFFSET ?",
+			wantArgs: []interface{}{"lemon", 10, 0},
+		},
+		{
+			name:     "Id In Sort Is Not Repeated",
+			query:    m.CakeQuery{Sort: []m.SortField{{Field: "id", Desc: true}}, Limit: 10},
+			want:     database.SelectCakes + " WHERE deleted_at IS NULL ORDER BY id DESC LIMIT ? OFFSET ?",
+			wantArgs: []interface{}{10, 0},
+		},
+		{
+			name:  "Keyset After Default Order",
+			query: m.CakeQuery{Limit: 10, After: &key},
+			want: database.SelectCakes +
+				" WHERE deleted_at IS NULL AND ((rating < ?) OR (rating = ? AND title > ?) OR (rating = ? AND title = ? AND id > ?))" +
+				" ORDER BY rating DESC, title ASC, id ASC LIMIT ?",
+			wantArgs: []interface{}{key.Rating, key.Rating, key.Title, key.Rating, key.Title, key.Id, 10},
+		},
+		{
+			name: "Keyset With Filter And Search Drops Relevance",
+			query: m.CakeQuery{
+				CakeFilter: m.CakeFilter{Search: "lemon", MinRating: &min},
+				Sort:       []m.SortField{{Field: "created_at", Desc: true}},
+				Limit:      10,
+				After:      &key,
+			},
+			want: database.SelectCakes +
+				" WHERE deleted_at IS NULL AND MATCH (title, description) AGAINST (? IN NATURAL LANGUAGE MODE) AND rating >= ?" +
+				" AND ((created_at < ?) OR (created_at = ? AND id > ?))" +
+				" ORDER BY created_at DESC, id ASC LIMIT ?",
+			wantArgs: []interface{}{"lemon", min, key.CreatedAt, key.CreatedAt, key.Id, 10},
+		},
+		{
+			name: "Keyset In Trash",
+			query: m.CakeQuery{
+				CakeFilter: m.CakeFilter{Trashed: true},
+				Limit:      10,
+				After:      &key,
+			},
+			want: database.SelectCakes +
+				" WHERE deleted_at IS NOT NULL AND ((deleted_at < ?) OR (deleted_at = ? AND id > ?))" +
+				" ORDER BY deleted_at DESC, id ASC LIMIT ?",
+			wantArgs: []interface{}{key.DeletedAt, key.DeletedAt, key.Id, 10},
+		},
+		{
+			name:    "Trash Only Sort Field",
+			query:   m.CakeQuery{Sort: []m.SortField{{Field: "deleted_at", Desc: true}}, Limit: 10},
+			wantErr: apperror.ErrValidation,
+		},
+		{
+			name:    "Unknown Sort Field",
+			query:   m.CakeQuery{Sort: []m.SortField{{Field: "rating; DROP TABLE privy_cakes"}}, Limit: 10},
+			wantErr: apperror.ErrValidation,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, args, err := buildListCakes(tt.query)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("buildListCakes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("buildListCakes() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("buildListCakes() args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisStore is a Store shared by every instance talking to one Redis, so
+// a write through any of them invalidates the entries of all.
+type redisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore keeps entries in client under keys starting with prefix.
+// Closing the store closes the client.
+func NewRedisStore(client *redis.Client, prefix string) Store {
+	return &redisStore{client: client, prefix: prefix}
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, s.prefix+key, value, ttl).Err()
+}
+
+func (s *redisStore) Delete(ctx context.Context, keys ...string) error {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = s.prefix + key
+	}
+	return s.client.Del(ctx, prefixed...).Err()
+}
+
+func (s *redisStore) Incr(ctx context.Context, key string) (int64, error) {
+	return s.client.Incr(ctx, s.prefix+key).Result()
+}
+
+func (s *redisStore) Close() error {
+	return s.client.Close()
+}
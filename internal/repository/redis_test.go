@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-playground/assert/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedisStore runs a Store against an in-process Redis stand-in.
+func newTestRedisStore(t *testing.T) (Store, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "privy:")
+	t.Cleanup(func() { _ = store.(*redisStore).Close() })
+	return store, server
+}
+
+func TestRedisStore(t *testing.T) {
+	store, server := newTestRedisStore(t)
+
+	testStore(t, store, server.FastForward)
+
+	assert.Equal(t, true, server.Exists("privy:counter"))
+}
@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"privy/database"
+	"privy/internal/actor"
+	"privy/internal/apperror"
+	m "privy/models"
+)
+
+// recordRevision appends a revision to the history of after.Id. It runs on
+// a statement bound to the transaction of the change it records; the row
+// lock that change holds keeps revision numbers from racing.
+func recordRevision(ctx context.Context, stmt *sql.Stmt, action string, before, after m.Cake) error {
+	snapshot, changed, err := encodeRevision(before, after)
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.ExecContext(ctx, after.Id, action, snapshot, changed, actor.Name(ctx), after.Id)
+	if err != nil {
+		log.Println("[recordRevision] can't record revision, err:", err.Error())
+		return err
+	}
+	return nil
+}
+
+// recordCreations writes the first revision of every cake in created with
+// a single statement.
+func recordCreations(ctx context.Context, tx *sql.Tx, created []m.Cake) error {
+	args := make([]interface{}, 0, 5*len(created))
+	for _, cake := range created {
+		snapshot, changed, err := encodeRevision(m.Cake{}, cake)
+		if err != nil {
+			return err
+		}
+		args = append(args, cake.Id, m.RevisionCreate, snapshot, changed, actor.Name(ctx))
+	}
+
+	_, err := tx.ExecContext(ctx, multiRow(database.InsertFirstCakeRevisions, database.InsertFirstCakeRevisionsRow, len(created)), args...)
+	if err != nil {
+		log.Println("[recordCreations] can't record revisions, err:", err.Error())
+		return err
+	}
+	return nil
+}
+
+func encodeRevision(before, after m.Cake) (snapshot, changed []byte, err error) {
+	snapshot, err = json.Marshal(after)
+	if err != nil {
+		return nil, nil, err
+	}
+	changed, err = json.Marshal(m.ChangedFields(before, after))
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshot, changed, nil
+}
+
+func scanRevision(row scanner) (m.Revision, error) {
+	var (
+		revision          m.Revision
+		snapshot, changed []byte
+	)
+	err := row.Scan(&revision.CakeId, &revision.Number, &revision.Action, &snapshot, &changed, &revision.Actor, &revision.CreatedAt)
+	if err != nil {
+		return m.Revision{}, err
+	}
+	if err := json.Unmarshal(snapshot, &revision.Snapshot); err != nil {
+		return m.Revision{}, err
+	}
+	if err := json.Unmarshal(changed, &revision.Changed); err != nil {
+		return m.Revision{}, err
+	}
+	revision.CreatedAt = revision.CreatedAt.UTC()
+	return revision, nil
+}
+
+// GetRevisions lists the history of a cake, newest first. Purged cakes
+// keep their history.
+func (r *repository) GetRevisions(ctx context.Context, id, limit, offset int) ([]m.Revision, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	stmt, err := r.stmt(ctx, database.SelectCakeRevisions)
+	if err != nil {
+		log.Println("[GetRevisions] can't prepare statement, err:", err.Error())
+		return nil, wrapErr(ctx, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, id, limit, offset)
+	if err != nil {
+		log.Println("[GetRevisions] can't get revisions, err:", err.Error())
+		return nil, wrapErr(ctx, err)
+	}
+	defer rows.Close()
+
+	revisions := []m.Revision{}
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			log.Println("[GetRevisions] can't scan revision, err:", err.Error())
+			return nil, wrapErr(ctx, err)
+		}
+		revisions = append(revisions, revision)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println("[GetRevisions] can't iterate revisions, err:", err.Error())
+		return nil, wrapErr(ctx, err)
+	}
+
+	return revisions, nil
+}
+func (r *repository) CountRevisions(ctx context.Context, id int) (int, error) {
+	var total int
+
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	stmt, err := r.stmt(ctx, database.CountCakeRevisions)
+	if err != nil {
+		log.Println("[CountRevisions] can't prepare statement, err:", err.Error())
+		return 0, wrapErr(ctx, err)
+	}
+	if err := stmt.QueryRowContext(ctx, id).Scan(&total); err != nil {
+		log.Println("[CountRevisions] can't count revisions, err:", err.Error())
+		return 0, wrapErr(ctx, err)
+	}
+
+	return total, nil
+}
+func (r *repository) GetRevision(ctx context.Context, id, number int) (m.Revision, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	stmt, err := r.stmt(ctx, database.GetCakeRevision)
+	if err != nil {
+		log.Println("[GetRevision] can't prepare statement, err:", err.Error())
+		return m.Revision{}, wrapErr(ctx, err)
+	}
+
+	revision, err := scanRevision(stmt.QueryRowContext(ctx, id, number))
+	if errors.Is(err, sql.ErrNoRows) {
+		return m.Revision{}, apperror.Wrap(apperror.KindNotFound, "revision not found", err)
+	}
+	if err != nil {
+		log.Println("[GetRevision] can't get revision, err:", err.Error())
+		return m.Revision{}, wrapErr(ctx, err)
+	}
+
+	return revision, nil
+}
+
+// RevertCake sets the fields of a live cake back to their values in one of
+// its revisions. The revert is recorded as a new revision; history is never
+// rewritten. A version of 0 skips the version check.
+func (r *repository) RevertCake(ctx context.Context, id, version, number int) (m.Cake, error) {
+	revision, err := r.GetRevision(ctx, id, number)
+	if err != nil {
+		return m.Cake{}, err
+	}
+
+	snapshot := revision.Snapshot
+	return r.modifyCake(ctx, "RevertCake", m.RevisionRevert, id, version, func(cake *m.Cake) {
+		cake.Title = snapshot.Title
+		cake.Description = snapshot.Description
+		cake.Rating = snapshot.Rating
+		cake.Image = snapshot.Image
+	})
+}
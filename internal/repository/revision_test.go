@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"privy/database"
+	"privy/internal/actor"
+	"privy/internal/apperror"
+	m "privy/models"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const testSnapshot = `{"id":1,"title":"title","description":"description","rating":10,"image":"` + testImage + `","version":1,"created_at":"2022-12-01T20:29:00Z","updated_at":"2022-12-01T20:29:00Z"}`
+
+func Test_recordRevision(t *testing.T) {
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	before := m.Cake{Id: 1, Title: "old", Description: "description", Rating: 9, Image: testImage, CreatedAt: createdAt, UpdatedAt: createdAt}
+	after := m.Cake{Id: 1, Title: "title", Description: "description", Rating: 10, Image: testImage, Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt}
+
+	sqlMock.ExpectPrepare(regexp.QuoteMeta(database.InsertCakeRevision)).
+		ExpectExec().
+		WithArgs(1, m.RevisionUpdate, []byte(testSnapshot), []byte(`["title","rating"]`), "admin", 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	stmt, err := db.Prepare(database.InsertCakeRevision)
+	if err != nil {
+		t.Fatalf("can't prepare: %v", err)
+	}
+	ctx := actor.WithName(context.Background(), "admin")
+	if err := recordRevision(ctx, stmt, m.RevisionUpdate, before, after); err != nil {
+		t.Fatalf("recordRevision() error = %v", err)
+	}
+	if err := sqlMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+func Test_repository_GetRevisions(t *testing.T) {
+	ctx := context.Background()
+
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	snapshot := m.Cake{Id: 1, Title: "title", Description: "description", Rating: 10, Image: testImage, Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt}
+	tests := []struct {
+		name    string
+		want    []m.Revision
+		wantErr bool
+		mock    func()
+	}{
+		{
+			name: "Success",
+			want: []m.Revision{
+				{CakeId: 1, Number: 2, Action: "update", Snapshot: snapshot, Changed: []string{"title"}, Actor: "anonymous", CreatedAt: updatedAt},
+				{CakeId: 1, Number: 1, Action: "create", Snapshot: snapshot, Changed: []string{"title", "description", "rating", "image"}, Actor: "migration", CreatedAt: createdAt},
+			},
+			mock: func() {
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.SelectCakeRevisions)).
+					ExpectQuery().WithArgs(1, 10, 0).
+					WillReturnRows(sqlmock.NewRows(revisionColumns).
+						AddRow(1, 2, "update", testSnapshot, `["title"]`, "anonymous", updatedAt).
+						AddRow(1, 1, "create", testSnapshot, `["title","description","rating","image"]`, "migration", createdAt))
+			},
+		},
+		{
+			name: "No History",
+			want: []m.Revision{},
+			mock: func() {
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.SelectCakeRevisions)).
+					ExpectQuery().WithArgs(1, 10, 0).
+					WillReturnRows(sqlmock.NewRows(revisionColumns))
+			},
+		},
+		{
+			name:    "Corrupt Snapshot",
+			wantErr: true,
+			mock: func() {
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.SelectCakeRevisions)).
+					ExpectQuery().WithArgs(1, 10, 0).
+					WillReturnRows(sqlmock.NewRows(revisionColumns).
+						AddRow(1, 1, "create", `{"id":`, `[]`, "anonymous", createdAt))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+
+			r := &repository{
+				db: db,
+			}
+			got, err := r.GetRevisions(ctx, 1, 10, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("repository.GetRevisions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("repository.GetRevisions() = %v, want %v", got, tt.want)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+func Test_repository_RevertCake(t *testing.T) {
+	ctx := context.Background()
+
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name    string
+		version int
+		want    m.Cake
+		wantErr error
+		mock    func()
+	}{
+		{
+			name: "Success",
+			want: m.Cake{Id: 1, Title: "title", Description: "description", Rating: 10, Image: testImage, Version: 1, CreatedAt: createdAt, UpdatedAt: updatedAt},
+			mock: func() {
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetCakeRevision)).
+					ExpectQuery().WithArgs(1, 1).
+					WillReturnRows(sqlmock.NewRows(revisionColumns).
+						AddRow(1, 1, "create", testSnapshot, `[]`, "anonymous", createdAt))
+				lock := sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByIDForUpdate))
+				update := sqlMock.ExpectPrepare(regexp.QuoteMeta(database.UpdateCakeByID))
+				read := sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByID))
+				revision := sqlMock.ExpectPrepare(regexp.QuoteMeta(database.InsertCakeRevision))
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(1, "newtitle", "", 2, testImage, 1, createdAt, createdAt, nil))
+				update.ExpectExec().
+					WithArgs("title", "description", float32(10), testImage, 1, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				read.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(1, "title", "description", 10, testImage, 1, createdAt, updatedAt, nil))
+				expectRevision(revision, 1, "revert", `["title","description","rating"]`)
+				sqlMock.ExpectCommit()
+			},
+		},
+		{
+			name:    "Version Mismatch",
+			version: 2,
+			wantErr: apperror.ErrPreconditionFailed,
+			mock: func() {
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetCakeRevision)).
+					ExpectQuery().WithArgs(1, 1).
+					WillReturnRows(sqlmock.NewRows(revisionColumns).
+						AddRow(1, 1, "create", testSnapshot, `[]`, "anonymous", createdAt))
+				lock := sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByIDForUpdate))
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.UpdateCakeByID))
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetDetailsOfCakeByID))
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.InsertCakeRevision))
+				sqlMock.ExpectBegin()
+				lock.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows(cakeColumns).
+					AddRow(1, "newtitle", "", 2, testImage, 1, createdAt, createdAt, nil))
+				sqlMock.ExpectRollback()
+			},
+		},
+		{
+			name:    "Unknown Revision",
+			wantErr: apperror.ErrNotFound,
+			mock: func() {
+				sqlMock.ExpectPrepare(regexp.QuoteMeta(database.GetCakeRevision)).
+					ExpectQuery().WithArgs(1, 1).
+					WillReturnError(sql.ErrNoRows)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+
+			r := &repository{
+				db: db,
+			}
+			got, err := r.RevertCake(ctx, 1, tt.version, 1)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("repository.RevertCake() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("repository.RevertCake() = %v, want %v", got, tt.want)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
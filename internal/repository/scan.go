@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"database/sql"
+	m "privy/models"
+)
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanCake reads one privy_cakes row. Timestamps are normalised to UTC.
+func scanCake(row scanner) (m.Cake, error) {
+	var (
+		cake      m.Cake
+		deletedAt sql.NullTime
+	)
+	err := row.Scan(&cake.Id, &cake.Title, &cake.Description, &cake.Rating, &cake.Image, &cake.Version, &cake.CreatedAt, &cake.UpdatedAt, &deletedAt)
+	if err != nil {
+		return m.Cake{}, err
+	}
+	cake.CreatedAt = cake.CreatedAt.UTC()
+	cake.UpdatedAt = cake.UpdatedAt.UTC()
+	if deletedAt.Valid {
+		deleted := deletedAt.Time.UTC()
+		cake.DeletedAt = &deleted
+	}
+	return cake, nil
+}
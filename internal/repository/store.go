@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Store keeps the entries of a CachedRepository. Entries expire after their
+// ttl and may be evicted earlier; counters never expire, since readers
+// trust their value to tell current entries from outdated ones.
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	// Incr adds one to the counter at key, starting from zero, and returns
+	// the new value.
+	Incr(ctx context.Context, key string) (int64, error)
+}
+
+// memoryStore is a Store bounded to size entries, evicting the least
+// recently used one first.
+type memoryStore struct {
+	mu       sync.Mutex
+	size     int
+	entries  map[string]*list.Element
+	order    *list.List
+	counters map[string]int64
+	now      func() time.Time
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func NewMemoryStore(size int) Store {
+	return &memoryStore{
+		size:     size,
+		entries:  make(map[string]*list.Element, size),
+		order:    list.New(),
+		counters: make(map[string]int64),
+		now:      time.Now,
+	}
+}
+
+func (s *memoryStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n, ok := s.counters[key]; ok {
+		return []byte(formatCounter(n)), true, nil
+	}
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := el.Value.(*memoryEntry)
+	if !s.now().Before(entry.expires) {
+		s.remove(el)
+		return nil, false, nil
+	}
+	s.order.MoveToFront(el)
+	return entry.value, true, nil
+}
+
+func (s *memoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expires := s.now().Add(ttl)
+	if el, ok := s.entries[key]; ok {
+		entry := el.Value.(*memoryEntry)
+		entry.value, entry.expires = value, expires
+		s.order.MoveToFront(el)
+		return nil
+	}
+	s.entries[key] = s.order.PushFront(&memoryEntry{key: key, value: value, expires: expires})
+	for s.order.Len() > s.size {
+		s.remove(s.order.Back())
+	}
+	return nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.counters, key)
+		if el, ok := s.entries[key]; ok {
+			s.remove(el)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) Incr(_ context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counters[key]++
+	return s.counters[key], nil
+}
+
+func (s *memoryStore) remove(el *list.Element) {
+	s.order.Remove(el)
+	delete(s.entries, el.Value.(*memoryEntry).key)
+}
+
+func formatCounter(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+// testStore checks the behaviour every Store shares; advance moves the
+// clock of store forward.
+func testStore(t *testing.T, store Store, advance func(time.Duration)) {
+	ctx := context.Background()
+
+	get := func(key string) (string, bool) {
+		t.Helper()
+		value, ok, err := store.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get(%q) error = %v", key, err)
+		}
+		return string(value), ok
+	}
+
+	if _, ok := get("missing"); ok {
+		t.Errorf("Get() of a missing key hit")
+	}
+
+	if err := store.Set(ctx, "a", []byte("1"), time.Minute); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := store.Set(ctx, "b", []byte("2"), 2*time.Minute); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	value, ok := get("a")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "1", value)
+
+	advance(90 * time.Second)
+	_, ok = get("a")
+	assert.Equal(t, false, ok)
+	_, ok = get("b")
+	assert.Equal(t, true, ok)
+
+	if err := store.Delete(ctx, "b", "missing"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	_, ok = get("b")
+	assert.Equal(t, false, ok)
+
+	for want := int64(1); want <= 2; want++ {
+		n, err := store.Incr(ctx, "counter")
+		if err != nil {
+			t.Fatalf("Incr() error = %v", err)
+		}
+		assert.Equal(t, want, n)
+	}
+	advance(24 * time.Hour)
+	value, ok = get("counter")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "2", value)
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore(10).(*memoryStore)
+	now := time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	testStore(t, store, func(d time.Duration) { now = now.Add(d) })
+}
+
+func TestMemoryStore_evictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(2)
+
+	_ = store.Set(ctx, "a", []byte("1"), time.Minute)
+	_ = store.Set(ctx, "b", []byte("2"), time.Minute)
+	_, _, _ = store.Get(ctx, "a")
+	_ = store.Set(ctx, "c", []byte("3"), time.Minute)
+	// Counters don't take up entries and are never evicted.
+	_, _ = store.Incr(ctx, "counter")
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true, "counter": true} {
+		_, ok, _ := store.Get(ctx, key)
+		assert.Equal(t, want, ok)
+	}
+}
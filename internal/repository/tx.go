@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+)
+
+// prepareAll prepares every query up front, before a transaction takes its
+// connection, and returns the statements in the same order.
+func (r *repository) prepareAll(ctx context.Context, queries ...string) ([]*sql.Stmt, error) {
+	stmts := make([]*sql.Stmt, len(queries))
+	for i, query := range queries {
+		stmt, err := r.stmt(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		stmts[i] = stmt
+	}
+	return stmts, nil
+}
+
+// inTx runs fn inside a transaction that is committed when fn succeeds and
+// rolled back otherwise.
+func (r *repository) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			log.Println("[inTx] can't rollback transaction, err:", rbErr.Error())
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
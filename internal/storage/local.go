@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// metaDir holds a file per blob with its content type. Keys can't start
+// with a dot, so it can't be read as a blob.
+const metaDir = ".meta"
+
+// LocalStore keeps blobs as files in a directory. A blob is written to a
+// temporary file and renamed into place, so readers never see half of it.
+type LocalStore struct {
+	dir string
+}
+
+var _ BlobStore = (*LocalStore)(nil)
+
+// NewLocalStore keeps blobs in dir, creating it when missing.
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, metaDir), 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{dir: dir}, nil
+}
+
+func (s *LocalStore) Put(_ context.Context, key string, body io.Reader, info Info) error {
+	if !ValidKey(key) {
+		return invalidKey()
+	}
+
+	meta, err := json.Marshal(localInfo{ContentType: info.ContentType})
+	if err != nil {
+		return err
+	}
+	if err := s.writeFile(filepath.Join(metaDir, key), func(f *os.File) error {
+		_, err := f.Write(meta)
+		return err
+	}); err != nil {
+		return err
+	}
+	return s.writeFile(key, func(f *os.File) error {
+		_, err := io.Copy(f, body)
+		return err
+	})
+}
+
+func (s *LocalStore) Get(_ context.Context, key string) (Blob, error) {
+	if !ValidKey(key) {
+		return Blob{}, ErrNotFound
+	}
+
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Blob{}, ErrNotFound
+	}
+	if err != nil {
+		return Blob{}, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return Blob{}, err
+	}
+
+	var meta localInfo
+	if raw, err := os.ReadFile(s.path(filepath.Join(metaDir, key))); err == nil {
+		if err := json.Unmarshal(raw, &meta); err != nil {
+			log.Println("[LocalStore][Get] can't decode info of", key, "err:", err.Error())
+		}
+	}
+
+	return Blob{
+		Info: Info{ContentType: meta.ContentType, Size: stat.Size(), ModTime: stat.ModTime()},
+		Body: f,
+	}, nil
+}
+
+func (s *LocalStore) Delete(_ context.Context, key string) error {
+	if !ValidKey(key) {
+		return ErrNotFound
+	}
+
+	err := os.Remove(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(filepath.Join(metaDir, key))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+type localInfo struct {
+	ContentType string `json:"content_type"`
+}
+
+func (s *LocalStore) path(key string) string {
+	return filepath.Join(s.dir, key)
+}
+
+// writeFile fills a temporary file with write and renames it to name.
+func (s *LocalStore) writeFile(name string, write func(*os.File) error) error {
+	f, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path(name))
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"privy/internal/apperror"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir)
+	if err != nil {
+		t.Fatalf("NewLocalStore() error = %v", err)
+	}
+
+	if err := store.Put(ctx, "cake.png", strings.NewReader("first"), Info{ContentType: "image/png"}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := store.Put(ctx, "cake.png", strings.NewReader("second"), Info{ContentType: "image/png"}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	blob, err := store.Get(ctx, "cake.png")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	body, _ := io.ReadAll(blob.Body)
+	blob.Body.Close()
+	assert.Equal(t, "second", string(body))
+	assert.Equal(t, "image/png", blob.ContentType)
+	assert.Equal(t, int64(6), blob.Size)
+	_, seekable := blob.Body.(io.Seeker)
+	assert.Equal(t, true, seekable)
+
+	if err := store.Delete(ctx, "cake.png"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	_, err = store.Get(ctx, "cake.png")
+	assert.Equal(t, true, errors.Is(err, ErrNotFound))
+	assert.Equal(t, true, errors.Is(store.Delete(ctx, "cake.png"), ErrNotFound))
+
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if entry.Name() != metaDir {
+			t.Errorf("Delete() left %s behind", entry.Name())
+		}
+	}
+	meta, _ := os.ReadDir(filepath.Join(dir, metaDir))
+	assert.Equal(t, 0, len(meta))
+}
+
+func TestLocalStore_invalidKeys(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore() error = %v", err)
+	}
+
+	for _, key := range []string{"", ".meta", "../cake.png", "cakes/cake.png", ".upload-1", strings.Repeat("a", 256)} {
+		err := store.Put(ctx, key, strings.NewReader("x"), Info{})
+		assert.Equal(t, apperror.KindValidation, apperror.KindOf(err))
+		_, err = store.Get(ctx, key)
+		assert.Equal(t, true, errors.Is(err, ErrNotFound))
+	}
+}
@@ -0,0 +1,49 @@
+// Package storage keeps uploaded files. BlobStore is what the API needs
+// from a store; LocalStore keeps blobs in a directory, and a store backed
+// by an S3-compatible bucket can take its place.
+package storage
+
+import (
+	"context"
+	"io"
+	"privy/internal/apperror"
+	"regexp"
+	"time"
+)
+
+var ErrNotFound = apperror.New(apperror.KindNotFound, "file not found")
+
+// keyPattern restricts keys to names safe as a file name and as an object
+// key, so no key can climb out of a store.
+var keyPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,254}$`)
+
+// BlobStore keeps blobs under flat keys. Put replaces any blob at key;
+// Get and Delete fail with ErrNotFound when there is none.
+type BlobStore interface {
+	Put(ctx context.Context, key string, body io.Reader, info Info) error
+	Get(ctx context.Context, key string) (Blob, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Info describes a blob.
+type Info struct {
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+// Blob is a stored blob being read. Body is also an io.Seeker when the
+// store can seek, and must be closed.
+type Blob struct {
+	Info
+	Body io.ReadCloser
+}
+
+// ValidKey reports whether key can name a blob.
+func ValidKey(key string) bool {
+	return keyPattern.MatchString(key) && key != "." && key != ".."
+}
+
+func invalidKey() error {
+	return apperror.New(apperror.KindValidation, "file key is invalid")
+}
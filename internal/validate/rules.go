@@ -0,0 +1,118 @@
+package validate
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// rule checks a dereferenced field value and returns the message to report
+// when it fails.
+type rule func(v reflect.Value, param string) (string, bool)
+
+type boundRule struct {
+	name  string
+	param string
+	fn    rule
+}
+
+func (r boundRule) check(v reflect.Value) (string, bool) {
+	return r.fn(v, r.param)
+}
+
+var rules = map[string]rule{
+	"min":       atLeast,
+	"max":       atMost,
+	"notblank":  notBlank,
+	"title":     title,
+	"image_url": imageURL,
+}
+
+// bind resolves a rule by name when a struct type is first validated, so a
+// typo in a tag fails loudly instead of silently passing.
+func bind(t reflect.Type, sf reflect.StructField, name, param string) boundRule {
+	fn, ok := rules[name]
+	if !ok {
+		panic(fmt.Sprintf("validate: unknown rule %q on %s.%s", name, t.Name(), sf.Name))
+	}
+	if (name == "min" || name == "max") && param == "" {
+		panic(fmt.Sprintf("validate: rule %q on %s.%s needs a parameter", name, t.Name(), sf.Name))
+	}
+	return boundRule{name: name, param: param, fn: fn}
+}
+
+var (
+	// titlePattern accepts letters and digits of any script, combining
+	// marks, and single spaces, hyphens or apostrophes between them.
+	titlePattern = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{M}\p{N}]*(?:[ '’-][\p{L}\p{N}][\p{L}\p{M}\p{N}]*)*$`)
+
+	imageExtensions = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true, ".webp": true}
+)
+
+// atLeast and atMost bound the value of numbers and the length in
+// characters of strings.
+func atLeast(v reflect.Value, param string) (string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		limit, _ := strconv.Atoi(param)
+		return fmt.Sprintf("must be at least %d characters", limit), utf8.RuneCountInString(v.String()) >= limit
+	default:
+		limit, _ := strconv.ParseFloat(param, 64)
+		return "must be at least " + param, number(v) >= limit
+	}
+}
+
+func atMost(v reflect.Value, param string) (string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		limit, _ := strconv.Atoi(param)
+		return fmt.Sprintf("must be at most %d characters", limit), utf8.RuneCountInString(v.String()) <= limit
+	default:
+		limit, _ := strconv.ParseFloat(param, 64)
+		return "must be at most " + param, number(v) <= limit
+	}
+}
+
+func number(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	default:
+		panic(fmt.Sprintf("validate: can't compare %s with a number", v.Kind()))
+	}
+}
+
+func notBlank(v reflect.Value, _ string) (string, bool) {
+	return "can't be blank", strings.TrimSpace(v.String()) != ""
+}
+
+func title(v reflect.Value, _ string) (string, bool) {
+	return "may only contain letters, digits and single spaces, hyphens or apostrophes between words", titlePattern.MatchString(v.String())
+}
+
+// imageURL takes http and https links, and paths on this service such as
+// the /images/ links of uploads.
+func imageURL(v reflect.Value, _ string) (string, bool) {
+	const message = "must be an http or https link, or a path starting with /, to a png, jpg, jpeg, gif, svg or webp image"
+
+	u, err := url.Parse(v.String())
+	if err != nil {
+		return message, false
+	}
+	switch {
+	case (u.Scheme == "http" || u.Scheme == "https") && u.Host != "":
+	case u.Scheme == "" && u.Host == "" && strings.HasPrefix(u.Path, "/"):
+	default:
+		return message, false
+	}
+	return message, imageExtensions[strings.ToLower(path.Ext(u.Path))]
+}
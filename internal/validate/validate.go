@@ -0,0 +1,145 @@
+// Package validate checks request DTOs against rules declared in their
+// `validate` struct tags and reports every failing field at once.
+//
+// A tag is a comma separated list of rules applied in order, for example
+// `validate:"required,max=100,title"`. Pointer fields are dereferenced; a
+// nil pointer only fails `required` and skips every other rule, so the same
+// rules serve full and partial updates. Field names in reports come from
+// the `json` tag.
+package validate
+
+import (
+	"fmt"
+	"privy/internal/apperror"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// FieldError describes one rule a field failed.
+type FieldError struct {
+	Field   string
+	Rule    string
+	Message string
+}
+
+// Errors lists every field that failed validation, in declaration order.
+type Errors []FieldError
+
+func (es Errors) Error() string {
+	parts := make([]string, len(es))
+	for i, e := range es {
+		parts[i] = e.Field + " " + e.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Struct validates v, a struct or a pointer to one. It returns nil or an
+// apperror of KindValidation wrapping Errors.
+func Struct(v interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validate: %T is not a struct", v))
+	}
+
+	var errs Errors
+	for _, f := range fieldsOf(value.Type()) {
+		field := value.Field(f.index)
+		if field.Kind() == reflect.Pointer {
+			if field.IsNil() {
+				if f.required {
+					errs = append(errs, FieldError{Field: f.name, Rule: "required", Message: "is required"})
+				}
+				continue
+			}
+			field = field.Elem()
+		} else if f.required && field.IsZero() {
+			errs = append(errs, FieldError{Field: f.name, Rule: "required", Message: "is required"})
+			continue
+		}
+
+		if f.omitEmpty && field.IsZero() {
+			continue
+		}
+		for _, r := range f.rules {
+			if message, ok := r.check(field); !ok {
+				errs = append(errs, FieldError{Field: f.name, Rule: r.name, Message: message})
+				break
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs.wrap()
+	}
+	return nil
+}
+
+// Field reports a single failing field, for checks made while decoding a
+// request before the DTO exists.
+func Field(name, rule, message string) error {
+	return Errors{{Field: name, Rule: rule, Message: message}}.wrap()
+}
+
+// Err returns es as a validation error, or nil when it is empty.
+func (es Errors) Err() error {
+	if len(es) == 0 {
+		return nil
+	}
+	return es.wrap()
+}
+
+func (es Errors) wrap() error {
+	return apperror.Wrap(apperror.KindValidation, apperror.ErrValidation.Message, es)
+}
+
+type field struct {
+	index     int
+	name      string
+	required  bool
+	omitEmpty bool
+	rules     []boundRule
+}
+
+// fields caches the parsed tags of every struct type seen so far.
+var fields sync.Map
+
+func fieldsOf(t reflect.Type) []field {
+	if cached, ok := fields.Load(t); ok {
+		return cached.([]field)
+	}
+
+	var parsed []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("validate")
+		if !ok || tag == "-" {
+			continue
+		}
+
+		f := field{index: i, name: jsonName(sf)}
+		for _, spec := range strings.Split(tag, ",") {
+			name, param, _ := strings.Cut(strings.TrimSpace(spec), "=")
+			switch name {
+			case "required":
+				f.required = true
+			case "omitempty":
+				f.omitEmpty = true
+			default:
+				f.rules = append(f.rules, bind(t, sf, name, param))
+			}
+		}
+		parsed = append(parsed, f)
+	}
+
+	cached, _ := fields.LoadOrStore(t, parsed)
+	return cached.([]field)
+}
+
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
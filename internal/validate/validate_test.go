@@ -0,0 +1,132 @@
+package validate
+
+import (
+	"errors"
+	"privy/internal/apperror"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type cakeRequest struct {
+	Title       *string  `json:"title" validate:"required,max=20,title"`
+	Description *string  `json:"description" validate:"notblank"`
+	Rating      *float32 `json:"rating" validate:"required,min=0,max=10"`
+	Image       string   `json:"image" validate:"omitempty,image_url"`
+	Internal    string
+}
+
+func TestStruct(t *testing.T) {
+	str := func(s string) *string { return &s }
+	rating := func(f float32) *float32 { return &f }
+
+	tests := []struct {
+		name   string
+		input  interface{}
+		fields []string
+	}{
+		{
+			name:  "Valid",
+			input: cakeRequest{Title: str("Crème-brûlée"), Rating: rating(0), Image: "https://example.com/a/cake.JPG"},
+		},
+		{
+			name:  "Pointer To Struct",
+			input: &cakeRequest{Title: str("Bolu"), Rating: rating(10)},
+		},
+		{
+			name:   "Missing Required Fields",
+			input:  cakeRequest{},
+			fields: []string{"title", "rating"},
+		},
+		{
+			name:   "Every Failing Field Is Reported",
+			input:  cakeRequest{Title: str("<script>"), Description: str("  "), Rating: rating(10.5), Image: "http://example.com/cake.exe"},
+			fields: []string{"title", "description", "rating", "image"},
+		},
+		{
+			name:   "Length Counts Characters Not Bytes",
+			input:  cakeRequest{Title: str("ケーキケーキケーキケーキケーキケーキケーキ"), Rating: rating(5)},
+			fields: []string{"title"},
+		},
+		{
+			name:  "Length Within Limit For Multibyte Title",
+			input: cakeRequest{Title: str("ケーキ ケーキ ケーキ"), Rating: rating(5)},
+		},
+		{
+			name:   "Title Can't Start With A Hyphen",
+			input:  cakeRequest{Title: str("-cake"), Rating: rating(5)},
+			fields: []string{"title"},
+		},
+		{
+			name:   "Image Needs A Host",
+			input:  cakeRequest{Title: str("cake"), Rating: rating(5), Image: "https:///cake.png"},
+			fields: []string{"image"},
+		},
+		{
+			name:  "Image Path On This Service",
+			input: cakeRequest{Title: str("cake"), Rating: rating(5), Image: "/images/0123abcd.png"},
+		},
+		{
+			name:   "Image Path Of Another Host",
+			input:  cakeRequest{Title: str("cake"), Rating: rating(5), Image: "//example.com/cake.png"},
+			fields: []string{"image"},
+		},
+		{
+			name:   "Relative Image Path",
+			input:  cakeRequest{Title: str("cake"), Rating: rating(5), Image: "images/cake.png"},
+			fields: []string{"image"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Struct(tt.input)
+			if tt.fields == nil {
+				if err != nil {
+					t.Errorf("Struct() error = %v, want nil", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, apperror.ErrValidation) {
+				t.Fatalf("Struct() error = %v, want a validation error", err)
+			}
+			var errs Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("Struct() error = %v, want Errors", err)
+			}
+			fields := make([]string, len(errs))
+			for i, e := range errs {
+				fields[i] = e.Field
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("Struct() failing fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestStruct_UnknownRule(t *testing.T) {
+	type request struct {
+		Name string `json:"name" validate:"shiny"`
+	}
+
+	defer func() {
+		r := recover()
+		if r == nil || !strings.Contains(r.(string), `unknown rule "shiny"`) {
+			t.Errorf("Struct() panic = %v, want unknown rule", r)
+		}
+	}()
+	_ = Struct(request{})
+}
+
+func TestField(t *testing.T) {
+	err := Field("rating", "type", "must be a number")
+
+	var errs Errors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0] != (FieldError{Field: "rating", Rule: "type", Message: "must be a number"}) {
+		t.Errorf("Field() = %#v", err)
+	}
+	if apperror.KindOf(err) != apperror.KindValidation {
+		t.Errorf("KindOf(Field()) = %v, want %v", apperror.KindOf(err), apperror.KindValidation)
+	}
+}
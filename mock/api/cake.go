@@ -1,5 +1,5 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: ./internal/api/cake_v2.go
+// Source: ./internal/api/cake.go
 
 // Package mock_api is a generated GoMock package.
 package mock_api
@@ -34,6 +34,48 @@ func (m *MockHandler) EXPECT() *MockHandlerMockRecorder {
 	return m.recorder
 }
 
+// AddCakeImage mocks base method.
+func (m *MockHandler) AddCakeImage(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddCakeImage", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddCakeImage indicates an expected call of AddCakeImage.
+func (mr *MockHandlerMockRecorder) AddCakeImage(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddCakeImage", reflect.TypeOf((*MockHandler)(nil).AddCakeImage), c)
+}
+
+// BatchCakes mocks base method.
+func (m *MockHandler) BatchCakes(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BatchCakes", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// BatchCakes indicates an expected call of BatchCakes.
+func (mr *MockHandlerMockRecorder) BatchCakes(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BatchCakes", reflect.TypeOf((*MockHandler)(nil).BatchCakes), c)
+}
+
+// CreateAPIKey mocks base method.
+func (m *MockHandler) CreateAPIKey(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAPIKey", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAPIKey indicates an expected call of CreateAPIKey.
+func (mr *MockHandlerMockRecorder) CreateAPIKey(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAPIKey", reflect.TypeOf((*MockHandler)(nil).CreateAPIKey), c)
+}
+
 // DeleteCake mocks base method.
 func (m *MockHandler) DeleteCake(c echo.Context) error {
 	m.ctrl.T.Helper()
@@ -48,6 +90,90 @@ func (mr *MockHandlerMockRecorder) DeleteCake(c interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCake", reflect.TypeOf((*MockHandler)(nil).DeleteCake), c)
 }
 
+// DeleteCakeImage mocks base method.
+func (m *MockHandler) DeleteCakeImage(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCakeImage", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteCakeImage indicates an expected call of DeleteCakeImage.
+func (mr *MockHandlerMockRecorder) DeleteCakeImage(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCakeImage", reflect.TypeOf((*MockHandler)(nil).DeleteCakeImage), c)
+}
+
+// DiffRevisions mocks base method.
+func (m *MockHandler) DiffRevisions(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DiffRevisions", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DiffRevisions indicates an expected call of DiffRevisions.
+func (mr *MockHandlerMockRecorder) DiffRevisions(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DiffRevisions", reflect.TypeOf((*MockHandler)(nil).DiffRevisions), c)
+}
+
+// ExportCakes mocks base method.
+func (m *MockHandler) ExportCakes(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportCakes", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExportCakes indicates an expected call of ExportCakes.
+func (mr *MockHandlerMockRecorder) ExportCakes(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportCakes", reflect.TypeOf((*MockHandler)(nil).ExportCakes), c)
+}
+
+// GetAPIKeys mocks base method.
+func (m *MockHandler) GetAPIKeys(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKeys", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetAPIKeys indicates an expected call of GetAPIKeys.
+func (mr *MockHandlerMockRecorder) GetAPIKeys(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKeys", reflect.TypeOf((*MockHandler)(nil).GetAPIKeys), c)
+}
+
+// GetCacheStats mocks base method.
+func (m *MockHandler) GetCacheStats(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCacheStats", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetCacheStats indicates an expected call of GetCacheStats.
+func (mr *MockHandlerMockRecorder) GetCacheStats(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCacheStats", reflect.TypeOf((*MockHandler)(nil).GetCacheStats), c)
+}
+
+// GetCakeImages mocks base method.
+func (m *MockHandler) GetCakeImages(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCakeImages", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetCakeImages indicates an expected call of GetCakeImages.
+func (mr *MockHandlerMockRecorder) GetCakeImages(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCakeImages", reflect.TypeOf((*MockHandler)(nil).GetCakeImages), c)
+}
+
 // GetDetailsOfCake mocks base method.
 func (m *MockHandler) GetDetailsOfCake(c echo.Context) error {
 	m.ctrl.T.Helper()
@@ -62,6 +188,20 @@ func (mr *MockHandlerMockRecorder) GetDetailsOfCake(c interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDetailsOfCake", reflect.TypeOf((*MockHandler)(nil).GetDetailsOfCake), c)
 }
 
+// GetImage mocks base method.
+func (m *MockHandler) GetImage(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetImage", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetImage indicates an expected call of GetImage.
+func (mr *MockHandlerMockRecorder) GetImage(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetImage", reflect.TypeOf((*MockHandler)(nil).GetImage), c)
+}
+
 // GetListOfCakes mocks base method.
 func (m *MockHandler) GetListOfCakes(c echo.Context) error {
 	m.ctrl.T.Helper()
@@ -76,6 +216,48 @@ func (mr *MockHandlerMockRecorder) GetListOfCakes(c interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetListOfCakes", reflect.TypeOf((*MockHandler)(nil).GetListOfCakes), c)
 }
 
+// GetRevisions mocks base method.
+func (m *MockHandler) GetRevisions(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRevisions", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetRevisions indicates an expected call of GetRevisions.
+func (mr *MockHandlerMockRecorder) GetRevisions(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRevisions", reflect.TypeOf((*MockHandler)(nil).GetRevisions), c)
+}
+
+// GetTrash mocks base method.
+func (m *MockHandler) GetTrash(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTrash", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetTrash indicates an expected call of GetTrash.
+func (mr *MockHandlerMockRecorder) GetTrash(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTrash", reflect.TypeOf((*MockHandler)(nil).GetTrash), c)
+}
+
+// ImportCakes mocks base method.
+func (m *MockHandler) ImportCakes(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImportCakes", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ImportCakes indicates an expected call of ImportCakes.
+func (mr *MockHandlerMockRecorder) ImportCakes(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImportCakes", reflect.TypeOf((*MockHandler)(nil).ImportCakes), c)
+}
+
 // InsertCake mocks base method.
 func (m *MockHandler) InsertCake(c echo.Context) error {
 	m.ctrl.T.Helper()
@@ -90,6 +272,90 @@ func (mr *MockHandlerMockRecorder) InsertCake(c interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertCake", reflect.TypeOf((*MockHandler)(nil).InsertCake), c)
 }
 
+// PurgeCake mocks base method.
+func (m *MockHandler) PurgeCake(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeCake", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PurgeCake indicates an expected call of PurgeCake.
+func (mr *MockHandlerMockRecorder) PurgeCake(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeCake", reflect.TypeOf((*MockHandler)(nil).PurgeCake), c)
+}
+
+// ReorderCakeImages mocks base method.
+func (m *MockHandler) ReorderCakeImages(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReorderCakeImages", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReorderCakeImages indicates an expected call of ReorderCakeImages.
+func (mr *MockHandlerMockRecorder) ReorderCakeImages(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReorderCakeImages", reflect.TypeOf((*MockHandler)(nil).ReorderCakeImages), c)
+}
+
+// ReplaceCake mocks base method.
+func (m *MockHandler) ReplaceCake(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceCake", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplaceCake indicates an expected call of ReplaceCake.
+func (mr *MockHandlerMockRecorder) ReplaceCake(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceCake", reflect.TypeOf((*MockHandler)(nil).ReplaceCake), c)
+}
+
+// RestoreCake mocks base method.
+func (m *MockHandler) RestoreCake(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreCake", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreCake indicates an expected call of RestoreCake.
+func (mr *MockHandlerMockRecorder) RestoreCake(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreCake", reflect.TypeOf((*MockHandler)(nil).RestoreCake), c)
+}
+
+// RevertCake mocks base method.
+func (m *MockHandler) RevertCake(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevertCake", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevertCake indicates an expected call of RevertCake.
+func (mr *MockHandlerMockRecorder) RevertCake(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevertCake", reflect.TypeOf((*MockHandler)(nil).RevertCake), c)
+}
+
+// RevokeAPIKey mocks base method.
+func (m *MockHandler) RevokeAPIKey(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockHandlerMockRecorder) RevokeAPIKey(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockHandler)(nil).RevokeAPIKey), c)
+}
+
 // UpdateCake mocks base method.
 func (m *MockHandler) UpdateCake(c echo.Context) error {
 	m.ctrl.T.Helper()
@@ -103,3 +369,31 @@ func (mr *MockHandlerMockRecorder) UpdateCake(c interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCake", reflect.TypeOf((*MockHandler)(nil).UpdateCake), c)
 }
+
+// UpdateCakeImage mocks base method.
+func (m *MockHandler) UpdateCakeImage(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateCakeImage", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateCakeImage indicates an expected call of UpdateCakeImage.
+func (mr *MockHandlerMockRecorder) UpdateCakeImage(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCakeImage", reflect.TypeOf((*MockHandler)(nil).UpdateCakeImage), c)
+}
+
+// UploadCakeImage mocks base method.
+func (m *MockHandler) UploadCakeImage(c echo.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UploadCakeImage", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UploadCakeImage indicates an expected call of UploadCakeImage.
+func (mr *MockHandlerMockRecorder) UploadCakeImage(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadCakeImage", reflect.TypeOf((*MockHandler)(nil).UploadCakeImage), c)
+}
@@ -1,5 +1,5 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: ./internal/repository/cake_v2.go
+// Source: ./internal/repository/cake.go
 
 // Package mock_repository is a generated GoMock package.
 package mock_repository
@@ -35,18 +35,170 @@ func (m *MockRepository) EXPECT() *MockRepositoryMockRecorder {
 	return m.recorder
 }
 
+// AddCakeImage mocks base method.
+func (m *MockRepository) AddCakeImage(ctx context.Context, id, version int, image models.CakeImage) (models.Cake, []models.CakeImage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddCakeImage", ctx, id, version, image)
+	ret0, _ := ret[0].(models.Cake)
+	ret1, _ := ret[1].([]models.CakeImage)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// AddCakeImage indicates an expected call of AddCakeImage.
+func (mr *MockRepositoryMockRecorder) AddCakeImage(ctx, id, version, image interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddCakeImage", reflect.TypeOf((*MockRepository)(nil).AddCakeImage), ctx, id, version, image)
+}
+
+// ApplyBatch mocks base method.
+func (m *MockRepository) ApplyBatch(ctx context.Context, ops []models.BatchOperation, mode models.BatchMode) ([]models.BatchResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ApplyBatch", ctx, ops, mode)
+	ret0, _ := ret[0].([]models.BatchResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ApplyBatch indicates an expected call of ApplyBatch.
+func (mr *MockRepositoryMockRecorder) ApplyBatch(ctx, ops, mode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ApplyBatch", reflect.TypeOf((*MockRepository)(nil).ApplyBatch), ctx, ops, mode)
+}
+
+// CountRevisions mocks base method.
+func (m *MockRepository) CountRevisions(ctx context.Context, id int) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountRevisions", ctx, id)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountRevisions indicates an expected call of CountRevisions.
+func (mr *MockRepositoryMockRecorder) CountRevisions(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountRevisions", reflect.TypeOf((*MockRepository)(nil).CountRevisions), ctx, id)
+}
+
+// CreateAPIKey mocks base method.
+func (m *MockRepository) CreateAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAPIKey", ctx, key)
+	ret0, _ := ret[0].(models.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateAPIKey indicates an expected call of CreateAPIKey.
+func (mr *MockRepositoryMockRecorder) CreateAPIKey(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAPIKey", reflect.TypeOf((*MockRepository)(nil).CreateAPIKey), ctx, key)
+}
+
 // DeleteCake mocks base method.
-func (m *MockRepository) DeleteCake(ctx context.Context, id int) error {
+func (m *MockRepository) DeleteCake(ctx context.Context, id, version int) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteCake", ctx, id)
+	ret := m.ctrl.Call(m, "DeleteCake", ctx, id, version)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteCake indicates an expected call of DeleteCake.
-func (mr *MockRepositoryMockRecorder) DeleteCake(ctx, id interface{}) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) DeleteCake(ctx, id, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCake", reflect.TypeOf((*MockRepository)(nil).DeleteCake), ctx, id, version)
+}
+
+// DeleteCakeImage mocks base method.
+func (m *MockRepository) DeleteCakeImage(ctx context.Context, id, version, imageID int) (models.Cake, []models.CakeImage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCakeImage", ctx, id, version, imageID)
+	ret0, _ := ret[0].(models.Cake)
+	ret1, _ := ret[1].([]models.CakeImage)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// DeleteCakeImage indicates an expected call of DeleteCakeImage.
+func (mr *MockRepositoryMockRecorder) DeleteCakeImage(ctx, id, version, imageID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCakeImage", reflect.TypeOf((*MockRepository)(nil).DeleteCakeImage), ctx, id, version, imageID)
+}
+
+// ExportCakes mocks base method.
+func (m *MockRepository) ExportCakes(ctx context.Context, fn func(models.Cake) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportCakes", ctx, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExportCakes indicates an expected call of ExportCakes.
+func (mr *MockRepositoryMockRecorder) ExportCakes(ctx, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportCakes", reflect.TypeOf((*MockRepository)(nil).ExportCakes), ctx, fn)
+}
+
+// GetAPIKeyByHash mocks base method.
+func (m *MockRepository) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKeyByHash", ctx, hash)
+	ret0, _ := ret[0].(models.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPIKeyByHash indicates an expected call of GetAPIKeyByHash.
+func (mr *MockRepositoryMockRecorder) GetAPIKeyByHash(ctx, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKeyByHash", reflect.TypeOf((*MockRepository)(nil).GetAPIKeyByHash), ctx, hash)
+}
+
+// GetAPIKeys mocks base method.
+func (m *MockRepository) GetAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKeys", ctx)
+	ret0, _ := ret[0].([]models.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPIKeys indicates an expected call of GetAPIKeys.
+func (mr *MockRepositoryMockRecorder) GetAPIKeys(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKeys", reflect.TypeOf((*MockRepository)(nil).GetAPIKeys), ctx)
+}
+
+// GetAnyCake mocks base method.
+func (m *MockRepository) GetAnyCake(ctx context.Context, id int) (models.Cake, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAnyCake", ctx, id)
+	ret0, _ := ret[0].(models.Cake)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAnyCake indicates an expected call of GetAnyCake.
+func (mr *MockRepositoryMockRecorder) GetAnyCake(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAnyCake", reflect.TypeOf((*MockRepository)(nil).GetAnyCake), ctx, id)
+}
+
+// GetCakeImages mocks base method.
+func (m *MockRepository) GetCakeImages(ctx context.Context, id int) (models.Cake, []models.CakeImage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCakeImages", ctx, id)
+	ret0, _ := ret[0].(models.Cake)
+	ret1, _ := ret[1].([]models.CakeImage)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetCakeImages indicates an expected call of GetCakeImages.
+func (mr *MockRepositoryMockRecorder) GetCakeImages(ctx, id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCake", reflect.TypeOf((*MockRepository)(nil).DeleteCake), ctx, id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCakeImages", reflect.TypeOf((*MockRepository)(nil).GetCakeImages), ctx, id)
 }
 
 // GetDetailsOfCake mocks base method.
@@ -65,18 +217,48 @@ func (mr *MockRepositoryMockRecorder) GetDetailsOfCake(ctx, id interface{}) *gom
 }
 
 // GetListOfCakes mocks base method.
-func (m *MockRepository) GetListOfCakes(ctx context.Context, limit, offset int) ([]models.Cake, error) {
+func (m *MockRepository) GetListOfCakes(ctx context.Context, query models.CakeQuery) ([]models.Cake, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetListOfCakes", ctx, limit, offset)
+	ret := m.ctrl.Call(m, "GetListOfCakes", ctx, query)
 	ret0, _ := ret[0].([]models.Cake)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetListOfCakes indicates an expected call of GetListOfCakes.
-func (mr *MockRepositoryMockRecorder) GetListOfCakes(ctx, limit, offset interface{}) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) GetListOfCakes(ctx, query interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetListOfCakes", reflect.TypeOf((*MockRepository)(nil).GetListOfCakes), ctx, limit, offset)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetListOfCakes", reflect.TypeOf((*MockRepository)(nil).GetListOfCakes), ctx, query)
+}
+
+// GetRevision mocks base method.
+func (m *MockRepository) GetRevision(ctx context.Context, id, number int) (models.Revision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRevision", ctx, id, number)
+	ret0, _ := ret[0].(models.Revision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRevision indicates an expected call of GetRevision.
+func (mr *MockRepositoryMockRecorder) GetRevision(ctx, id, number interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRevision", reflect.TypeOf((*MockRepository)(nil).GetRevision), ctx, id, number)
+}
+
+// GetRevisions mocks base method.
+func (m *MockRepository) GetRevisions(ctx context.Context, id, limit, offset int) ([]models.Revision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRevisions", ctx, id, limit, offset)
+	ret0, _ := ret[0].([]models.Revision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRevisions indicates an expected call of GetRevisions.
+func (mr *MockRepositoryMockRecorder) GetRevisions(ctx, id, limit, offset interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRevisions", reflect.TypeOf((*MockRepository)(nil).GetRevisions), ctx, id, limit, offset)
 }
 
 // InsertCake mocks base method.
@@ -94,17 +276,167 @@ func (mr *MockRepositoryMockRecorder) InsertCake(ctx, cake interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertCake", reflect.TypeOf((*MockRepository)(nil).InsertCake), ctx, cake)
 }
 
+// PatchCake mocks base method.
+func (m *MockRepository) PatchCake(ctx context.Context, id, version int, patch models.CakePatch) (models.Cake, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PatchCake", ctx, id, version, patch)
+	ret0, _ := ret[0].(models.Cake)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PatchCake indicates an expected call of PatchCake.
+func (mr *MockRepositoryMockRecorder) PatchCake(ctx, id, version, patch interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PatchCake", reflect.TypeOf((*MockRepository)(nil).PatchCake), ctx, id, version, patch)
+}
+
+// PurgeCake mocks base method.
+func (m *MockRepository) PurgeCake(ctx context.Context, id int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeCake", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PurgeCake indicates an expected call of PurgeCake.
+func (mr *MockRepositoryMockRecorder) PurgeCake(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeCake", reflect.TypeOf((*MockRepository)(nil).PurgeCake), ctx, id)
+}
+
+// ReorderCakeImages mocks base method.
+func (m *MockRepository) ReorderCakeImages(ctx context.Context, id, version int, order []int) (models.Cake, []models.CakeImage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReorderCakeImages", ctx, id, version, order)
+	ret0, _ := ret[0].(models.Cake)
+	ret1, _ := ret[1].([]models.CakeImage)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ReorderCakeImages indicates an expected call of ReorderCakeImages.
+func (mr *MockRepositoryMockRecorder) ReorderCakeImages(ctx, id, version, order interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReorderCakeImages", reflect.TypeOf((*MockRepository)(nil).ReorderCakeImages), ctx, id, version, order)
+}
+
+// RestoreCake mocks base method.
+func (m *MockRepository) RestoreCake(ctx context.Context, id int) (models.Cake, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreCake", ctx, id)
+	ret0, _ := ret[0].(models.Cake)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreCake indicates an expected call of RestoreCake.
+func (mr *MockRepositoryMockRecorder) RestoreCake(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreCake", reflect.TypeOf((*MockRepository)(nil).RestoreCake), ctx, id)
+}
+
+// RevertCake mocks base method.
+func (m *MockRepository) RevertCake(ctx context.Context, id, version, number int) (models.Cake, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevertCake", ctx, id, version, number)
+	ret0, _ := ret[0].(models.Cake)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RevertCake indicates an expected call of RevertCake.
+func (mr *MockRepositoryMockRecorder) RevertCake(ctx, id, version, number interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevertCake", reflect.TypeOf((*MockRepository)(nil).RevertCake), ctx, id, version, number)
+}
+
+// RevokeAPIKey mocks base method.
+func (m *MockRepository) RevokeAPIKey(ctx context.Context, id int) (models.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", ctx, id)
+	ret0, _ := ret[0].(models.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockRepositoryMockRecorder) RevokeAPIKey(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockRepository)(nil).RevokeAPIKey), ctx, id)
+}
+
+// SaveImageVariants mocks base method.
+func (m *MockRepository) SaveImageVariants(ctx context.Context, id int, source string, variants []models.ImageVariant) ([]models.ImageVariant, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveImageVariants", ctx, id, source, variants)
+	ret0, _ := ret[0].([]models.ImageVariant)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SaveImageVariants indicates an expected call of SaveImageVariants.
+func (mr *MockRepositoryMockRecorder) SaveImageVariants(ctx, id, source, variants interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveImageVariants", reflect.TypeOf((*MockRepository)(nil).SaveImageVariants), ctx, id, source, variants)
+}
+
+// SummarizeCakes mocks base method.
+func (m *MockRepository) SummarizeCakes(ctx context.Context, filter models.CakeFilter) (models.CakeSummary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SummarizeCakes", ctx, filter)
+	ret0, _ := ret[0].(models.CakeSummary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SummarizeCakes indicates an expected call of SummarizeCakes.
+func (mr *MockRepositoryMockRecorder) SummarizeCakes(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SummarizeCakes", reflect.TypeOf((*MockRepository)(nil).SummarizeCakes), ctx, filter)
+}
+
+// TouchAPIKey mocks base method.
+func (m *MockRepository) TouchAPIKey(ctx context.Context, id int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchAPIKey", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchAPIKey indicates an expected call of TouchAPIKey.
+func (mr *MockRepositoryMockRecorder) TouchAPIKey(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchAPIKey", reflect.TypeOf((*MockRepository)(nil).TouchAPIKey), ctx, id)
+}
+
 // UpdateCake mocks base method.
-func (m *MockRepository) UpdateCake(ctx context.Context, cake models.Cake) (models.Cake, error) {
+func (m *MockRepository) UpdateCake(ctx context.Context, cake models.Cake, version int) (models.Cake, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateCake", ctx, cake)
+	ret := m.ctrl.Call(m, "UpdateCake", ctx, cake, version)
 	ret0, _ := ret[0].(models.Cake)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // UpdateCake indicates an expected call of UpdateCake.
-func (mr *MockRepositoryMockRecorder) UpdateCake(ctx, cake interface{}) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) UpdateCake(ctx, cake, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCake", reflect.TypeOf((*MockRepository)(nil).UpdateCake), ctx, cake, version)
+}
+
+// UpdateCakeImage mocks base method.
+func (m *MockRepository) UpdateCakeImage(ctx context.Context, id, version, imageID int, patch models.CakeImagePatch) (models.Cake, []models.CakeImage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateCakeImage", ctx, id, version, imageID, patch)
+	ret0, _ := ret[0].(models.Cake)
+	ret1, _ := ret[1].([]models.CakeImage)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// UpdateCakeImage indicates an expected call of UpdateCakeImage.
+func (mr *MockRepositoryMockRecorder) UpdateCakeImage(ctx, id, version, imageID, patch interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCake", reflect.TypeOf((*MockRepository)(nil).UpdateCake), ctx, cake)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCakeImage", reflect.TypeOf((*MockRepository)(nil).UpdateCakeImage), ctx, id, version, imageID, patch)
 }
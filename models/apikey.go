@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// APIKey is a key a partner integration authenticates with. Only the hash
+// of the key is stored; Prefix, its first characters, tells keys apart.
+// A key never expires when ExpiresAt is nil.
+type APIKey struct {
+	Id         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Expired reports whether the key has expired at now.
+func (k APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// NewAPIKey is a key as it is created, the only time the key itself is
+// shown.
+type NewAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
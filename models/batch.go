@@ -0,0 +1,46 @@
+package models
+
+// BatchMode decides what happens to a batch when one of its operations
+// fails.
+type BatchMode string
+
+const (
+	// BatchTransactional applies every operation or none of them.
+	BatchTransactional BatchMode = "transactional"
+	// BatchBestEffort applies each operation on its own and reports the
+	// outcome of each.
+	BatchBestEffort BatchMode = "best_effort"
+)
+
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+// BatchOperation is one write of a batch. A create inserts the fields set
+// in Patch, an update applies Patch to the cake with Id and a delete moves
+// that cake to the trash. Version guards updates and deletes like If-Match;
+// zero skips the check.
+type BatchOperation struct {
+	Op      string
+	Id      int
+	Version int
+	Patch   CakePatch
+}
+
+// BatchResult is the outcome of the operation at the same index: the cake
+// it left behind, nil after a delete, or why it failed.
+type BatchResult struct {
+	Cake *Cake
+	Err  error
+}
+
+// BatchItem reports one operation of a batch to the client.
+type BatchItem struct {
+	Index  int      `json:"index"`
+	Op     string   `json:"op"`
+	Status int      `json:"status"`
+	Data   *Cake    `json:"data,omitempty"`
+	Error  *Problem `json:"error,omitempty"`
+}
@@ -1,11 +1,50 @@
 package models
 
+import "time"
+
 type Cake struct {
-	Id          int     `json:"id" form:"id"`
-	Title       string  `json:"title" form:"title"`
-	Description string  `json:"description" form:"description"`
-	Rating      float32 `json:"rating" form:"rating"`
-	Image       string  `json:"image" form:"image"`
-	CreatedAt   string  `json:"created_at" form:"created_at"`
-	UpdatedAt   string  `json:"updated_at" form:"updated_at"`
+	Id          int         `json:"id" form:"id"`
+	Title       string      `json:"title" form:"title"`
+	Description string      `json:"description" form:"description"`
+	Rating      float32     `json:"rating" form:"rating"`
+	Image       string      `json:"image" form:"image"`
+	Version     int         `json:"version" form:"-"`
+	CreatedAt   time.Time   `json:"created_at" form:"-"`
+	UpdatedAt   time.Time   `json:"updated_at" form:"-"`
+	DeletedAt   *time.Time  `json:"deleted_at,omitempty" form:"-"`
+	Images      *CakeImages `json:"images,omitempty" form:"-"`
+}
+
+// CakeSummary describes the cakes matched by a filter as a whole. Versions
+// is the sum of their versions, which grows with every write to any of
+// them.
+type CakeSummary struct {
+	Total        int
+	LastModified time.Time
+	Versions     int
+}
+
+// CakePatch is a partial update of a cake. A nil field is left untouched,
+// a non-nil field replaces the stored value, including zero values.
+type CakePatch struct {
+	Title       *string
+	Description *string
+	Rating      *float32
+	Image       *string
+}
+
+// Apply copies every field present in the patch onto cake.
+func (p CakePatch) Apply(cake *Cake) {
+	if p.Title != nil {
+		cake.Title = *p.Title
+	}
+	if p.Description != nil {
+		cake.Description = *p.Description
+	}
+	if p.Rating != nil {
+		cake.Rating = *p.Rating
+	}
+	if p.Image != nil {
+		cake.Image = *p.Image
+	}
 }
@@ -1,6 +0,0 @@
-package models
-
-const (
-	Addres = "0.0.0.0"
-	Port   = "8800"
-)
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// MaxCakeImages caps the gallery of a cake.
+const MaxCakeImages = 20
+
+// CakeImage is an image in the gallery of a cake. Positions run from 1 in
+// display order. At most one image of a cake is primary, and the image of
+// the cake is its URL.
+type CakeImage struct {
+	Id        int       `json:"id"`
+	CakeId    int       `json:"cake_id"`
+	URL       string    `json:"url"`
+	Alt       string    `json:"alt"`
+	Position  int       `json:"position"`
+	Primary   bool      `json:"primary"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CakeImagePatch changes an image of a gallery. Alt is left untouched when
+// nil. Primary makes the image primary; an image stops being primary only
+// when another one takes its place.
+type CakeImagePatch struct {
+	Alt     *string
+	Primary bool
+}
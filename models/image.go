@@ -0,0 +1,60 @@
+package models
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PlaceholderVariant names the variant holding the blurred placeholder of
+// an image, inlined as a data URI.
+const PlaceholderVariant = "placeholder"
+
+// ImageVariant is one rendition of a cake image. Key is where it is kept
+// in the image store; the placeholder is inlined and has none.
+type ImageVariant struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+	Key    string `json:"-"`
+}
+
+// CakeImages are the renditions of the image of a cake. Srcset holds a
+// srcset attribute per content type, smallest first, ready for the
+// <source> elements of a <picture>.
+type CakeImages struct {
+	Placeholder string            `json:"placeholder,omitempty"`
+	Variants    []ImageVariant    `json:"variants"`
+	Srcset      map[string]string `json:"srcset"`
+}
+
+// NewCakeImages gathers the variants of an image, or returns nil when
+// there are none yet.
+func NewCakeImages(variants []ImageVariant) *CakeImages {
+	if len(variants) == 0 {
+		return nil
+	}
+
+	images := &CakeImages{Variants: []ImageVariant{}, Srcset: map[string]string{}}
+	for _, v := range variants {
+		if v.Name == PlaceholderVariant {
+			images.Placeholder = v.URL
+			continue
+		}
+		images.Variants = append(images.Variants, v)
+	}
+	sort.SliceStable(images.Variants, func(i, j int) bool {
+		return images.Variants[i].Width < images.Variants[j].Width
+	})
+
+	candidates := map[string][]string{}
+	for _, v := range images.Variants {
+		candidates[v.Type] = append(candidates[v.Type], v.URL+" "+strconv.Itoa(v.Width)+"w")
+	}
+	for contentType, list := range candidates {
+		images.Srcset[contentType] = strings.Join(list, ", ")
+	}
+	return images
+}
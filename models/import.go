@@ -0,0 +1,18 @@
+package models
+
+// ImportReport sums up an import. In a dry run nothing is written and
+// Created and Updated count what the import would do.
+type ImportReport struct {
+	DryRun  bool          `json:"dry_run"`
+	Rows    int           `json:"rows"`
+	Created int           `json:"created"`
+	Updated int           `json:"updated"`
+	Failed  int           `json:"failed"`
+	Errors  []ImportError `json:"errors"`
+}
+
+// ImportError tells why the row starting at Line wasn't imported.
+type ImportError struct {
+	Line int `json:"line"`
+	Problem
+}
@@ -0,0 +1,101 @@
+package models
+
+import "time"
+
+// CakeFilter narrows a listing of cakes. Zero fields don't filter; time
+// bounds are inclusive. Trashed lists the deleted cakes instead of the live
+// ones.
+type CakeFilter struct {
+	Trashed     bool
+	Search      string
+	MinRating   *float32
+	MaxRating   *float32
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	UpdatedFrom time.Time
+	UpdatedTo   time.Time
+}
+
+// SortField orders a listing by one field, ascending unless Desc is set.
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// DefaultCakeSort orders a listing when the request doesn't ask for an
+// order.
+var DefaultCakeSort = []SortField{{Field: "rating", Desc: true}, {Field: "title"}}
+
+// DefaultTrashSort orders the trash, most recently deleted first.
+var DefaultTrashSort = []SortField{{Field: "deleted_at", Desc: true}}
+
+// CakeQuery selects one page of a filtered, sorted listing of cakes. A page
+// starts either at Offset or, in keyset mode, right after the cake at
+// After.
+type CakeQuery struct {
+	CakeFilter
+	Sort   []SortField
+	Limit  int
+	Offset int
+	After  *CakeKey
+}
+
+// CakeKey is the position of a cake in any sorted listing: the value of
+// every sortable field.
+type CakeKey struct {
+	Id        int       `json:"id"`
+	Title     string    `json:"title"`
+	Rating    float32   `json:"rating"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	DeletedAt time.Time `json:"deleted_at,omitempty"`
+}
+
+func KeyOf(cake Cake) CakeKey {
+	key := CakeKey{
+		Id:        cake.Id,
+		Title:     cake.Title,
+		Rating:    cake.Rating,
+		CreatedAt: cake.CreatedAt,
+		UpdatedAt: cake.UpdatedAt,
+	}
+	if cake.DeletedAt != nil {
+		key.DeletedAt = *cake.DeletedAt
+	}
+	return key
+}
+
+// ByRelevance reports whether the listing is ordered by search relevance,
+// which is the case for searches without an explicit sort. Relevance isn't
+// part of a CakeKey, so such listings can only be paged by offset.
+func (q CakeQuery) ByRelevance() bool {
+	return q.Search != "" && len(q.Sort) == 0 && q.After == nil
+}
+
+// OrderBy is the full order of the listing: the requested fields or the
+// default ones, without repeats, always ending on id so that no two cakes
+// tie.
+func (q CakeQuery) OrderBy() []SortField {
+	sort := q.Sort
+	if len(sort) == 0 && q.Trashed {
+		sort = DefaultTrashSort
+	} else if len(sort) == 0 {
+		sort = DefaultCakeSort
+	}
+
+	var (
+		order []SortField
+		seen  = make(map[string]bool)
+	)
+	for _, s := range sort {
+		if seen[s.Field] {
+			continue
+		}
+		seen[s.Field] = true
+		order = append(order, s)
+	}
+	if !seen["id"] {
+		order = append(order, SortField{Field: "id"})
+	}
+	return order
+}
@@ -1,13 +1,28 @@
 package models
 
-type Response struct {
-	Status  int           `json:"status"`
-	Message string        `json:"message"`
-	Data    []interface{} `json:"data"`
+// Response is the body of every successful response. Data holds a single
+// object or, for collections, a slice; Meta is only set on collections.
+type Response[T any] struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	Data    T      `json:"data"`
+	Meta    *Meta  `json:"meta,omitempty"`
+}
+
+// Meta describes the page of a collection. Pages reached by offset carry
+// the total and the offsets of the neighbouring pages; NextCursor resumes
+// the listing after this page and is omitted on the last one.
+type Meta struct {
+	Total      *int   `json:"total,omitempty"`
+	Limit      int    `json:"limit"`
+	Offset     *int   `json:"offset,omitempty"`
+	Next       *int   `json:"next,omitempty"`
+	Prev       *int   `json:"prev,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
-func SetResponse(Status int, Message string, Data []interface{}) (res Response) {
-	res = Response{
+func SetResponse[T any](Status int, Message string, Data T) (res Response[T]) {
+	res = Response[T]{
 		Status:  Status,
 		Message: Message,
 		Data:    Data,
@@ -15,15 +30,36 @@ func SetResponse(Status int, Message string, Data []interface{}) (res Response)
 	return
 }
 
-type Error struct {
-	Status  int    `json:"status"`
-	Message string `json:"message"`
-}
-
-func SetError(Status int, Message string) (err Error) {
-	err = Error{
+// SetCollection wraps a page of items. A nil slice is sent as [].
+func SetCollection[T any](Status int, Message string, Data []T, Meta Meta) (res Response[[]T]) {
+	if Data == nil {
+		Data = []T{}
+	}
+	res = Response[[]T]{
 		Status:  Status,
 		Message: Message,
+		Data:    Data,
+		Meta:    &Meta,
 	}
 	return
 }
+
+// NewMeta computes the neighbouring pages of the page at offset.
+func NewMeta(total, limit, offset int) Meta {
+	meta := Meta{
+		Total:  &total,
+		Limit:  limit,
+		Offset: &offset,
+	}
+	if next := offset + limit; limit > 0 && next < total {
+		meta.Next = &next
+	}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		meta.Prev = &prev
+	}
+	return meta
+}
@@ -0,0 +1,80 @@
+package models
+
+import "time"
+
+// Actions recorded in the revision history of a cake.
+const (
+	RevisionCreate  = "create"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+	RevisionRevert  = "revert"
+	RevisionPurge   = "purge"
+)
+
+// Revision is one entry in the history of a cake: the cake as it was right
+// after the change, or right before it for a purge, and the fields the
+// change touched.
+type Revision struct {
+	CakeId    int       `json:"cake_id"`
+	Number    int       `json:"revision"`
+	Action    string    `json:"action"`
+	Snapshot  Cake      `json:"snapshot"`
+	Changed   []string  `json:"changed"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Change is one field that differs between two states of a cake.
+type Change struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// RevisionDiff lists what changed from one revision of a cake to another.
+type RevisionDiff struct {
+	CakeId  int      `json:"cake_id"`
+	From    int      `json:"from"`
+	To      int      `json:"to"`
+	Changes []Change `json:"changes"`
+}
+
+// Diff compares the fields a client controls, plus whether the cake is in
+// the trash. Ids and bookkeeping timestamps are left out. It never returns
+// nil.
+func Diff(from, to Cake) []Change {
+	changes := []Change{}
+	if from.Title != to.Title {
+		changes = append(changes, Change{Field: "title", From: from.Title, To: to.Title})
+	}
+	if from.Description != to.Description {
+		changes = append(changes, Change{Field: "description", From: from.Description, To: to.Description})
+	}
+	if from.Rating != to.Rating {
+		changes = append(changes, Change{Field: "rating", From: from.Rating, To: to.Rating})
+	}
+	if from.Image != to.Image {
+		changes = append(changes, Change{Field: "image", From: from.Image, To: to.Image})
+	}
+	if !sameTime(from.DeletedAt, to.DeletedAt) {
+		changes = append(changes, Change{Field: "deleted_at", From: from.DeletedAt, To: to.DeletedAt})
+	}
+	return changes
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// ChangedFields names the fields Diff reports.
+func ChangedFields(from, to Cake) []string {
+	fields := []string{}
+	for _, change := range Diff(from, to) {
+		fields = append(fields, change.Field)
+	}
+	return fields
+}
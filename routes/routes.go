@@ -2,30 +2,60 @@ package routes
 
 import (
 	"net/http"
+	"privy/config"
 	"privy/internal/api"
+	"privy/internal/auth"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
-func GetRoutes(handler api.Handler) *echo.Echo {
+// GetRoutes registers every route of handler, each behind guard with the
+// scope it requires.
+func GetRoutes(handler api.Handler, cfg config.Config, guard *api.Guard) *echo.Echo {
 	e := echo.New()
-	useMiddlewares(e)
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	useMiddlewares(e, cfg)
+	read, write, admin := guard.Require(auth.ScopeRead), guard.Require(auth.ScopeWrite), guard.Require(auth.ScopeAdmin)
+	stream := api.StreamDeadlines(cfg.Server.StreamTimeout)
 
 	// CRUD User
-	e.GET("/cakes", handler.GetListOfCakes)
-	e.GET("/cakes/:id", handler.GetDetailsOfCake)
-	e.POST("/cakes", handler.InsertCake)
-	e.PATCH("/cakes/:id", handler.UpdateCake)
-	e.DELETE("/cakes/:id", handler.DeleteCake)
+	e.GET("/cakes", handler.GetListOfCakes, read, api.CacheControl(cfg.CacheControl.List))
+	e.GET("/cakes/export", handler.ExportCakes, stream, read)
+	e.GET("/cakes/trash", handler.GetTrash, read, api.CacheControl(cfg.CacheControl.List))
+	e.GET("/cakes/:id", handler.GetDetailsOfCake, read, api.CacheControl(cfg.CacheControl.Detail))
+	e.POST("/cakes", handler.InsertCake, write)
+	e.POST("/cakes\\:batch", handler.BatchCakes, write)
+	e.POST("/cakes/import", handler.ImportCakes, stream, write)
+	e.PATCH("/cakes/:id", handler.UpdateCake, write)
+	e.PUT("/cakes/:id", handler.ReplaceCake, write)
+	e.DELETE("/cakes/:id", handler.DeleteCake, write)
+	e.POST("/cakes/:id/restore", handler.RestoreCake, write)
+	e.POST("/cakes/:id/image", handler.UploadCakeImage, write)
+	e.GET("/images/:key", handler.GetImage, read, api.CacheControl(cfg.Images.CacheControl))
+	e.GET("/cakes/:id/images", handler.GetCakeImages, read, api.CacheControl(cfg.CacheControl.Detail))
+	e.POST("/cakes/:id/images", handler.AddCakeImage, write)
+	e.PUT("/cakes/:id/images/order", handler.ReorderCakeImages, write)
+	e.PATCH("/cakes/:id/images/:image_id", handler.UpdateCakeImage, write)
+	e.DELETE("/cakes/:id/images/:image_id", handler.DeleteCakeImage, write)
+	e.DELETE("/cakes/trash/:id", handler.PurgeCake, admin)
+	e.GET("/cakes/:id/revisions", handler.GetRevisions, read)
+	e.GET("/cakes/:id/revisions/diff", handler.DiffRevisions, read)
+	e.POST("/cakes/:id/revisions/:rev/revert", handler.RevertCake, write)
+	e.GET("/admin/cache", handler.GetCacheStats, admin)
+	e.GET("/admin/keys", handler.GetAPIKeys, admin)
+	e.POST("/admin/keys", handler.CreateAPIKey, admin)
+	e.POST("/admin/keys/:id/revoke", handler.RevokeAPIKey, admin)
 	return e
 }
 
-func useMiddlewares(e *echo.Echo) {
+func useMiddlewares(e *echo.Echo, cfg config.Config) {
+	e.Use(middleware.RequestID())
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-		AllowMethods: []string{http.MethodGet, http.MethodPost, http.MethodDelete, http.MethodPatch},
+		AllowOrigins:  cfg.CORS.AllowOrigins,
+		AllowMethods:  []string{http.MethodGet, http.MethodPost, http.MethodDelete, http.MethodPatch, http.MethodPut},
+		ExposeHeaders: []string{echo.HeaderXRequestID, api.HeaderETag, echo.HeaderWWWAuthenticate},
 	}))
 }
@@ -36,8 +36,10 @@ CREATE TABLE `privy_cakes` (
   `description` text NOT NULL,
   `rating` float NOT NULL,
   `image` text NOT NULL,
-  `created_at` datetime NOT NULL,
-  `updated_at` datetime NOT NULL DEFAULT current_timestamp()
+  `version` int(11) NOT NULL DEFAULT 1,
+  `created_at` datetime NOT NULL DEFAULT current_timestamp(),
+  `updated_at` datetime NOT NULL DEFAULT current_timestamp() ON UPDATE current_timestamp(),
+  `deleted_at` datetime DEFAULT NULL
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
 --
@@ -48,6 +50,86 @@ INSERT INTO `privy_cakes` (`id`, `title`, `description`, `rating`, `image`, `cre
 (1, 'First Cake', 'This is very first cake in this store', 9, 'https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg', '2022-12-08 04:39:09', '2022-12-08 10:40:02'),
 (4, 'New Cakes', 'This is red velvet cakes', 8.2, 'https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg', '2022-12-09 20:47:40', '2022-12-09 20:47:40');
 
+-- --------------------------------------------------------
+
+--
+-- Table structure for table `privy_cake_revisions`
+--
+
+CREATE TABLE `privy_cake_revisions` (
+  `id` int(11) NOT NULL,
+  `cake_id` int(11) NOT NULL,
+  `revision` int(11) NOT NULL,
+  `action` varchar(16) NOT NULL,
+  `snapshot` longtext NOT NULL CHECK (json_valid(`snapshot`)),
+  `changed` longtext NOT NULL CHECK (json_valid(`changed`)),
+  `actor` varchar(255) NOT NULL,
+  `created_at` datetime NOT NULL DEFAULT current_timestamp()
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+--
+-- Dumping data for table `privy_cake_revisions`
+--
+
+INSERT INTO `privy_cake_revisions` (`id`, `cake_id`, `revision`, `action`, `snapshot`, `changed`, `actor`, `created_at`) VALUES
+(1, 1, 1, 'create', '{"id":1,"title":"First Cake","description":"This is very first cake in this store","rating":9,"image":"https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg","version":1,"created_at":"2022-12-08T04:39:09Z","updated_at":"2022-12-08T10:40:02Z"}', '["title","description","rating","image"]', 'migration', '2022-12-08 10:40:02'),
+(2, 4, 1, 'create', '{"id":4,"title":"New Cakes","description":"This is red velvet cakes","rating":8.2,"image":"https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg","version":1,"created_at":"2022-12-09T20:47:40Z","updated_at":"2022-12-09T20:47:40Z"}', '["title","description","rating","image"]', 'migration', '2022-12-09 20:47:40');
+
+--
+-- Table structure for table `privy_cake_image_variants`
+--
+
+CREATE TABLE `privy_cake_image_variants` (
+  `id` int(11) NOT NULL,
+  `cake_id` int(11) NOT NULL,
+  `source` text NOT NULL,
+  `name` varchar(32) NOT NULL,
+  `content_type` varchar(64) NOT NULL,
+  `width` int(11) NOT NULL,
+  `height` int(11) NOT NULL,
+  `url` text NOT NULL,
+  `key` varchar(255) NOT NULL,
+  `created_at` datetime NOT NULL DEFAULT current_timestamp()
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+--
+-- Table structure for table `privy_cake_images`
+--
+
+CREATE TABLE `privy_cake_images` (
+  `id` int(11) NOT NULL,
+  `cake_id` int(11) NOT NULL,
+  `url` text NOT NULL,
+  `alt` varchar(255) NOT NULL DEFAULT '',
+  `position` int(11) NOT NULL,
+  `is_primary` tinyint(1) NOT NULL DEFAULT 0,
+  `created_at` datetime NOT NULL DEFAULT current_timestamp()
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+--
+-- Dumping data for table `privy_cake_images`
+--
+
+INSERT INTO `privy_cake_images` (`id`, `cake_id`, `url`, `alt`, `position`, `is_primary`, `created_at`) VALUES
+(1, 1, 'https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg', '', 1, 1, '2022-12-08 04:39:09'),
+(2, 4, 'https://img.taste.com.au/ynYrqkOs/w720-h480-cfill-q80/taste/2016/11/sunny-lemon-cheesecake-102220-1.jpeg', '', 1, 1, '2022-12-09 20:47:40');
+
+--
+-- Table structure for table `privy_api_keys`
+--
+
+CREATE TABLE `privy_api_keys` (
+  `id` int(11) NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `prefix` varchar(16) NOT NULL,
+  `hash` char(64) NOT NULL,
+  `scopes` varchar(255) NOT NULL,
+  `expires_at` datetime DEFAULT NULL,
+  `last_used_at` datetime DEFAULT NULL,
+  `revoked_at` datetime DEFAULT NULL,
+  `created_at` datetime NOT NULL DEFAULT current_timestamp()
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
 --
 -- Indexes for dumped tables
 --
@@ -56,7 +138,40 @@ INSERT INTO `privy_cakes` (`id`, `title`, `description`, `rating`, `image`, `cre
 -- Indexes for table `privy_cakes`
 --
 ALTER TABLE `privy_cakes`
-  ADD PRIMARY KEY (`id`);
+  ADD PRIMARY KEY (`id`),
+  ADD FULLTEXT KEY `ft_privy_cakes_title_description` (`title`, `description`),
+  ADD KEY `idx_privy_cakes_rating` (`rating`),
+  ADD KEY `idx_privy_cakes_created_at` (`created_at`),
+  ADD KEY `idx_privy_cakes_updated_at` (`updated_at`),
+  ADD KEY `idx_privy_cakes_deleted_at` (`deleted_at`);
+
+--
+-- Indexes for table `privy_cake_revisions`
+--
+ALTER TABLE `privy_cake_revisions`
+  ADD PRIMARY KEY (`id`),
+  ADD UNIQUE KEY `uq_privy_cake_revisions_cake_revision` (`cake_id`, `revision`);
+
+--
+-- Indexes for table `privy_cake_images`
+--
+ALTER TABLE `privy_cake_images`
+  ADD PRIMARY KEY (`id`),
+  ADD KEY `idx_privy_cake_images_cake_id_position` (`cake_id`, `position`);
+
+--
+-- Indexes for table `privy_cake_image_variants`
+--
+ALTER TABLE `privy_cake_image_variants`
+  ADD PRIMARY KEY (`id`),
+  ADD KEY `idx_privy_cake_image_variants_cake_id` (`cake_id`);
+
+--
+-- Indexes for table `privy_api_keys`
+--
+ALTER TABLE `privy_api_keys`
+  ADD PRIMARY KEY (`id`),
+  ADD UNIQUE KEY `uq_privy_api_keys_hash` (`hash`);
 
 --
 -- AUTO_INCREMENT for dumped tables
@@ -67,6 +182,30 @@ ALTER TABLE `privy_cakes`
 --
 ALTER TABLE `privy_cakes`
   MODIFY `id` int(11) NOT NULL AUTO_INCREMENT, AUTO_INCREMENT=8;
+
+--
+-- AUTO_INCREMENT for table `privy_cake_revisions`
+--
+ALTER TABLE `privy_cake_revisions`
+  MODIFY `id` int(11) NOT NULL AUTO_INCREMENT, AUTO_INCREMENT=3;
+
+--
+-- AUTO_INCREMENT for table `privy_cake_images`
+--
+ALTER TABLE `privy_cake_images`
+  MODIFY `id` int(11) NOT NULL AUTO_INCREMENT, AUTO_INCREMENT=3;
+
+--
+-- AUTO_INCREMENT for table `privy_cake_image_variants`
+--
+ALTER TABLE `privy_cake_image_variants`
+  MODIFY `id` int(11) NOT NULL AUTO_INCREMENT;
+
+--
+-- AUTO_INCREMENT for table `privy_api_keys`
+--
+ALTER TABLE `privy_api_keys`
+  MODIFY `id` int(11) NOT NULL AUTO_INCREMENT;
 COMMIT;
 
 /*!40101 SET CHARACTER_SET_CLIENT=@OLD_CHARACTER_SET_CLIENT */;